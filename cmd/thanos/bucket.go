@@ -23,6 +23,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/compact"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
 	"github.com/thanos-io/thanos/pkg/component"
 	"github.com/thanos-io/thanos/pkg/extflag"
 	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
@@ -63,6 +64,7 @@ func registerBucket(m map[string]setupFunc, app *kingpin.Application, name strin
 	registerBucketLs(m, cmd, name, objStoreConfig)
 	registerBucketInspect(m, cmd, name, objStoreConfig)
 	registerBucketWeb(m, cmd, name, objStoreConfig)
+	registerBucketMark(m, cmd, name, objStoreConfig)
 }
 
 func registerBucketVerify(m map[string]setupFunc, root *kingpin.CmdClause, name string, objStoreConfig *extflag.PathOrContent) {
@@ -256,6 +258,7 @@ func registerBucketInspect(m map[string]setupFunc, root *kingpin.CmdClause, name
 	sortBy := cmd.Flag("sort-by", "Sort by columns. It's also possible to sort by multiple columns, e.g. '--sort-by FROM --sort-by UNTIL'. I.e., if the 'FROM' value is equal the rows are then further sorted by the 'UNTIL' value.").
 		Default("FROM", "UNTIL").Enums(inspectColumns...)
 	timeout := cmd.Flag("timeout", "Timeout to download metadata from remote storage").Default("5m").Duration()
+	levelSpecs := regDownsamplingLevelsFlag(cmd)
 
 	m[name+" inspect"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer, _ bool) error {
 
@@ -265,6 +268,11 @@ func registerBucketInspect(m map[string]setupFunc, root *kingpin.CmdClause, name
 			return fmt.Errorf("error parsing selector flag: %v", err)
 		}
 
+		levels, err := downsample.ParseLevels(*levelSpecs)
+		if err != nil {
+			return errors.Wrap(err, "parse downsampling resolutions")
+		}
+
 		confContentYaml, err := objStoreConfig.Content()
 		if err != nil {
 			return err
@@ -303,7 +311,60 @@ func registerBucketInspect(m map[string]setupFunc, root *kingpin.CmdClause, name
 			return err
 		}
 
-		return printTable(blockMetas, selectorLabels, *sortBy)
+		return printTable(blockMetas, selectorLabels, *sortBy, levels)
+	}
+}
+
+func registerBucketMark(m map[string]setupFunc, root *kingpin.CmdClause, name string, objStoreConfig *extflag.PathOrContent) {
+	cmd := root.Command("mark", "Mark blocks for no compaction or no downsampling, keeping them queryable")
+	blockIDs := cmd.Flag("id", "ID (ULID) of the block to mark. Repeated field").Required().Strings()
+	marker := cmd.Flag("marker", fmt.Sprintf("Marker to upload to the markers directory. Possible values: %s, %s", metadata.NoCompactMarkFilename, metadata.NoDownsampleMarkFilename)).
+		Required().Enum(metadata.NoCompactMarkFilename, metadata.NoDownsampleMarkFilename)
+	details := cmd.Flag("details", "Human readable details of the reason for marking, stored in the marker.").String()
+	remove := cmd.Flag("remove", "Remove the marker from the block directory instead of uploading it.").Default("false").Bool()
+	timeout := cmd.Flag("timeout", "Timeout of marking all blocks").Default("5m").Duration()
+
+	m[name+" mark"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, _ opentracing.Tracer, _ bool) error {
+		var ids []ulid.ULID
+		for _, bid := range *blockIDs {
+			id, err := ulid.Parse(bid)
+			if err != nil {
+				return errors.Wrap(err, "invalid ULID found in --id flag")
+			}
+			ids = append(ids, id)
+		}
+
+		confContentYaml, err := objStoreConfig.Content()
+		if err != nil {
+			return err
+		}
+
+		bkt, err := client.NewBucket(logger, confContentYaml, reg, name)
+		if err != nil {
+			return err
+		}
+		defer runutil.CloseWithLogOnErr(logger, bkt, "bucket client")
+
+		// Dummy actor to immediately kill the group after the run function returns.
+		g.Add(func() error { return nil }, func(error) {})
+
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+
+		for _, id := range ids {
+			switch {
+			case *remove:
+				err = block.RemoveMark(ctx, logger, bkt, id, *marker)
+			case *marker == metadata.NoCompactMarkFilename:
+				err = block.MarkForNoCompact(ctx, logger, bkt, id, metadata.ManualNoCompactReason, *details, nil)
+			default:
+				err = block.MarkForNoDownsample(ctx, logger, bkt, id, metadata.ManualNoDownsampleReason, *details)
+			}
+			if err != nil {
+				return errors.Wrapf(err, "mark block %s", id)
+			}
+		}
+		return nil
 	}
 }
 
@@ -431,7 +492,7 @@ func download(ctx context.Context, logger log.Logger, bkt objstore.Bucket) (bloc
 	return blocks, nil
 }
 
-func printTable(blockMetas []*metadata.Meta, selectorLabels labels.Labels, sortBy []string) error {
+func printTable(blockMetas []*metadata.Meta, selectorLabels labels.Labels, sortBy []string, levels downsample.Levels) error {
 	header := inspectColumns
 
 	var lines [][]string
@@ -445,7 +506,7 @@ func printTable(blockMetas []*metadata.Meta, selectorLabels labels.Labels, sortB
 		timeRange := time.Duration((blockMeta.MaxTime - blockMeta.MinTime) * int64(time.Millisecond))
 
 		untilDown := "-"
-		if until, err := compact.UntilNextDownsampling(blockMeta); err == nil {
+		if until, err := compact.UntilNextDownsampling(blockMeta, levels); err == nil {
 			untilDown = until.String()
 		}
 		var labels []string
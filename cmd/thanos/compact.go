@@ -17,20 +17,25 @@ import (
 	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/route"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/indexheader"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/compact"
+	v1 "github.com/thanos-io/thanos/pkg/compact/api"
 	"github.com/thanos-io/thanos/pkg/compact/downsample"
 	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/discovery/dns"
 	"github.com/thanos-io/thanos/pkg/extflag"
 	"github.com/thanos-io/thanos/pkg/extprom"
+	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
 	"github.com/thanos-io/thanos/pkg/objstore"
 	"github.com/thanos-io/thanos/pkg/objstore/client"
 	"github.com/thanos-io/thanos/pkg/prober"
 	"github.com/thanos-io/thanos/pkg/runutil"
 	httpserver "github.com/thanos-io/thanos/pkg/server/http"
+	"github.com/thanos-io/thanos/pkg/ui"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
@@ -97,12 +102,20 @@ func registerCompact(m map[string]setupFunc, app *kingpin.Application) {
 		Default("30m"))
 
 	retentionRaw := modelDuration(cmd.Flag("retention.resolution-raw", "How long to retain raw samples in bucket. 0d - disables this retention").Default("0d"))
-	retention5m := modelDuration(cmd.Flag("retention.resolution-5m", "How long to retain samples of resolution 1 (5 minutes) in bucket. 0d - disables this retention").Default("0d"))
-	retention1h := modelDuration(cmd.Flag("retention.resolution-1h", "How long to retain samples of resolution 2 (1 hour) in bucket. 0d - disables this retention").Default("0d"))
+	retention5m := modelDuration(cmd.Flag("retention.resolution-5m", "How long to retain samples of resolution 1 (5 minutes) in bucket. 0d - disables this retention. "+
+		"Only allowed if the 5m resolution is configured by --downsampling.resolution, whose retention takes precedence.").Default("0d"))
+	retention1h := modelDuration(cmd.Flag("retention.resolution-1h", "How long to retain samples of resolution 2 (1 hour) in bucket. 0d - disables this retention. "+
+		"Only allowed if the 1h resolution is configured by --downsampling.resolution, whose retention takes precedence.").Default("0d"))
+	retentionConfig := extflag.RegisterPathOrContent(cmd, "retention.config", "YAML file with retention policies of blocks matching external label selectors and resolutions and of series matching series selectors. Blocks not matching any policy are retained according to --retention.resolution-raw and the retention of --downsampling.resolution levels. See format details: https://thanos.io/components/compact.md/#retention-policies", false)
+	retentionDryRun := cmd.Flag("retention.dry-run", "Only log blocks which would be deleted and series which would be dropped by retention, without deleting them.").
+		Default("false").Bool()
 
 	wait := cmd.Flag("wait", "Do not exit after all compactions have been processed and wait for new work.").
 		Short('w').Bool()
 
+	waitInterval := cmd.Flag("wait-interval", "Wait interval between consecutive compaction runs. Only works when --wait flag specified. It is also the initial back-off of groups quarantined because of --compact.quarantine-failing-groups.").
+		Default("5m").Duration()
+
 	generateMissingIndexCacheFiles := cmd.Flag("index.generate-missing-cache-file", "If enabled, on startup compactor runs an on-off job that scans all the blocks to find all blocks with missing index cache file. It generates those if needed and upload.").
 		Hidden().Default("false").Bool()
 
@@ -110,6 +123,9 @@ func registerCompact(m map[string]setupFunc, app *kingpin.Application) {
 		"as querying long time ranges without non-downsampled data is not efficient and useful e.g it is not possible to render all samples for a human eye anyway").
 		Default("false").Bool()
 
+	downsamplingLevels := regDownsamplingLevelsFlag(cmd)
+	extraAggrs := regDownsamplingExtraAggrsFlag(cmd)
+
 	maxCompactionLevel := cmd.Flag("debug.max-compaction-level", fmt.Sprintf("Maximum compaction level, default is %d: %s", compactions.maxLevel(), compactions.String())).
 		Hidden().Default(strconv.Itoa(compactions.maxLevel())).Int()
 
@@ -119,10 +135,48 @@ func registerCompact(m map[string]setupFunc, app *kingpin.Application) {
 	compactionConcurrency := cmd.Flag("compact.concurrency", "Number of goroutines to use when compacting groups.").
 		Default("1").Int()
 
+	maxBlockIndexSize := cmd.Flag("compact.max-block-index-size", "Maximum estimated index size of a compacted block. Blocks are not compacted into a block with bigger index, which prevents creating blocks with index too big for store gateways. "+
+		"The index size is estimated as the sum of index sizes of compacted blocks recorded in their meta.json, or from their number of series and chunks for blocks without recorded sizes. 0 disables this limit.").
+		Default("0").Bytes()
+
+	maxBlockSeries := cmd.Flag("compact.max-block-series", "Maximum estimated number of series of a compacted block. The number is estimated from the number of series of compacted blocks in their meta.json. 0 disables this limit.").
+		Default("0").Uint64()
+
+	streaming := cmd.Flag("compact.streaming", "Experimental: compact non-overlapping blocks without downloading them. Series of source blocks are read sequentially via range requests from the bucket "+
+		"and the compacted block is written incrementally, so local disk holds only the compacted block and index caches of source blocks. Overlapping blocks are still downloaded for vertical compaction.").
+		Default("false").Bool()
+
+	maxDisk := cmd.Flag("compact.max-disk", "Maximum local disk space needed by a single compaction, estimated from sizes of source blocks in the bucket. Compactions needing more space, i.e. twice the size of "+
+		"source blocks or their size and the size of their index caches with --compact.streaming, are refused and their groups are skipped with a warning or quarantined with --compact.quarantine-failing-groups. 0 disables this limit.").
+		Default("0").Bytes()
+
+	markUnhealthyBlocks := cmd.Flag("compact.mark-unhealthy-blocks", "Instead of halting, mark blocks with critical index issues (e.g. out-of-order chunks) for no compaction by uploading "+
+		"no-compact-mark.json with the reason to the markers directory, and continue compacting other blocks. Marked blocks are still queryable, but they are not compacted nor downsampled.").
+		Default("false").Bool()
+
+	quarantineFailingGroups := cmd.Flag("compact.quarantine-failing-groups", "Instead of halting or retrying the whole compactor iteration, quarantine compaction groups which failed to be compacted, downsampled or rewritten by series retention. "+
+		"Blocks of a quarantined group, including blocks of the same external labels in other resolutions, are excluded from all work for a back-off starting at --wait-interval and doubled with each following failure, while other groups continue.").
+		Default("false").Bool()
+
+	quarantineMaxBackoff := modelDuration(cmd.Flag("compact.quarantine-max-backoff", "Maximum back-off of a compaction group quarantined because of --compact.quarantine-failing-groups.").
+		Default("24h"))
+
+	shardMembers := cmd.Flag("compact.shard-member", "Address of a compactor instance sharing compaction groups of the bucket, including this one. Groups are split between members by hashing their external labels and resolution. Prefix with 'dns+' or 'dnssrv+' to resolve members through DNS lookup. Repeat for multiple members. If not set, this instance compacts all groups.").
+		PlaceHolder("<address>").Strings()
+
+	shardSelf := cmd.Flag("compact.shard-self", "Address of this compactor instance as present among resolved --compact.shard-member addresses. Required if --compact.shard-member is set.").
+		Default("").String()
+
+	shardDNSResolver := cmd.Flag("compact.shard-dns-resolver", fmt.Sprintf("Resolver to use. Possible options: [%s, %s]", dns.GolangResolverType, dns.MiekgdnsResolverType)).
+		Default(string(dns.GolangResolverType)).Hidden().String()
+
+	webExternalPrefix := cmd.Flag("web.external-prefix", "Static prefix for all HTML links and redirect URLs in the compactor web UI interface. Actual endpoints are still served on / or the web.route-prefix. This allows thanos compactor web UI to be served behind a reverse proxy that strips a URL sub-path.").Default("").String()
+	webPrefixHeaderName := cmd.Flag("web.prefix-header", "Name of HTTP request header used for dynamic prefixing of UI links and redirects. This option is ignored if web.external-prefix argument is set. Security risk: enable this option only if a reverse proxy in front of thanos is resetting the header. The --web.prefix-header=X-Forwarded-Prefix option can be useful, for example, if Thanos UI is served via Traefik reverse proxy with PathPrefixStrip option enabled, which sends the stripped prefix value in X-Forwarded-Prefix header. This allows thanos UI to be served on a sub-path.").Default("").String()
+
 	selectorRelabelConf := regSelectorRelabelFlags(cmd)
 
 	m[component.Compact.String()] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer, _ bool) error {
-		return runCompact(g, logger, reg,
+		return runCompact(g, logger, reg, tracer,
 			*httpAddr,
 			time.Duration(*httpGracePeriod),
 			*dataDir,
@@ -143,14 +197,79 @@ func registerCompact(m map[string]setupFunc, app *kingpin.Application) {
 			*blockSyncConcurrency,
 			*compactionConcurrency,
 			selectorRelabelConf,
+			compactConfig{
+				waitInterval:            *waitInterval,
+				retentionConfig:         retentionConfig,
+				retentionDryRun:         *retentionDryRun,
+				levelSpecs:              *downsamplingLevels,
+				extraAggrNames:          *extraAggrs,
+				maxBlockIndexSize:       uint64(*maxBlockIndexSize),
+				maxBlockSeries:          *maxBlockSeries,
+				streaming:               *streaming,
+				maxDisk:                 int64(*maxDisk),
+				markUnhealthyBlocks:     *markUnhealthyBlocks,
+				quarantineFailingGroups: *quarantineFailingGroups,
+				quarantineMaxBackoff:    time.Duration(*quarantineMaxBackoff),
+				shardMembers:            *shardMembers,
+				shardSelf:               *shardSelf,
+				shardDNSResolver:        *shardDNSResolver,
+				webExternalPrefix:       *webExternalPrefix,
+				webPrefixHeaderName:     *webPrefixHeaderName,
+			},
 		)
 	}
 }
 
+// mergeRetentionByLevel merges retention of the given downsampling levels into the given retention by resolution of
+// the --retention.resolution-* flags. Retention of a resolution which is not configured is refused.
+func mergeRetentionByLevel(retentionByResolution map[compact.ResolutionLevel]time.Duration, levels downsample.Levels) error {
+	for res, d := range retentionByResolution {
+		if d != 0 && !levels.Known(int64(res)) {
+			return errors.Errorf("retention of resolution %s is set, but the resolution is not configured by --downsampling.resolution", downsample.ResolutionString(int64(res)))
+		}
+	}
+	for _, lvl := range levels {
+		if lvl.Retention != 0 {
+			retentionByResolution[compact.ResolutionLevel(lvl.Resolution)] = lvl.Retention
+		}
+	}
+	return nil
+}
+
+// compactConfig holds options of the compactor beyond the basic ones passed to runCompact directly.
+type compactConfig struct {
+	// waitInterval is the interval between compactor iterations with --wait, as well as the initial back-off of
+	// quarantined groups and the time shard membership must stay unchanged before it is adopted.
+	waitInterval time.Duration
+
+	retentionConfig *extflag.PathOrContent
+	retentionDryRun bool
+
+	levelSpecs     []string
+	extraAggrNames []string
+
+	maxBlockIndexSize uint64
+	maxBlockSeries    uint64
+	streaming         bool
+	maxDisk           int64
+
+	markUnhealthyBlocks     bool
+	quarantineFailingGroups bool
+	quarantineMaxBackoff    time.Duration
+
+	shardMembers     []string
+	shardSelf        string
+	shardDNSResolver string
+
+	webExternalPrefix   string
+	webPrefixHeaderName string
+}
+
 func runCompact(
 	g *run.Group,
 	logger log.Logger,
 	reg *prometheus.Registry,
+	tracer opentracing.Tracer,
 	httpBindAddr string,
 	httpGracePeriod time.Duration,
 	dataDir string,
@@ -167,6 +286,7 @@ func runCompact(
 	blockSyncConcurrency int,
 	concurrency int,
 	selectorRelabelConf *extflag.PathOrContent,
+	conf compactConfig,
 ) error {
 	halted := prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "thanos_compactor_halted",
@@ -202,6 +322,25 @@ func runCompact(
 		httpserver.WithGracePeriod(httpGracePeriod),
 	)
 
+	// Expose progress of the compactor through the web UI and API.
+	progress := compact.NewProgress()
+	{
+		flagsMap := map[string]string{
+			"web.external-prefix": conf.webExternalPrefix,
+			"web.prefix-header":   conf.webPrefixHeaderName,
+		}
+
+		router := route.New()
+		ins := extpromhttp.NewInstrumentationMiddleware(reg)
+
+		ui.NewCompactUI(logger, progress, flagsMap).Register(router.WithPrefix(conf.webExternalPrefix), ins)
+
+		api := v1.NewAPI(logger, progress)
+		api.Register(router.WithPrefix(path.Join(conf.webExternalPrefix, "/api/v1")), tracer, logger, ins)
+
+		srv.Handle("/", router)
+	}
+
 	g.Add(func() error {
 		statusProber.Healthy()
 
@@ -223,6 +362,20 @@ func runCompact(
 		return err
 	}
 
+	extraAggrs, err := parseDownsamplingExtraAggrs(conf.extraAggrNames)
+	if err != nil {
+		return errors.Wrap(err, "parse extra aggregates")
+	}
+
+	downsamplingLevels, err := downsample.ParseLevels(conf.levelSpecs)
+	if err != nil {
+		return errors.Wrap(err, "parse downsampling resolutions")
+	}
+
+	if err := mergeRetentionByLevel(retentionByResolution, downsamplingLevels); err != nil {
+		return errors.Wrap(err, "parse retention of resolutions")
+	}
+
 	relabelContentYaml, err := selectorRelabelConf.Content()
 	if err != nil {
 		return errors.Wrap(err, "get content of relabel configuration")
@@ -240,10 +393,34 @@ func runCompact(
 		}
 	}()
 
-	metaFetcher, err := block.NewMetaFetcher(logger, 32, bkt, "", extprom.WrapRegistererWithPrefix("thanos_", reg),
+	filters := []block.MetaFetcherFilter{
 		block.NewLabelShardedMetaFilter(relabelConfig).Filter,
 		(&consistencyDelayMetaFilter{logger: logger, consistencyDelay: consistencyDelay}).Filter,
-	)
+	}
+
+	var sharding *compact.GroupSharding
+	if len(conf.shardMembers) > 0 {
+		// Other members observe membership changes before their next iteration at latest, so a changed membership
+		// is used only after a full interval between iterations. Single run does not wait.
+		var settle time.Duration
+		if wait {
+			settle = conf.waitInterval
+		}
+		sharding, err = compact.NewGroupSharding(logger, reg, dns.NewResolver(dns.ResolverType(conf.shardDNSResolver).ToResolver(logger)), conf.shardSelf, conf.shardMembers, settle)
+		if err != nil {
+			return errors.Wrap(err, "create group sharding")
+		}
+		filters = append(filters, sharding.Filter)
+	}
+
+	var quarantine *compact.Quarantine
+	if conf.quarantineFailingGroups {
+		// Start with the back-off equal to the interval of compactor iterations.
+		quarantine = compact.NewQuarantine(logger, reg, conf.waitInterval, conf.quarantineMaxBackoff)
+		filters = append(filters, quarantine.Filter)
+	}
+
+	metaFetcher, err := block.NewMetaFetcher(logger, 32, bkt, "", extprom.WrapRegistererWithPrefix("thanos_", reg), filters...)
 	if err != nil {
 		return errors.Wrap(err, "create meta fetcher")
 	}
@@ -262,6 +439,12 @@ func runCompact(
 		level.Warn(logger).Log("msg", "Max compaction level is lower than should be", "current", maxCompactionLevel, "default", compactions.maxLevel())
 	}
 
+	if !disableDownsampling {
+		if err := downsamplingLevels.ValidateMaxRange(levels[len(levels)-1]); err != nil {
+			return errors.Wrap(err, "validate downsampling resolutions")
+		}
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	// Instantiate the compactor with different time slices. Timestamps in TSDB
 	// are in milliseconds.
@@ -274,6 +457,7 @@ func runCompact(
 	var (
 		compactDir      = path.Join(dataDir, "compact")
 		downsamplingDir = path.Join(dataDir, "downsample")
+		retentionDir    = path.Join(dataDir, "retention")
 		indexCacheDir   = path.Join(dataDir, "index_cache")
 	)
 
@@ -282,52 +466,76 @@ func runCompact(
 		return errors.Wrap(err, "clean working downsample directory")
 	}
 
-	compactor, err := compact.NewBucketCompactor(logger, sy, comp, compactDir, bkt, concurrency)
+	planner := compact.NewLimitingPlanner(logger, levels, sy.NoCompactMarks, conf.maxBlockSeries, int64(conf.maxBlockIndexSize))
+	compactor, err := compact.NewBucketCompactor(logger, sy, planner, comp, compactDir, bkt, concurrency, conf.markUnhealthyBlocks, progress, quarantine, conf.streaming, conf.maxDisk)
 	if err != nil {
 		cancel()
 		return errors.Wrap(err, "create bucket compactor")
 	}
 
-	if retentionByResolution[compact.ResolutionLevelRaw].Seconds() != 0 {
-		level.Info(logger).Log("msg", "retention policy of raw samples is enabled", "duration", retentionByResolution[compact.ResolutionLevelRaw])
+	retentionContentYaml, err := conf.retentionConfig.Content()
+	if err != nil {
+		cancel()
+		return errors.Wrap(err, "get content of retention configuration")
 	}
-	if retentionByResolution[compact.ResolutionLevel5m].Seconds() != 0 {
-		level.Info(logger).Log("msg", "retention policy of 5 min aggregated samples is enabled", "duration", retentionByResolution[compact.ResolutionLevel5m])
+	retentionPolicies, err := compact.NewRetentionPolicies(retentionContentYaml, retentionByResolution)
+	if err != nil {
+		cancel()
+		return errors.Wrap(err, "parse retention configuration")
 	}
-	if retentionByResolution[compact.ResolutionLevel1h].Seconds() != 0 {
-		level.Info(logger).Log("msg", "retention policy of 1 hour aggregated samples is enabled", "duration", retentionByResolution[compact.ResolutionLevel1h])
+	seriesRetention := compact.NewSeriesRetention(logger, reg, bkt, metaFetcher, comp, retentionDir, retentionPolicies, conf.retentionDryRun, progress, quarantine)
+
+	for _, res := range downsamplingLevels.Resolutions() {
+		if d := retentionByResolution[compact.ResolutionLevel(res)]; d.Seconds() != 0 {
+			level.Info(logger).Log("msg", "retention policy of samples is enabled", "resolution", downsample.ResolutionString(res), "duration", d)
+		}
 	}
 
 	compactMainFn := func() error {
+		iterationStart := time.Now()
+
+		if sharding != nil {
+			// Refuse to do any work if the membership is ambiguous.
+			if err := sharding.Resolve(ctx); err != nil {
+				return errors.Wrap(err, "resolve shard members")
+			}
+		}
+
 		if err := compactor.Compact(ctx); err != nil {
 			return errors.Wrap(err, "compaction failed")
 		}
 
 		if !disableDownsampling {
 			// After all compactions are done, work down the downsampling backlog.
-			// We run two passes of this to ensure that the 1h downsampling is generated
-			// for 5m downsamplings created in the first run.
-			level.Info(logger).Log("msg", "start first pass of downsampling")
+			// We run a pass for each resolution to ensure that each resolution is generated
+			// for blocks of the previous one created in the previous pass.
+			for pass := 1; pass <= len(downsamplingLevels); pass++ {
+				level.Info(logger).Log("msg", "start pass of downsampling", "pass", pass)
 
-			if err := downsampleBucket(ctx, logger, downsampleMetrics, bkt, metaFetcher, downsamplingDir); err != nil {
-				return errors.Wrap(err, "first pass of downsampling failed")
-			}
-
-			level.Info(logger).Log("msg", "start second pass of downsampling")
-
-			if err := downsampleBucket(ctx, logger, downsampleMetrics, bkt, metaFetcher, downsamplingDir); err != nil {
-				return errors.Wrap(err, "second pass of downsampling failed")
+				if err := downsampleBucket(ctx, logger, downsampleMetrics, bkt, metaFetcher, downsamplingDir, downsamplingLevels, extraAggrs, progress, quarantine); err != nil {
+					return errors.Wrapf(err, "pass %d of downsampling failed", pass)
+				}
 			}
 			level.Info(logger).Log("msg", "downsampling iterations done")
 		} else {
 			level.Warn(logger).Log("msg", "downsampling was explicitly disabled")
 		}
 
-		if err := compact.ApplyRetentionPolicyByResolution(ctx, logger, bkt, metaFetcher, retentionByResolution); err != nil {
+		if _, err := compact.ApplyRetentionPolicies(ctx, logger, bkt, metaFetcher, retentionPolicies, conf.retentionDryRun); err != nil {
 			return errors.Wrap(err, fmt.Sprintf("retention failed"))
 		}
 
-		compact.BestEffortCleanAbortedPartialUploads(ctx, logger, metaFetcher, bkt, partialUploadDeleteAttempts)
+		if err := seriesRetention.Apply(ctx); err != nil {
+			return errors.Wrap(err, "series retention failed")
+		}
+
+		// Partial uploads do not belong to any group, so only one of shard members cleans them.
+		if sharding == nil || sharding.IsLeader() {
+			compact.BestEffortCleanAbortedPartialUploads(ctx, logger, metaFetcher, bkt, partialUploadDeleteAttempts)
+		}
+
+		// Groups which did not fail during the whole iteration recovered.
+		quarantine.Release(iterationStart)
 		return nil
 	}
 
@@ -336,6 +544,24 @@ func runCompact(
 
 		// Generate index file.
 		if generateMissingIndexCacheFiles {
+			if sharding != nil {
+				// Wait for the membership to settle, retrying DNS failures as well.
+				for {
+					err := sharding.Resolve(ctx)
+					if err == nil {
+						break
+					}
+					if !compact.IsRetryError(err) {
+						return errors.Wrap(err, "resolve shard members")
+					}
+					level.Info(logger).Log("msg", "waiting for shard members before generating index cache files", "err", err)
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case <-time.After(conf.waitInterval):
+					}
+				}
+			}
 			if err := genMissingIndexCacheFiles(ctx, logger, reg, bkt, metaFetcher, indexCacheDir); err != nil {
 				return err
 			}
@@ -346,7 +572,7 @@ func runCompact(
 		}
 
 		// --wait=true is specified.
-		return runutil.Repeat(5*time.Minute, ctx.Done(), func() error {
+		return runutil.Repeat(conf.waitInterval, ctx.Done(), func() error {
 			err := compactMainFn()
 			if err == nil {
 				iterations.Inc()
@@ -13,6 +13,7 @@ import (
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
 	"github.com/thanos-io/thanos/pkg/block"
@@ -41,14 +42,50 @@ func registerDownsample(m map[string]setupFunc, app *kingpin.Application) {
 
 	objStoreConfig := regCommonObjStoreFlags(cmd, "", true)
 
+	levels := regDownsamplingLevelsFlag(cmd)
+	extraAggrs := regDownsamplingExtraAggrsFlag(cmd)
+
 	m[comp.String()] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer, _ bool) error {
-		return runDownsample(g, logger, reg, *httpAddr, time.Duration(*httpGracePeriod), *dataDir, objStoreConfig, comp)
+		return runDownsample(g, logger, reg, *httpAddr, time.Duration(*httpGracePeriod), *dataDir, objStoreConfig, *levels, *extraAggrs, comp)
+	}
+}
+
+func regDownsamplingLevelsFlag(cmd *kingpin.CmdClause) *[]string {
+	return cmd.Flag("downsampling.resolution", "Resolution of downsampled blocks, the minimum time range of blocks of the previous resolution "+
+		"which are downsampled to it and optionally the retention of its blocks, in the <resolution>:<min source range>[:<retention>] format, e.g. 10m:14d or 10m:14d:1y. "+
+		"Resolutions are ordered from the highest to the lowest one, raw blocks are downsampled to the first one. Each resolution must be a multiple of the previous one. "+
+		"The min source range is a block time range reached by compaction, not an age, so the compactor refuses ranges bigger than its largest compaction range. "+
+		"Retention is only applied by the compactor. Repeatable.").
+		PlaceHolder("<resolution>:<min source range>[:<retention>]").Default("5m:40h", "1h:10d").Strings()
+}
+
+func regDownsamplingExtraAggrsFlag(cmd *kingpin.CmdClause) *[]string {
+	var names []string
+	for _, at := range downsample.OptionalAggrTypes {
+		names = append(names, at.String())
+	}
+	return cmd.Flag("downsampling.extra-aggregates", "Optional aggregates to store in downsampled blocks besides count, sum, min, max and counter, "+
+		"at the cost of bigger blocks. 'last' keeps the last value of each window for delta and idelta, 'quantiles' keeps a quantile sketch "+
+		"of each window for quantile_over_time. Already downsampled blocks get only aggregates which they were downsampled with. Repeatable.").
+		Enums(names...)
+}
+
+func parseDownsamplingExtraAggrs(names []string) ([]downsample.AggrType, error) {
+	var aggrs []downsample.AggrType
+	for _, name := range names {
+		at, err := downsample.ParseOptionalAggrType(name)
+		if err != nil {
+			return nil, err
+		}
+		aggrs = append(aggrs, at)
 	}
+	return aggrs, nil
 }
 
 type DownsampleMetrics struct {
 	downsamples        *prometheus.CounterVec
 	downsampleFailures *prometheus.CounterVec
+	todoDownsamples    prometheus.Gauge
 }
 
 func newDownsampleMetrics(reg *prometheus.Registry) *DownsampleMetrics {
@@ -63,8 +100,14 @@ func newDownsampleMetrics(reg *prometheus.Registry) *DownsampleMetrics {
 		Help: "Total number of failed downsampling attempts.",
 	}, []string{"group"})
 
+	m.todoDownsamples = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "thanos_compact_todo_downsamples",
+		Help: "Number of blocks that still have to be downsampled in the current downsampling pass.",
+	})
+
 	reg.MustRegister(m.downsamples)
 	reg.MustRegister(m.downsampleFailures)
+	reg.MustRegister(m.todoDownsamples)
 
 	return m
 }
@@ -77,6 +120,8 @@ func runDownsample(
 	httpGracePeriod time.Duration,
 	dataDir string,
 	objStoreConfig *extflag.PathOrContent,
+	levelSpecs []string,
+	extraAggrNames []string,
 	comp component.Component,
 ) error {
 	confContentYaml, err := objStoreConfig.Content()
@@ -84,6 +129,16 @@ func runDownsample(
 		return err
 	}
 
+	extraAggrs, err := parseDownsamplingExtraAggrs(extraAggrNames)
+	if err != nil {
+		return errors.Wrap(err, "parse extra aggregates")
+	}
+
+	levels, err := downsample.ParseLevels(levelSpecs)
+	if err != nil {
+		return errors.Wrap(err, "parse downsampling resolutions")
+	}
+
 	bkt, err := client.NewBucket(logger, confContentYaml, reg, component.Downsample.String())
 	if err != nil {
 		return err
@@ -111,16 +166,13 @@ func runDownsample(
 			defer runutil.CloseWithLogOnErr(logger, bkt, "bucket client")
 			statusProber.Ready()
 
-			level.Info(logger).Log("msg", "start first pass of downsampling")
+			// Run a pass for each resolution, so that blocks downsampled in a pass are downsampled further in the next one.
+			for pass := 1; pass <= len(levels); pass++ {
+				level.Info(logger).Log("msg", "start pass of downsampling", "pass", pass)
 
-			if err := downsampleBucket(ctx, logger, metrics, bkt, metaFetcher, dataDir); err != nil {
-				return errors.Wrap(err, "downsampling failed")
-			}
-
-			level.Info(logger).Log("msg", "start second pass of downsampling")
-
-			if err := downsampleBucket(ctx, logger, metrics, bkt, metaFetcher, dataDir); err != nil {
-				return errors.Wrap(err, "downsampling failed")
+				if err := downsampleBucket(ctx, logger, metrics, bkt, metaFetcher, dataDir, levels, extraAggrs, nil, nil); err != nil {
+					return errors.Wrap(err, "downsampling failed")
+				}
 			}
 
 			return nil
@@ -156,7 +208,15 @@ func downsampleBucket(
 	bkt objstore.Bucket,
 	fetcher block.MetadataFetcher,
 	dir string,
-) error {
+	levels downsample.Levels,
+	extraAggrs []downsample.AggrType,
+	progress *compact.Progress,
+	quarantine *compact.Quarantine,
+) (err error) {
+	defer func() {
+		progress.StageDone(compact.DownsamplingStage, err)
+	}()
+
 	if err := os.RemoveAll(dir); err != nil {
 		return errors.Wrap(err, "clean working directory")
 	}
@@ -177,79 +237,112 @@ func downsampleBucket(
 
 	// mapping from a hash over all source IDs to blocks. We don't need to downsample a block
 	// if a downsampled version with the same hash already exists.
-	sources5m := map[ulid.ULID]struct{}{}
-	sources1h := map[ulid.ULID]struct{}{}
+	sources := map[int64]map[ulid.ULID]struct{}{}
+	for _, lvl := range levels {
+		sources[lvl.Resolution] = map[ulid.ULID]struct{}{}
+	}
 
 	for _, m := range metas {
-		switch m.Thanos.Downsample.Resolution {
-		case downsample.ResLevel0:
+		if m.Thanos.Downsample.Resolution == downsample.ResLevel0 {
 			continue
-		case downsample.ResLevel1:
-			for _, id := range m.Compaction.Sources {
-				sources5m[id] = struct{}{}
-			}
-		case downsample.ResLevel2:
-			for _, id := range m.Compaction.Sources {
-				sources1h[id] = struct{}{}
-			}
-		default:
-			return errors.Errorf("unexpected downsampling resolution %d", m.Thanos.Downsample.Resolution)
+		}
+		s, ok := sources[m.Thanos.Downsample.Resolution]
+		if !ok {
+			// Blocks of resolutions no longer configured are not downsampled further.
+			level.Warn(logger).Log("msg", "skipping block of resolution not configured for downsampling", "block", m.ULID, "resolution", downsample.ResolutionString(m.Thanos.Downsample.Resolution))
+			continue
+		}
+		for _, id := range m.Compaction.Sources {
+			s[id] = struct{}{}
 		}
 	}
 
-	for _, m := range metas {
-		switch m.Thanos.Downsample.Resolution {
-		case downsample.ResLevel0:
-			missing := false
-			for _, id := range m.Compaction.Sources {
-				if _, ok := sources5m[id]; !ok {
-					missing = true
-					break
-				}
-			}
-			if !missing {
-				continue
-			}
-			// Only downsample blocks once we are sure to get roughly 2 chunks out of it.
-			// NOTE(fabxc): this must match with at which block size the compactor creates downsampled
-			// blocks. Otherwise we may never downsample some data.
-			if m.MaxTime-m.MinTime < downsample.DownsampleRange0 {
-				continue
-			}
-			if err := processDownsampling(ctx, logger, bkt, m, dir, downsample.ResLevel1); err != nil {
-				metrics.downsampleFailures.WithLabelValues(compact.GroupKey(m.Thanos)).Inc()
-				return errors.Wrap(err, "downsampling to 5 min")
-			}
-			metrics.downsamples.WithLabelValues(compact.GroupKey(m.Thanos)).Inc()
-
-		case downsample.ResLevel1:
-			missing := false
-			for _, id := range m.Compaction.Sources {
-				if _, ok := sources1h[id]; !ok {
-					missing = true
-					break
-				}
-			}
-			if !missing {
-				continue
-			}
-			// Only downsample blocks once we are sure to get roughly 2 chunks out of it.
-			// NOTE(fabxc): this must match with at which block size the compactor creates downsampled
-			// blocks. Otherwise we may never downsample some data.
-			if m.MaxTime-m.MinTime < downsample.DownsampleRange1 {
+	todo, err := withoutMarkedBlocks(ctx, logger, bkt, downsampleTodo(metas, levels, sources))
+	if err != nil {
+		return errors.Wrap(err, "read block marks")
+	}
+	metrics.todoDownsamples.Set(float64(len(todo)))
+	progress.StageStarted(compact.DownsamplingStage, len(todo))
+
+	for _, m := range todo {
+		progress.WorkStarted(compact.DownsamplingStage, m.ULID)
+
+		next, _ := levels.Next(m.Thanos.Downsample.Resolution)
+		err := processDownsampling(ctx, logger, bkt, m, dir, next.Resolution, extraAggrs)
+		progress.WorkDone(compact.DownsamplingStage, err)
+		if err != nil {
+			metrics.downsampleFailures.WithLabelValues(compact.GroupKey(m.Thanos)).Inc()
+			err = errors.Wrapf(err, "downsampling to %s", downsample.ResolutionString(next.Resolution))
+			if quarantine != nil && ctx.Err() == nil {
+				quarantine.Fail(compact.GroupKey(m.Thanos), labels.FromMap(m.Thanos.Labels), err)
 				continue
 			}
-			if err := processDownsampling(ctx, logger, bkt, m, dir, downsample.ResLevel2); err != nil {
-				metrics.downsampleFailures.WithLabelValues(compact.GroupKey(m.Thanos))
-				return errors.Wrap(err, "downsampling to 60 min")
-			}
-			metrics.downsamples.WithLabelValues(compact.GroupKey(m.Thanos))
+			return err
 		}
+		metrics.downsamples.WithLabelValues(compact.GroupKey(m.Thanos)).Inc()
+		metrics.todoDownsamples.Dec()
 	}
 	return nil
 }
 
-func processDownsampling(ctx context.Context, logger log.Logger, bkt objstore.Bucket, m *metadata.Meta, dir string, resolution int64) error {
+// downsampleTodo returns blocks that have to be downsampled to the next level, given source IDs of already existing
+// blocks of each level.
+func downsampleTodo(metas map[ulid.ULID]*metadata.Meta, levels downsample.Levels, sources map[int64]map[ulid.ULID]struct{}) []*metadata.Meta {
+	var todo []*metadata.Meta
+	for _, m := range metas {
+		next, ok := levels.Next(m.Thanos.Downsample.Resolution)
+		if !ok {
+			continue
+		}
+
+		missing := false
+		for _, id := range m.Compaction.Sources {
+			if _, ok := sources[next.Resolution][id]; !ok {
+				missing = true
+				break
+			}
+		}
+		if !missing {
+			continue
+		}
+		// Only downsample blocks once we are sure to get roughly 2 chunks out of it.
+		// NOTE(fabxc): this must match with at which block size the compactor creates downsampled
+		// blocks. Otherwise we may never downsample some data.
+		if m.MaxTime-m.MinTime < next.MinSourceRange {
+			continue
+		}
+		todo = append(todo, m)
+	}
+	return todo
+}
+
+// withoutMarkedBlocks filters out blocks marked for no compaction or no downsampling.
+func withoutMarkedBlocks(ctx context.Context, logger log.Logger, bkt objstore.Bucket, metas []*metadata.Meta) ([]*metadata.Meta, error) {
+	noCompactMarks, err := block.ReadNoCompactMarks(ctx, logger, bkt)
+	if err != nil {
+		return nil, err
+	}
+	noDownsampleMarks, err := block.ReadNoDownsampleMarks(ctx, logger, bkt)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*metadata.Meta, 0, len(metas))
+	for _, m := range metas {
+		if noCompact, ok := noCompactMarks[m.ULID]; ok {
+			level.Debug(logger).Log("msg", "skipping downsampling of block marked for no compaction", "block", m.ULID, "reason", noCompact.Reason)
+			continue
+		}
+		if noDownsample, ok := noDownsampleMarks[m.ULID]; ok {
+			level.Debug(logger).Log("msg", "skipping downsampling of block marked for no downsampling", "block", m.ULID, "reason", noDownsample.Reason)
+			continue
+		}
+		res = append(res, m)
+	}
+	return res, nil
+}
+
+func processDownsampling(ctx context.Context, logger log.Logger, bkt objstore.Bucket, m *metadata.Meta, dir string, resolution int64, extraAggrs []downsample.AggrType) error {
 	begin := time.Now()
 	bdir := filepath.Join(dir, m.ULID.String())
 
@@ -278,7 +371,7 @@ func processDownsampling(ctx context.Context, logger log.Logger, bkt objstore.Bu
 	}
 	defer runutil.CloseWithLogOnErr(log.With(logger, "outcome", "potential left mmap file handlers left"), b, "tsdb reader")
 
-	id, err := downsample.Downsample(logger, m, b, dir, resolution)
+	id, err := downsample.Downsample(logger, m, b, dir, resolution, extraAggrs...)
 	if err != nil {
 		return errors.Wrapf(err, "downsample block %s to window %d", m.ULID, resolution)
 	}
@@ -6,6 +6,7 @@ import (
 	"math"
 	"net/http"
 	"path"
+	"strings"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -24,8 +25,12 @@ import (
 	"github.com/thanos-io/thanos/pkg/component"
 	"github.com/thanos-io/thanos/pkg/discovery/cache"
 	"github.com/thanos-io/thanos/pkg/discovery/dns"
+	"github.com/thanos-io/thanos/pkg/extflag"
+	"github.com/thanos-io/thanos/pkg/extgrpc"
 	"github.com/thanos-io/thanos/pkg/extprom"
 	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
+	"github.com/thanos-io/thanos/pkg/gate"
+	"github.com/thanos-io/thanos/pkg/metadata"
 	"github.com/thanos-io/thanos/pkg/prober"
 	"github.com/thanos-io/thanos/pkg/query"
 	v1 "github.com/thanos-io/thanos/pkg/query/api"
@@ -33,6 +38,8 @@ import (
 	grpcserver "github.com/thanos-io/thanos/pkg/server/grpc"
 	httpserver "github.com/thanos-io/thanos/pkg/server/http"
 	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/targets"
+	"github.com/thanos-io/thanos/pkg/tenancy"
 	"github.com/thanos-io/thanos/pkg/tls"
 	"github.com/thanos-io/thanos/pkg/tracing"
 	"github.com/thanos-io/thanos/pkg/ui"
@@ -41,6 +48,11 @@ import (
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 )
 
+const (
+	queryModeLocal       = "local"
+	queryModeDistributed = "distributed"
+)
+
 // registerQuery registers a query command.
 func registerQuery(m map[string]setupFunc, app *kingpin.Application) {
 	comp := component.Query
@@ -54,6 +66,8 @@ func registerQuery(m map[string]setupFunc, app *kingpin.Application) {
 	key := cmd.Flag("grpc-client-tls-key", "TLS Key for the client's certificate").Default("").String()
 	caCert := cmd.Flag("grpc-client-tls-ca", "TLS CA Certificates to use to verify gRPC servers").Default("").String()
 	serverName := cmd.Flag("grpc-client-server-name", "Server name to verify the hostname on the returned gRPC certificates. See https://tools.ietf.org/html/rfc4366#section-3.1").Default("").String()
+	compression := cmd.Flag("grpc-client-compression", "Compression of requests sent to stores, which respond with the same compression. Supported by stores of this or newer version only.").
+		Default(extgrpc.CompressionNone).Enum(extgrpc.Compressions...)
 
 	webRoutePrefix := cmd.Flag("web.route-prefix", "Prefix for API and UI endpoints. This allows thanos UI to be served on a sub-path. This option is analogous to --web.route-prefix of Promethus.").Default("").String()
 	webExternalPrefix := cmd.Flag("web.external-prefix", "Static prefix for all HTML links and redirect URLs in the UI query web interface. Actual endpoints are still served on / or the web.route-prefix. This allows thanos UI to be served behind a reverse proxy that strips a URL sub-path.").Default("").String()
@@ -68,6 +82,9 @@ func registerQuery(m map[string]setupFunc, app *kingpin.Application) {
 	replicaLabels := cmd.Flag("query.replica-label", "Labels to treat as a replica indicator along which data is deduplicated. Still you will be able to query without deduplication using 'dedup=false' parameter.").
 		Strings()
 
+	dedupAlgorithm := cmd.Flag("query.dedup-algorithm", "Default algorithm merging samples of replicas during deduplication. Can be overridden per query using 'dedup_algorithm' parameter. 'penalty' works for all series, 'chain' prefers the most complete replica, 'counter' avoids counter resets when switching replicas of counters.").
+		Default(string(query.DedupPenalty)).Enum(query.DedupAlgorithms...)
+
 	instantDefaultMaxSourceResolution := modelDuration(cmd.Flag("query.instant.default.max_source_resolution", "default value for max_source_resolution for instant queries. If not set, defaults to 0s only taking raw resolution into account. 1h can be a good value if you use instant queries over time ranges that incorporate times outside of your raw-retention.").Default("0s").Hidden())
 
 	selectorLabels := cmd.Flag("selector-label", "Query selector labels that will be exposed in info endpoint (repeated).").
@@ -76,6 +93,12 @@ func registerQuery(m map[string]setupFunc, app *kingpin.Application) {
 	stores := cmd.Flag("store", "Addresses of statically configured store API servers (repeatable). The scheme may be prefixed with 'dns+' or 'dnssrv+' to detect store API servers through respective DNS lookups.").
 		PlaceHolder("<store>").Strings()
 
+	strictStores := cmd.Flag("store-strict", "Addresses of only statically configured store API servers that are always used, even if the health check fails (repeatable). Queries always hit them and report them as failed when they are not reachable.").
+		PlaceHolder("<staticstore>").Strings()
+
+	storeCompressions := cmd.Flag("store.compression", "Compression of requests sent to the store with the given address, overriding --grpc-client-compression (repeatable). The address must be the same as the one shown on the Stores page, i.e. resolved one for DNS discovered stores.").
+		PlaceHolder("<store>=<compression>").Strings()
+
 	fileSDFiles := cmd.Flag("store.sd-files", "Path to files that contain addresses of store API servers. The path can be a glob pattern (repeatable).").
 		PlaceHolder("<path>").Strings()
 
@@ -99,14 +122,55 @@ func registerQuery(m map[string]setupFunc, app *kingpin.Application) {
 
 	defaultEvaluationInterval := modelDuration(cmd.Flag("query.default-evaluation-interval", "Set default evaluation interval for sub queries.").Default("1m"))
 
+	queryLogFile := cmd.Flag("query.log-file", "Path to the file all executed queries are logged to as JSON lines, together with their parameters and statistics. Use '-' for standard output. Empty disables the query log.").
+		Default("").String()
+
+	slowQueryLogThreshold := modelDuration(cmd.Flag("query.slow-query-log-threshold", "Queries taking longer than this are logged as warnings along with their parameters and statistics. 0 disables the slow query log.").Default("0s"))
+
+	queryMode := cmd.Flag("query.mode", "Mode of query execution. In 'distributed' mode aggregations with sum, min, max, count or avg on the top level are pushed down to leaf queriers selected by their external labels, and only their partial aggregates are merged by this querier. Queries which can't be decomposed, or which touch stores other than queriers, are executed locally.").
+		Default(queryModeLocal).Enum(queryModeLocal, queryModeDistributed)
+
+	grpcQueryAPI := cmd.Flag("query.grpc-query-api", "Serve the Query API on the gRPC port, evaluating PromQL queries of queriers running with --query.mode=distributed. The API is not limited by --query.tenant-header, so the gRPC port must not be exposed to tenants.").
+		Default("false").Bool()
+
+	tenantHeader := cmd.Flag("query.tenant-header", "HTTP header holding the tenant of query API requests. If set, requests without a tenant configured in the tenancy config are rejected, and all others are limited to series matching the label matchers of their tenant.").
+		Default("").String()
+
+	tenancyConfig := extflag.RegisterPathOrContent(cmd, "query.tenancy-config", "YAML file with label matchers enforced on queries of each tenant. Used only with --query.tenant-header. See format details: https://thanos.io/components/query.md/#tenant-enforcement", false)
+
 	storeResponseTimeout := modelDuration(cmd.Flag("store.response-timeout", "If a Store doesn't send any data in this specified duration then a Store will be ignored and partial data will be returned if it's enabled. 0 disables timeout.").Default("0ms"))
 
+	storeResponseBatchSize := cmd.Flag("store.response-batch-size", "Maximum number of series stores are asked to send in a single Series response. Batching reduces per-message overhead for queries returning many small series. Stores not supporting batching send one series per response. 0 disables batching.").
+		Default("0").Int64()
+
+	storeReplicaGroups := cmd.Flag("store.replica-groups", "Treat stores announcing identical label sets and time ranges as replicas of each other. Series are requested from only one of them and retried on the next replica if it fails before the first response.").
+		Default("false").Bool()
+
+	storeReplicaHedgeDelay := modelDuration(cmd.Flag("store.replica-hedge-delay", "If a store replica does not respond within this duration, series are also requested from the next replica of the same group and the first response is used. 0 disables hedging. Used only with --store.replica-groups.").Default("0s"))
+
 	m[comp.String()] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer, _ bool) error {
 		selectorLset, err := parseFlagLabels(*selectorLabels)
 		if err != nil {
 			return errors.Wrap(err, "parse federation labels")
 		}
 
+		compressionOverrides, err := extgrpc.ParseCompressionOverrides(*storeCompressions)
+		if err != nil {
+			return errors.Wrap(err, "parse store compressions")
+		}
+
+		var tenantEnforcer *tenancy.Enforcer
+		if *tenantHeader != "" {
+			tenancyConfYaml, err := tenancyConfig.Content()
+			if err != nil {
+				return errors.Wrap(err, "get tenancy config")
+			}
+			tenantEnforcer, err = tenancy.NewEnforcer(*tenantHeader, tenancyConfYaml)
+			if err != nil {
+				return errors.Wrap(err, "parse tenancy config")
+			}
+		}
+
 		lookupStores := map[string]struct{}{}
 		for _, s := range *stores {
 			if _, ok := lookupStores[s]; ok {
@@ -115,6 +179,16 @@ func registerQuery(m map[string]setupFunc, app *kingpin.Application) {
 
 			lookupStores[s] = struct{}{}
 		}
+		for _, s := range *strictStores {
+			if _, ok := lookupStores[s]; ok {
+				return errors.Errorf("Address %s is duplicated for --store or --store-strict flag.", s)
+			}
+			if strings.Contains(s, "+") {
+				return errors.Errorf("Address %s of --store-strict flag has to be static, DNS lookups are not supported.", s)
+			}
+
+			lookupStores[s] = struct{}{}
+		}
 
 		var fileSD *file.Discovery
 		if len(*fileSDFiles) > 0 {
@@ -142,6 +216,8 @@ func registerQuery(m map[string]setupFunc, app *kingpin.Application) {
 			*key,
 			*caCert,
 			*serverName,
+			*compression,
+			compressionOverrides,
 			*httpBindAddr,
 			time.Duration(*httpGracePeriod),
 			*webRoutePrefix,
@@ -150,9 +226,14 @@ func registerQuery(m map[string]setupFunc, app *kingpin.Application) {
 			*maxConcurrentQueries,
 			time.Duration(*queryTimeout),
 			time.Duration(*storeResponseTimeout),
+			*storeResponseBatchSize,
+			*storeReplicaGroups,
+			time.Duration(*storeReplicaHedgeDelay),
 			*replicaLabels,
+			query.DedupAlgorithm(*dedupAlgorithm),
 			selectorLset,
 			*stores,
+			*strictStores,
 			*enableAutodownsampling,
 			*enablePartialResponse,
 			fileSD,
@@ -160,16 +241,22 @@ func registerQuery(m map[string]setupFunc, app *kingpin.Application) {
 			*dnsSDResolver,
 			time.Duration(*unhealthyStoreTimeout),
 			time.Duration(*instantDefaultMaxSourceResolution),
+			*queryLogFile,
+			time.Duration(*slowQueryLogThreshold),
+			*queryMode,
+			*grpcQueryAPI,
+			tenantEnforcer,
 			component.Query,
 		)
 	}
 }
 
-func storeClientGRPCOpts(logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer, secure bool, cert, key, caCert, serverName string) ([]grpc.DialOption, error) {
+func storeClientGRPCOpts(logger log.Logger, reg *prometheus.Registry, tracer opentracing.Tracer, secure bool, cert, key, caCert, serverName, compression string, compressionOverrides map[string]string) ([]grpc.DialOption, error) {
 	grpcMets := grpc_prometheus.NewClientMetrics()
 	grpcMets.EnableClientHandlingTimeHistogram(
 		grpc_prometheus.WithHistogramBuckets([]float64{0.001, 0.01, 0.1, 0.3, 0.6, 1, 3, 6, 9, 20, 30, 60, 90, 120}),
 	)
+	compressionUnary, compressionStream := extgrpc.ClientCompressionInterceptors(compression, compressionOverrides)
 	dialOpts := []grpc.DialOption{
 		// We want to make sure that we can receive huge gRPC messages from storeAPI.
 		// On TCP level we can be fine, but the gRPC overhead for huge messages could be significant.
@@ -180,14 +267,17 @@ func storeClientGRPCOpts(logger log.Logger, reg *prometheus.Registry, tracer ope
 			grpc_middleware.ChainUnaryClient(
 				grpcMets.UnaryClientInterceptor(),
 				tracing.UnaryClientInterceptor(tracer),
+				compressionUnary,
 			),
 		),
 		grpc.WithStreamInterceptor(
 			grpc_middleware.ChainStreamClient(
 				grpcMets.StreamClientInterceptor(),
 				tracing.StreamClientInterceptor(tracer),
+				compressionStream,
 			),
 		),
+		grpc.WithStatsHandler(extgrpc.NewClientPayloadMetrics(reg)),
 	}
 
 	if reg != nil {
@@ -224,6 +314,8 @@ func runQuery(
 	key string,
 	caCert string,
 	serverName string,
+	compression string,
+	compressionOverrides map[string]string,
 	httpBindAddr string,
 	httpGracePeriod time.Duration,
 	webRoutePrefix string,
@@ -232,9 +324,14 @@ func runQuery(
 	maxConcurrentQueries int,
 	queryTimeout time.Duration,
 	storeResponseTimeout time.Duration,
+	storeResponseBatchSize int64,
+	storeReplicaGroups bool,
+	storeReplicaHedgeDelay time.Duration,
 	replicaLabels []string,
+	dedupAlgorithm query.DedupAlgorithm,
 	selectorLset labels.Labels,
 	storeAddrs []string,
+	strictStoreAddrs []string,
 	enableAutodownsampling bool,
 	enablePartialResponse bool,
 	fileSD *file.Discovery,
@@ -242,6 +339,11 @@ func runQuery(
 	dnsSDResolver string,
 	unhealthyStoreTimeout time.Duration,
 	instantDefaultMaxSourceResolution time.Duration,
+	queryLogFile string,
+	slowQueryLogThreshold time.Duration,
+	queryMode string,
+	grpcQueryAPI bool,
+	tenantEnforcer *tenancy.Enforcer,
 	comp component.Component,
 ) error {
 	// TODO(bplotka in PR #513 review): Move arguments into struct.
@@ -251,7 +353,7 @@ func runQuery(
 	})
 	reg.MustRegister(duplicatedStores)
 
-	dialOpts, err := storeClientGRPCOpts(logger, reg, tracer, secure, cert, key, caCert, serverName)
+	dialOpts, err := storeClientGRPCOpts(logger, reg, tracer, secure, cert, key, caCert, serverName, compression, compressionOverrides)
 	if err != nil {
 		return errors.Wrap(err, "building gRPC client")
 	}
@@ -263,6 +365,14 @@ func runQuery(
 		dns.ResolverType(dnsSDResolver),
 	)
 
+	var proxyOpts []store.ProxyStoreOption
+	if storeReplicaGroups {
+		proxyOpts = append(proxyOpts, store.WithReplicaGroups(storeReplicaHedgeDelay))
+	}
+	if storeResponseBatchSize > 1 {
+		proxyOpts = append(proxyOpts, store.WithResponseBatchSize(storeResponseBatchSize))
+	}
+
 	var (
 		stores = query.NewStoreSet(
 			logger,
@@ -270,7 +380,11 @@ func runQuery(
 			func() (specs []query.StoreSpec) {
 				// Add DNS resolved addresses from static flags and file SD.
 				for _, addr := range dnsProvider.Addresses() {
-					specs = append(specs, query.NewGRPCStoreSpec(addr))
+					specs = append(specs, query.NewGRPCStoreSpec(addr, false))
+				}
+				// Add strict static stores. They are never removed from the store set.
+				for _, addr := range strictStoreAddrs {
+					specs = append(specs, query.NewGRPCStoreSpec(addr, true))
 				}
 
 				specs = removeDuplicateStoreSpecs(logger, duplicatedStores, specs)
@@ -280,19 +394,28 @@ func runQuery(
 			dialOpts,
 			unhealthyStoreTimeout,
 		)
-		proxy            = store.NewProxyStore(logger, stores.Get, component.Query, selectorLset, storeResponseTimeout)
+		proxy            = store.NewProxyStore(logger, stores.Get, component.Query, selectorLset, storeResponseTimeout, proxyOpts...)
 		queryableCreator = query.NewQueryableCreator(logger, proxy)
-		engine           = promql.NewEngine(
+		metadataProxy    = metadata.NewProxy(logger, stores.GetMetadataClients)
+		targetsProxy     = targets.NewProxy(logger, stores.GetTargetsClients)
+		// TODO(bwplotka): Expose this as a flag: https://github.com/thanos-io/thanos/issues/703.
+		maxSamples = math.MaxInt32
+		engine     = promql.NewEngine(
 			promql.EngineOpts{
 				Logger:        logger,
 				Reg:           reg,
 				MaxConcurrent: maxConcurrentQueries,
-				// TODO(bwplotka): Expose this as a flag: https://github.com/thanos-io/thanos/issues/703.
-				MaxSamples: math.MaxInt32,
-				Timeout:    queryTimeout,
+				MaxSamples:    maxSamples,
+				Timeout:       queryTimeout,
 			},
 		)
 	)
+	var distributedEngine *query.DistributedEngine
+	if queryMode == queryModeDistributed {
+		distributedEngine = query.NewDistributedEngine(logger, stores.Get, stores.GetQueryClients, maxSamples)
+	}
+	// The engine limits only locally evaluated queries, so API queries, including pushed down ones, share this gate.
+	queryGate := gate.NewGate(maxConcurrentQueries, extprom.WrapRegistererWithPrefix("thanos_query_concurrent_", reg))
 	// Periodically update the store set with the addresses we see in our cluster.
 	{
 		ctx, cancel := context.WithCancel(context.Background())
@@ -373,9 +496,24 @@ func runQuery(
 		}
 
 		ins := extpromhttp.NewInstrumentationMiddleware(reg)
-		ui.NewQueryUI(logger, reg, stores, flagsMap).Register(router.WithPrefix(webRoutePrefix), ins)
+		ui.NewQueryUI(logger, reg, stores, targetsProxy, flagsMap).Register(router.WithPrefix(webRoutePrefix), ins)
+
+		queryLogger, err := v1.NewQueryLogger(logger, queryLogFile, slowQueryLogThreshold)
+		if err != nil {
+			return errors.Wrap(err, "create query logger")
+		}
 
-		api := v1.NewAPI(logger, reg, engine, queryableCreator, enableAutodownsampling, enablePartialResponse, replicaLabels, instantDefaultMaxSourceResolution)
+		api := v1.NewAPI(logger, reg, engine, queryableCreator, enableAutodownsampling, enablePartialResponse, replicaLabels, instantDefaultMaxSourceResolution, v1.Options{
+			QueryTimeout:            queryTimeout,
+			QueryGate:               queryGate,
+			DedupAlgorithm:          dedupAlgorithm,
+			DownsamplingResolutions: stores.DownsamplingResolutions,
+			Metadatas:               metadataProxy,
+			Targets:                 targetsProxy,
+			QueryLogger:             queryLogger,
+			DistributedEngine:       distributedEngine,
+			TenantEnforcer:          tenantEnforcer,
+		})
 
 		api.Register(router.WithPrefix(path.Join(webRoutePrefix, "/api/v1")), tracer, logger, ins)
 
@@ -395,6 +533,7 @@ func runQuery(
 			defer statusProber.NotHealthy(err)
 
 			srv.Shutdown(err)
+			runutil.CloseWithLogOnErr(logger, queryLogger, "query logger")
 		})
 	}
 	// Start query (proxy) gRPC StoreAPI.
@@ -404,11 +543,18 @@ func runQuery(
 			return errors.Wrap(err, "setup gRPC server")
 		}
 
-		s := grpcserver.New(logger, reg, tracer, comp, proxy,
+		grpcOpts := []grpcserver.Option{
 			grpcserver.WithListen(grpcBindAddr),
 			grpcserver.WithGracePeriod(grpcGracePeriod),
 			grpcserver.WithTLSConfig(tlsCfg),
-		)
+			grpcserver.WithServer(metadata.RegisterMetadataServer(metadataProxy)),
+			grpcserver.WithServer(targets.RegisterTargetsServer(targetsProxy)),
+		}
+		if grpcQueryAPI {
+			// Queries of the API are not limited by the tenancy config, which is enforced only for HTTP requests.
+			grpcOpts = append(grpcOpts, grpcserver.WithServer(query.RegisterQueryServer(query.NewQueryServer(engine, queryableCreator))))
+		}
+		s := grpcserver.New(logger, reg, tracer, comp, proxy, grpcOpts...)
 
 		g.Add(func() error {
 			statusProber.Ready()
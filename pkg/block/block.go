@@ -34,6 +34,9 @@ const (
 
 	// DebugMetas is a directory for debug meta files that happen in the past. Useful for debugging.
 	DebugMetas = "debug/metas"
+	// MarkersDir is a directory for marks of blocks, e.g. no-compact marks, so that marks of all blocks can be listed
+	// at once.
+	MarkersDir = "markers"
 )
 
 // Download downloads directory that is mean to be block directory.
@@ -89,6 +92,15 @@ func Upload(ctx context.Context, logger log.Logger, bkt objstore.Bucket, bdir st
 		return errors.Wrap(err, "upload meta file to debug dir")
 	}
 
+	// Record sizes of the block files, so that they are known from meta.json without reading the files.
+	meta.Thanos.Files, err = gatherFileStats(bdir)
+	if err != nil {
+		return errors.Wrap(err, "gather block files")
+	}
+	if err := metadata.Write(logger, bdir, meta); err != nil {
+		return errors.Wrap(err, "write meta with block files")
+	}
+
 	if err := objstore.UploadDir(ctx, logger, bkt, path.Join(bdir, ChunksDirname), path.Join(id.String(), ChunksDirname)); err != nil {
 		return cleanUp(logger, bkt, id, errors.Wrap(err, "upload chunks"))
 	}
@@ -112,6 +124,24 @@ func Upload(ctx context.Context, logger log.Logger, bkt objstore.Bucket, bdir st
 	return nil
 }
 
+// gatherFileStats returns the index and chunk files of the given block directory with their sizes.
+func gatherFileStats(bdir string) ([]metadata.File, error) {
+	chunkFiles, err := ioutil.ReadDir(filepath.Join(bdir, ChunksDirname))
+	if err != nil {
+		return nil, errors.Wrap(err, "read chunks dir")
+	}
+	files := make([]metadata.File, 0, len(chunkFiles)+1)
+	for _, f := range chunkFiles {
+		files = append(files, metadata.File{RelPath: path.Join(ChunksDirname, f.Name()), SizeBytes: f.Size()})
+	}
+
+	f, err := os.Stat(filepath.Join(bdir, IndexFilename))
+	if err != nil {
+		return nil, errors.Wrap(err, "stat index")
+	}
+	return append(files, metadata.File{RelPath: IndexFilename, SizeBytes: f.Size()}), nil
+}
+
 func cleanUp(logger log.Logger, bkt objstore.Bucket, id ulid.ULID, err error) error {
 	// Cleanup the dir with an uncancelable context.
 	cleanErr := Delete(context.Background(), logger, bkt, id)
@@ -140,7 +170,10 @@ func Delete(ctx context.Context, logger log.Logger, bkt objstore.Bucket, id ulid
 		level.Debug(logger).Log("msg", "deleted file", "file", metaFile, "bucket", bkt.Name())
 	}
 
-	return deleteDir(ctx, logger, bkt, id.String())
+	if err := deleteDir(ctx, logger, bkt, id.String()); err != nil {
+		return err
+	}
+	return deleteMarks(ctx, logger, bkt, id)
 }
 
 // deleteDir removes all objects prefixed with dir from the bucket.
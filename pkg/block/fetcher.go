@@ -47,6 +47,8 @@ const (
 	labelExcludedMeta = "label-excluded"
 	timeExcludedMeta  = "time-excluded"
 	TooFreshMeta      = "too-fresh"
+	NotOwnedMeta      = "not-owned"
+	QuarantinedMeta   = "quarantined"
 )
 
 func newSyncMetrics(r prometheus.Registerer) *syncMetrics {
@@ -81,6 +83,8 @@ func newSyncMetrics(r prometheus.Registerer) *syncMetrics {
 		[]string{failedMeta},
 		[]string{labelExcludedMeta},
 		[]string{timeExcludedMeta},
+		[]string{NotOwnedMeta},
+		[]string{QuarantinedMeta},
 	)
 	if r != nil {
 		r.MustRegister(
@@ -158,77 +158,87 @@ func GatherIndexIssueStats(logger log.Logger, fn string, minTime int64, maxTime
 		lastLset = append(lastLset[:0], lset...)
 
 		id := p.At()
-		stats.TotalSeries++
-
 		if err := r.Series(id, &lset, &chks); err != nil {
 			return stats, errors.Wrap(err, "read series")
 		}
-		if len(lset) == 0 {
-			return stats, errors.Errorf("empty label set detected for series %d", id)
-		}
-		if lastLset != nil && labels.Compare(lastLset, lset) >= 0 {
-			return stats, errors.Errorf("series %v out of order; previous %v", lset, lastLset)
-		}
-		l0 := lset[0]
-		for _, l := range lset[1:] {
-			if l.Name < l0.Name {
-				stats.OutOfOrderLabels++
-				level.Warn(logger).Log("msg",
-					"out-of-order label set: known bug in Prometheus 2.8.0 and below",
-					"labelset", lset.String(),
-					"series", fmt.Sprintf("%d", id),
-				)
-			}
-			l0 = l
-		}
-		if len(chks) == 0 {
-			return stats, errors.Errorf("empty chunks for series %d", id)
+		if err := stats.AddSeries(logger, id, lastLset, lset, chks, minTime, maxTime); err != nil {
+			return stats, err
 		}
+	}
+	if p.Err() != nil {
+		return stats, errors.Wrap(err, "walk postings")
+	}
 
-		ooo := 0
-		// Per chunk in series.
-		for i, c := range chks {
-			// Chunk vs the block ranges.
-			if c.MinTime < minTime || c.MaxTime > maxTime {
-				stats.OutsideChunks++
-				if c.MinTime > maxTime || c.MaxTime < minTime {
-					stats.CompleteOutsideChunks++
-				} else if c.MinTime == maxTime {
-					stats.Issue347OutsideChunks++
-				}
-			}
+	return stats, nil
+}
 
-			if i == 0 {
-				continue
+// AddSeries gathers issues of the series with the given ID, labels and chunks of a block with the given time range.
+// Previous labels are the ones of the preceding series in the index, empty for the first series. Errors are returned
+// for issues which make the index unreadable.
+func (i *Stats) AddSeries(logger log.Logger, id uint64, lastLset, lset labels.Labels, chks []chunks.Meta, minTime, maxTime int64) error {
+	i.TotalSeries++
+
+	if len(lset) == 0 {
+		return errors.Errorf("empty label set detected for series %d", id)
+	}
+	if len(lastLset) > 0 && labels.Compare(lastLset, lset) >= 0 {
+		return errors.Errorf("series %v out of order; previous %v", lset, lastLset)
+	}
+	l0 := lset[0]
+	for _, l := range lset[1:] {
+		if l.Name < l0.Name {
+			i.OutOfOrderLabels++
+			level.Warn(logger).Log("msg",
+				"out-of-order label set: known bug in Prometheus 2.8.0 and below",
+				"labelset", lset.String(),
+				"series", fmt.Sprintf("%d", id),
+			)
+		}
+		l0 = l
+	}
+	if len(chks) == 0 {
+		return errors.Errorf("empty chunks for series %d", id)
+	}
+
+	ooo := 0
+	// Per chunk in series.
+	for j, c := range chks {
+		// Chunk vs the block ranges.
+		if c.MinTime < minTime || c.MaxTime > maxTime {
+			i.OutsideChunks++
+			if c.MinTime > maxTime || c.MaxTime < minTime {
+				i.CompleteOutsideChunks++
+			} else if c.MinTime == maxTime {
+				i.Issue347OutsideChunks++
 			}
+		}
 
-			c0 := chks[i-1]
+		if j == 0 {
+			continue
+		}
 
-			// Chunk order within block.
-			if c.MinTime > c0.MaxTime {
-				continue
-			}
+		c0 := chks[j-1]
 
-			if c.MinTime == c0.MinTime && c.MaxTime == c0.MaxTime {
-				// TODO(bplotka): Calc and check checksum from chunks itself.
-				// The chunks can overlap 1:1 in time, but does not have same data.
-				// We assume same data for simplicity, but it can be a symptom of error.
-				stats.DuplicatedChunks++
-				continue
-			}
-			// Chunks partly overlaps or out of order.
-			ooo++
+		// Chunk order within block.
+		if c.MinTime > c0.MaxTime {
+			continue
 		}
-		if ooo > 0 {
-			stats.OutOfOrderSeries++
-			stats.OutOfOrderChunks += ooo
+
+		if c.MinTime == c0.MinTime && c.MaxTime == c0.MaxTime {
+			// TODO(bplotka): Calc and check checksum from chunks itself.
+			// The chunks can overlap 1:1 in time, but does not have same data.
+			// We assume same data for simplicity, but it can be a symptom of error.
+			i.DuplicatedChunks++
+			continue
 		}
+		// Chunks partly overlaps or out of order.
+		ooo++
 	}
-	if p.Err() != nil {
-		return stats, errors.Wrap(err, "walk postings")
+	if ooo > 0 {
+		i.OutOfOrderSeries++
+		i.OutOfOrderChunks += ooo
 	}
-
-	return stats, nil
+	return nil
 }
 
 type ignoreFnType func(mint, maxt int64, prev *chunks.Meta, curr *chunks.Meta) (bool, error)
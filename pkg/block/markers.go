@@ -0,0 +1,215 @@
+package block
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// ReadNoCompactMark reads no-compact mark of the block with the given ID from the bucket. It returns nil if the block
+// is not marked.
+func ReadNoCompactMark(ctx context.Context, logger log.Logger, bkt objstore.BucketReader, id ulid.ULID) (*metadata.NoCompactMark, error) {
+	var m metadata.NoCompactMark
+	ok, err := readMarker(ctx, logger, bkt, id, metadata.NoCompactMarkFilename, &m)
+	if err != nil || !ok {
+		return nil, err
+	}
+	if m.Version != metadata.NoCompactMarkVersion1 {
+		return nil, errors.Errorf("unexpected no-compact mark version %d of block %s", m.Version, id)
+	}
+	return &m, nil
+}
+
+// ReadNoDownsampleMark reads no-downsample mark of the block with the given ID from the bucket. It returns nil if the
+// block is not marked.
+func ReadNoDownsampleMark(ctx context.Context, logger log.Logger, bkt objstore.BucketReader, id ulid.ULID) (*metadata.NoDownsampleMark, error) {
+	var m metadata.NoDownsampleMark
+	ok, err := readMarker(ctx, logger, bkt, id, metadata.NoDownsampleMarkFilename, &m)
+	if err != nil || !ok {
+		return nil, err
+	}
+	if m.Version != metadata.NoDownsampleMarkVersion1 {
+		return nil, errors.Errorf("unexpected no-downsample mark version %d of block %s", m.Version, id)
+	}
+	return &m, nil
+}
+
+// ReadNoCompactMarks reads no-compact marks of all blocks from the bucket, listing the marks at once.
+func ReadNoCompactMarks(ctx context.Context, logger log.Logger, bkt objstore.BucketReader) (map[ulid.ULID]*metadata.NoCompactMark, error) {
+	marks := map[ulid.ULID]*metadata.NoCompactMark{}
+	err := iterMarkers(ctx, bkt, metadata.NoCompactMarkFilename, func(id ulid.ULID) error {
+		m, err := ReadNoCompactMark(ctx, logger, bkt, id)
+		if err != nil {
+			return err
+		}
+		if m != nil {
+			marks[id] = m
+		}
+		return nil
+	})
+	return marks, err
+}
+
+// ReadNoDownsampleMarks reads no-downsample marks of all blocks from the bucket, listing the marks at once.
+func ReadNoDownsampleMarks(ctx context.Context, logger log.Logger, bkt objstore.BucketReader) (map[ulid.ULID]*metadata.NoDownsampleMark, error) {
+	marks := map[ulid.ULID]*metadata.NoDownsampleMark{}
+	err := iterMarkers(ctx, bkt, metadata.NoDownsampleMarkFilename, func(id ulid.ULID) error {
+		m, err := ReadNoDownsampleMark(ctx, logger, bkt, id)
+		if err != nil {
+			return err
+		}
+		if m != nil {
+			marks[id] = m
+		}
+		return nil
+	})
+	return marks, err
+}
+
+// markerPath returns path of the mark with the given filename of the block with the given ID.
+func markerPath(id ulid.ULID, filename string) string {
+	return path.Join(MarkersDir, id.String()+"-"+filename)
+}
+
+// iterMarkers calls f with ID of each block having the mark with the given filename.
+func iterMarkers(ctx context.Context, bkt objstore.BucketReader, filename string, f func(id ulid.ULID) error) error {
+	return bkt.Iter(ctx, MarkersDir, func(name string) error {
+		base := path.Base(name)
+		if !strings.HasSuffix(base, "-"+filename) {
+			return nil
+		}
+		id, err := ulid.Parse(strings.TrimSuffix(base, "-"+filename))
+		if err != nil {
+			return nil
+		}
+		return f(id)
+	})
+}
+
+func readMarker(ctx context.Context, logger log.Logger, bkt objstore.BucketReader, id ulid.ULID, filename string, v interface{}) (bool, error) {
+	markFile := markerPath(id, filename)
+	rc, err := bkt.Get(ctx, markFile)
+	if err != nil {
+		if bkt.IsObjNotFoundErr(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "get %s", markFile)
+	}
+	defer runutil.CloseWithLogOnErr(logger, rc, "close marker reader")
+
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return false, errors.Wrapf(err, "read %s", markFile)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return false, errors.Wrapf(err, "unmarshal %s", markFile)
+	}
+	return true, nil
+}
+
+// MarkForNoCompact uploads no-compact mark with the given reason for the block with the given ID, so that the block is
+// excluded from compaction and downsampling. It does nothing if the block is already marked.
+func MarkForNoCompact(ctx context.Context, logger log.Logger, bkt objstore.Bucket, id ulid.ULID, reason metadata.NoCompactReason, details string, markedForNoCompact prometheus.Counter) error {
+	uploaded, err := uploadMarker(ctx, logger, bkt, id, metadata.NoCompactMarkFilename, metadata.NoCompactMark{
+		ID:      id,
+		Version: metadata.NoCompactMarkVersion1,
+		Reason:  reason,
+		Details: details,
+	})
+	if err != nil {
+		return err
+	}
+	if uploaded && markedForNoCompact != nil {
+		markedForNoCompact.Inc()
+	}
+	return nil
+}
+
+// MarkForNoDownsample uploads no-downsample mark with the given reason for the block with the given ID, so that the
+// block is excluded from downsampling. It does nothing if the block is already marked.
+func MarkForNoDownsample(ctx context.Context, logger log.Logger, bkt objstore.Bucket, id ulid.ULID, reason metadata.NoDownsampleReason, details string) error {
+	_, err := uploadMarker(ctx, logger, bkt, id, metadata.NoDownsampleMarkFilename, metadata.NoDownsampleMark{
+		ID:      id,
+		Version: metadata.NoDownsampleMarkVersion1,
+		Reason:  reason,
+		Details: details,
+	})
+	return err
+}
+
+func uploadMarker(ctx context.Context, logger log.Logger, bkt objstore.Bucket, id ulid.ULID, filename string, v interface{}) (bool, error) {
+	metaFile := path.Join(id.String(), MetaFilename)
+	ok, err := bkt.Exists(ctx, metaFile)
+	if err != nil {
+		return false, errors.Wrapf(err, "stat %s", metaFile)
+	}
+	if !ok {
+		return false, errors.Errorf("block %s does not exist", id)
+	}
+
+	markFile := markerPath(id, filename)
+	ok, err = bkt.Exists(ctx, markFile)
+	if err != nil {
+		return false, errors.Wrapf(err, "stat %s", markFile)
+	}
+	if ok {
+		level.Warn(logger).Log("msg", "requested to mark block, but it is already marked", "block", id, "mark", filename)
+		return false, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return false, errors.Wrapf(err, "marshal %s", markFile)
+	}
+	if err := bkt.Upload(ctx, markFile, bytes.NewReader(b)); err != nil {
+		return false, errors.Wrapf(err, "upload %s", markFile)
+	}
+	level.Info(logger).Log("msg", "block has been marked", "block", id, "mark", filename)
+	return true, nil
+}
+
+// RemoveMark removes the mark with the given filename, e.g. metadata.NoCompactMarkFilename, of the block with the given
+// ID. It does nothing if the block is not marked.
+func RemoveMark(ctx context.Context, logger log.Logger, bkt objstore.Bucket, id ulid.ULID, filename string) error {
+	markFile := markerPath(id, filename)
+	ok, err := bkt.Exists(ctx, markFile)
+	if err != nil {
+		return errors.Wrapf(err, "stat %s", markFile)
+	}
+	if !ok {
+		level.Warn(logger).Log("msg", "requested to remove mark, but block is not marked", "block", id, "mark", filename)
+		return nil
+	}
+	if err := bkt.Delete(ctx, markFile); err != nil {
+		return errors.Wrapf(err, "delete %s", markFile)
+	}
+	level.Info(logger).Log("msg", "mark has been removed", "block", id, "mark", filename)
+	return nil
+}
+
+// deleteMarks removes all marks of the block with the given ID.
+func deleteMarks(ctx context.Context, logger log.Logger, bkt objstore.Bucket, id ulid.ULID) error {
+	for _, filename := range []string{metadata.NoCompactMarkFilename, metadata.NoDownsampleMarkFilename} {
+		markFile := markerPath(id, filename)
+		if err := bkt.Delete(ctx, markFile); err != nil {
+			if bkt.IsObjNotFoundErr(err) {
+				continue
+			}
+			return errors.Wrapf(err, "delete %s", markFile)
+		}
+		level.Debug(logger).Log("msg", "deleted file", "file", markFile, "bucket", bkt.Name())
+	}
+	return nil
+}
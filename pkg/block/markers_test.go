@@ -0,0 +1,110 @@
+package block
+
+import (
+	"context"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/objstore/inmem"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestMarkForNoCompact(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+	bkt := inmem.NewBucket()
+	id := ulid.MustNew(1, nil)
+	marked := prometheus.NewCounter(prometheus.CounterOpts{})
+
+	// Non existing block cannot be marked.
+	testutil.NotOk(t, MarkForNoCompact(ctx, logger, bkt, id, metadata.ManualNoCompactReason, "", marked))
+
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(id.String(), MetaFilename), strings.NewReader("{}")))
+
+	m, err := ReadNoCompactMark(ctx, logger, bkt, id)
+	testutil.Ok(t, err)
+	testutil.Assert(t, m == nil, "expected no mark")
+
+	testutil.Ok(t, MarkForNoCompact(ctx, logger, bkt, id, metadata.UnhealthyIndexNoCompactReason, "out-of-order chunks", marked))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(marked))
+
+	m, err = ReadNoCompactMark(ctx, logger, bkt, id)
+	testutil.Ok(t, err)
+	testutil.Equals(t, &metadata.NoCompactMark{
+		ID:      id,
+		Version: metadata.NoCompactMarkVersion1,
+		Reason:  metadata.UnhealthyIndexNoCompactReason,
+		Details: "out-of-order chunks",
+	}, m)
+
+	// Already marked block is not marked again.
+	testutil.Ok(t, MarkForNoCompact(ctx, logger, bkt, id, metadata.ManualNoCompactReason, "", marked))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(marked))
+	m, err = ReadNoCompactMark(ctx, logger, bkt, id)
+	testutil.Ok(t, err)
+	testutil.Equals(t, metadata.UnhealthyIndexNoCompactReason, m.Reason)
+
+	testutil.Ok(t, RemoveMark(ctx, logger, bkt, id, metadata.NoCompactMarkFilename))
+	m, err = ReadNoCompactMark(ctx, logger, bkt, id)
+	testutil.Ok(t, err)
+	testutil.Assert(t, m == nil, "expected no mark")
+}
+
+func TestMarkForNoDownsample(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+	bkt := inmem.NewBucket()
+	id := ulid.MustNew(1, nil)
+
+	testutil.Ok(t, bkt.Upload(ctx, path.Join(id.String(), MetaFilename), strings.NewReader("{}")))
+	testutil.Ok(t, MarkForNoDownsample(ctx, logger, bkt, id, metadata.ManualNoDownsampleReason, "not needed"))
+
+	m, err := ReadNoDownsampleMark(ctx, logger, bkt, id)
+	testutil.Ok(t, err)
+	testutil.Equals(t, &metadata.NoDownsampleMark{
+		ID:      id,
+		Version: metadata.NoDownsampleMarkVersion1,
+		Reason:  metadata.ManualNoDownsampleReason,
+		Details: "not needed",
+	}, m)
+
+	// Marks of unsupported version are rejected.
+	testutil.Ok(t, bkt.Upload(ctx, markerPath(id, metadata.NoDownsampleMarkFilename), strings.NewReader(`{"version":2}`)))
+	_, err = ReadNoDownsampleMark(ctx, logger, bkt, id)
+	testutil.NotOk(t, err)
+}
+
+func TestReadNoCompactMarks(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+	bkt := inmem.NewBucket()
+	id1, id2 := ulid.MustNew(1, nil), ulid.MustNew(2, nil)
+
+	for _, id := range []ulid.ULID{id1, id2} {
+		testutil.Ok(t, bkt.Upload(ctx, path.Join(id.String(), MetaFilename), strings.NewReader("{}")))
+	}
+	testutil.Ok(t, MarkForNoCompact(ctx, logger, bkt, id1, metadata.ManualNoCompactReason, "", nil))
+	testutil.Ok(t, MarkForNoDownsample(ctx, logger, bkt, id2, metadata.ManualNoDownsampleReason, ""))
+
+	noCompact, err := ReadNoCompactMarks(ctx, logger, bkt)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(noCompact))
+	testutil.Equals(t, metadata.ManualNoCompactReason, noCompact[id1].Reason)
+
+	noDownsample, err := ReadNoDownsampleMarks(ctx, logger, bkt)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(noDownsample))
+	testutil.Equals(t, metadata.ManualNoDownsampleReason, noDownsample[id2].Reason)
+
+	// Marks are deleted together with their block.
+	testutil.Ok(t, Delete(ctx, logger, bkt, id1))
+	noCompact, err = ReadNoCompactMarks(ctx, logger, bkt)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 0, len(noCompact))
+}
@@ -0,0 +1,68 @@
+package metadata
+
+import (
+	"github.com/oklog/ulid"
+)
+
+const (
+	// NoCompactMarkFilename is the known JSON filename suffix for optional file storing details about why block has
+	// to be excluded from compaction. If such file prefixed with the block ID is present in the markers dir, it means
+	// the block has to be excluded from compaction.
+	NoCompactMarkFilename = "no-compact-mark.json"
+
+	// NoCompactMarkVersion1 is a version of no-compact marks supported by Thanos.
+	NoCompactMarkVersion1 = 1
+
+	// NoDownsampleMarkFilename is the known JSON filename suffix for optional file storing details about why block
+	// has to be excluded from downsampling. If such file prefixed with the block ID is present in the markers dir, it
+	// means the block has to be excluded from downsampling.
+	NoDownsampleMarkFilename = "no-downsample-mark.json"
+
+	// NoDownsampleMarkVersion1 is a version of no-downsample marks supported by Thanos.
+	NoDownsampleMarkVersion1 = 1
+)
+
+// NoCompactReason is a reason for a block to be excluded from compaction.
+type NoCompactReason string
+
+const (
+	// ManualNoCompactReason is a custom reason of excluding from compaction that should be added when no-compact mark
+	// is added for unknown case.
+	ManualNoCompactReason NoCompactReason = "manual"
+	// UnhealthyIndexNoCompactReason is a reason of excluding from compaction added by the compactor when the block
+	// has index with critical issues, e.g. out-of-order chunks, so that it cannot be compacted.
+	UnhealthyIndexNoCompactReason NoCompactReason = "unhealthy-index"
+)
+
+// NoCompactMark marker stores reason of block being excluded from compaction if needed.
+type NoCompactMark struct {
+	// ID of the tsdb block.
+	ID ulid.ULID `json:"id"`
+	// Version of the file.
+	Version int `json:"version"`
+
+	Reason NoCompactReason `json:"reason"`
+	// Details is a human readable string giving details of reason.
+	Details string `json:"details"`
+}
+
+// NoDownsampleReason is a reason for a block to be excluded from downsampling.
+type NoDownsampleReason string
+
+const (
+	// ManualNoDownsampleReason is a custom reason of excluding from downsampling that should be added when
+	// no-downsample mark is added for unknown case.
+	ManualNoDownsampleReason NoDownsampleReason = "manual"
+)
+
+// NoDownsampleMark marker stores reason of block being excluded from downsampling if needed.
+type NoDownsampleMark struct {
+	// ID of the tsdb block.
+	ID ulid.ULID `json:"id"`
+	// Version of the file.
+	Version int `json:"version"`
+
+	Reason NoDownsampleReason `json:"reason"`
+	// Details is a human readable string giving details of reason.
+	Details string `json:"details"`
+}
@@ -21,14 +21,15 @@ import (
 type SourceType string
 
 const (
-	UnknownSource         SourceType = ""
-	SidecarSource         SourceType = "sidecar"
-	ReceiveSource         SourceType = "receive"
-	CompactorSource       SourceType = "compactor"
-	CompactorRepairSource SourceType = "compactor.repair"
-	RulerSource           SourceType = "ruler"
-	BucketRepairSource    SourceType = "bucket.repair"
-	TestSource            SourceType = "test"
+	UnknownSource            SourceType = ""
+	SidecarSource            SourceType = "sidecar"
+	ReceiveSource            SourceType = "receive"
+	CompactorSource          SourceType = "compactor"
+	CompactorRepairSource    SourceType = "compactor.repair"
+	CompactorRetentionSource SourceType = "compactor.retention"
+	RulerSource              SourceType = "ruler"
+	BucketRepairSource       SourceType = "bucket.repair"
+	TestSource               SourceType = "test"
 )
 
 const (
@@ -56,10 +57,21 @@ type Thanos struct {
 
 	// Source is a real upload source of the block.
 	Source SourceType `json:"source"`
+
+	// Files are the block files with their sizes, recorded when the block is uploaded.
+	Files []File `json:"files,omitempty"`
+}
+
+// File is a block file with its path relative to the block directory.
+type File struct {
+	RelPath   string `json:"rel_path"`
+	SizeBytes int64  `json:"size_bytes"`
 }
 
 type ThanosDownsample struct {
 	Resolution int64 `json:"resolution"`
+	// Aggregates are names of optional aggregates stored in chunks of the block besides count, sum, min, max and counter.
+	Aggregates []string `json:"aggregates,omitempty"`
 }
 
 // InjectThanos sets Thanos meta to the block meta JSON and saves it to the disk.
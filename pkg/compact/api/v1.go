@@ -0,0 +1,53 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/NYTimes/gziphandler"
+	"github.com/go-kit/kit/log"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/prometheus/common/route"
+	"github.com/thanos-io/thanos/pkg/compact"
+	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
+	qapi "github.com/thanos-io/thanos/pkg/query/api"
+	"github.com/thanos-io/thanos/pkg/tracing"
+)
+
+// ProgressRetriever returns the current progress of the compactor.
+type ProgressRetriever interface {
+	Status() compact.ProgressStatus
+}
+
+type API struct {
+	logger            log.Logger
+	progressRetriever ProgressRetriever
+}
+
+func NewAPI(logger log.Logger, progressRetriever ProgressRetriever) *API {
+	return &API{
+		logger:            logger,
+		progressRetriever: progressRetriever,
+	}
+}
+
+func (api *API) Register(r *route.Router, tracer opentracing.Tracer, logger log.Logger, ins extpromhttp.InstrumentationMiddleware) {
+	instr := func(name string, f qapi.ApiFunc) http.HandlerFunc {
+		hf := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			qapi.SetCORS(w)
+			if data, warnings, err := f(r); err != nil {
+				qapi.RespondError(w, err, data)
+			} else if data != nil {
+				qapi.Respond(w, data, warnings)
+			} else {
+				w.WriteHeader(http.StatusNoContent)
+			}
+		})
+		return ins.NewHandler(name, tracing.HTTPMiddleware(tracer, name, logger, gziphandler.GzipHandler(hf)))
+	}
+
+	r.Get("/progress", instr("progress", api.progress))
+}
+
+func (api *API) progress(r *http.Request) (interface{}, []error, *qapi.ApiError) {
+	return api.progressRetriever.Status(), nil, nil
+}
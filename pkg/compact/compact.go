@@ -10,6 +10,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/alecthomas/units"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/oklog/ulid"
@@ -42,6 +43,7 @@ type Syncer struct {
 	fetcher                  block.MetadataFetcher
 	mtx                      sync.Mutex
 	blocks                   map[ulid.ULID]*metadata.Meta
+	noCompactMarks           map[ulid.ULID]*metadata.NoCompactMark
 	blockSyncConcurrency     int
 	metrics                  *syncerMetrics
 	acceptMalformedIndex     bool
@@ -57,7 +59,12 @@ type syncerMetrics struct {
 	compactionRunsStarted     *prometheus.CounterVec
 	compactionRunsCompleted   *prometheus.CounterVec
 	compactionFailures        *prometheus.CounterVec
+	compactionsRefused        *prometheus.CounterVec
 	verticalCompactions       *prometheus.CounterVec
+	noCompactMarkedBlocks     prometheus.Gauge
+	blocksMarkedForNoCompact  prometheus.Counter
+	todoCompactions           prometheus.Gauge
+	todoCompactionBlocks      prometheus.Gauge
 }
 
 func newSyncerMetrics(reg prometheus.Registerer) *syncerMetrics {
@@ -97,11 +104,32 @@ func newSyncerMetrics(reg prometheus.Registerer) *syncerMetrics {
 		Name: "thanos_compact_group_compactions_failures_total",
 		Help: "Total number of failed group compactions.",
 	}, []string{"group"})
+	m.compactionsRefused = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "thanos_compact_group_compactions_refused_total",
+		Help: "Total number of group compactions refused because they would need more local disk space than the disk budget.",
+	}, []string{"group"})
 	m.verticalCompactions = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "thanos_compact_group_vertical_compactions_total",
 		Help: "Total number of group compaction attempts that resulted in a new block based on overlapping blocks.",
 	}, []string{"group"})
 
+	m.noCompactMarkedBlocks = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "thanos_compact_blocks_marked_for_no_compact",
+		Help: "Number of blocks marked for no compaction.",
+	})
+	m.blocksMarkedForNoCompact = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "thanos_compact_blocks_marked_for_no_compact_total",
+		Help: "Total number of blocks marked for no compaction by the compactor.",
+	})
+	m.todoCompactions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "thanos_compact_todo_compactions",
+		Help: "Number of compactions planned to be done in the current compaction pass.",
+	})
+	m.todoCompactionBlocks = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "thanos_compact_todo_compaction_blocks",
+		Help: "Number of blocks planned to be compacted in the current compaction pass.",
+	})
+
 	if reg != nil {
 		reg.MustRegister(
 			m.garbageCollectedBlocks,
@@ -112,7 +140,12 @@ func newSyncerMetrics(reg prometheus.Registerer) *syncerMetrics {
 			m.compactionRunsStarted,
 			m.compactionRunsCompleted,
 			m.compactionFailures,
+			m.compactionsRefused,
 			m.verticalCompactions,
+			m.noCompactMarkedBlocks,
+			m.blocksMarkedForNoCompact,
+			m.todoCompactions,
+			m.todoCompactionBlocks,
 		)
 	}
 	return &m
@@ -130,6 +163,7 @@ func NewSyncer(logger log.Logger, reg prometheus.Registerer, bkt objstore.Bucket
 		bkt:                  bkt,
 		fetcher:              fetcher,
 		blocks:               map[ulid.ULID]*metadata.Meta{},
+		noCompactMarks:       map[ulid.ULID]*metadata.NoCompactMark{},
 		metrics:              newSyncerMetrics(reg),
 		blockSyncConcurrency: blockSyncConcurrency,
 		acceptMalformedIndex: acceptMalformedIndex,
@@ -140,20 +174,18 @@ func NewSyncer(logger log.Logger, reg prometheus.Registerer, bkt objstore.Bucket
 	}, nil
 }
 
-// UntilNextDownsampling calculates how long it will take until the next downsampling operation.
+// UntilNextDownsampling calculates how long it will take until the next downsampling operation with the given levels.
 // Returns an error if there will be no downsampling.
-func UntilNextDownsampling(m *metadata.Meta) (time.Duration, error) {
+func UntilNextDownsampling(m *metadata.Meta, levels downsample.Levels) (time.Duration, error) {
 	timeRange := time.Duration((m.MaxTime - m.MinTime) * int64(time.Millisecond))
-	switch m.Thanos.Downsample.Resolution {
-	case downsample.ResLevel2:
+	if !levels.Known(m.Thanos.Downsample.Resolution) {
+		return time.Duration(0), errors.Errorf("unknown resolution %v", m.Thanos.Downsample.Resolution)
+	}
+	next, ok := levels.Next(m.Thanos.Downsample.Resolution)
+	if !ok {
 		return time.Duration(0), errors.New("no downsampling")
-	case downsample.ResLevel1:
-		return time.Duration(downsample.DownsampleRange1*time.Millisecond) - timeRange, nil
-	case downsample.ResLevel0:
-		return time.Duration(downsample.DownsampleRange0*time.Millisecond) - timeRange, nil
-	default:
-		panic(fmt.Errorf("invalid resolution %v", m.Thanos.Downsample.Resolution))
 	}
+	return time.Duration(next.MinSourceRange*int64(time.Millisecond)) - timeRange, nil
 }
 
 func (s *Syncer) SyncMetas(ctx context.Context) error {
@@ -166,9 +198,39 @@ func (s *Syncer) SyncMetas(ctx context.Context) error {
 	}
 	s.blocks = metas
 
+	marks, err := s.syncNoCompactMarks(ctx)
+	if err != nil {
+		return retry(errors.Wrap(err, "sync no-compact marks"))
+	}
+	s.noCompactMarks = marks
+	s.metrics.noCompactMarkedBlocks.Set(float64(len(marks)))
+
 	return nil
 }
 
+// syncNoCompactMarks reads no-compact marks of all synced blocks.
+func (s *Syncer) syncNoCompactMarks(ctx context.Context) (map[ulid.ULID]*metadata.NoCompactMark, error) {
+	marks, err := block.ReadNoCompactMarks(ctx, s.logger, s.bkt)
+	if err != nil {
+		return nil, err
+	}
+	// Marks of blocks not synced, e.g. deleted or owned by another shard member, are not relevant.
+	for id := range marks {
+		if _, ok := s.blocks[id]; !ok {
+			delete(marks, id)
+		}
+	}
+	return marks, nil
+}
+
+// NoCompactMarks returns no-compact marks of blocks synced by the last SyncMetas call.
+func (s *Syncer) NoCompactMarks() map[ulid.ULID]*metadata.NoCompactMark {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.noCompactMarks
+}
+
 // GroupKey returns a unique identifier for the group the block belongs to. It considers
 // the downsampling resolution and the block's labels.
 func GroupKey(meta metadata.Thanos) string {
@@ -227,10 +289,18 @@ func (s *Syncer) GarbageCollect(ctx context.Context) error {
 
 	begin := time.Now()
 
-	// Run a separate round of garbage collections for each valid resolution.
-	for _, res := range []int64{
-		downsample.ResLevel0, downsample.ResLevel1, downsample.ResLevel2,
-	} {
+	// Run a separate round of garbage collections for each resolution of synced blocks.
+	resolutions := map[int64]struct{}{}
+	for _, m := range s.blocks {
+		resolutions[m.Thanos.Downsample.Resolution] = struct{}{}
+	}
+	sorted := make([]int64, 0, len(resolutions))
+	for res := range resolutions {
+		sorted = append(sorted, res)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	for _, res := range sorted {
 		err := s.garbageCollect(ctx, res)
 		if err != nil {
 			s.metrics.garbageCollectionFailures.Inc()
@@ -423,6 +493,21 @@ func (cg *Group) IDs() (ids []ulid.ULID) {
 	return ids
 }
 
+// metasByMinTime returns metas of all blocks in the group sorted by MinTime. It expects the group to be locked.
+func (cg *Group) metasByMinTime() []*metadata.Meta {
+	metas := make([]*metadata.Meta, 0, len(cg.blocks))
+	for _, m := range cg.blocks {
+		metas = append(metas, m)
+	}
+	sort.Slice(metas, func(i, j int) bool {
+		if metas[i].MinTime == metas[j].MinTime {
+			return metas[i].ULID.Compare(metas[j].ULID) < 0
+		}
+		return metas[i].MinTime < metas[j].MinTime
+	})
+	return metas
+}
+
 // Labels returns the labels that all blocks in the group share.
 func (cg *Group) Labels() labels.Labels {
 	return cg.labels
@@ -434,8 +519,9 @@ func (cg *Group) Resolution() int64 {
 }
 
 // Compact plans and runs a single compaction against the group. The compacted result
-// is uploaded into the bucket the blocks were retrieved from.
-func (cg *Group) Compact(ctx context.Context, dir string, comp tsdb.Compactor) (bool, ulid.ULID, error) {
+// is uploaded into the bucket the blocks were retrieved from. If streamedComp is not nil, non-overlapping blocks are
+// compacted by it without downloading them. Non-zero maxDisk refuses compactions which need more local disk space.
+func (cg *Group) Compact(ctx context.Context, dir string, planner Planner, comp tsdb.Compactor, streamedComp *StreamedCompactor, maxDisk int64) (bool, ulid.ULID, error) {
 	cg.compactionRunsStarted.Inc()
 
 	subDir := filepath.Join(dir, cg.Key())
@@ -453,7 +539,7 @@ func (cg *Group) Compact(ctx context.Context, dir string, comp tsdb.Compactor) (
 		return false, ulid.ULID{}, errors.Wrap(err, "create compaction group dir")
 	}
 
-	shouldRerun, compID, err := cg.compact(ctx, subDir, comp)
+	shouldRerun, compID, err := cg.compact(ctx, subDir, planner, comp, streamedComp, maxDisk)
 	if err != nil {
 		cg.compactionFailures.Inc()
 		return false, ulid.ULID{}, err
@@ -462,6 +548,65 @@ func (cg *Group) Compact(ctx context.Context, dir string, comp tsdb.Compactor) (
 	return shouldRerun, compID, nil
 }
 
+// plannedCompactions returns number of compactions and number of blocks in them, which the group would need to run
+// until there is nothing to compact, assuming all of them succeed. It simulates results of compactions from metas only.
+func (cg *Group) plannedCompactions(ctx context.Context, planner Planner) (compactions int, blocks int, err error) {
+	cg.mtx.Lock()
+	metas := cg.metasByMinTime()
+	cg.mtx.Unlock()
+
+	for {
+		plan, err := planner.Plan(ctx, metas)
+		if err != nil {
+			return 0, 0, err
+		}
+		if len(plan) == 0 {
+			return compactions, blocks, nil
+		}
+		compactions++
+		blocks += len(plan)
+
+		planned := map[ulid.ULID]struct{}{}
+		for _, m := range plan {
+			planned[m.ULID] = struct{}{}
+		}
+		res := []*metadata.Meta{compactedMeta(ulid.MustNew(uint64(compactions), nil), plan)}
+		for _, m := range metas {
+			if _, ok := planned[m.ULID]; !ok {
+				res = append(res, m)
+			}
+		}
+		sort.Slice(res, func(i, j int) bool {
+			return res[i].MinTime < res[j].MinTime
+		})
+		metas = res
+	}
+}
+
+// compactedMeta returns an estimated meta of a block compacted from the given blocks.
+func compactedMeta(id ulid.ULID, metas []*metadata.Meta) *metadata.Meta {
+	res := &metadata.Meta{Thanos: metas[0].Thanos}
+	res.ULID = id
+	res.MinTime, res.MaxTime = metas[0].MinTime, metas[0].MaxTime
+	for _, m := range metas {
+		if m.MinTime < res.MinTime {
+			res.MinTime = m.MinTime
+		}
+		if m.MaxTime > res.MaxTime {
+			res.MaxTime = m.MaxTime
+		}
+		if m.Compaction.Level > res.Compaction.Level {
+			res.Compaction.Level = m.Compaction.Level
+		}
+		res.Compaction.Sources = append(res.Compaction.Sources, m.Compaction.Sources...)
+		res.Stats.NumSeries += m.Stats.NumSeries
+		res.Stats.NumChunks += m.Stats.NumChunks
+		res.Stats.NumSamples += m.Stats.NumSamples
+	}
+	res.Compaction.Level++
+	return res
+}
+
 // Issue347Error is a type wrapper for errors that should invoke repair process for broken block.
 type Issue347Error struct {
 	err error
@@ -483,6 +628,51 @@ func IsIssue347Error(err error) bool {
 	return ok
 }
 
+// UnhealthyBlockError is a type wrapper for errors caused by a block with critical index issues, which cannot be
+// compacted.
+type UnhealthyBlockError struct {
+	err error
+	id  ulid.ULID
+}
+
+func unhealthyBlockError(err error, id ulid.ULID) UnhealthyBlockError {
+	return UnhealthyBlockError{err: err, id: id}
+}
+
+func (e UnhealthyBlockError) Error() string {
+	return e.err.Error()
+}
+
+// unhealthyBlock returns ID of the unhealthy block if the base error, possibly wrapped in HaltError, is an
+// UnhealthyBlockError.
+func unhealthyBlock(err error) (ulid.ULID, bool) {
+	if h, ok := errors.Cause(err).(HaltError); ok {
+		err = h.err
+	}
+	e, ok := errors.Cause(err).(UnhealthyBlockError)
+	return e.id, ok
+}
+
+// DiskBudgetError is a type wrapper for errors of compactions refused because they would need more local disk space
+// than the disk budget.
+type DiskBudgetError struct {
+	err error
+}
+
+func diskBudgetError(err error) DiskBudgetError {
+	return DiskBudgetError{err: err}
+}
+
+func (e DiskBudgetError) Error() string {
+	return e.err.Error()
+}
+
+// IsDiskBudgetError returns true if the base error is a DiskBudgetError.
+func IsDiskBudgetError(err error) bool {
+	_, ok := errors.Cause(err).(DiskBudgetError)
+	return ok
+}
+
 // HaltError is a type wrapper for errors that should halt any further progress on compactions.
 type HaltError struct {
 	err error
@@ -638,7 +828,7 @@ func RepairIssue347(ctx context.Context, logger log.Logger, bkt objstore.Bucket,
 	return nil
 }
 
-func (cg *Group) compact(ctx context.Context, dir string, comp tsdb.Compactor) (shouldRerun bool, compID ulid.ULID, err error) {
+func (cg *Group) compact(ctx context.Context, dir string, planner Planner, comp tsdb.Compactor, streamedComp *StreamedCompactor, maxDisk int64) (shouldRerun bool, compID ulid.ULID, err error) {
 	cg.mtx.Lock()
 	defer cg.mtx.Unlock()
 
@@ -652,24 +842,11 @@ func (cg *Group) compact(ctx context.Context, dir string, comp tsdb.Compactor) (
 		overlappingBlocks = true
 	}
 
-	// Planning a compaction works purely based on the meta.json files in our future group's dir.
-	// So we first dump all our memory block metas into the directory.
-	for _, meta := range cg.blocks {
-		bdir := filepath.Join(dir, meta.ULID.String())
-		if err := os.MkdirAll(bdir, 0777); err != nil {
-			return false, ulid.ULID{}, errors.Wrap(err, "create planning block dir")
-		}
-		if err := metadata.Write(cg.logger, bdir, meta); err != nil {
-			return false, ulid.ULID{}, errors.Wrap(err, "write planning meta file")
-		}
-	}
-
-	// Plan against the written meta.json files.
-	plan, err := comp.Plan(dir)
+	toCompact, err := planner.Plan(ctx, cg.metasByMinTime())
 	if err != nil {
 		return false, ulid.ULID{}, errors.Wrap(err, "plan compaction")
 	}
-	if len(plan) == 0 {
+	if len(toCompact) == 0 {
 		// Nothing to do.
 		return false, ulid.ULID{}, nil
 	}
@@ -678,79 +855,49 @@ func (cg *Group) compact(ctx context.Context, dir string, comp tsdb.Compactor) (
 	// This is one potential source of how we could end up with duplicated chunks.
 	uniqueSources := map[ulid.ULID]struct{}{}
 
-	// Once we have a plan we need to download the actual data.
-	begin := time.Now()
-
-	for _, pdir := range plan {
-		meta, err := metadata.Read(pdir)
-		if err != nil {
-			return false, ulid.ULID{}, errors.Wrapf(err, "read meta from %s", pdir)
-		}
-
+	var plan []string
+	for _, meta := range toCompact {
 		if cg.Key() != GroupKey(meta.Thanos) {
-			return false, ulid.ULID{}, halt(errors.Wrapf(err, "compact planned compaction for mixed groups. group: %s, planned block's group: %s", cg.Key(), GroupKey(meta.Thanos)))
+			return false, ulid.ULID{}, halt(errors.Errorf("compact planned compaction for mixed groups. group: %s, planned block's group: %s", cg.Key(), GroupKey(meta.Thanos)))
 		}
 
 		for _, s := range meta.Compaction.Sources {
 			if _, ok := uniqueSources[s]; ok {
-				return false, ulid.ULID{}, halt(errors.Errorf("overlapping sources detected for plan %v", plan))
+				return false, ulid.ULID{}, halt(errors.Errorf("overlapping sources detected for plan %v", ids(toCompact)))
 			}
 			uniqueSources[s] = struct{}{}
 		}
+		plan = append(plan, filepath.Join(dir, meta.ULID.String()))
+	}
 
-		id, err := ulid.Parse(filepath.Base(pdir))
-		if err != nil {
-			return false, ulid.ULID{}, errors.Wrapf(err, "plan dir %s", pdir)
-		}
-
-		if meta.ULID.Compare(id) != 0 {
-			return false, ulid.ULID{}, errors.Errorf("mismatch between meta %s and dir %s", meta.ULID, id)
+	// Vertical compaction of overlapping blocks needs the TSDB compactor.
+	streamed := streamedComp != nil && !overlappingBlocks
+	if maxDisk > 0 {
+		if err := cg.checkDiskBudget(ctx, toCompact, streamed, maxDisk); err != nil {
+			return false, ulid.ULID{}, err
 		}
+	}
 
-		if err := block.Download(ctx, cg.logger, cg.bkt, id, pdir); err != nil {
-			return false, ulid.ULID{}, retry(errors.Wrapf(err, "download block %s", id))
-		}
+	begin := time.Now()
 
-		// Ensure all input blocks are valid.
-		stats, err := block.GatherIndexIssueStats(cg.logger, filepath.Join(pdir, block.IndexFilename), meta.MinTime, meta.MaxTime)
+	if streamed {
+		compID, err = cg.streamAndCompact(ctx, dir, toCompact, streamedComp)
 		if err != nil {
-			return false, ulid.ULID{}, errors.Wrapf(err, "gather index issues for block %s", pdir)
-		}
-
-		if err := stats.CriticalErr(); err != nil {
-			return false, ulid.ULID{}, halt(errors.Wrapf(err, "block with not healthy index found %s; Compaction level %v; Labels: %v", pdir, meta.Compaction.Level, meta.Thanos.Labels))
-		}
-
-		if err := stats.Issue347OutsideChunksErr(); err != nil {
-			return false, ulid.ULID{}, issue347Error(errors.Wrapf(err, "invalid, but reparable block %s", pdir), meta.ULID)
+			return false, ulid.ULID{}, err
 		}
-
-		if err := stats.PrometheusIssue5372Err(); !cg.acceptMalformedIndex && err != nil {
-			return false, ulid.ULID{}, errors.Wrapf(err,
-				"block id %s, try running with --debug.accept-malformed-index", id)
+	} else {
+		compID, err = cg.downloadAndCompact(ctx, dir, toCompact, comp)
+		if err != nil {
+			return false, ulid.ULID{}, err
 		}
 	}
-	level.Debug(cg.logger).Log("msg", "downloaded and verified blocks",
-		"blocks", fmt.Sprintf("%v", plan), "duration", time.Since(begin))
-
-	begin = time.Now()
-
-	compID, err = comp.Compact(dir, plan, nil)
-	if err != nil {
-		return false, ulid.ULID{}, halt(errors.Wrapf(err, "compact blocks %v", plan))
-	}
 	if compID == (ulid.ULID{}) {
 		// Prometheus compactor found that the compacted block would have no samples.
 		level.Info(cg.logger).Log("msg", "compacted block would have no samples, deleting source blocks", "blocks", fmt.Sprintf("%v", plan))
-		for _, block := range plan {
-			meta, err := metadata.Read(block)
-			if err != nil {
-				level.Warn(cg.logger).Log("msg", "failed to read meta for block", "block", block)
-				continue
-			}
+		for _, meta := range toCompact {
 			if meta.Stats.NumSamples == 0 {
-				if err := cg.deleteBlock(block); err != nil {
-					level.Warn(cg.logger).Log("msg", "failed to delete empty block found during compaction", "block", block)
+				if err := cg.deleteBlock(filepath.Join(dir, meta.ULID.String())); err != nil {
+					level.Warn(cg.logger).Log("msg", "failed to delete empty block found during compaction", "block", meta.ULID)
 				}
 			}
 		}
@@ -762,7 +909,7 @@ func (cg *Group) compact(ctx context.Context, dir string, comp tsdb.Compactor) (
 		cg.verticalCompactions.Inc()
 	}
 	level.Debug(cg.logger).Log("msg", "compacted blocks",
-		"blocks", fmt.Sprintf("%v", plan), "duration", time.Since(begin), "overlapping_blocks", overlappingBlocks)
+		"blocks", fmt.Sprintf("%v", plan), "duration", time.Since(begin), "overlapping_blocks", overlappingBlocks, "streamed", streamed)
 
 	bdir := filepath.Join(dir, compID.String())
 	index := filepath.Join(bdir, block.IndexFilename)
@@ -770,14 +917,15 @@ func (cg *Group) compact(ctx context.Context, dir string, comp tsdb.Compactor) (
 
 	newMeta, err := metadata.InjectThanos(cg.logger, bdir, metadata.Thanos{
 		Labels:     cg.labels.Map(),
-		Downsample: metadata.ThanosDownsample{Resolution: cg.resolution},
+		Downsample: metadata.ThanosDownsample{Resolution: cg.resolution, Aggregates: commonAggregates(toCompact)},
 		Source:     metadata.CompactorSource,
 	}, nil)
 	if err != nil {
 		return false, ulid.ULID{}, errors.Wrapf(err, "failed to finalize the block %s", bdir)
 	}
 
-	if err = os.Remove(filepath.Join(bdir, "tombstones")); err != nil {
+	// Streamed compaction does not write tombstones.
+	if err = os.Remove(filepath.Join(bdir, "tombstones")); err != nil && !os.IsNotExist(err) {
 		return false, ulid.ULID{}, errors.Wrap(err, "remove tombstones")
 	}
 
@@ -818,6 +966,150 @@ func (cg *Group) compact(ctx context.Context, dir string, comp tsdb.Compactor) (
 	return true, compID, nil
 }
 
+// downloadAndCompact downloads and verifies the given blocks and compacts them with the TSDB compactor.
+func (cg *Group) downloadAndCompact(ctx context.Context, dir string, toCompact []*metadata.Meta, comp tsdb.Compactor) (ulid.ULID, error) {
+	// Once we have a plan we need to download the actual data.
+	begin := time.Now()
+
+	var plan []string
+	for _, meta := range toCompact {
+		id := meta.ULID
+		pdir := filepath.Join(dir, id.String())
+		plan = append(plan, pdir)
+
+		if err := block.Download(ctx, cg.logger, cg.bkt, id, pdir); err != nil {
+			return ulid.ULID{}, retry(errors.Wrapf(err, "download block %s", id))
+		}
+
+		// Ensure all input blocks are valid.
+		stats, err := block.GatherIndexIssueStats(cg.logger, filepath.Join(pdir, block.IndexFilename), meta.MinTime, meta.MaxTime)
+		if err != nil {
+			return ulid.ULID{}, errors.Wrapf(err, "gather index issues for block %s", pdir)
+		}
+		if err := cg.verifyIndexIssueStats(stats, meta, pdir); err != nil {
+			return ulid.ULID{}, err
+		}
+	}
+	level.Debug(cg.logger).Log("msg", "downloaded and verified blocks",
+		"blocks", fmt.Sprintf("%v", plan), "duration", time.Since(begin))
+
+	compID, err := comp.Compact(dir, plan, nil)
+	if err != nil {
+		return ulid.ULID{}, halt(errors.Wrapf(err, "compact blocks %v", plan))
+	}
+	return compID, nil
+}
+
+// streamAndCompact verifies the given blocks in the bucket and compacts them with the streamed compactor.
+func (cg *Group) streamAndCompact(ctx context.Context, dir string, toCompact []*metadata.Meta, comp *StreamedCompactor) (ulid.ULID, error) {
+	begin := time.Now()
+
+	for _, meta := range toCompact {
+		// Ensure all input blocks are valid.
+		stats, err := comp.IndexIssueStats(ctx, dir, meta)
+		if err != nil {
+			if IsRetryError(err) {
+				return ulid.ULID{}, err
+			}
+			return ulid.ULID{}, halt(errors.Wrapf(err, "gather index issues for block %s", meta.ULID))
+		}
+		if err := cg.verifyIndexIssueStats(stats, meta, meta.ULID.String()); err != nil {
+			return ulid.ULID{}, err
+		}
+	}
+	level.Debug(cg.logger).Log("msg", "verified blocks for streamed compaction",
+		"blocks", fmt.Sprintf("%v", ids(toCompact)), "duration", time.Since(begin))
+
+	compID, err := comp.Compact(ctx, dir, toCompact)
+	if err != nil {
+		if IsIssue347Error(err) || IsRetryError(err) || IsHaltError(err) {
+			return ulid.ULID{}, err
+		}
+		return ulid.ULID{}, halt(errors.Wrapf(err, "streamed compaction of blocks %v", ids(toCompact)))
+	}
+	return compID, nil
+}
+
+// verifyIndexIssueStats returns an error if index issues of the given block prevent its compaction.
+func (cg *Group) verifyIndexIssueStats(stats block.Stats, meta *metadata.Meta, desc string) error {
+	if err := stats.CriticalErr(); err != nil {
+		return halt(unhealthyBlockError(errors.Wrapf(err, "block with not healthy index found %s; Compaction level %v; Labels: %v", desc, meta.Compaction.Level, meta.Thanos.Labels), meta.ULID))
+	}
+
+	if err := stats.Issue347OutsideChunksErr(); err != nil {
+		return issue347Error(errors.Wrapf(err, "invalid, but reparable block %s", desc), meta.ULID)
+	}
+
+	if err := stats.PrometheusIssue5372Err(); !cg.acceptMalformedIndex && err != nil {
+		return errors.Wrapf(err,
+			"block id %s, try running with --debug.accept-malformed-index", meta.ULID)
+	}
+	return nil
+}
+
+// checkDiskBudget returns DiskBudgetError if compaction of the given blocks needs more local disk space than maxDisk. Downloaded
+// source blocks and the compacted block need about twice the size of source blocks, streamed compaction needs space for
+// the compacted block and index caches of source blocks. The index of a source block without index cache is downloaded
+// to build the cache.
+func (cg *Group) checkDiskBudget(ctx context.Context, toCompact []*metadata.Meta, streamed bool, maxDisk int64) error {
+	var size, cacheSize int64
+	for _, meta := range toCompact {
+		s, err := BlockSize(ctx, cg.bkt, meta.ULID)
+		if err != nil {
+			return retry(errors.Wrapf(err, "get size of block %s", meta.ULID))
+		}
+		size += s
+
+		if !streamed {
+			continue
+		}
+		s, err = indexCacheSize(ctx, cg.bkt, meta.ULID)
+		if err != nil {
+			return retry(errors.Wrapf(err, "get index cache size of block %s", meta.ULID))
+		}
+		cacheSize += s
+	}
+
+	need := 2 * size
+	if streamed {
+		need = size + cacheSize
+	}
+	if need > maxDisk {
+		return diskBudgetError(errors.Errorf("compaction of blocks %v needs %s of local disk exceeding the disk budget of %s; "+
+			"try running with --compact.streaming, a bigger --compact.max-disk or a smaller --compact.max-block-index-size",
+			ids(toCompact), units.Base2Bytes(need), units.Base2Bytes(maxDisk)))
+	}
+	return nil
+}
+
+// commonAggregates returns optional downsampling aggregates available in all given blocks.
+func commonAggregates(metas []*metadata.Meta) []string {
+	if len(metas) == 0 {
+		return nil
+	}
+	var res []string
+	for _, aggr := range metas[0].Thanos.Downsample.Aggregates {
+		common := true
+		for _, m := range metas[1:] {
+			found := false
+			for _, a := range m.Thanos.Downsample.Aggregates {
+				if a == aggr {
+					found = true
+					break
+				}
+			}
+			if !found {
+				common = false
+				break
+			}
+		}
+		if common {
+			res = append(res, aggr)
+		}
+	}
+	return res
+}
+
 func (cg *Group) deleteBlock(b string) error {
 	id, err := ulid.Parse(filepath.Base(b))
 	if err != nil {
@@ -842,31 +1134,56 @@ func (cg *Group) deleteBlock(b string) error {
 type BucketCompactor struct {
 	logger      log.Logger
 	sy          *Syncer
+	planner     Planner
 	comp        tsdb.Compactor
 	compactDir  string
 	bkt         objstore.Bucket
 	concurrency int
+
+	markUnhealthyBlocks bool
+	progress            *Progress
+	quarantine          *Quarantine
+	streamedComp        *StreamedCompactor
+	maxDisk             int64
 }
 
-// NewBucketCompactor creates a new bucket compactor.
+// NewBucketCompactor creates a new bucket compactor. If streaming is enabled, non-overlapping blocks are compacted
+// without downloading them. Non-zero maxDisk refuses compactions which would need more local disk space in bytes.
 func NewBucketCompactor(
 	logger log.Logger,
 	sy *Syncer,
+	planner Planner,
 	comp tsdb.Compactor,
 	compactDir string,
 	bkt objstore.Bucket,
 	concurrency int,
+	markUnhealthyBlocks bool,
+	progress *Progress,
+	quarantine *Quarantine,
+	streaming bool,
+	maxDisk int64,
 ) (*BucketCompactor, error) {
 	if concurrency <= 0 {
 		return nil, errors.Errorf("invalid concurrency level (%d), concurrency level must be > 0", concurrency)
 	}
+	var streamedComp *StreamedCompactor
+	if streaming {
+		streamedComp = NewStreamedCompactor(logger, bkt)
+	}
 	return &BucketCompactor{
 		logger:      logger,
 		sy:          sy,
+		planner:     planner,
 		comp:        comp,
 		compactDir:  compactDir,
 		bkt:         bkt,
 		concurrency: concurrency,
+
+		markUnhealthyBlocks: markUnhealthyBlocks,
+		progress:            progress,
+		quarantine:          quarantine,
+		streamedComp:        streamedComp,
+		maxDisk:             maxDisk,
 	}, nil
 }
 
@@ -897,7 +1214,9 @@ func (c *BucketCompactor) Compact(ctx context.Context) error {
 			go func() {
 				defer wg.Done()
 				for g := range groupChan {
-					shouldRerunGroup, _, err := g.Compact(workCtx, c.compactDir, c.comp)
+					planner := &progressPlanner{Planner: c.planner, progress: c.progress, groupKey: g.Key()}
+					shouldRerunGroup, _, err := g.Compact(workCtx, c.compactDir, planner, c.comp, c.streamedComp, c.maxDisk)
+					c.progress.compactionDone(g.Key(), err)
 					if err == nil {
 						if shouldRerunGroup {
 							mtx.Lock()
@@ -915,6 +1234,33 @@ func (c *BucketCompactor) Compact(ctx context.Context) error {
 							continue
 						}
 					}
+
+					// Instead of halting, exclude the unhealthy block from compaction and continue with the rest.
+					if id, ok := unhealthyBlock(err); ok && c.markUnhealthyBlocks {
+						level.Warn(c.logger).Log("msg", "marking block with unhealthy index for no compaction", "block", id, "group", g.Key(), "err", err)
+						if err := block.MarkForNoCompact(workCtx, c.logger, c.bkt, id, metadata.UnhealthyIndexNoCompactReason, err.Error(), c.sy.metrics.blocksMarkedForNoCompact); err == nil {
+							mtx.Lock()
+							finishedAllGroups = false
+							mtx.Unlock()
+							continue
+						}
+					}
+
+					// Refused compactions do not fail the whole compaction. Their groups are quarantined if enabled,
+					// otherwise skipped until the next compaction pass.
+					if IsDiskBudgetError(err) {
+						c.sy.metrics.compactionsRefused.WithLabelValues(g.Key()).Inc()
+						if c.quarantine == nil {
+							level.Warn(c.logger).Log("msg", "skipping compaction group exceeding the disk budget", "group", g.Key(), "err", err)
+							continue
+						}
+					}
+
+					// Instead of failing the whole compaction, exclude the failing group and continue with the rest.
+					if c.quarantine != nil && workCtx.Err() == nil {
+						c.quarantine.Fail(g.Key(), g.Labels(), err)
+						continue
+					}
 					errChan <- errors.Wrap(err, fmt.Sprintf("compaction failed for group %s", g.Key()))
 					return
 				}
@@ -947,11 +1293,35 @@ func (c *BucketCompactor) Compact(ctx context.Context) error {
 			return errors.Wrap(err, "build compaction groups")
 		}
 
+		var (
+			todoCompactions, todoBlocks int
+			todoGroups                  = make([]*Group, 0, len(groups))
+			statuses                    = make([]*GroupStatus, 0, len(groups))
+			noCompactMarks              = c.sy.NoCompactMarks()
+		)
+		for _, g := range groups {
+			compactions, blocks, err := g.plannedCompactions(ctx, c.planner)
+			if err != nil {
+				if c.quarantine == nil {
+					return errors.Wrapf(err, "plan compactions of group %s", g.Key())
+				}
+				c.quarantine.Fail(g.Key(), g.Labels(), errors.Wrap(err, "plan compactions"))
+				continue
+			}
+			todoGroups = append(todoGroups, g)
+			todoCompactions += compactions
+			todoBlocks += blocks
+			statuses = append(statuses, g.status(compactions, blocks, noCompactMarks))
+		}
+		c.sy.metrics.todoCompactions.Set(float64(todoCompactions))
+		c.sy.metrics.todoCompactionBlocks.Set(float64(todoBlocks))
+		c.progress.setGroups(statuses)
+
 		// Send all groups found during this pass to the compaction workers.
 		var groupErrs terrors.MultiError
 
 	groupLoop:
-		for _, g := range groups {
+		for _, g := range todoGroups {
 			select {
 			case groupErr := <-errChan:
 				groupErrs.Add(groupErr)
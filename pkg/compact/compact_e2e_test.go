@@ -169,7 +169,9 @@ func TestGroup_Compact_e2e(t *testing.T) {
 		comp, err := tsdb.NewLeveledCompactor(ctx, reg, logger, []int64{1000, 3000}, nil)
 		testutil.Ok(t, err)
 
-		bComp, err := NewBucketCompactor(logger, sy, comp, dir, bkt, 2)
+		planner := NewLimitingPlanner(logger, []int64{1000, 3000}, sy.NoCompactMarks, 0, 0)
+		progress := NewProgress()
+		bComp, err := NewBucketCompactor(logger, sy, planner, comp, dir, bkt, 2, false, progress, nil, false, 0)
 		testutil.Ok(t, err)
 
 		// Compaction on empty should not fail.
@@ -286,6 +288,20 @@ func TestGroup_Compact_e2e(t *testing.T) {
 		testutil.Equals(t, 0.0, promtest.ToFloat64(sy.metrics.compactionFailures.WithLabelValues(GroupKey(metas[7].Thanos))))
 		testutil.Equals(t, 0.0, promtest.ToFloat64(sy.metrics.compactionFailures.WithLabelValues(GroupKey(metas[4].Thanos))))
 		testutil.Equals(t, 0.0, promtest.ToFloat64(sy.metrics.compactionFailures.WithLabelValues(GroupKey(metas[5].Thanos))))
+		// Last pass has nothing to compact.
+		testutil.Equals(t, 0.0, promtest.ToFloat64(sy.metrics.todoCompactions))
+		testutil.Equals(t, 0.0, promtest.ToFloat64(sy.metrics.todoCompactionBlocks))
+
+		status := progress.Status()
+		testutil.Equals(t, 4, len(status.Groups))
+		for _, g := range status.Groups {
+			testutil.Equals(t, 0, g.PlannedCompactions)
+			testutil.Assert(t, g.InProgress == nil, "group %s should not have compaction in progress", g.Key)
+			testutil.Assert(t, g.LastError == nil, "group %s should not have failed", g.Key)
+			if g.Key == GroupKey(metas[0].Thanos) || g.Key == GroupKey(metas[7].Thanos) {
+				testutil.Assert(t, g.LastCompaction != nil, "group %s should have been compacted", g.Key)
+			}
+		}
 
 		_, err = os.Stat(dir)
 		testutil.Assert(t, os.IsNotExist(err), "dir %s should be remove after compaction.", dir)
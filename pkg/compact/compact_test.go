@@ -5,6 +5,7 @@ import (
 
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 
+	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
 	terrors "github.com/prometheus/prometheus/tsdb/errors"
 	"github.com/thanos-io/thanos/pkg/testutil"
@@ -66,6 +67,19 @@ func TestRetryError(t *testing.T) {
 	testutil.Assert(t, IsHaltError(err), "not a halt error. Retry should not hide halt error")
 }
 
+func TestUnhealthyBlockError(t *testing.T) {
+	id := ulid.MustNew(1, nil)
+
+	_, ok := unhealthyBlock(halt(errors.New("test")))
+	testutil.Assert(t, !ok, "unhealthy block error")
+
+	err := errors.Wrap(halt(errors.Wrap(unhealthyBlockError(errors.New("test"), id), "something")), "something2")
+	testutil.Assert(t, IsHaltError(err), "not a halt error")
+	got, ok := unhealthyBlock(err)
+	testutil.Assert(t, ok, "not an unhealthy block error")
+	testutil.Equals(t, id, got)
+}
+
 func TestGroupKey(t *testing.T) {
 	for _, tcase := range []struct {
 		input    metadata.Thanos
@@ -15,12 +15,16 @@ const ChunkEncAggr = chunkenc.Encoding(0xff)
 // Not all aggregates must be present.
 type AggrChunk []byte
 
-// EncodeAggrChunk encodes a new aggregate chunk from the array of chunks for each aggregate.
-// Each array entry corresponds to the respective AggrType number.
-func EncodeAggrChunk(chks [5]chunkenc.Chunk) *AggrChunk {
+// EncodeAggrChunk encodes a new aggregate chunk from the slice of chunks for each aggregate.
+// Each slice entry corresponds to the respective AggrType number. Unset optional aggregates at the end of
+// the slice are not encoded, so that chunks without them can be read by older versions.
+func EncodeAggrChunk(chks []chunkenc.Chunk) *AggrChunk {
 	var b []byte
 	buf := [8]byte{}
 
+	for len(chks) > int(AggrCounter)+1 && chks[len(chks)-1] == nil {
+		chks = chks[:len(chks)-1]
+	}
 	for _, c := range chks {
 		// Unset aggregates are marked with a zero length entry.
 		if c == nil {
@@ -71,6 +75,10 @@ func (c AggrChunk) Get(t AggrType) (chunkenc.Chunk, error) {
 	var x []byte
 
 	for i := AggrType(0); i <= t; i++ {
+		// Chunks encoded before optional aggregates were added end after the last standard aggregate.
+		if len(b) == 0 && i > AggrCounter {
+			return nil, ErrAggrNotExist
+		}
 		l, n := binary.Uvarint(b)
 		if n < 1 || len(b[n:]) < int(l)+1 {
 			return nil, errors.New("invalid size")
@@ -99,8 +107,27 @@ const (
 	AggrMin
 	AggrMax
 	AggrCounter
+	// AggrLast is an optional aggregate holding the last sample value of each window.
+	AggrLast
+	// AggrQuantiles is an optional aggregate holding a quantile sketch of each window, see QuantileSketchSize.
+	AggrQuantiles
+
+	numAggrTypes = int(AggrQuantiles) + 1
 )
 
+// OptionalAggrTypes are aggregates which are produced by downsampling only if requested.
+var OptionalAggrTypes = []AggrType{AggrLast, AggrQuantiles}
+
+// ParseOptionalAggrType returns the optional aggregate of the given name.
+func ParseOptionalAggrType(name string) (AggrType, error) {
+	for _, t := range OptionalAggrTypes {
+		if t.String() == name {
+			return t, nil
+		}
+	}
+	return 0, errors.Errorf("unknown optional aggregate %q", name)
+}
+
 func (t AggrType) String() string {
 	switch t {
 	case AggrCount:
@@ -113,6 +140,10 @@ func (t AggrType) String() string {
 		return "max"
 	case AggrCounter:
 		return "counter"
+	case AggrLast:
+		return "last"
+	case AggrQuantiles:
+		return "quantiles"
 	}
 	return "<unknown>"
 }
@@ -36,7 +36,7 @@ func TestAggrChunk(t *testing.T) {
 	}
 
 	var res [5][]sample
-	ac := EncodeAggrChunk(chks)
+	ac := EncodeAggrChunk(chks[:])
 
 	for _, at := range []AggrType{AggrCount, AggrSum, AggrMin, AggrMax, AggrCounter} {
 		if c, err := ac.Get(at); err != ErrAggrNotExist {
@@ -45,4 +45,10 @@ func TestAggrChunk(t *testing.T) {
 		}
 	}
 	testutil.Equals(t, input, res)
+
+	// Optional aggregates are absent from chunks encoded without them.
+	for _, at := range OptionalAggrTypes {
+		_, err := ac.Get(at)
+		testutil.Equals(t, ErrAggrNotExist, err)
+	}
 }
@@ -5,6 +5,7 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"sort"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -34,13 +35,20 @@ const (
 	DownsampleRange1 = 10 * 24 * 60 * 60 * 1000 // 10 days.
 )
 
+// QuantileSketchSize is the maximum number of samples of a quantile sketch of a single window. Samples of the sketch
+// are quantiles of the window at evenly spaced ranks, so that each of them represents the same share of raw samples
+// of the window. Windows with fewer raw samples keep all of them.
+const QuantileSketchSize = 10
+
 // Downsample downsamples the given block. It writes a new block into dir and returns its ID.
+// Optional aggregates are produced only if they are given and, for already downsampled blocks, if the block has them.
 func Downsample(
 	logger log.Logger,
 	origMeta *metadata.Meta,
 	b tsdb.BlockReader,
 	dir string,
 	resolution int64,
+	aggrs ...AggrType,
 ) (id ulid.ULID, err error) {
 	if origMeta.Thanos.Downsample.Resolution >= resolution {
 		return id, errors.New("target resolution not lower than existing one")
@@ -82,9 +90,17 @@ func Downsample(
 	newMeta.Thanos.Downsample.Resolution = resolution
 	newMeta.ULID = uid
 
+	if origMeta.Thanos.Downsample.Resolution > 0 {
+		aggrs = availableAggrs(origMeta.Thanos.Downsample.Aggregates, aggrs)
+	}
+	newMeta.Thanos.Downsample.Aggregates = nil
+	for _, at := range aggrs {
+		newMeta.Thanos.Downsample.Aggregates = append(newMeta.Thanos.Downsample.Aggregates, at.String())
+	}
+
 	// Writes downsampled chunks right into the files, avoiding excess memory allocation.
 	// Flushes index and meta data after aggregations.
-	streamedBlockWriter, err := NewStreamedBlockWriter(blockDir, indexr, logger, newMeta)
+	streamedBlockWriter, err := NewStreamedBlockWriter(blockDir, indexr.Symbols(), logger, newMeta)
 	if err != nil {
 		return id, errors.Wrap(err, "get streamed block writer")
 	}
@@ -130,7 +146,7 @@ func Downsample(
 					return id, errors.Wrapf(err, "expand chunk %d, series %d", c.Ref, postings.At())
 				}
 			}
-			if err := streamedBlockWriter.WriteSeries(lset, downsampleRaw(all, resolution)); err != nil {
+			if err := streamedBlockWriter.WriteSeries(lset, downsampleRaw(all, resolution, aggrs...)); err != nil {
 				return id, errors.Wrapf(err, "downsample raw data, series: %d", postings.At())
 			}
 		} else {
@@ -145,6 +161,7 @@ func Downsample(
 				chks[len(chks)-1].MaxTime,
 				origMeta.Thanos.Downsample.Resolution,
 				resolution,
+				aggrs...,
 			)
 			if err != nil {
 				return id, errors.Wrapf(err, "downsample aggregate block, series: %d", postings.At())
@@ -162,6 +179,20 @@ func Downsample(
 	return
 }
 
+// availableAggrs returns the given optional aggregates which are among the given names of available aggregates.
+func availableAggrs(available []string, aggrs []AggrType) []AggrType {
+	var res []AggrType
+	for _, at := range aggrs {
+		for _, name := range available {
+			if at.String() == name {
+				res = append(res, at)
+				break
+			}
+		}
+	}
+	return res
+}
+
 // currentWindow returns the end timestamp of the window that t falls into.
 func currentWindow(t, r int64) int64 {
 	// The next timestamp is the next number after s.t that's aligned with window.
@@ -250,11 +281,11 @@ type aggrChunkBuilder struct {
 	mint, maxt int64
 	added      int
 
-	chunks [5]chunkenc.Chunk
-	apps   [5]chunkenc.Appender
+	chunks [numAggrTypes]chunkenc.Chunk
+	apps   [numAggrTypes]chunkenc.Appender
 }
 
-func newAggrChunkBuilder() *aggrChunkBuilder {
+func newAggrChunkBuilder(aggrs ...AggrType) *aggrChunkBuilder {
 	b := &aggrChunkBuilder{
 		mint: math.MaxInt64,
 		maxt: math.MinInt64,
@@ -264,6 +295,9 @@ func newAggrChunkBuilder() *aggrChunkBuilder {
 	b.chunks[AggrMin] = chunkenc.NewXORChunk()
 	b.chunks[AggrMax] = chunkenc.NewXORChunk()
 	b.chunks[AggrCounter] = chunkenc.NewXORChunk()
+	for _, at := range aggrs {
+		b.chunks[at] = chunkenc.NewXORChunk()
+	}
 
 	for i, c := range b.chunks {
 		if c != nil {
@@ -285,6 +319,9 @@ func (b *aggrChunkBuilder) add(t int64, aggr *aggregator) {
 	b.apps[AggrMax].Append(t, aggr.max)
 	b.apps[AggrCount].Append(t, float64(aggr.count))
 	b.apps[AggrCounter].Append(t, aggr.counter)
+	if b.apps[AggrLast] != nil {
+		b.apps[AggrLast].Append(t, aggr.last)
+	}
 
 	b.added++
 }
@@ -293,12 +330,12 @@ func (b *aggrChunkBuilder) encode() chunks.Meta {
 	return chunks.Meta{
 		MinTime: b.mint,
 		MaxTime: b.maxt,
-		Chunk:   EncodeAggrChunk(b.chunks),
+		Chunk:   EncodeAggrChunk(b.chunks[:]),
 	}
 }
 
 // downsampleRaw create a series of aggregation chunks for the given sample data.
-func downsampleRaw(data []sample, resolution int64) []chunks.Meta {
+func downsampleRaw(data []sample, resolution int64, aggrs ...AggrType) []chunks.Meta {
 	if len(data) == 0 {
 		return nil
 	}
@@ -307,10 +344,10 @@ func downsampleRaw(data []sample, resolution int64) []chunks.Meta {
 	// We assume a raw resolution of 1 minute. In practice it will often be lower
 	// but this is sufficient for our heuristic to produce well-sized chunks.
 	numChunks := targetChunkCount(mint, maxt, 1*60*1000, resolution, len(data))
-	return downsampleRawLoop(data, resolution, numChunks)
+	return downsampleRawLoop(data, resolution, numChunks, aggrs...)
 }
 
-func downsampleRawLoop(data []sample, resolution int64, numChunks int) []chunks.Meta {
+func downsampleRawLoop(data []sample, resolution int64, numChunks int, aggrs ...AggrType) []chunks.Meta {
 	batchSize := (len(data) / numChunks) + 1
 	chks := make([]chunks.Meta, 0, numChunks)
 
@@ -329,7 +366,7 @@ func downsampleRawLoop(data []sample, resolution int64, numChunks int) []chunks.
 		batch := data[:j]
 		data = data[j:]
 
-		ab := newAggrChunkBuilder()
+		ab := newAggrChunkBuilder(aggrs...)
 
 		// Encode first raw value; see CounterSeriesIterator.
 		ab.apps[AggrCounter].Append(batch[0].t, batch[0].v)
@@ -339,6 +376,14 @@ func downsampleRawLoop(data []sample, resolution int64, numChunks int) []chunks.
 		// Encode last raw value; see CounterSeriesIterator.
 		ab.apps[AggrCounter].Append(lastT, batch[len(batch)-1].v)
 
+		if ab.apps[AggrQuantiles] != nil {
+			weighted := make([]weightedSample, 0, len(batch))
+			for _, s := range batch {
+				weighted = append(weighted, weightedSample{t: s.t, v: s.v, w: 1})
+			}
+			downsampleQuantiles(weighted, resolution, ab.apps[AggrQuantiles])
+		}
+
 		chks = append(chks, ab.encode())
 	}
 
@@ -380,17 +425,142 @@ func downsampleBatch(data []sample, resolution int64, add func(int64, *aggregato
 	return nextT
 }
 
+// weightedSample is a sample of a quantile sketch representing w raw samples.
+type weightedSample struct {
+	t int64
+	v float64
+	w float64
+}
+
+// downsampleQuantiles appends quantile sketches of the given samples to app for the same windows as downsampleBatch
+// aggregates. The sketch of a window ending at t is encoded as samples at timestamps directly preceding t, so that
+// quantiles over the sketches of a time range approximate quantiles over its raw samples.
+func downsampleQuantiles(data []weightedSample, resolution int64, app chunkenc.Appender) {
+	var (
+		window []weightedSample
+		nextT  = int64(-1)
+		after  int64
+		lastT  = data[len(data)-1].t
+	)
+	for _, s := range data {
+		// Unlike other aggregates, quantiles cannot represent NaN values, including stale markers.
+		if math.IsNaN(s.v) {
+			continue
+		}
+		if s.t > nextT {
+			if nextT != -1 {
+				appendQuantileSketch(app, window, nextT, after)
+			}
+			// Sketch samples must stay within their window and after the previous one.
+			if windowStart := s.t - s.t%resolution - 1; nextT < windowStart {
+				after = windowStart
+			} else {
+				after = nextT
+			}
+			window = window[:0]
+			nextT = currentWindow(s.t, resolution)
+			// Limit next timestamp to not go beyond the batch, see downsampleBatch.
+			if nextT > lastT {
+				nextT = lastT
+			}
+		}
+		window = append(window, s)
+	}
+	if len(window) > 0 {
+		appendQuantileSketch(app, window, nextT, after)
+	}
+}
+
+// appendQuantileSketch appends the sketch of the given window ending at t, with all its samples after the given
+// timestamp.
+func appendQuantileSketch(app chunkenc.Appender, window []weightedSample, t, after int64) {
+	var total float64
+	for _, s := range window {
+		total += s.w
+	}
+	sort.Slice(window, func(i, j int) bool {
+		return window[i].v < window[j].v
+	})
+
+	n := QuantileSketchSize
+	if c := int(math.Ceil(total)); c < n {
+		n = c
+	}
+	if int64(n) > t-after {
+		n = int(t - after)
+	}
+
+	var (
+		j   int
+		cum = window[0].w
+	)
+	for i := 0; i < n; i++ {
+		// Each sample of the sketch is the quantile at the middle of its share of the window.
+		rank := float64(2*i+1) * total / float64(2*n)
+		for cum < rank && j < len(window)-1 {
+			j++
+			cum += window[j].w
+		}
+		app.Append(t-int64(n-1-i), window[j].v)
+	}
+}
+
+// expandQuantileSketches reads quantile sketches of the given aggregate chunk and appends their samples to buf,
+// weighted by the number of raw samples of their window, which is given by the count aggregate.
+func expandQuantileSketches(chk *AggrChunk, buf *[]weightedSample) error {
+	qc, err := chk.Get(AggrQuantiles)
+	if err != nil {
+		return err
+	}
+	cc, err := chk.Get(AggrCount)
+	if err != nil {
+		return err
+	}
+	var counts, points []sample
+	if err := expandChunkIterator(cc.Iterator(nil), &counts); err != nil {
+		return err
+	}
+	if err := expandChunkIterator(qc.Iterator(nil), &points); err != nil {
+		return err
+	}
+
+	i := 0
+	for _, c := range counts {
+		// Samples of the sketch of a window precede the end of the window, where its count is.
+		j := i
+		for ; j < len(points) && points[j].t <= c.t; j++ {
+		}
+		for _, p := range points[i:j] {
+			*buf = append(*buf, weightedSample{t: p.t, v: p.v, w: c.v / float64(j-i)})
+		}
+		i = j
+	}
+	return nil
+}
+
+// hasAggr returns true if all given chunks have the given aggregate.
+func hasAggr(chks []*AggrChunk, at AggrType) (bool, error) {
+	for _, chk := range chks {
+		if _, err := chk.Get(at); err == ErrAggrNotExist {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
 // downsampleAggr downsamples a sequence of aggregation chunks to the given resolution.
-func downsampleAggr(chks []*AggrChunk, buf *[]sample, mint, maxt, inRes, outRes int64) ([]chunks.Meta, error) {
+func downsampleAggr(chks []*AggrChunk, buf *[]sample, mint, maxt, inRes, outRes int64, aggrs ...AggrType) ([]chunks.Meta, error) {
 	var numSamples int
 	for _, c := range chks {
 		numSamples += c.NumSamples()
 	}
 	numChunks := targetChunkCount(mint, maxt, inRes, outRes, numSamples)
-	return downsampleAggrLoop(chks, buf, outRes, numChunks)
+	return downsampleAggrLoop(chks, buf, outRes, numChunks, aggrs...)
 }
 
-func downsampleAggrLoop(chks []*AggrChunk, buf *[]sample, resolution int64, numChunks int) ([]chunks.Meta, error) {
+func downsampleAggrLoop(chks []*AggrChunk, buf *[]sample, resolution int64, numChunks int, aggrs ...AggrType) ([]chunks.Meta, error) {
 	// We downsample aggregates only along chunk boundaries. This is required
 	// for counters to be downsampled correctly since a chunk's first and last
 	// counter values are the true values of the original series. We need
@@ -406,7 +576,7 @@ func downsampleAggrLoop(chks []*AggrChunk, buf *[]sample, resolution int64, numC
 		part := chks[:j]
 		chks = chks[j:]
 
-		chk, err := downsampleAggrBatch(part, buf, resolution)
+		chk, err := downsampleAggrBatch(part, buf, resolution, aggrs...)
 		if err != nil {
 			return nil, err
 		}
@@ -436,7 +606,7 @@ func expandChunkIterator(it chunkenc.Iterator, buf *[]sample) error {
 	return it.Err()
 }
 
-func downsampleAggrBatch(chks []*AggrChunk, buf *[]sample, resolution int64) (chk chunks.Meta, err error) {
+func downsampleAggrBatch(chks []*AggrChunk, buf *[]sample, resolution int64, aggrs ...AggrType) (chk chunks.Meta, err error) {
 	ab := &aggrChunkBuilder{}
 	mint, maxt := int64(math.MaxInt64), int64(math.MinInt64)
 	var reuseIt chunkenc.Iterator
@@ -496,6 +666,38 @@ func downsampleAggrBatch(chks []*AggrChunk, buf *[]sample, resolution int64) (ch
 		return chk, err
 	}
 
+	// Optional aggregates are produced only if all chunks have them, otherwise they would not cover the whole chunk.
+	for _, at := range aggrs {
+		ok, err := hasAggr(chks, at)
+		if err != nil {
+			return chk, err
+		}
+		if !ok {
+			continue
+		}
+		switch at {
+		case AggrLast:
+			if err := do(AggrLast, func(a *aggregator) float64 {
+				return a.last
+			}); err != nil {
+				return chk, err
+			}
+		case AggrQuantiles:
+			var weighted []weightedSample
+			for _, c := range chks {
+				if err := expandQuantileSketches(c, &weighted); err != nil {
+					return chk, err
+				}
+			}
+			if len(weighted) == 0 {
+				continue
+			}
+			ab.chunks[AggrQuantiles] = chunkenc.NewXORChunk()
+			ab.apps[AggrQuantiles], _ = ab.chunks[AggrQuantiles].Appender()
+			downsampleQuantiles(weighted, resolution, ab.apps[AggrQuantiles])
+		}
+	}
+
 	// Handle counters by reading them properly.
 	acs := make([]chunkenc.Iterator, 0, len(chks))
 	for _, achk := range chks {
@@ -223,8 +223,140 @@ func TestDownsampleAggr(t *testing.T) {
 	testDownsample(t, input, &meta, 500)
 }
 
+func TestDownsampleRawExtraAggregates(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	staleMarker := math.Float64frombits(value.StaleNaN)
+
+	input := []*downsampleTestSet{
+		{
+			lset: labels.FromStrings("__name__", "a"),
+			inRaw: []sample{
+				{20, 1}, {40, 2}, {60, 3}, {80, 1}, {100, 2}, {101, staleMarker}, {120, 5}, {180, 10}, {250, 1},
+			},
+			output: map[AggrType][]sample{
+				AggrCount:     {{99, 4}, {199, 3}, {250, 1}},
+				AggrSum:       {{99, 7}, {199, 17}, {250, 1}},
+				AggrMin:       {{99, 1}, {199, 2}, {250, 1}},
+				AggrMax:       {{99, 3}, {199, 10}, {250, 1}},
+				AggrCounter:   {{20, 1}, {99, 4}, {199, 13}, {250, 14}, {250, 1}},
+				AggrLast:      {{99, 1}, {199, 10}, {250, 1}},
+				AggrQuantiles: {{96, 1}, {97, 1}, {98, 2}, {99, 3}, {197, 2}, {198, 5}, {199, 10}, {250, 1}},
+			},
+		},
+	}
+	meta := testDownsample(t, input, &metadata.Meta{BlockMeta: tsdb.BlockMeta{MinTime: 0, MaxTime: 250}}, 100, AggrLast, AggrQuantiles)
+	testutil.Equals(t, []string{"last", "quantiles"}, meta.Thanos.Downsample.Aggregates)
+}
+
+func TestDownsampleAggrExtraAggregates(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	inAggr := map[AggrType][]sample{
+		AggrCount:   {{199, 5}, {299, 1}, {399, 10}, {400, 3}, {499, 10}, {699, 0}, {999, 100}},
+		AggrSum:     {{199, 5}, {299, 1}, {399, 10}, {400, 3}, {499, 10}, {699, 0}, {999, 100}},
+		AggrMin:     {{199, 5}, {299, 1}, {399, 10}, {400, -3}, {499, 10}, {699, 0}, {999, 100}},
+		AggrMax:     {{199, 5}, {299, 1}, {399, 10}, {400, -3}, {499, 10}, {699, 0}, {999, 100}},
+		AggrCounter: {{99, 100}, {299, 150}, {499, 210}, {499, 10}, {599, 20}, {799, 50}, {999, 120}, {999, 50}},
+		AggrLast:    {{199, 1}, {299, 2}, {399, 3}, {400, 4}, {499, 5}, {699, 6}, {999, 7}},
+		// Single sample sketches weighted by counts of their windows.
+		AggrQuantiles: {{199, 5}, {299, 1}, {399, 10}, {400, 3}, {499, 10}, {999, 100}},
+	}
+	output := map[AggrType][]sample{
+		AggrCount:   {{499, 29}, {999, 100}},
+		AggrSum:     {{499, 29}, {999, 100}},
+		AggrMin:     {{499, -3}, {999, 0}},
+		AggrMax:     {{499, 10}, {999, 100}},
+		AggrCounter: {{99, 100}, {499, 210}, {999, 320}, {999, 50}},
+		AggrLast:    {{499, 5}, {999, 7}},
+		AggrQuantiles: {
+			{490, 3}, {491, 5}, {492, 5}, {493, 10}, {494, 10}, {495, 10}, {496, 10}, {497, 10}, {498, 10}, {499, 10},
+			{990, 100}, {991, 100}, {992, 100}, {993, 100}, {994, 100}, {995, 100}, {996, 100}, {997, 100}, {998, 100}, {999, 100},
+		},
+	}
+
+	for _, tcase := range []struct {
+		name       string
+		aggregates []string
+		expected   []string
+	}{
+		{name: "all available", aggregates: []string{"last", "quantiles"}, expected: []string{"last", "quantiles"}},
+		{name: "only last available", aggregates: []string{"last"}, expected: []string{"last"}},
+		{name: "none available"},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			// Optional aggregates are expected only if the input block has them.
+			out := map[AggrType][]sample{}
+			for _, at := range append([]AggrType{AggrCount, AggrSum, AggrMin, AggrMax, AggrCounter}, availableAggrs(tcase.expected, OptionalAggrTypes)...) {
+				out[at] = output[at]
+			}
+			var meta metadata.Meta
+			meta.Thanos.Downsample.Resolution = 10
+			meta.Thanos.Downsample.Aggregates = tcase.aggregates
+			meta.BlockMeta = tsdb.BlockMeta{MinTime: 99, MaxTime: 1000}
+
+			input := []*downsampleTestSet{{lset: labels.FromStrings("__name__", "a"), inAggr: inAggr, output: out}}
+			newMeta := testDownsample(t, input, &meta, 500, AggrLast, AggrQuantiles)
+			testutil.Equals(t, tcase.expected, newMeta.Thanos.Downsample.Aggregates)
+		})
+	}
+}
+
+func TestDownsampleQuantiles(t *testing.T) {
+	for _, tcase := range []struct {
+		name       string
+		in         []weightedSample
+		resolution int64
+		expected   []sample
+	}{
+		{
+			name:       "more raw samples than sketch size",
+			resolution: 100,
+			in: func() (res []weightedSample) {
+				for i := 0; i < 100; i++ {
+					// Values in reverse order of timestamps.
+					res = append(res, weightedSample{t: int64(i), v: float64(100 - i), w: 1})
+				}
+				return res
+			}(),
+			expected: []sample{{90, 5}, {91, 15}, {92, 25}, {93, 35}, {94, 45}, {95, 55}, {96, 65}, {97, 75}, {98, 85}, {99, 95}},
+		},
+		{
+			// Last window ends with the last sample.
+			name:       "weighted samples",
+			in:         []weightedSample{{t: 10, v: 2, w: 1}, {t: 20, v: 1, w: 3}},
+			resolution: 100,
+			expected:   []sample{{17, 1}, {18, 1}, {19, 1}, {20, 2}},
+		},
+		{
+			name:       "sketches bounded by windows",
+			in:         []weightedSample{{t: 200, v: 1, w: 10}, {t: 203, v: 2, w: 10}, {t: 205, v: 3, w: 10}},
+			resolution: 4,
+			expected:   []sample{{200, 1}, {201, 1}, {202, 2}, {203, 2}, {204, 3}, {205, 3}},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			chk := chunkenc.NewXORChunk()
+			app, err := chk.Appender()
+			testutil.Ok(t, err)
+
+			downsampleQuantiles(tcase.in, tcase.resolution, app)
+
+			var got []sample
+			testutil.Ok(t, expandChunkIterator(chk.Iterator(nil), &got))
+			testutil.Equals(t, tcase.expected, got)
+		})
+	}
+}
+
 func encodeTestAggrSeries(v map[AggrType][]sample) chunks.Meta {
-	b := newAggrChunkBuilder()
+	var optional []AggrType
+	for _, at := range OptionalAggrTypes {
+		if _, ok := v[at]; ok {
+			optional = append(optional, at)
+		}
+	}
+	b := newAggrChunkBuilder(optional...)
 
 	for at, d := range v {
 		for _, s := range d {
@@ -244,7 +376,8 @@ type downsampleTestSet struct {
 
 // testDownsample inserts the input into a block and invokes the downsampler with the given resolution.
 // The chunk ranges within the input block are aligned at 500 time units.
-func testDownsample(t *testing.T, data []*downsampleTestSet, meta *metadata.Meta, resolution int64) {
+// It returns the meta of the downsampled block.
+func testDownsample(t *testing.T, data []*downsampleTestSet, meta *metadata.Meta, resolution int64, aggrs ...AggrType) *metadata.Meta {
 	t.Helper()
 
 	dir, err := ioutil.TempDir("", "downsample-raw")
@@ -279,10 +412,10 @@ func testDownsample(t *testing.T, data []*downsampleTestSet, meta *metadata.Meta
 		mb.addSeries(ser)
 	}
 
-	id, err := Downsample(log.NewNopLogger(), meta, mb, dir, resolution)
+	id, err := Downsample(log.NewNopLogger(), meta, mb, dir, resolution, aggrs...)
 	testutil.Ok(t, err)
 
-	_, err = metadata.Read(filepath.Join(dir, id.String()))
+	newMeta, err := metadata.Read(filepath.Join(dir, id.String()))
 	testutil.Ok(t, err)
 
 	exp := map[uint64]map[AggrType][]sample{}
@@ -316,7 +449,7 @@ func testDownsample(t *testing.T, data []*downsampleTestSet, meta *metadata.Meta
 			chk, err := chunkr.Chunk(c.Ref)
 			testutil.Ok(t, err)
 
-			for _, at := range []AggrType{AggrCount, AggrSum, AggrMin, AggrMax, AggrCounter} {
+			for _, at := range allTestAggrTypes {
 				c, err := chk.(*AggrChunk).Get(at)
 				if err == ErrAggrNotExist {
 					continue
@@ -333,13 +466,16 @@ func testDownsample(t *testing.T, data []*downsampleTestSet, meta *metadata.Meta
 	testutil.Equals(t, len(exp), len(got))
 
 	for h, ser := range exp {
-		for _, at := range []AggrType{AggrCount, AggrSum, AggrMin, AggrMax, AggrCounter} {
+		for _, at := range allTestAggrTypes {
 			t.Logf("series %d, type %s", h, at)
 			testutil.Equals(t, ser[at], got[h][at])
 		}
 	}
+	return newMeta
 }
 
+var allTestAggrTypes = append([]AggrType{AggrCount, AggrSum, AggrMin, AggrMax, AggrCounter}, OptionalAggrTypes...)
+
 func TestAverageChunkIterator(t *testing.T) {
 	sum := []sample{{100, 30}, {200, 40}, {300, 5}, {400, -10}}
 	cnt := []sample{{100, 1}, {200, 5}, {300, 2}, {400, 10}}
@@ -0,0 +1,146 @@
+package downsample
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+)
+
+// Level is a downsampling resolution together with the minimum time range of blocks of the previous level, i.e. of the
+// next higher resolution, which are downsampled to it, and the retention of its blocks.
+// The minimum time range is not the age of blocks: blocks reach it only by compaction, so it must not be bigger than
+// the largest compaction range.
+type Level struct {
+	Resolution     int64 // In milliseconds.
+	MinSourceRange int64 // In milliseconds.
+	// Retention is how long to retain blocks of the level. Zero means the level has no retention of its own.
+	Retention time.Duration
+}
+
+func (l Level) String() string {
+	s := fmt.Sprintf("%s:%s", ResolutionString(l.Resolution), model.Duration(time.Duration(l.MinSourceRange)*time.Millisecond))
+	if l.Retention != 0 {
+		s += ":" + model.Duration(l.Retention).String()
+	}
+	return s
+}
+
+// Levels are downsampling levels ordered from the highest to the lowest resolution. Raw data is not a level, it is
+// downsampled to the first one.
+type Levels []Level
+
+// DefaultLevels are the standard 5m and 1h resolutions, downsampled from blocks of 40 hours and 10 days respectively.
+var DefaultLevels = Levels{
+	{Resolution: ResLevel1, MinSourceRange: DownsampleRange0},
+	{Resolution: ResLevel2, MinSourceRange: DownsampleRange1},
+}
+
+// ParseLevels parses levels in the <resolution>:<min source range>[:<retention>] format, e.g. 5m:40h or 5m:40h:1y.
+func ParseLevels(specs []string) (Levels, error) {
+	levels := make(Levels, 0, len(specs))
+	for _, spec := range specs {
+		parts := strings.Split(spec, ":")
+		if len(parts) != 2 && len(parts) != 3 {
+			return nil, errors.Errorf("invalid downsampling level %q, expected <resolution>:<min source range>[:<retention>]", spec)
+		}
+		res, err := model.ParseDuration(parts[0])
+		if err != nil {
+			return nil, errors.Wrapf(err, "resolution of downsampling level %q", spec)
+		}
+		minRange, err := model.ParseDuration(parts[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "min source range of downsampling level %q", spec)
+		}
+		var retention model.Duration
+		if len(parts) == 3 {
+			retention, err = model.ParseDuration(parts[2])
+			if err != nil {
+				return nil, errors.Wrapf(err, "retention of downsampling level %q", spec)
+			}
+		}
+		levels = append(levels, Level{
+			Resolution:     int64(time.Duration(res) / time.Millisecond),
+			MinSourceRange: int64(time.Duration(minRange) / time.Millisecond),
+			Retention:      time.Duration(retention),
+		})
+	}
+	return levels, levels.Validate()
+}
+
+// Validate returns an error if resolutions of levels do not grow or if they are not multiples of each other, which
+// would make windows of downsampled data misaligned.
+func (l Levels) Validate() error {
+	var prev Level
+	for _, lvl := range l {
+		if lvl.Resolution <= prev.Resolution {
+			return errors.Errorf("resolution of downsampling level %s must be bigger than %s", lvl, ResolutionString(prev.Resolution))
+		}
+		if prev.Resolution > 0 && lvl.Resolution%prev.Resolution != 0 {
+			return errors.Errorf("resolution of downsampling level %s must be a multiple of %s", lvl, ResolutionString(prev.Resolution))
+		}
+		if lvl.MinSourceRange < lvl.Resolution {
+			return errors.Errorf("min source range of downsampling level %s must not be smaller than its resolution", lvl)
+		}
+		prev = lvl
+	}
+	return nil
+}
+
+// ValidateMaxRange returns an error if the min source range of some level is bigger than the given largest compaction
+// range in milliseconds. Blocks never reach such a range, so the level would never be produced.
+func (l Levels) ValidateMaxRange(maxRange int64) error {
+	for _, lvl := range l {
+		if lvl.MinSourceRange > maxRange {
+			return errors.Errorf("min source range of downsampling level %s is bigger than the largest compaction range %s, blocks would never be downsampled to it",
+				lvl, model.Duration(time.Duration(maxRange)*time.Millisecond))
+		}
+	}
+	return nil
+}
+
+// Next returns the level to which blocks of the given resolution are downsampled. It returns false if blocks of the
+// resolution are not downsampled further or if the resolution is not known.
+func (l Levels) Next(resolution int64) (Level, bool) {
+	if resolution == ResLevel0 {
+		if len(l) == 0 {
+			return Level{}, false
+		}
+		return l[0], true
+	}
+	for i := 0; i+1 < len(l); i++ {
+		if l[i].Resolution == resolution {
+			return l[i+1], true
+		}
+	}
+	return Level{}, false
+}
+
+// Resolutions returns all resolutions including raw data, from the highest to the lowest one.
+func (l Levels) Resolutions() []int64 {
+	res := []int64{ResLevel0}
+	for _, lvl := range l {
+		res = append(res, lvl.Resolution)
+	}
+	return res
+}
+
+// Known returns true if the given resolution is raw data or one of the levels.
+func (l Levels) Known(resolution int64) bool {
+	for _, r := range l.Resolutions() {
+		if r == resolution {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolutionString returns a human readable form of the given resolution, e.g. raw or 5m.
+func ResolutionString(resolution int64) string {
+	if resolution == ResLevel0 {
+		return "raw"
+	}
+	return model.Duration(time.Duration(resolution) * time.Millisecond).String()
+}
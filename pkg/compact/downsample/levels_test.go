@@ -0,0 +1,81 @@
+package downsample
+
+import (
+	"testing"
+	"time"
+
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestParseLevels(t *testing.T) {
+	minute := int64(time.Minute / time.Millisecond)
+	for _, tcase := range []struct {
+		specs    []string
+		expected Levels
+		err      bool
+	}{
+		{specs: []string{"5m:40h", "1h:10d"}, expected: DefaultLevels},
+		{
+			specs:    []string{"1m:1d", "10m:14d", "1h:30d"},
+			expected: Levels{{Resolution: minute, MinSourceRange: 1440 * minute}, {Resolution: 10 * minute, MinSourceRange: 14 * 1440 * minute}, {Resolution: 60 * minute, MinSourceRange: 30 * 1440 * minute}},
+		},
+		{
+			specs:    []string{"5m:40h:1y", "1h:10d"},
+			expected: Levels{{Resolution: ResLevel1, MinSourceRange: DownsampleRange0, Retention: 365 * 24 * time.Hour}, {Resolution: ResLevel2, MinSourceRange: DownsampleRange1}},
+		},
+		{specs: []string{}, expected: Levels{}},
+		{specs: []string{"5m"}, err: true},
+		{specs: []string{"5m:40h:1x"}, err: true},
+		{specs: []string{"5m:40h:1y:1d"}, err: true},
+		{specs: []string{"5x:40h"}, err: true},
+		{specs: []string{"0s:40h"}, err: true},
+		{specs: []string{"1h:10d", "5m:40h"}, err: true},
+		{specs: []string{"5m:40h", "5m:10d"}, err: true},
+		{specs: []string{"5m:40h", "7m:10d"}, err: true},
+		{specs: []string{"1h:30m"}, err: true},
+	} {
+		t.Run("", func(t *testing.T) {
+			levels, err := ParseLevels(tcase.specs)
+			if tcase.err {
+				testutil.NotOk(t, err)
+				return
+			}
+			testutil.Ok(t, err)
+			testutil.Equals(t, tcase.expected, levels)
+		})
+	}
+}
+
+func TestLevels_ValidateMaxRange(t *testing.T) {
+	day := int64(24 * time.Hour / time.Millisecond)
+
+	testutil.Ok(t, DefaultLevels.ValidateMaxRange(14*day))
+	testutil.Ok(t, DefaultLevels.ValidateMaxRange(DownsampleRange1))
+	testutil.NotOk(t, DefaultLevels.ValidateMaxRange(2*day))
+	testutil.NotOk(t, Levels{{Resolution: ResLevel1, MinSourceRange: 30 * day}}.ValidateMaxRange(14*day))
+}
+
+func TestLevels_Next(t *testing.T) {
+	levels := Levels{{Resolution: 60000, MinSourceRange: 86400000}, {Resolution: 600000, MinSourceRange: 1209600000}}
+
+	next, ok := levels.Next(ResLevel0)
+	testutil.Assert(t, ok, "expected next level of raw data")
+	testutil.Equals(t, levels[0], next)
+
+	next, ok = levels.Next(60000)
+	testutil.Assert(t, ok, "expected next level of 1m")
+	testutil.Equals(t, levels[1], next)
+
+	_, ok = levels.Next(600000)
+	testutil.Assert(t, !ok, "expected no next level of the last level")
+	_, ok = levels.Next(ResLevel1)
+	testutil.Assert(t, !ok, "expected no next level of unknown resolution")
+	_, ok = Levels{}.Next(ResLevel0)
+	testutil.Assert(t, !ok, "expected no next level without levels")
+
+	testutil.Equals(t, []int64{ResLevel0, 60000, 600000}, levels.Resolutions())
+	testutil.Assert(t, levels.Known(600000), "expected 10m to be known")
+	testutil.Assert(t, !levels.Known(ResLevel2), "expected 1h not to be known")
+	testutil.Equals(t, "raw", ResolutionString(ResLevel0))
+	testutil.Equals(t, "10m", ResolutionString(600000))
+}
@@ -20,7 +20,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/runutil"
 )
 
-// streamedBlockWriter writes downsampled blocks to a new data block. Implemented to save memory consumption
+// streamedBlockWriter writes downsampled or compacted series to a new data block. Implemented to save memory consumption
 // by writing chunks data right into the files, omitting keeping them in-memory. Index and meta data should be
 // sealed afterwards, when there aren't more series to process.
 type streamedBlockWriter struct {
@@ -34,13 +34,13 @@ type streamedBlockWriter struct {
 
 	chunkWriter tsdb.ChunkWriter
 	indexWriter tsdb.IndexWriter
-	indexReader tsdb.IndexReader
 	closers     []io.Closer
 
 	seriesRefs uint64 // postings is a current posting position.
 }
 
 // NewStreamedBlockWriter returns streamedBlockWriter instance, it's not concurrency safe.
+// Symbols have to contain all label names and values of written series in sorted order.
 // Caller is responsible to Close all io.Closers by calling the Close when downsampling is done.
 // In case if error happens outside of the StreamedBlockWriter during the processing,
 // index and meta files will be written anyway, so the caller is always responsible for removing block directory with
@@ -49,7 +49,7 @@ type streamedBlockWriter struct {
 // exception, not a general case.
 func NewStreamedBlockWriter(
 	blockDir string,
-	indexReader tsdb.IndexReader,
+	symbols index.StringIter,
 	logger log.Logger,
 	originMeta metadata.Meta,
 ) (w *streamedBlockWriter, err error) {
@@ -79,7 +79,6 @@ func NewStreamedBlockWriter(
 	}
 	closers = append(closers, indexWriter)
 
-	symbols := indexReader.Symbols()
 	for symbols.Next() {
 		if err = indexWriter.AddSymbol(symbols.At()); err != nil {
 			return nil, errors.Wrap(err, "add symbols")
@@ -92,7 +91,6 @@ func NewStreamedBlockWriter(
 	return &streamedBlockWriter{
 		logger:      logger,
 		blockDir:    blockDir,
-		indexReader: indexReader,
 		indexWriter: indexWriter,
 		chunkWriter: chunkWriter,
 		meta:        originMeta,
@@ -179,7 +177,7 @@ func (w *streamedBlockWriter) Close() error {
 	// No error, claim success.
 
 	level.Info(w.logger).Log(
-		"msg", "finalized downsampled block",
+		"msg", "finalized block",
 		"mint", w.meta.MinTime,
 		"maxt", w.meta.MaxTime,
 		"ulid", w.meta.ULID,
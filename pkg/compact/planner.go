@@ -0,0 +1,322 @@
+package compact
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+// Planner returns blocks to compact.
+type Planner interface {
+	// Plan returns a list of blocks that should be compacted into single one.
+	// The blocks can be overlapping. The provided metadata has to be ordered by minTime.
+	Plan(ctx context.Context, metasByMinTime []*metadata.Meta) ([]*metadata.Meta, error)
+}
+
+type tsdbBasedPlanner struct {
+	ranges []int64
+}
+
+// NewTSDBBasedPlanner is a Planner planning the same way as the leveled compactor of Prometheus TSDB, for the
+// given compaction ranges.
+func NewTSDBBasedPlanner(ranges []int64) Planner {
+	return &tsdbBasedPlanner{ranges: ranges}
+}
+
+func (p *tsdbBasedPlanner) Plan(_ context.Context, metasByMinTime []*metadata.Meta) ([]*metadata.Meta, error) {
+	return p.plan(nil, metasByMinTime), nil
+}
+
+// plan returns blocks to compact, never including the excluded ones. Excluded blocks are still taken into account
+// when choosing time ranges to compact, so that blocks around them are compacted the same way as without them and no
+// compacted block overlaps them.
+func (p *tsdbBasedPlanner) plan(excluded map[ulid.ULID]struct{}, metasByMinTime []*metadata.Meta) []*metadata.Meta {
+	if len(metasByMinTime) == 0 {
+		return nil
+	}
+
+	notExcludedMetasByMinTime := make([]*metadata.Meta, 0, len(metasByMinTime))
+	for _, m := range metasByMinTime {
+		if _, ok := excluded[m.ULID]; !ok {
+			notExcludedMetasByMinTime = append(notExcludedMetasByMinTime, m)
+		}
+	}
+
+	res := selectOverlappingMetas(notExcludedMetasByMinTime)
+	if len(res) > 0 {
+		return res
+	}
+	// No overlapping blocks, do compaction the usual way.
+	// We do not include a recently created block with max(minTime), so the block which was just uploaded.
+	if _, ok := excluded[metasByMinTime[len(metasByMinTime)-1].ULID]; !ok {
+		notExcludedMetasByMinTime = notExcludedMetasByMinTime[:len(notExcludedMetasByMinTime)-1]
+	}
+	metasByMinTime = metasByMinTime[:len(metasByMinTime)-1]
+
+	res = append(res, p.selectMetas(excluded, metasByMinTime)...)
+	if len(res) > 0 {
+		return res
+	}
+
+	// Compact any blocks with big enough time range that have >5% tombstones.
+	for i := len(notExcludedMetasByMinTime) - 1; i >= 0; i-- {
+		meta := notExcludedMetasByMinTime[i]
+		if meta.MaxTime-meta.MinTime < p.ranges[len(p.ranges)/2] {
+			break
+		}
+		if float64(meta.Stats.NumTombstones)/float64(meta.Stats.NumSeries+1) > 0.05 {
+			return []*metadata.Meta{notExcludedMetasByMinTime[i]}
+		}
+	}
+	return nil
+}
+
+// selectMetas returns the metas that should be compacted into a single new block.
+// If only a single block range is configured, the result is always nil.
+func (p *tsdbBasedPlanner) selectMetas(excluded map[ulid.ULID]struct{}, metasByMinTime []*metadata.Meta) []*metadata.Meta {
+	if len(p.ranges) < 2 || len(metasByMinTime) < 1 {
+		return nil
+	}
+
+	highTime := metasByMinTime[len(metasByMinTime)-1].MinTime
+
+	for _, iv := range p.ranges[1:] {
+		parts := splitByRange(metasByMinTime, iv)
+		if len(parts) == 0 {
+			continue
+		}
+
+	Outer:
+		for _, part := range parts {
+			// Do not select the range if it has a block whose compaction failed.
+			for _, m := range part {
+				if m.Compaction.Failed {
+					continue Outer
+				}
+			}
+
+			if len(part) < 2 {
+				continue
+			}
+
+			mint := part[0].MinTime
+			maxt := part[len(part)-1].MaxTime
+			// Pick the range of blocks if it spans the full range (potentially with gaps)
+			// or is before the most recent block.
+			// This ensures we don't compact blocks prematurely when another one of the same
+			// size still fits in the range.
+			if maxt-mint != iv && maxt > highTime {
+				continue
+			}
+
+			// Excluded blocks split the range, so that no compacted block overlaps them.
+			lastExcluded := 0
+			for i, m := range part {
+				if _, ok := excluded[m.ULID]; !ok {
+					continue
+				}
+				if len(part[lastExcluded:i]) > 1 {
+					return part[lastExcluded:i]
+				}
+				lastExcluded = i + 1
+			}
+			if len(part[lastExcluded:]) > 1 {
+				return part[lastExcluded:]
+			}
+		}
+	}
+	return nil
+}
+
+// selectOverlappingMetas returns all metas with overlapping time ranges.
+// It expects sorted input by mint and returns the overlapping metas in the same order as received.
+func selectOverlappingMetas(metasByMinTime []*metadata.Meta) []*metadata.Meta {
+	if len(metasByMinTime) < 2 {
+		return nil
+	}
+	var overlappingMetas []*metadata.Meta
+	globalMaxt := metasByMinTime[0].MaxTime
+	for i, m := range metasByMinTime[1:] {
+		if m.MinTime < globalMaxt {
+			if len(overlappingMetas) == 0 {
+				// When it is the first overlap, need to add the last one as well.
+				overlappingMetas = append(overlappingMetas, metasByMinTime[i])
+			}
+			overlappingMetas = append(overlappingMetas, m)
+		} else if len(overlappingMetas) > 0 {
+			break
+		}
+
+		if m.MaxTime > globalMaxt {
+			globalMaxt = m.MaxTime
+		}
+	}
+	return overlappingMetas
+}
+
+// splitByRange splits the directories by the time range. The range sequence starts at 0.
+//
+// For example, if we have blocks [0-10, 10-20, 50-60, 90-100] and the split range tr is 30
+// it returns [0-10, 10-20], [50-60], [90-100].
+func splitByRange(metasByMinTime []*metadata.Meta, tr int64) [][]*metadata.Meta {
+	var splitDirs [][]*metadata.Meta
+
+	for i := 0; i < len(metasByMinTime); {
+		var (
+			group []*metadata.Meta
+			t0    int64
+			m     = metasByMinTime[i]
+		)
+		// Compute start of aligned time range of size tr closest to the current block's start.
+		if m.MinTime >= 0 {
+			t0 = tr * (m.MinTime / tr)
+		} else {
+			t0 = tr * ((m.MinTime - tr + 1) / tr)
+		}
+
+		// Skip blocks that don't fall into the range. This can happen via mis-alignment or
+		// by being the multiple of the intended range.
+		if m.MaxTime > t0+tr {
+			i++
+			continue
+		}
+
+		// Add all metas to the current group that are within [t0, t0+tr].
+		for ; i < len(metasByMinTime); i++ {
+			// Either the block falls into the next range or doesn't fit at all (checked above).
+			if metasByMinTime[i].MaxTime > t0+tr {
+				break
+			}
+			group = append(group, metasByMinTime[i])
+		}
+
+		if len(group) > 0 {
+			splitDirs = append(splitDirs, group)
+		}
+	}
+
+	return splitDirs
+}
+
+const (
+	// Index of a block is dominated by series entries with their label references and chunk metas and by postings.
+	// Those are the estimated sizes of one series and one chunk in the index.
+	estimatedIndexBytesPerSeries = 128
+	estimatedIndexBytesPerChunk  = 12
+)
+
+// EstimateIndexSize returns the estimated upper bound of the index size of a block compacted from the given blocks,
+// i.e. the sum of their index sizes. Index sizes are taken from files recorded in meta.json, or estimated from stats
+// for blocks uploaded without them.
+func EstimateIndexSize(metas ...*metadata.Meta) int64 {
+	var size int64
+	for _, m := range metas {
+		size += indexSize(m)
+	}
+	return size
+}
+
+func indexSize(m *metadata.Meta) int64 {
+	for _, f := range m.Thanos.Files {
+		if f.RelPath == block.IndexFilename {
+			return f.SizeBytes
+		}
+	}
+	return int64(m.Stats.NumSeries*estimatedIndexBytesPerSeries + m.Stats.NumChunks*estimatedIndexBytesPerChunk)
+}
+
+// estimateSeries returns the upper bound of number of series of a block compacted from the given blocks.
+func estimateSeries(metas ...*metadata.Meta) uint64 {
+	var series uint64
+	for _, m := range metas {
+		series += m.Stats.NumSeries
+	}
+	return series
+}
+
+type limitingPlanner struct {
+	logger         log.Logger
+	planner        *tsdbBasedPlanner
+	noCompactMarks func() map[ulid.ULID]*metadata.NoCompactMark
+	maxSeries      uint64
+	maxIndexSize   int64
+}
+
+// NewLimitingPlanner returns Planner which plans the same way as NewTSDBBasedPlanner for the given compaction ranges,
+// but never plans blocks marked for no compaction and caps planned blocks, so that the estimated number of series and
+// index size of the compacted block do not exceed the given maximums. Zero maximum means no limit. If the plan cannot
+// be capped to at least two blocks, its first block is not compacted with any other block, similar to blocks marked
+// for no compaction.
+func NewLimitingPlanner(logger log.Logger, ranges []int64, noCompactMarks func() map[ulid.ULID]*metadata.NoCompactMark, maxSeries uint64, maxIndexSize int64) Planner {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	if noCompactMarks == nil {
+		noCompactMarks = func() map[ulid.ULID]*metadata.NoCompactMark { return nil }
+	}
+	return &limitingPlanner{
+		logger:         logger,
+		planner:        &tsdbBasedPlanner{ranges: ranges},
+		noCompactMarks: noCompactMarks,
+		maxSeries:      maxSeries,
+		maxIndexSize:   maxIndexSize,
+	}
+}
+
+func (p *limitingPlanner) fits(metas []*metadata.Meta) bool {
+	if p.maxSeries > 0 && estimateSeries(metas...) > p.maxSeries {
+		return false
+	}
+	if p.maxIndexSize > 0 && EstimateIndexSize(metas...) > p.maxIndexSize {
+		return false
+	}
+	return true
+}
+
+func (p *limitingPlanner) Plan(_ context.Context, metasByMinTime []*metadata.Meta) ([]*metadata.Meta, error) {
+	excluded := map[ulid.ULID]struct{}{}
+	for id := range p.noCompactMarks() {
+		excluded[id] = struct{}{}
+	}
+
+	for {
+		plan := p.planner.plan(excluded, metasByMinTime)
+		if len(plan) == 0 {
+			return nil, nil
+		}
+		if p.fits(plan) {
+			return plan, nil
+		}
+
+		// Overlapping blocks have to be compacted together.
+		if len(selectOverlappingMetas(plan)) > 0 {
+			level.Warn(p.logger).Log("msg", "planned compaction of overlapping blocks exceeds limits", "blocks", fmt.Sprintf("%v", ids(plan)))
+			return plan, nil
+		}
+
+		n := 0
+		for n < len(plan) && p.fits(plan[:n+1]) {
+			n++
+		}
+		if n > 1 {
+			return plan[:n], nil
+		}
+
+		level.Info(p.logger).Log("msg", "block exceeds compaction limits with following blocks, excluding it from compaction", "block", plan[0].ULID,
+			"series", estimateSeries(plan[:n+1]...), "maxSeries", p.maxSeries, "indexSize", EstimateIndexSize(plan[:n+1]...), "maxIndexSize", p.maxIndexSize)
+		excluded[plan[0].ULID] = struct{}{}
+	}
+}
+
+func ids(metas []*metadata.Meta) []ulid.ULID {
+	res := make([]ulid.ULID, 0, len(metas))
+	for _, m := range metas {
+		res = append(res, m.ULID)
+	}
+	return res
+}
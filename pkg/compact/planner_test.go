@@ -0,0 +1,229 @@
+package compact
+
+import (
+	"context"
+	"testing"
+
+	"github.com/oklog/ulid"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func testMeta(id uint64, mint, maxt int64, series uint64) *metadata.Meta {
+	m := &metadata.Meta{}
+	m.ULID = ulid.MustNew(id, nil)
+	m.MinTime = mint
+	m.MaxTime = maxt
+	m.Stats.NumSeries = series
+	m.Compaction.Level = 1
+	m.Compaction.Sources = []ulid.ULID{m.ULID}
+	return m
+}
+
+func TestTSDBBasedPlanner_Plan(t *testing.T) {
+	ctx := context.Background()
+	p := NewTSDBBasedPlanner([]int64{20, 60, 180})
+
+	for _, tcase := range []struct {
+		name     string
+		metas    []*metadata.Meta
+		expected []uint64
+	}{
+		{
+			name: "no blocks",
+		},
+		{
+			name:  "single block",
+			metas: []*metadata.Meta{testMeta(1, 0, 20, 1)},
+		},
+		{
+			name: "not enough blocks to fill the range",
+			metas: []*metadata.Meta{
+				testMeta(1, 0, 20, 1),
+				testMeta(2, 20, 40, 1),
+			},
+		},
+		{
+			name: "full range, excluding the most recent block",
+			metas: []*metadata.Meta{
+				testMeta(1, 0, 20, 1),
+				testMeta(2, 20, 40, 1),
+				testMeta(3, 40, 60, 1),
+				testMeta(4, 60, 80, 1),
+			},
+			expected: []uint64{1, 2, 3},
+		},
+		{
+			name: "overlapping blocks first",
+			metas: []*metadata.Meta{
+				testMeta(1, 0, 20, 1),
+				testMeta(2, 20, 40, 1),
+				testMeta(3, 30, 50, 1),
+				testMeta(4, 60, 80, 1),
+			},
+			expected: []uint64{2, 3},
+		},
+	} {
+		if ok := t.Run(tcase.name, func(t *testing.T) {
+			plan, err := p.Plan(ctx, tcase.metas)
+			testutil.Ok(t, err)
+			testutil.Equals(t, expectedIDs(tcase.expected), ids(plan))
+		}); !ok {
+			return
+		}
+	}
+}
+
+func TestLimitingPlanner_Plan(t *testing.T) {
+	ctx := context.Background()
+	metas := []*metadata.Meta{
+		testMeta(1, 0, 20, 10),
+		testMeta(2, 20, 40, 10),
+		testMeta(3, 40, 60, 10),
+		testMeta(4, 60, 80, 10),
+	}
+
+	for _, tcase := range []struct {
+		name         string
+		metas        []*metadata.Meta
+		noCompact    []uint64
+		maxSeries    uint64
+		maxIndexSize int64
+		expected     []uint64
+	}{
+		{
+			name:     "no limits",
+			metas:    metas,
+			expected: []uint64{1, 2, 3},
+		},
+		{
+			name:      "plan capped by series",
+			metas:     metas,
+			maxSeries: 20,
+			expected:  []uint64{1, 2},
+		},
+		{
+			name:         "plan capped by index size",
+			metas:        metas,
+			maxIndexSize: 2 * EstimateIndexSize(metas[0]),
+			expected:     []uint64{1, 2},
+		},
+		{
+			name: "too big first block is excluded",
+			metas: []*metadata.Meta{
+				testMeta(1, 0, 20, 30),
+				testMeta(2, 20, 40, 10),
+				testMeta(3, 40, 60, 10),
+				testMeta(4, 60, 80, 10),
+				testMeta(5, 80, 100, 10),
+			},
+			maxSeries: 20,
+			expected:  []uint64{2, 3},
+		},
+		{
+			name:      "nothing fits",
+			metas:     metas,
+			maxSeries: 10,
+		},
+		{
+			name:      "no-compact marked block splits the plan",
+			metas:     metas,
+			noCompact: []uint64{2},
+		},
+		{
+			name: "no-compact marked block is never planned",
+			metas: []*metadata.Meta{
+				testMeta(1, 0, 20, 10),
+				testMeta(2, 20, 40, 10),
+				testMeta(3, 40, 60, 10),
+				testMeta(4, 60, 80, 10),
+				testMeta(5, 80, 100, 10),
+				testMeta(6, 100, 120, 10),
+				testMeta(7, 120, 140, 10),
+			},
+			noCompact: []uint64{1},
+			expected:  []uint64{2, 3},
+		},
+		{
+			name: "blocks just before no-compact marked block are planned",
+			metas: []*metadata.Meta{
+				testMeta(1, 0, 20, 10),
+				testMeta(2, 20, 40, 10),
+				testMeta(3, 40, 60, 10),
+				testMeta(4, 60, 80, 10),
+				testMeta(5, 80, 100, 10),
+				testMeta(6, 100, 120, 10),
+			},
+			noCompact: []uint64{3},
+			expected:  []uint64{1, 2},
+		},
+		{
+			name: "no-compact marked most recent block",
+			metas: []*metadata.Meta{
+				testMeta(1, 0, 20, 10),
+				testMeta(2, 20, 40, 10),
+				testMeta(3, 40, 60, 10),
+				testMeta(4, 60, 80, 10),
+			},
+			noCompact: []uint64{4},
+			expected:  []uint64{1, 2, 3},
+		},
+		{
+			name: "overlapping blocks are planned regardless of limits",
+			metas: []*metadata.Meta{
+				testMeta(1, 0, 20, 10),
+				testMeta(2, 10, 30, 10),
+			},
+			maxSeries: 10,
+			expected:  []uint64{1, 2},
+		},
+	} {
+		if ok := t.Run(tcase.name, func(t *testing.T) {
+			marks := map[ulid.ULID]*metadata.NoCompactMark{}
+			for _, id := range expectedIDs(tcase.noCompact) {
+				marks[id] = &metadata.NoCompactMark{ID: id, Version: metadata.NoCompactMarkVersion1, Reason: metadata.ManualNoCompactReason}
+			}
+			p := NewLimitingPlanner(nil, []int64{20, 60, 180}, func() map[ulid.ULID]*metadata.NoCompactMark { return marks }, tcase.maxSeries, tcase.maxIndexSize)
+
+			plan, err := p.Plan(ctx, tcase.metas)
+			testutil.Ok(t, err)
+			testutil.Equals(t, expectedIDs(tcase.expected), ids(plan))
+		}); !ok {
+			return
+		}
+	}
+}
+
+func TestEstimateIndexSize(t *testing.T) {
+	withFiles := testMeta(1, 0, 20, 10)
+	withFiles.Thanos.Files = []metadata.File{{RelPath: "chunks/000001", SizeBytes: 1000}, {RelPath: "index", SizeBytes: 300}}
+	withoutFiles := testMeta(2, 20, 40, 10)
+
+	// Real index size is used where known.
+	testutil.Equals(t, int64(300), EstimateIndexSize(withFiles))
+	testutil.Equals(t, int64(300+10*estimatedIndexBytesPerSeries), EstimateIndexSize(withFiles, withoutFiles))
+}
+
+func TestGroup_PlannedCompactions(t *testing.T) {
+	ctx := context.Background()
+
+	g, err := newGroup(nil, nil, nil, 0, false, false, nil, nil, nil, nil, nil, nil)
+	testutil.Ok(t, err)
+	for i := uint64(0); i < 10; i++ {
+		testutil.Ok(t, g.Add(testMeta(i+1, int64(i)*20, int64(i+1)*20, 10)))
+	}
+
+	compactions, blocks, err := g.plannedCompactions(ctx, NewLimitingPlanner(nil, []int64{20, 60, 180}, nil, 0, 0))
+	testutil.Ok(t, err)
+	// Three 60 ranges, then the 180 range made of them.
+	testutil.Equals(t, 4, compactions)
+	testutil.Equals(t, 12, blocks)
+}
+
+func expectedIDs(ids []uint64) []ulid.ULID {
+	res := make([]ulid.ULID, 0, len(ids))
+	for _, id := range ids {
+		res = append(res, ulid.MustNew(id, nil))
+	}
+	return res
+}
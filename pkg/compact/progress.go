@@ -0,0 +1,299 @@
+package compact
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+// Stage is a part of the compactor work done outside of compaction groups.
+type Stage string
+
+const (
+	// DownsamplingStage is downsampling of compacted blocks.
+	DownsamplingStage Stage = "downsampling"
+	// RetentionStage is rewriting of blocks by series retention policies.
+	RetentionStage Stage = "retention"
+)
+
+// ProgressStatus is a snapshot of the compactor progress.
+type ProgressStatus struct {
+	Groups       []GroupStatus `json:"groups"`
+	Downsampling StageStatus   `json:"downsampling"`
+	Retention    StageStatus   `json:"retention"`
+}
+
+// GroupStatus is a status of a single compaction group.
+type GroupStatus struct {
+	Key        string            `json:"key"`
+	Labels     map[string]string `json:"labels"`
+	Resolution int64             `json:"resolution"`
+	Blocks     []BlockStatus     `json:"blocks"`
+	// PlannedCompactions is a number of compactions the group still needs, estimated at the beginning of the
+	// compaction pass. PlannedCompactionBlocks is a number of blocks compacted by them.
+	PlannedCompactions      int          `json:"plannedCompactions"`
+	PlannedCompactionBlocks int          `json:"plannedCompactionBlocks"`
+	InProgress              *WorkStatus  `json:"inProgress,omitempty"`
+	LastCompaction          *time.Time   `json:"lastCompaction,omitempty"`
+	LastError               *ErrorStatus `json:"lastError,omitempty"`
+}
+
+// BlockStatus is a status of a single block of a compaction group.
+type BlockStatus struct {
+	ID              ulid.ULID `json:"id"`
+	MinTime         int64     `json:"minTime"`
+	MaxTime         int64     `json:"maxTime"`
+	Series          uint64    `json:"series"`
+	CompactionLevel int       `json:"compactionLevel"`
+	// NoCompactReason is a reason of no-compact mark of the block, if the block is marked.
+	NoCompactReason metadata.NoCompactReason `json:"noCompactReason,omitempty"`
+}
+
+// StageStatus is a status of a Stage.
+type StageStatus struct {
+	// Todo is a number of blocks left to be processed in the current pass of the stage.
+	Todo         int          `json:"todo"`
+	InProgress   *WorkStatus  `json:"inProgress,omitempty"`
+	LastPassDone *time.Time   `json:"lastPassDone,omitempty"`
+	LastError    *ErrorStatus `json:"lastError,omitempty"`
+}
+
+// WorkStatus describes work in progress on the given blocks.
+type WorkStatus struct {
+	Blocks    []ulid.ULID `json:"blocks"`
+	StartTime time.Time   `json:"startTime"`
+	// ElapsedSeconds is a time elapsed since StartTime at the time of the snapshot.
+	ElapsedSeconds float64 `json:"elapsedSeconds"`
+}
+
+// ErrorStatus is the last error and the time it happened.
+type ErrorStatus struct {
+	Error string    `json:"error"`
+	Time  time.Time `json:"time"`
+}
+
+// Progress tracks what the compactor is doing, so that it can be inspected through HTTP API and UI. It is safe for
+// concurrent use. All updates of nil Progress are ignored.
+type Progress struct {
+	mtx    sync.Mutex
+	now    func() time.Time
+	groups map[string]*GroupStatus
+	stages map[Stage]*StageStatus
+}
+
+// NewProgress returns empty Progress.
+func NewProgress() *Progress {
+	return &Progress{
+		now:    time.Now,
+		groups: map[string]*GroupStatus{},
+		stages: map[Stage]*StageStatus{
+			DownsamplingStage: {},
+			RetentionStage:    {},
+		},
+	}
+}
+
+// Status returns snapshot of the current progress. Groups are sorted by key.
+func (p *Progress) Status() ProgressStatus {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	now := p.now()
+	res := ProgressStatus{
+		Groups:       make([]GroupStatus, 0, len(p.groups)),
+		Downsampling: p.stageSnapshot(DownsamplingStage, now),
+		Retention:    p.stageSnapshot(RetentionStage, now),
+	}
+	for _, g := range p.groups {
+		s := *g
+		s.InProgress = workSnapshot(g.InProgress, now)
+		res.Groups = append(res.Groups, s)
+	}
+	sort.Slice(res.Groups, func(i, j int) bool {
+		return res.Groups[i].Key < res.Groups[j].Key
+	})
+	return res
+}
+
+func (p *Progress) stageSnapshot(stage Stage, now time.Time) StageStatus {
+	s := *p.stages[stage]
+	s.InProgress = workSnapshot(s.InProgress, now)
+	return s
+}
+
+func workSnapshot(w *WorkStatus, now time.Time) *WorkStatus {
+	if w == nil {
+		return nil
+	}
+	s := *w
+	s.ElapsedSeconds = now.Sub(w.StartTime).Seconds()
+	return &s
+}
+
+// status returns status of the group with the given planned compactions and no-compact marks of its blocks.
+func (cg *Group) status(compactions, blocks int, noCompactMarks map[ulid.ULID]*metadata.NoCompactMark) *GroupStatus {
+	s := &GroupStatus{
+		Key:                     cg.Key(),
+		Labels:                  cg.Labels().Map(),
+		Resolution:              cg.Resolution(),
+		PlannedCompactions:      compactions,
+		PlannedCompactionBlocks: blocks,
+	}
+
+	cg.mtx.Lock()
+	defer cg.mtx.Unlock()
+
+	for _, m := range cg.metasByMinTime() {
+		b := BlockStatus{
+			ID:              m.ULID,
+			MinTime:         m.MinTime,
+			MaxTime:         m.MaxTime,
+			Series:          m.Stats.NumSeries,
+			CompactionLevel: m.Compaction.Level,
+		}
+		if mark, ok := noCompactMarks[m.ULID]; ok {
+			b.NoCompactReason = mark.Reason
+		}
+		s.Blocks = append(s.Blocks, b)
+	}
+	return s
+}
+
+// setGroups replaces tracked groups with the given ones, keeping the history of groups tracked before.
+func (p *Progress) setGroups(groups []*GroupStatus) {
+	if p == nil {
+		return
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	statuses := make(map[string]*GroupStatus, len(groups))
+	for _, s := range groups {
+		if prev, ok := p.groups[s.Key]; ok {
+			s.LastCompaction = prev.LastCompaction
+			s.LastError = prev.LastError
+		}
+		statuses[s.Key] = s
+	}
+	p.groups = statuses
+}
+
+func (p *Progress) compactionStarted(groupKey string, plan []*metadata.Meta) {
+	if p == nil {
+		return
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if g, ok := p.groups[groupKey]; ok {
+		g.InProgress = &WorkStatus{Blocks: ids(plan), StartTime: p.now()}
+	}
+}
+
+func (p *Progress) compactionDone(groupKey string, err error) {
+	if p == nil {
+		return
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	g, ok := p.groups[groupKey]
+	if !ok {
+		return
+	}
+	now := p.now()
+	if err != nil {
+		g.LastError = &ErrorStatus{Error: err.Error(), Time: now}
+	} else if g.InProgress != nil {
+		g.LastCompaction = &now
+		if g.PlannedCompactions > 0 {
+			g.PlannedCompactions--
+			g.PlannedCompactionBlocks -= len(g.InProgress.Blocks)
+			if g.PlannedCompactionBlocks < 0 {
+				g.PlannedCompactionBlocks = 0
+			}
+		}
+	}
+	g.InProgress = nil
+}
+
+// StageStarted records start of a new pass of the given stage, which has the given number of blocks to process.
+func (p *Progress) StageStarted(stage Stage, todo int) {
+	if p == nil {
+		return
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	s := p.stages[stage]
+	s.Todo = todo
+	s.InProgress = nil
+}
+
+// StageDone records end of the current pass of the given stage, failed if err is not nil.
+func (p *Progress) StageDone(stage Stage, err error) {
+	if p == nil {
+		return
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	now := p.now()
+	s := p.stages[stage]
+	s.InProgress = nil
+	if err != nil {
+		s.LastError = &ErrorStatus{Error: err.Error(), Time: now}
+		return
+	}
+	s.LastPassDone = &now
+}
+
+// WorkStarted records start of processing of the given blocks within the given stage.
+func (p *Progress) WorkStarted(stage Stage, blocks ...ulid.ULID) {
+	if p == nil {
+		return
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	p.stages[stage].InProgress = &WorkStatus{Blocks: blocks, StartTime: p.now()}
+}
+
+// WorkDone records end of processing started by the last WorkStarted call of the given stage, failed if err is
+// not nil.
+func (p *Progress) WorkDone(stage Stage, err error) {
+	if p == nil {
+		return
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	s := p.stages[stage]
+	s.InProgress = nil
+	if err != nil {
+		s.LastError = &ErrorStatus{Error: err.Error(), Time: p.now()}
+		return
+	}
+	if s.Todo > 0 {
+		s.Todo--
+	}
+}
+
+// progressPlanner is a Planner recording planned compactions of the group as in progress.
+type progressPlanner struct {
+	Planner
+	progress *Progress
+	groupKey string
+}
+
+func (p *progressPlanner) Plan(ctx context.Context, metasByMinTime []*metadata.Meta) ([]*metadata.Meta, error) {
+	plan, err := p.Planner.Plan(ctx, metasByMinTime)
+	if err == nil && len(plan) > 0 {
+		p.progress.compactionStarted(p.groupKey, plan)
+	}
+	return plan, err
+}
@@ -0,0 +1,68 @@
+package compact
+
+import (
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestProgress(t *testing.T) {
+	now := time.Unix(1000, 0)
+	p := NewProgress()
+	p.now = func() time.Time { return now }
+
+	p.setGroups([]*GroupStatus{
+		{Key: "0@1", PlannedCompactions: 2, PlannedCompactionBlocks: 6},
+		{Key: "0@2"},
+	})
+
+	// Running compaction with elapsed time.
+	p.compactionStarted("0@1", []*metadata.Meta{testMeta(1, 0, 20, 1), testMeta(2, 20, 40, 1), testMeta(3, 40, 60, 1)})
+	now = now.Add(time.Minute)
+	status := p.Status()
+	testutil.Equals(t, 2, len(status.Groups))
+	testutil.Equals(t, "0@1", status.Groups[0].Key)
+	testutil.Equals(t, expectedIDs([]uint64{1, 2, 3}), status.Groups[0].InProgress.Blocks)
+	testutil.Equals(t, 60.0, status.Groups[0].InProgress.ElapsedSeconds)
+
+	p.compactionDone("0@1", nil)
+	p.compactionDone("0@2", errors.New("failed"))
+	status = p.Status()
+	testutil.Assert(t, status.Groups[0].InProgress == nil, "compaction should be done")
+	testutil.Equals(t, 1, status.Groups[0].PlannedCompactions)
+	testutil.Equals(t, 3, status.Groups[0].PlannedCompactionBlocks)
+	testutil.Equals(t, now, *status.Groups[0].LastCompaction)
+	testutil.Equals(t, &ErrorStatus{Error: "failed", Time: now}, status.Groups[1].LastError)
+
+	// History of groups is kept between passes.
+	p.setGroups([]*GroupStatus{{Key: "0@1"}, {Key: "0@3"}})
+	status = p.Status()
+	testutil.Equals(t, 2, len(status.Groups))
+	testutil.Equals(t, now, *status.Groups[0].LastCompaction)
+	testutil.Equals(t, "0@3", status.Groups[1].Key)
+
+	p.StageStarted(DownsamplingStage, 2)
+	p.WorkStarted(DownsamplingStage, ulid.MustNew(1, nil))
+	p.WorkDone(DownsamplingStage, nil)
+	p.WorkStarted(DownsamplingStage, ulid.MustNew(2, nil))
+	testutil.Equals(t, 1, p.Status().Downsampling.Todo)
+	testutil.Equals(t, []ulid.ULID{ulid.MustNew(2, nil)}, p.Status().Downsampling.InProgress.Blocks)
+
+	p.WorkDone(DownsamplingStage, errors.New("failed"))
+	p.StageDone(DownsamplingStage, errors.New("failed"))
+	status = p.Status()
+	testutil.Equals(t, 1, status.Downsampling.Todo)
+	testutil.Assert(t, status.Downsampling.InProgress == nil, "downsampling should be done")
+	testutil.Assert(t, status.Downsampling.LastPassDone == nil, "downsampling pass should have failed")
+	testutil.Equals(t, "failed", status.Downsampling.LastError.Error)
+	testutil.Equals(t, StageStatus{}, status.Retention)
+
+	// Nil progress ignores updates.
+	var nilProgress *Progress
+	nilProgress.StageStarted(RetentionStage, 1)
+	nilProgress.compactionDone("0@1", nil)
+}
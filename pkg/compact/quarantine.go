@@ -0,0 +1,145 @@
+package compact
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+)
+
+// Quarantine excludes failing compaction groups from all work of the compactor for an exponentially growing back-off,
+// so that a problem of one group does not stop compaction, downsampling and retention of other groups. Blocks of the
+// same external labels in all resolutions are excluded together with the failing group, so that blocks of quarantined
+// groups are not downsampled again. All methods of nil Quarantine are no-ops.
+type Quarantine struct {
+	logger     log.Logger
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	now        func() time.Time
+
+	mtx    sync.Mutex
+	groups map[string]*quarantinedGroup
+
+	quarantined *prometheus.GaugeVec
+	failures    *prometheus.CounterVec
+}
+
+type quarantinedGroup struct {
+	labelsHash uint64
+	failures   int
+	until      time.Time
+}
+
+// NewQuarantine returns Quarantine excluding a failing group for minBackoff, doubled with every following failure up
+// to maxBackoff.
+func NewQuarantine(logger log.Logger, reg prometheus.Registerer, minBackoff, maxBackoff time.Duration) *Quarantine {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	q := &Quarantine{
+		logger:     logger,
+		minBackoff: minBackoff,
+		maxBackoff: maxBackoff,
+		now:        time.Now,
+		groups:     map[string]*quarantinedGroup{},
+		quarantined: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "thanos_compact_group_quarantined",
+			Help: "Set to 1 for each compaction group quarantined after a failure.",
+		}, []string{"group"}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_compact_group_quarantines_total",
+			Help: "Total number of times a compaction group was quarantined after a failure.",
+		}, []string{"group"}),
+	}
+	if reg != nil {
+		reg.MustRegister(q.quarantined, q.failures)
+	}
+	return q
+}
+
+// Fail quarantines the group with the given key and external labels after the given error. Failures of groups which
+// are still quarantined do not prolong their back-off.
+func (q *Quarantine) Fail(groupKey string, lset labels.Labels, err error) {
+	if q == nil {
+		return
+	}
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	g, ok := q.groups[groupKey]
+	if ok && q.now().Before(g.until) {
+		// Other blocks of the group processed before the group was filtered out may fail again.
+		level.Warn(q.logger).Log("msg", "quarantined compaction group failed again", "group", groupKey, "err", err)
+		return
+	}
+	if !ok {
+		g = &quarantinedGroup{labelsHash: lset.Hash()}
+		q.groups[groupKey] = g
+	}
+	g.failures++
+
+	backoff := q.minBackoff
+	for i := 1; i < g.failures && backoff < q.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > q.maxBackoff {
+		backoff = q.maxBackoff
+	}
+	g.until = q.now().Add(backoff)
+
+	q.quarantined.WithLabelValues(groupKey).Set(1)
+	q.failures.WithLabelValues(groupKey).Inc()
+	level.Error(q.logger).Log("msg", "compaction group failed; quarantining", "group", groupKey, "labels", lset, "failures", g.failures, "backoff", backoff, "err", err)
+}
+
+// Release releases groups whose back-off expired before the given time, i.e. the start of the compactor iteration
+// which has just succeeded. Such groups were processed during the whole iteration without failing again.
+func (q *Quarantine) Release(iterationStart time.Time) {
+	if q == nil {
+		return
+	}
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	for key, g := range q.groups {
+		if g.until.After(iterationStart) {
+			continue
+		}
+		level.Info(q.logger).Log("msg", "compaction group recovered; releasing from quarantine", "group", key, "failures", g.failures)
+		q.quarantined.DeleteLabelValues(key)
+		delete(q.groups, key)
+	}
+}
+
+// Filter filters out blocks of quarantined groups, including blocks of the same external labels in other resolutions.
+func (q *Quarantine) Filter(metas map[ulid.ULID]*metadata.Meta, synced block.GaugeLabeled, _ bool) {
+	if q == nil {
+		return
+	}
+	q.mtx.Lock()
+	now := q.now()
+	excluded := map[uint64]struct{}{}
+	for _, g := range q.groups {
+		if now.Before(g.until) {
+			excluded[g.labelsHash] = struct{}{}
+		}
+	}
+	q.mtx.Unlock()
+
+	if len(excluded) == 0 {
+		return
+	}
+	for id, m := range metas {
+		if _, ok := excluded[labels.FromMap(m.Thanos.Labels).Hash()]; !ok {
+			continue
+		}
+		synced.WithLabelValues(block.QuarantinedMeta).Inc()
+		delete(metas, id)
+	}
+}
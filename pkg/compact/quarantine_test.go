@@ -0,0 +1,93 @@
+package compact
+
+import (
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestQuarantine(t *testing.T) {
+	now := time.Unix(1000, 0)
+	q := NewQuarantine(nil, nil, time.Minute, 3*time.Minute)
+	q.now = func() time.Time { return now }
+
+	lsetA := labels.FromStrings("cluster", "a")
+	lsetB := labels.FromStrings("cluster", "b")
+	metas := func() map[ulid.ULID]*metadata.Meta {
+		res := map[ulid.ULID]*metadata.Meta{}
+		for i, b := range []struct {
+			lset labels.Labels
+			res  int64
+		}{{lsetA, 0}, {lsetA, 300000}, {lsetB, 0}} {
+			m := testMeta(uint64(i+1), 0, 20, 1)
+			m.Thanos.Labels = b.lset.Map()
+			m.Thanos.Downsample.Resolution = b.res
+			res[m.ULID] = m
+		}
+		return res
+	}
+	filtered := func() []ulid.ULID {
+		ms := metas()
+		q.Filter(ms, nopGaugeLabeled{}, false)
+		var res []ulid.ULID
+		for _, id := range expectedIDs([]uint64{1, 2, 3}) {
+			if _, ok := ms[id]; ok {
+				res = append(res, id)
+			}
+		}
+		return res
+	}
+	keyA := groupKey(0, lsetA)
+
+	testutil.Equals(t, expectedIDs([]uint64{1, 2, 3}), filtered())
+
+	// Blocks of the same labels in all resolutions are excluded.
+	q.Fail(keyA, lsetA, errors.New("failed"))
+	testutil.Equals(t, expectedIDs([]uint64{3}), filtered())
+	testutil.Equals(t, 1.0, promtest.ToFloat64(q.quarantined.WithLabelValues(keyA)))
+
+	// Failure during back-off does not prolong it.
+	q.Fail(keyA, lsetA, errors.New("failed"))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(q.failures.WithLabelValues(keyA)))
+
+	now = now.Add(time.Minute)
+	testutil.Equals(t, expectedIDs([]uint64{1, 2, 3}), filtered())
+
+	// Back-off is doubled up to the maximum.
+	for _, backoff := range []time.Duration{2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		q.Fail(keyA, lsetA, errors.New("failed"))
+		now = now.Add(backoff - time.Second)
+		testutil.Equals(t, expectedIDs([]uint64{3}), filtered())
+		now = now.Add(time.Second)
+		testutil.Equals(t, expectedIDs([]uint64{1, 2, 3}), filtered())
+	}
+	testutil.Equals(t, 4.0, promtest.ToFloat64(q.failures.WithLabelValues(keyA)))
+
+	// Group is released only after an iteration started after its back-off expired.
+	q.Fail(keyA, lsetA, errors.New("failed"))
+	q.Release(now)
+	testutil.Equals(t, 1, len(q.groups))
+
+	now = now.Add(3 * time.Minute)
+	q.Release(now)
+	testutil.Equals(t, 0, len(q.groups))
+
+	// Released group starts with the minimal back-off again.
+	q.Fail(keyA, lsetA, errors.New("failed"))
+	now = now.Add(time.Minute)
+	testutil.Equals(t, expectedIDs([]uint64{1, 2, 3}), filtered())
+
+	// Nil quarantine ignores updates and filters nothing.
+	var nilQuarantine *Quarantine
+	nilQuarantine.Fail(keyA, lsetA, errors.New("failed"))
+	nilQuarantine.Release(now)
+	ms := metas()
+	nilQuarantine.Filter(ms, nopGaugeLabeled{}, false)
+	testutil.Equals(t, 3, len(ms))
+}
@@ -7,34 +7,203 @@ import (
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
 	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/objstore"
+	"gopkg.in/yaml.v2"
 )
 
+// RetentionConfig holds retention policies of blocks selected by their external labels and resolution and
+// retention policies of series selected by their labels and resolution.
+type RetentionConfig struct {
+	Policies       []RetentionPolicyConfig `yaml:"policies"`
+	SeriesPolicies []RetentionPolicyConfig `yaml:"series_policies"`
+}
+
+// RetentionPolicyConfig is a retention of blocks matching a selector and resolution.
+type RetentionPolicyConfig struct {
+	// Selector is a series selector. For block policies it is matched against external labels of blocks and must not
+	// contain metric name, e.g. {env="dev"}. For series policies it is matched against labels of series,
+	// e.g. {__name__=~"slo:.*"}. Empty selector matches everything.
+	Selector string `yaml:"selector"`
+	// Resolution is one of raw, 5m or 1h. Empty resolution matches blocks of all resolutions.
+	Resolution string `yaml:"resolution"`
+	// Retention is how long to retain matching blocks or series. 0d disables retention for them.
+	Retention model.Duration `yaml:"retention"`
+}
+
+type retentionPolicy struct {
+	matchers   []*labels.Matcher
+	resolution *ResolutionLevel
+	retention  time.Duration
+}
+
+// specificity returns how specific the policy is. Policies with more matchers are more specific than ones with less,
+// policies with resolution more specific than ones without it.
+func (p retentionPolicy) specificity() int {
+	s := 2 * len(p.matchers)
+	if p.resolution != nil {
+		s++
+	}
+	return s
+}
+
+func (p retentionPolicy) matches(lset labels.Labels, res ResolutionLevel) bool {
+	if p.resolution != nil && *p.resolution != res {
+		return false
+	}
+	for _, m := range p.matchers {
+		if !m.Matches(lset.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// mostSpecific returns the most specific of policies matching the given labels and resolution, nil if none matches.
+// Among equally specific policies, the first one wins.
+func mostSpecific(policies []retentionPolicy, lset labels.Labels, res ResolutionLevel) *retentionPolicy {
+	var match *retentionPolicy
+	for i, policy := range policies {
+		if !policy.matches(lset, res) {
+			continue
+		}
+		if match == nil || policy.specificity() > match.specificity() {
+			match = &policies[i]
+		}
+	}
+	return match
+}
+
+// RetentionPolicies resolves retention of blocks and series. The most specific policy matching a block or series wins,
+// see RetentionPolicyConfig. Blocks not matching any policy are retained according to the retention of their
+// resolution, series not matching any series policy are retained as long as their block.
+type RetentionPolicies struct {
+	policies              []retentionPolicy
+	seriesPolicies        []retentionPolicy
+	retentionByResolution map[ResolutionLevel]time.Duration
+}
+
+// NewRetentionPolicies parses the given YAML retention config, falling back to the given retention by resolution
+// for blocks not matching any of its policies.
+func NewRetentionPolicies(confYaml []byte, retentionByResolution map[ResolutionLevel]time.Duration) (*RetentionPolicies, error) {
+	var conf RetentionConfig
+	if err := yaml.UnmarshalStrict(confYaml, &conf); err != nil {
+		return nil, errors.Wrap(err, "parsing retention config YAML")
+	}
+
+	policies, err := parseRetentionPolicies(conf.Policies)
+	if err != nil {
+		return nil, err
+	}
+	seriesPolicies, err := parseRetentionPolicies(conf.SeriesPolicies)
+	if err != nil {
+		return nil, errors.Wrap(err, "series policies")
+	}
+	return &RetentionPolicies{
+		policies:              policies,
+		seriesPolicies:        seriesPolicies,
+		retentionByResolution: retentionByResolution,
+	}, nil
+}
+
+func parseRetentionPolicies(confs []RetentionPolicyConfig) ([]retentionPolicy, error) {
+	var policies []retentionPolicy
+	for i, pc := range confs {
+		var policy retentionPolicy
+		if pc.Selector != "" {
+			ms, err := promql.ParseMetricSelector(pc.Selector)
+			if err != nil {
+				return nil, errors.Wrapf(err, "selector of policy %d", i)
+			}
+			policy.matchers = ms
+		}
+		if pc.Resolution != "" {
+			res, err := ParseResolutionLevel(pc.Resolution)
+			if err != nil {
+				return nil, errors.Wrapf(err, "resolution of policy %d", i)
+			}
+			policy.resolution = &res
+		}
+		policy.retention = time.Duration(pc.Retention)
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// ParseResolutionLevel parses a resolution level, which is either raw or a resolution duration like 5m or 1h.
+func ParseResolutionLevel(s string) (ResolutionLevel, error) {
+	if s == "raw" {
+		return ResolutionLevelRaw, nil
+	}
+	d, err := model.ParseDuration(s)
+	if err != nil || d == 0 {
+		return 0, errors.Errorf("unknown resolution %q, expected raw or a resolution like 5m or 1h", s)
+	}
+	return ResolutionLevel(time.Duration(d) / time.Millisecond), nil
+}
+
+// RetentionFor returns how long to retain the block with the given meta. Zero means forever.
+func (p *RetentionPolicies) RetentionFor(m *metadata.Meta) time.Duration {
+	res := ResolutionLevel(m.Thanos.Downsample.Resolution)
+	if match := mostSpecific(p.policies, labels.FromMap(m.Thanos.Labels), res); match != nil {
+		return match.retention
+	}
+	return p.retentionByResolution[res]
+}
+
+// SeriesRetentionFor returns how long to retain the series with the given labels in blocks of the given resolution.
+// Zero means as long as the block is retained.
+func (p *RetentionPolicies) SeriesRetentionFor(lset labels.Labels, res ResolutionLevel) time.Duration {
+	if match := mostSpecific(p.seriesPolicies, lset, res); match != nil {
+		return match.retention
+	}
+	return 0
+}
+
 // ApplyRetentionPolicyByResolution removes blocks depending on the specified retentionByResolution based on blocks MaxTime.
 // A value of 0 disables the retention for its resolution.
 func ApplyRetentionPolicyByResolution(ctx context.Context, logger log.Logger, bkt objstore.Bucket, fetcher block.MetadataFetcher, retentionByResolution map[ResolutionLevel]time.Duration) error {
-	level.Info(logger).Log("msg", "start optional retention")
+	_, err := ApplyRetentionPolicies(ctx, logger, bkt, fetcher, &RetentionPolicies{retentionByResolution: retentionByResolution}, false)
+	return err
+}
+
+// ApplyRetentionPolicies removes blocks retained longer than the given policies allow, based on blocks MaxTime.
+// It returns metas of the removed blocks. If dryRun is true, blocks are only listed and returned, not removed.
+func ApplyRetentionPolicies(ctx context.Context, logger log.Logger, bkt objstore.Bucket, fetcher block.MetadataFetcher, policies *RetentionPolicies, dryRun bool) ([]*metadata.Meta, error) {
+	level.Info(logger).Log("msg", "start optional retention", "dryRun", dryRun)
 	metas, _, err := fetcher.Fetch(ctx)
 	if err != nil {
-		return errors.Wrap(err, "fetch metas")
+		return nil, errors.Wrap(err, "fetch metas")
 	}
 
+	var deleted []*metadata.Meta
 	for id, m := range metas {
-		retentionDuration := retentionByResolution[ResolutionLevel(m.Thanos.Downsample.Resolution)]
+		retentionDuration := policies.RetentionFor(m)
 		if retentionDuration.Seconds() == 0 {
 			continue
 		}
 
 		maxTime := time.Unix(m.MaxTime/1000, 0)
-		if time.Now().After(maxTime.Add(retentionDuration)) {
-			level.Info(logger).Log("msg", "applying retention: deleting block", "id", id, "maxTime", maxTime.String())
-			if err := block.Delete(ctx, logger, bkt, id); err != nil {
-				return errors.Wrap(err, "delete block")
-			}
+		if !time.Now().After(maxTime.Add(retentionDuration)) {
+			continue
+		}
+		deleted = append(deleted, m)
+
+		if dryRun {
+			level.Info(logger).Log("msg", "retention dry run: would delete block", "id", id, "maxTime", maxTime.String(),
+				"labels", labels.FromMap(m.Thanos.Labels).String(), "resolution", m.Thanos.Downsample.Resolution, "retention", retentionDuration)
+			continue
+		}
+		level.Info(logger).Log("msg", "applying retention: deleting block", "id", id, "maxTime", maxTime.String())
+		if err := block.Delete(ctx, logger, bkt, id); err != nil {
+			return deleted, errors.Wrap(err, "delete block")
 		}
 	}
 
 	level.Info(logger).Log("msg", "optional retention apply done")
-	return nil
+	return deleted, nil
 }
@@ -256,7 +256,100 @@ func TestApplyRetentionPolicyByResolution(t *testing.T) {
 	}
 }
 
+func TestRetentionPolicies(t *testing.T) {
+	policies, err := compact.NewRetentionPolicies([]byte(`
+policies:
+- selector: '{env="dev"}'
+  retention: 7d
+- selector: '{env="dev"}'
+  resolution: 1h
+  retention: 30d
+- selector: '{env="dev", cluster="eu"}'
+  retention: 14d
+- selector: '{env=~"dev|test"}'
+  retention: 1d
+- resolution: raw
+  retention: 0d
+`), map[compact.ResolutionLevel]time.Duration{
+		compact.ResolutionLevelRaw: 24 * time.Hour,
+		compact.ResolutionLevel5m:  48 * time.Hour,
+	})
+	testutil.Ok(t, err)
+
+	for _, tcase := range []struct {
+		labels     map[string]string
+		resolution compact.ResolutionLevel
+		exp        time.Duration
+	}{
+		{labels: map[string]string{"env": "dev"}, resolution: compact.ResolutionLevelRaw, exp: 7 * 24 * time.Hour},
+		{labels: map[string]string{"env": "dev"}, resolution: compact.ResolutionLevel1h, exp: 30 * 24 * time.Hour},
+		{labels: map[string]string{"env": "dev", "cluster": "eu"}, resolution: compact.ResolutionLevel1h, exp: 14 * 24 * time.Hour},
+		{labels: map[string]string{"env": "test"}, resolution: compact.ResolutionLevel5m, exp: 24 * time.Hour},
+		// Policy matching all raw blocks disables retention of the raw resolution flag.
+		{labels: map[string]string{"env": "prod"}, resolution: compact.ResolutionLevelRaw, exp: 0},
+		// Blocks not matching any policy fall back to retention of their resolution.
+		{labels: map[string]string{"env": "prod"}, resolution: compact.ResolutionLevel5m, exp: 48 * time.Hour},
+		{labels: map[string]string{"env": "prod"}, resolution: compact.ResolutionLevel1h, exp: 0},
+	} {
+		m := &metadata.Meta{Thanos: metadata.Thanos{
+			Labels:     tcase.labels,
+			Downsample: metadata.ThanosDownsample{Resolution: int64(tcase.resolution)},
+		}}
+		testutil.Equals(t, tcase.exp, policies.RetentionFor(m), "labels %v resolution %d", tcase.labels, tcase.resolution)
+	}
+
+	_, err = compact.NewRetentionPolicies([]byte(`policies: [{selector: '{env="dev"', retention: 1d}]`), nil)
+	testutil.NotOk(t, err)
+	_, err = compact.NewRetentionPolicies([]byte(`policies: [{resolution: 10x, retention: 1d}]`), nil)
+	testutil.NotOk(t, err)
+	_, err = compact.NewRetentionPolicies([]byte(`policies: [{resolution: 0s, retention: 1d}]`), nil)
+	testutil.NotOk(t, err)
+
+	// Custom downsampling resolutions are allowed.
+	policies, err = compact.NewRetentionPolicies([]byte(`policies: [{resolution: 10m, retention: 1d}]`), nil)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 24*time.Hour, policies.RetentionFor(&metadata.Meta{Thanos: metadata.Thanos{
+		Downsample: metadata.ThanosDownsample{Resolution: int64(10 * time.Minute / time.Millisecond)},
+	}}))
+}
+
+func TestApplyRetentionPolicies_DryRun(t *testing.T) {
+	ctx := context.Background()
+	bkt := inmem.NewBucket()
+	uploadMockBlockWithLabels(t, bkt, "01CPHBEX20729MJQZXE3W0BW40", time.Now().Add(-3*24*time.Hour), time.Now().Add(-2*24*time.Hour), 0, map[string]string{"env": "dev"})
+	uploadMockBlockWithLabels(t, bkt, "01CPHBEX20729MJQZXE3W0BW41", time.Now().Add(-3*24*time.Hour), time.Now().Add(-2*24*time.Hour), 0, map[string]string{"env": "prod"})
+
+	policies, err := compact.NewRetentionPolicies([]byte(`policies: [{selector: '{env="dev"}', retention: 1d}]`), nil)
+	testutil.Ok(t, err)
+
+	metaFetcher, err := block.NewMetaFetcher(log.NewNopLogger(), 32, bkt, "", nil)
+	testutil.Ok(t, err)
+
+	for _, dryRun := range []bool{true, false} {
+		deleted, err := compact.ApplyRetentionPolicies(ctx, log.NewNopLogger(), bkt, metaFetcher, policies, dryRun)
+		testutil.Ok(t, err)
+		testutil.Equals(t, 1, len(deleted))
+		testutil.Equals(t, "01CPHBEX20729MJQZXE3W0BW40", deleted[0].ULID.String())
+
+		got := []string{}
+		testutil.Ok(t, bkt.Iter(ctx, "", func(name string) error {
+			got = append(got, name)
+			return nil
+		}))
+		if dryRun {
+			testutil.Equals(t, []string{"01CPHBEX20729MJQZXE3W0BW40/", "01CPHBEX20729MJQZXE3W0BW41/"}, got)
+			continue
+		}
+		testutil.Equals(t, []string{"01CPHBEX20729MJQZXE3W0BW41/"}, got)
+	}
+}
+
 func uploadMockBlock(t *testing.T, bkt objstore.Bucket, id string, minTime, maxTime time.Time, resolutionLevel int64) {
+	t.Helper()
+	uploadMockBlockWithLabels(t, bkt, id, minTime, maxTime, resolutionLevel, nil)
+}
+
+func uploadMockBlockWithLabels(t *testing.T, bkt objstore.Bucket, id string, minTime, maxTime time.Time, resolutionLevel int64, lset map[string]string) {
 	t.Helper()
 	meta1 := metadata.Meta{
 		BlockMeta: tsdb.BlockMeta{
@@ -266,6 +359,7 @@ func uploadMockBlock(t *testing.T, bkt objstore.Bucket, id string, minTime, maxT
 			Version: 1,
 		},
 		Thanos: metadata.Thanos{
+			Labels: lset,
 			Downsample: metadata.ThanosDownsample{
 				Resolution: resolutionLevel,
 			},
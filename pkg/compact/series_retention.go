@@ -0,0 +1,314 @@
+package compact
+
+import (
+	"context"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/prometheus/prometheus/tsdb/tombstones"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/indexheader"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// HasSeriesPolicies returns true if any series retention policy is configured.
+func (p *RetentionPolicies) HasSeriesPolicies() bool {
+	return len(p.seriesPolicies) > 0
+}
+
+// expiredSeriesPolicies returns number of series policies applicable to the block with the given meta, which
+// retention of the whole block already exceeded. This number only grows over time for a block.
+func (p *RetentionPolicies) expiredSeriesPolicies(m *metadata.Meta, now time.Time) int {
+	var (
+		res     = ResolutionLevel(m.Thanos.Downsample.Resolution)
+		maxTime = time.Unix(m.MaxTime/1000, 0)
+		expired int
+	)
+	for _, policy := range p.seriesPolicies {
+		if policy.retention.Seconds() == 0 {
+			continue
+		}
+		if policy.resolution != nil && *policy.resolution != res {
+			continue
+		}
+		if now.After(maxTime.Add(policy.retention)) {
+			expired++
+		}
+	}
+	return expired
+}
+
+// SeriesRetention applies series retention policies by rewriting blocks without series which are retained longer
+// than their policy allows. Similar to block retention, series are dropped from a block once the block MaxTime is
+// older than their retention, so they are dropped with the granularity of blocks time range.
+type SeriesRetention struct {
+	logger     log.Logger
+	bkt        objstore.Bucket
+	fetcher    block.MetadataFetcher
+	comp       tsdb.Compactor
+	policies   *RetentionPolicies
+	dir        string
+	dryRun     bool
+	progress   *Progress
+	quarantine *Quarantine
+
+	// checked holds number of expired series policies the block was already checked for, so that blocks are not
+	// downloaded again until another policy expires for them.
+	checked map[ulid.ULID]int
+
+	rewrittenBlocks prometheus.Counter
+	deletedSeries   prometheus.Counter
+}
+
+// NewSeriesRetention returns SeriesRetention rewriting blocks of the given bucket in the given working directory.
+// If dryRun is true, series to drop are only logged. The given Progress, if not nil, tracks the blocks to rewrite.
+// The given Quarantine, if not nil, quarantines groups of blocks which failed to be rewritten instead of failing Apply.
+func NewSeriesRetention(logger log.Logger, reg prometheus.Registerer, bkt objstore.Bucket, fetcher block.MetadataFetcher, comp tsdb.Compactor, dir string, policies *RetentionPolicies, dryRun bool, progress *Progress, quarantine *Quarantine) *SeriesRetention {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	r := &SeriesRetention{
+		logger:     logger,
+		bkt:        bkt,
+		fetcher:    fetcher,
+		comp:       comp,
+		policies:   policies,
+		dir:        dir,
+		dryRun:     dryRun,
+		progress:   progress,
+		quarantine: quarantine,
+		checked:    map[ulid.ULID]int{},
+		rewrittenBlocks: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "thanos_compact_series_retention_rewritten_blocks_total",
+			Help: "Total number of blocks rewritten or deleted because of series retention policies.",
+		}),
+		deletedSeries: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "thanos_compact_series_retention_deleted_series_total",
+			Help: "Total number of series dropped from blocks because of series retention policies.",
+		}),
+	}
+	if reg != nil {
+		reg.MustRegister(r.rewrittenBlocks, r.deletedSeries)
+	}
+	return r
+}
+
+// Apply rewrites all blocks containing series retained longer than series retention policies allow.
+func (r *SeriesRetention) Apply(ctx context.Context) error {
+	if !r.policies.HasSeriesPolicies() {
+		return nil
+	}
+	level.Info(r.logger).Log("msg", "start series retention", "dryRun", r.dryRun)
+	metas, _, err := r.fetcher.Fetch(ctx)
+	if err != nil {
+		return errors.Wrap(err, "fetch metas")
+	}
+
+	var (
+		now     = time.Now()
+		todo    []*metadata.Meta
+		expired = map[ulid.ULID]int{}
+	)
+	for id, m := range metas {
+		n := r.policies.expiredSeriesPolicies(m, now)
+		if n == 0 || r.checked[id] >= n {
+			continue
+		}
+		todo = append(todo, m)
+		expired[id] = n
+	}
+	r.progress.StageStarted(RetentionStage, len(todo))
+
+	for _, m := range todo {
+		id := m.ULID
+		r.progress.WorkStarted(RetentionStage, id)
+		newID, err := r.apply(ctx, m, now)
+		r.progress.WorkDone(RetentionStage, err)
+		if err != nil {
+			err = errors.Wrapf(err, "apply series retention to block %s", id)
+			if r.quarantine != nil && ctx.Err() == nil {
+				r.quarantine.Fail(GroupKey(m.Thanos), labels.FromMap(m.Thanos.Labels), err)
+				continue
+			}
+			r.progress.StageDone(RetentionStage, err)
+			return err
+		}
+		r.checked[id] = expired[id]
+		if newID != id {
+			delete(r.checked, id)
+			if newID != (ulid.ULID{}) {
+				r.checked[newID] = expired[id]
+			}
+		}
+	}
+	r.progress.StageDone(RetentionStage, nil)
+
+	level.Info(r.logger).Log("msg", "series retention apply done")
+	return nil
+}
+
+// apply rewrites the given block without expired series. It returns ID of the resulted block, which is the same
+// as the given one if nothing was rewritten and empty if the whole block was deleted.
+func (r *SeriesRetention) apply(ctx context.Context, m *metadata.Meta, now time.Time) (ulid.ULID, error) {
+	tmpdir := filepath.Join(r.dir, m.ULID.String())
+	if err := os.RemoveAll(tmpdir); err != nil {
+		return m.ULID, errors.Wrap(err, "clean working directory")
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpdir); err != nil {
+			level.Warn(r.logger).Log("msg", "failed to remove tmpdir", "err", err, "tmpdir", tmpdir)
+		}
+	}()
+
+	// Only the index is needed to find out which series to drop, the whole block is downloaded only if there are any.
+	bdir := filepath.Join(tmpdir, m.ULID.String())
+	if err := os.MkdirAll(bdir, os.ModePerm); err != nil {
+		return m.ULID, errors.Wrap(err, "create block dir")
+	}
+	indexFn := filepath.Join(bdir, block.IndexFilename)
+	if err := objstore.DownloadFile(ctx, r.logger, r.bkt, path.Join(m.ULID.String(), block.IndexFilename), indexFn); err != nil {
+		return m.ULID, retry(errors.Wrapf(err, "download index of block %s", m.ULID))
+	}
+	stones, deleted, total, err := r.expiredSeries(indexFn, m, now)
+	if err != nil {
+		return m.ULID, err
+	}
+	if deleted == 0 {
+		return m.ULID, nil
+	}
+
+	if r.dryRun {
+		level.Info(r.logger).Log("msg", "series retention dry run: would drop series from block", "id", m.ULID,
+			"series", deleted, "total", total, "labels", labels.FromMap(m.Thanos.Labels).String(), "resolution", m.Thanos.Downsample.Resolution)
+		return m.ULID, nil
+	}
+
+	level.Info(r.logger).Log("msg", "applying series retention: rewriting block", "id", m.ULID, "series", deleted, "total", total)
+	if err := block.Download(ctx, r.logger, r.bkt, m.ULID, bdir); err != nil {
+		return m.ULID, retry(errors.Wrapf(err, "download block %s", m.ULID))
+	}
+
+	b, err := tsdb.OpenBlock(r.logger, bdir, downsample.NewPool())
+	if err != nil {
+		return m.ULID, errors.Wrapf(err, "open block %s", m.ULID)
+	}
+	newID, err := r.comp.Write(tmpdir, &tombstonedBlock{Block: b, stones: stones}, m.MinTime, m.MaxTime, &m.BlockMeta)
+	runutil.CloseWithLogOnErr(r.logger, b, "close block")
+	if err != nil {
+		return m.ULID, errors.Wrapf(err, "rewrite block %s", m.ULID)
+	}
+
+	if newID != (ulid.ULID{}) {
+		newdir := filepath.Join(tmpdir, newID.String())
+
+		// The rewritten block keeps the compaction level and sources of the original one, so the original one gets
+		// garbage collected even if we fail to delete it below.
+		newMeta, err := metadata.InjectThanos(r.logger, newdir, metadata.Thanos{
+			Labels:     m.Thanos.Labels,
+			Downsample: m.Thanos.Downsample,
+			Source:     metadata.CompactorRetentionSource,
+		}, &m.BlockMeta)
+		if err != nil {
+			return m.ULID, errors.Wrapf(err, "failed to finalize the block %s", newdir)
+		}
+
+		if err = os.Remove(filepath.Join(newdir, "tombstones")); err != nil {
+			return m.ULID, errors.Wrap(err, "remove tombstones")
+		}
+
+		newIndexFn := filepath.Join(newdir, block.IndexFilename)
+		if err := block.VerifyIndex(r.logger, newIndexFn, newMeta.MinTime, newMeta.MaxTime); err != nil {
+			return m.ULID, halt(errors.Wrapf(err, "invalid rewritten block %s", newdir))
+		}
+
+		if err := indexheader.WriteJSON(r.logger, newIndexFn, filepath.Join(newdir, block.IndexCacheFilename)); err != nil {
+			return m.ULID, errors.Wrap(err, "write index cache")
+		}
+
+		if err := block.Upload(ctx, r.logger, r.bkt, newdir); err != nil {
+			return m.ULID, retry(errors.Wrapf(err, "upload of %s failed", newID))
+		}
+		level.Info(r.logger).Log("msg", "uploaded block rewritten by series retention", "id", m.ULID, "newID", newID)
+	} else {
+		level.Info(r.logger).Log("msg", "no series left in block after series retention", "id", m.ULID)
+	}
+
+	// Spawn a new context so we always delete a block in full on shutdown.
+	delCtx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	if err := block.Delete(delCtx, r.logger, r.bkt, m.ULID); err != nil {
+		return newID, retry(errors.Wrapf(err, "delete block %s rewritten by series retention", m.ULID))
+	}
+
+	r.rewrittenBlocks.Inc()
+	r.deletedSeries.Add(float64(deleted))
+	return newID, nil
+}
+
+// expiredSeries returns tombstones deleting all series of the given block index, which retention the block is older
+// than, together with number of such series and number of all series.
+func (r *SeriesRetention) expiredSeries(indexFn string, m *metadata.Meta, now time.Time) (tombstones.Reader, int, int, error) {
+	indexr, err := index.NewFileReader(indexFn)
+	if err != nil {
+		return nil, 0, 0, errors.Wrap(err, "open index")
+	}
+	defer runutil.CloseWithLogOnErr(r.logger, indexr, "close index reader")
+
+	postings, err := indexr.Postings(index.AllPostingsKey())
+	if err != nil {
+		return nil, 0, 0, errors.Wrap(err, "get all postings")
+	}
+
+	var (
+		stones  = tombstones.NewMemTombstones()
+		res     = ResolutionLevel(m.Thanos.Downsample.Resolution)
+		maxTime = time.Unix(m.MaxTime/1000, 0)
+
+		lset           labels.Labels
+		chks           []chunks.Meta
+		deleted, total int
+	)
+	for postings.Next() {
+		if err := indexr.Series(postings.At(), &lset, &chks); err != nil {
+			return nil, 0, 0, errors.Wrapf(err, "get series %d", postings.At())
+		}
+		total++
+
+		retention := r.policies.SeriesRetentionFor(lset, res)
+		if retention.Seconds() == 0 || !now.After(maxTime.Add(retention)) {
+			continue
+		}
+		// Whole series is deleted, so none of its chunks needs to be re-encoded.
+		stones.AddInterval(postings.At(), tombstones.Interval{Mint: math.MinInt64, Maxt: math.MaxInt64})
+		deleted++
+	}
+	if err := postings.Err(); err != nil {
+		return nil, 0, 0, errors.Wrap(err, "iterate postings")
+	}
+	return stones, deleted, total, nil
+}
+
+// tombstonedBlock is a block with the given tombstones instead of its own ones.
+type tombstonedBlock struct {
+	*tsdb.Block
+	stones tombstones.Reader
+}
+
+func (b *tombstonedBlock) Tombstones() (tombstones.Reader, error) {
+	return b.stones, nil
+}
@@ -0,0 +1,186 @@
+package compact_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/objstore/inmem"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestRetentionPolicies_SeriesRetentionFor(t *testing.T) {
+	policies, err := compact.NewRetentionPolicies([]byte(`
+series_policies:
+- selector: '{__name__=~"slo:.*"}'
+  retention: 5y
+- selector: ''
+  resolution: raw
+  retention: 30d
+- selector: '{__name__="up"}'
+  retention: 0d
+`), nil)
+	testutil.Ok(t, err)
+	testutil.Assert(t, policies.HasSeriesPolicies(), "expected series policies")
+
+	for _, tcase := range []struct {
+		lset     labels.Labels
+		res      compact.ResolutionLevel
+		expected time.Duration
+	}{
+		{lset: labels.FromStrings("__name__", "slo:errors:ratio"), res: compact.ResolutionLevelRaw, expected: 5 * 365 * 24 * time.Hour},
+		{lset: labels.FromStrings("__name__", "http_requests_total", "path", "/"), res: compact.ResolutionLevelRaw, expected: 30 * 24 * time.Hour},
+		{lset: labels.FromStrings("__name__", "http_requests_total", "path", "/"), res: compact.ResolutionLevel5m, expected: 0},
+		{lset: labels.FromStrings("__name__", "up"), res: compact.ResolutionLevelRaw, expected: 0},
+	} {
+		t.Run(tcase.lset.String(), func(t *testing.T) {
+			testutil.Equals(t, tcase.expected, policies.SeriesRetentionFor(tcase.lset, tcase.res))
+		})
+	}
+
+	policies, err = compact.NewRetentionPolicies([]byte(`policies: [{retention: 1d}]`), nil)
+	testutil.Ok(t, err)
+	testutil.Assert(t, !policies.HasSeriesPolicies(), "expected no series policies")
+
+	_, err = compact.NewRetentionPolicies([]byte(`series_policies: [{selector: '{__name__=~"slo:.*"', retention: 1d}]`), nil)
+	testutil.NotOk(t, err)
+}
+
+func TestSeriesRetention_Apply(t *testing.T) {
+	ctx := context.Background()
+	logger := log.NewNopLogger()
+
+	dir, err := ioutil.TempDir("", "series-retention-test")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	bkt := inmem.NewBucket()
+	now := time.Now()
+	extLset := labels.FromStrings("ext", "1")
+
+	var (
+		slo    = labels.FromStrings("__name__", "slo:errors:ratio")
+		req1   = labels.FromStrings("__name__", "http_requests_total", "path", "/a")
+		req2   = labels.FromStrings("__name__", "http_requests_total", "path", "/b")
+		blocks = map[string]ulid.ULID{}
+	)
+	for name, b := range map[string]struct {
+		series     []labels.Labels
+		mint, maxt time.Time
+	}{
+		"old":        {series: []labels.Labels{slo, req1, req2}, mint: now.Add(-10 * 24 * time.Hour), maxt: now.Add(-9 * 24 * time.Hour)},
+		"old-no-slo": {series: []labels.Labels{req1}, mint: now.Add(-9 * 24 * time.Hour), maxt: now.Add(-8 * 24 * time.Hour)},
+		"recent":     {series: []labels.Labels{slo, req1, req2}, mint: now.Add(-2 * time.Hour), maxt: now},
+	} {
+		id, err := testutil.CreateBlock(ctx, dir, b.series, 100, timestamp(b.mint), timestamp(b.maxt), extLset, 0)
+		testutil.Ok(t, err)
+		testutil.Ok(t, block.Upload(ctx, logger, bkt, filepath.Join(dir, id.String())))
+		blocks[name] = id
+	}
+
+	policies, err := compact.NewRetentionPolicies([]byte(`
+series_policies:
+- selector: '{__name__=~"slo:.*"}'
+  retention: 0d
+- selector: ''
+  retention: 7d
+`), nil)
+	testutil.Ok(t, err)
+
+	metaFetcher, err := block.NewMetaFetcher(logger, 32, bkt, "", nil)
+	testutil.Ok(t, err)
+	comp, err := tsdb.NewLeveledCompactor(ctx, nil, logger, []int64{1000}, nil)
+	testutil.Ok(t, err)
+
+	// Dry run must not touch any block.
+	testutil.Ok(t, compact.NewSeriesRetention(logger, nil, bkt, metaFetcher, comp, filepath.Join(dir, "retention"), policies, true, nil, nil).Apply(ctx))
+	metas, _, err := metaFetcher.Fetch(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 3, len(metas))
+	for _, id := range blocks {
+		_, ok := metas[id]
+		testutil.Assert(t, ok, "block %s removed by dry run", id)
+	}
+
+	r := compact.NewSeriesRetention(logger, nil, bkt, metaFetcher, comp, filepath.Join(dir, "retention"), policies, false, nil, nil)
+	testutil.Ok(t, r.Apply(ctx))
+
+	metas, _, err = metaFetcher.Fetch(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(metas))
+	_, ok := metas[blocks["recent"]]
+	testutil.Assert(t, ok, "recent block must not be rewritten")
+	_, ok = metas[blocks["old"]]
+	testutil.Assert(t, !ok, "old block must be rewritten")
+	_, ok = metas[blocks["old-no-slo"]]
+	testutil.Assert(t, !ok, "old block without retained series must be deleted")
+
+	var rewritten *metadata.Meta
+	for id, m := range metas {
+		if id != blocks["recent"] {
+			rewritten = m
+		}
+	}
+	testutil.Equals(t, metadata.CompactorRetentionSource, rewritten.Thanos.Source)
+	testutil.Equals(t, extLset.Map(), rewritten.Thanos.Labels)
+	testutil.Equals(t, []ulid.ULID{blocks["old"]}, rewritten.Compaction.Sources)
+	testutil.Equals(t, timestamp(now.Add(-10*24*time.Hour)), rewritten.MinTime)
+	testutil.Equals(t, uint64(1), rewritten.Stats.NumSeries)
+	testutil.Equals(t, []labels.Labels{slo}, seriesInBlock(t, ctx, bkt, filepath.Join(dir, "index"), rewritten.ULID))
+	testutil.Equals(t, []labels.Labels{req1, req2, slo}, seriesInBlock(t, ctx, bkt, filepath.Join(dir, "index"), blocks["recent"]))
+
+	// Already checked blocks are not rewritten again.
+	testutil.Ok(t, r.Apply(ctx))
+	metas, _, err = metaFetcher.Fetch(ctx)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(metas))
+	_, ok = metas[rewritten.ULID]
+	testutil.Assert(t, ok, "rewritten block must not be rewritten again")
+}
+
+func timestamp(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func seriesInBlock(t *testing.T, ctx context.Context, bkt objstore.Bucket, dir string, id ulid.ULID) []labels.Labels {
+	t.Helper()
+
+	testutil.Ok(t, os.MkdirAll(dir, os.ModePerm))
+	fn := filepath.Join(dir, id.String())
+	testutil.Ok(t, objstore.DownloadFile(ctx, log.NewNopLogger(), bkt, path.Join(id.String(), block.IndexFilename), fn))
+
+	indexr, err := index.NewFileReader(fn)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, indexr.Close()) }()
+
+	p, err := indexr.Postings(index.AllPostingsKey())
+	testutil.Ok(t, err)
+
+	var series []labels.Labels
+	for p.Next() {
+		var (
+			lset labels.Labels
+			chks []chunks.Meta
+		)
+		testutil.Ok(t, indexr.Series(p.At(), &lset, &chks))
+		series = append(series, lset)
+	}
+	testutil.Ok(t, p.Err())
+	sort.Slice(series, func(i, j int) bool { return labels.Compare(series[i], series[j]) < 0 })
+	return series
+}
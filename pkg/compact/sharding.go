@@ -0,0 +1,194 @@
+package compact
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/discovery/dns"
+)
+
+// GroupSharding splits compaction groups between multiple compactor instances sharing a bucket. Groups are assigned
+// by rendezvous hashing of their external labels, so groups of all resolutions of the same external labels are owned
+// by the same member, and only groups of the members joining or leaving move between instances.
+type GroupSharding struct {
+	logger   log.Logger
+	resolver dns.Resolver
+	self     string
+	members  []string
+	settle   time.Duration
+	now      func() time.Time
+
+	mtx          sync.RWMutex
+	resolved     []string
+	pending      []string
+	pendingSince time.Time
+
+	membersGauge prometheus.Gauge
+	ownedGroups  prometheus.Gauge
+}
+
+// NewGroupSharding returns GroupSharding of the given member addresses, where self is the address of this instance.
+// Addresses prefixed with `dns+` or `dnssrv+` are resolved through respective DNS lookup (A/AAAA or SRV). A changed
+// membership is used only after it was resolved unchanged for the settle duration.
+func NewGroupSharding(logger log.Logger, reg prometheus.Registerer, resolver dns.Resolver, self string, members []string, settle time.Duration) (*GroupSharding, error) {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	if self == "" {
+		return nil, errors.New("address of this compactor instance is required for sharding")
+	}
+	if len(members) == 0 {
+		return nil, errors.New("at least one member is required for sharding")
+	}
+
+	s := &GroupSharding{
+		logger:   logger,
+		resolver: resolver,
+		self:     self,
+		members:  members,
+		settle:   settle,
+		now:      time.Now,
+		membersGauge: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "thanos_compact_shard_members",
+			Help: "Number of compactor instances sharing compaction groups of the bucket.",
+		}),
+		ownedGroups: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "thanos_compact_shard_owned_groups",
+			Help: "Number of compaction groups owned by this compactor instance.",
+		}),
+	}
+	if reg != nil {
+		reg.MustRegister(s.membersGauge, s.ownedGroups)
+	}
+	return s, nil
+}
+
+// Resolve resolves the current members. It refuses to proceed if the membership is ambiguous, i.e. this instance is
+// not among members or some address is listed more than once. Members do not coordinate and observe membership changes
+// at different times, so a changed membership, including the initial one, is ambiguous as well until it is resolved
+// unchanged for the settle duration. Retry error is returned in that case and no group work should be done, so that
+// no group is owned by two members at once.
+func (s *GroupSharding) Resolve(ctx context.Context) error {
+	var resolved []string
+	for _, addr := range s.members {
+		qtypeAndName := strings.SplitN(addr, "+", 2)
+		if len(qtypeAndName) != 2 {
+			resolved = append(resolved, addr)
+			continue
+		}
+		addrs, err := s.resolver.Resolve(ctx, qtypeAndName[1], dns.QType(qtypeAndName[0]))
+		if err != nil {
+			return retry(errors.Wrapf(err, "resolve shard member %s", addr))
+		}
+		if len(addrs) == 0 {
+			return retry(errors.Errorf("no addresses resolved for shard member %s", addr))
+		}
+		resolved = append(resolved, addrs...)
+	}
+	sort.Strings(resolved)
+
+	for i := 1; i < len(resolved); i++ {
+		if resolved[i] == resolved[i-1] {
+			return errors.Errorf("ambiguous shard membership: member %s is listed more than once", resolved[i])
+		}
+	}
+	if i := sort.SearchStrings(resolved, s.self); i == len(resolved) || resolved[i] != s.self {
+		return errors.Errorf("ambiguous shard membership: this instance %s is not among members %v", s.self, resolved)
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.membersGauge.Set(float64(len(resolved)))
+	if s.resolved != nil && equalStrings(s.resolved, resolved) {
+		s.pending = nil
+		return nil
+	}
+
+	now := s.now()
+	if s.pending == nil || !equalStrings(s.pending, resolved) {
+		if s.resolved != nil {
+			level.Warn(s.logger).Log("msg", "shard membership changed", "previous", strings.Join(s.resolved, ","), "current", strings.Join(resolved, ","))
+		}
+		s.pending, s.pendingSince = resolved, now
+	}
+	if stable := now.Sub(s.pendingSince); stable < s.settle {
+		return retry(errors.Errorf("ambiguous shard membership: members %v are resolved unchanged only for %s, waiting for %s", resolved, stable, s.settle))
+	}
+	s.resolved, s.pending = resolved, nil
+	return nil
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Owns returns true if groups of blocks with the given external labels are owned by this instance. Before the first
+// successful Resolve, no groups are owned.
+func (s *GroupSharding) Owns(extLset map[string]string) bool {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	return s.owner(labels.FromMap(extLset).String()) == s.self
+}
+
+func (s *GroupSharding) owner(key string) string {
+	var (
+		owner string
+		max   uint64
+	)
+	for _, m := range s.resolved {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(m))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(key))
+		if w := h.Sum64(); owner == "" || w > max {
+			owner, max = m, w
+		}
+	}
+	return owner
+}
+
+// IsLeader returns true if this instance is responsible for work not belonging to any group, e.g. cleaning of aborted
+// partial uploads.
+func (s *GroupSharding) IsLeader() bool {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	return len(s.resolved) > 0 && s.resolved[0] == s.self
+}
+
+// Filter filters out blocks of groups not owned by this instance. Blocks of all resolutions are kept together, so that
+// downsampling sees which blocks were already downsampled.
+func (s *GroupSharding) Filter(metas map[ulid.ULID]*metadata.Meta, synced block.GaugeLabeled, _ bool) {
+	owned := map[string]struct{}{}
+	for id, m := range metas {
+		if s.Owns(m.Thanos.Labels) {
+			owned[GroupKey(m.Thanos)] = struct{}{}
+			continue
+		}
+		synced.WithLabelValues(block.NotOwnedMeta).Inc()
+		delete(metas, id)
+	}
+	s.ownedGroups.Set(float64(len(owned)))
+}
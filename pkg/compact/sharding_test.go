@@ -0,0 +1,195 @@
+package compact
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/discovery/dns"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+type mockResolver struct {
+	res map[string][]string
+	err error
+}
+
+func (r *mockResolver) Resolve(_ context.Context, name string, _ dns.QType) ([]string, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.res[name], nil
+}
+
+type nopGaugeLabeled struct{}
+
+func (nopGaugeLabeled) WithLabelValues(...string) prometheus.Gauge {
+	return prometheus.NewGauge(prometheus.GaugeOpts{Name: "nop"})
+}
+
+func TestGroupSharding_Resolve(t *testing.T) {
+	ctx := context.Background()
+	resolver := &mockResolver{res: map[string][]string{"compactor:10902": {"10.0.0.1:10902", "10.0.0.2:10902"}}}
+
+	_, err := NewGroupSharding(nil, nil, resolver, "", []string{"a"}, 0)
+	testutil.NotOk(t, err)
+	_, err = NewGroupSharding(nil, nil, resolver, "a", nil, 0)
+	testutil.NotOk(t, err)
+
+	s, err := NewGroupSharding(nil, nil, resolver, "10.0.0.1:10902", []string{"dns+compactor:10902", "10.0.0.3:10902"}, 0)
+	testutil.Ok(t, err)
+	testutil.Ok(t, s.Resolve(ctx))
+	testutil.Equals(t, []string{"10.0.0.1:10902", "10.0.0.2:10902", "10.0.0.3:10902"}, s.resolved)
+	testutil.Assert(t, s.IsLeader(), "expected the first member to be the leader")
+
+	// Changed membership is used right away.
+	resolver.res["compactor:10902"] = []string{"10.0.0.1:10902"}
+	testutil.Ok(t, s.Resolve(ctx))
+	testutil.Equals(t, []string{"10.0.0.1:10902", "10.0.0.3:10902"}, s.resolved)
+
+	// DNS failures are retriable.
+	resolver.err = errors.New("no such host")
+	err = s.Resolve(ctx)
+	testutil.NotOk(t, err)
+	testutil.Assert(t, IsRetryError(err), "expected retry error, got %v", err)
+	resolver.err = nil
+
+	// This instance not among members.
+	resolver.res["compactor:10902"] = []string{"10.0.0.2:10902"}
+	err = s.Resolve(ctx)
+	testutil.NotOk(t, err)
+	testutil.Assert(t, !IsRetryError(err), "expected non-retriable error, got %v", err)
+
+	// Duplicated members.
+	resolver.res["compactor:10902"] = []string{"10.0.0.1:10902", "10.0.0.3:10902"}
+	err = s.Resolve(ctx)
+	testutil.NotOk(t, err)
+	testutil.Assert(t, !IsRetryError(err), "expected non-retriable error, got %v", err)
+}
+
+func TestGroupSharding_Resolve_Settle(t *testing.T) {
+	ctx := context.Background()
+	resolver := &mockResolver{res: map[string][]string{"compactor:10902": {"10.0.0.1:10902", "10.0.0.2:10902"}}}
+
+	s, err := NewGroupSharding(nil, nil, resolver, "10.0.0.1:10902", []string{"dns+compactor:10902"}, 5*time.Minute)
+	testutil.Ok(t, err)
+	now := time.Unix(0, 0)
+	s.now = func() time.Time { return now }
+
+	resolve := func(settled bool) {
+		t.Helper()
+		err := s.Resolve(ctx)
+		if settled {
+			testutil.Ok(t, err)
+			return
+		}
+		testutil.NotOk(t, err)
+		testutil.Assert(t, IsRetryError(err), "expected retry error, got %v", err)
+	}
+
+	// The initial membership is not used until it settles.
+	resolve(false)
+	testutil.Assert(t, s.resolved == nil, "expected no members before the membership settles")
+	testutil.Assert(t, !s.IsLeader(), "expected no leader before the membership settles")
+	now = now.Add(time.Minute)
+	resolve(false)
+	now = now.Add(4 * time.Minute)
+	resolve(true)
+	testutil.Equals(t, []string{"10.0.0.1:10902", "10.0.0.2:10902"}, s.resolved)
+
+	// Changed membership is ambiguous until it stays the same for the settle duration.
+	resolver.res["compactor:10902"] = []string{"10.0.0.1:10902", "10.0.0.2:10902", "10.0.0.3:10902"}
+	resolve(false)
+	testutil.Equals(t, []string{"10.0.0.1:10902", "10.0.0.2:10902"}, s.resolved)
+	now = now.Add(3 * time.Minute)
+	resolver.res["compactor:10902"] = []string{"10.0.0.1:10902", "10.0.0.3:10902"}
+	resolve(false)
+	now = now.Add(3 * time.Minute)
+	resolve(false)
+	now = now.Add(2 * time.Minute)
+	resolve(true)
+	testutil.Equals(t, []string{"10.0.0.1:10902", "10.0.0.3:10902"}, s.resolved)
+
+	// Membership changed back before it settled is used right away.
+	resolver.res["compactor:10902"] = []string{"10.0.0.1:10902"}
+	resolve(false)
+	resolver.res["compactor:10902"] = []string{"10.0.0.1:10902", "10.0.0.3:10902"}
+	resolve(true)
+	testutil.Equals(t, []string{"10.0.0.1:10902", "10.0.0.3:10902"}, s.resolved)
+	resolver.res["compactor:10902"] = []string{"10.0.0.1:10902"}
+	resolve(false)
+}
+
+func TestGroupSharding_Filter(t *testing.T) {
+	ctx := context.Background()
+	members := []string{"a:10902", "b:10902", "c:10902"}
+
+	metas := map[ulid.ULID]*metadata.Meta{}
+	for i := 0; i < 100; i++ {
+		for _, res := range []int64{0, 5 * 60 * 1000} {
+			id := ulid.MustNew(uint64(i), nil)
+			id[15] = byte(res)
+			m := &metadata.Meta{}
+			m.ULID = id
+			m.Thanos.Labels = map[string]string{"cluster": fmt.Sprintf("%d", i)}
+			m.Thanos.Downsample.Resolution = res
+			metas[id] = m
+		}
+	}
+
+	owners := map[ulid.ULID]string{}
+	for _, self := range members {
+		s, err := NewGroupSharding(nil, nil, &mockResolver{}, self, members, 0)
+		testutil.Ok(t, err)
+
+		// Nothing is owned before resolving members.
+		owned := copyMetas(metas)
+		s.Filter(owned, nopGaugeLabeled{}, false)
+		testutil.Equals(t, 0, len(owned))
+
+		testutil.Ok(t, s.Resolve(ctx))
+		owned = copyMetas(metas)
+		s.Filter(owned, nopGaugeLabeled{}, false)
+		testutil.Assert(t, len(owned) > 0, "expected %s to own some groups", self)
+
+		for id, m := range owned {
+			prev, ok := owners[id]
+			testutil.Assert(t, !ok, "block %s owned by both %s and %s", id, prev, self)
+			owners[id] = self
+			testutil.Assert(t, s.Owns(m.Thanos.Labels), "expected %s to own group of block %s", self, id)
+		}
+	}
+	testutil.Equals(t, len(metas), len(owners))
+
+	// Blocks of all resolutions with the same external labels have the same owner.
+	for id, m := range metas {
+		for oid, o := range metas {
+			if m.Thanos.Labels["cluster"] == o.Thanos.Labels["cluster"] {
+				testutil.Equals(t, owners[id], owners[oid])
+			}
+		}
+	}
+
+	// Only groups of the leaving member move to other members.
+	s, err := NewGroupSharding(nil, nil, &mockResolver{}, "a:10902", members[:2], 0)
+	testutil.Ok(t, err)
+	testutil.Ok(t, s.Resolve(ctx))
+	for id, m := range metas {
+		if owners[id] == "a:10902" {
+			testutil.Assert(t, s.Owns(m.Thanos.Labels), "group of block %s moved from a remaining member", id)
+		}
+	}
+}
+
+func copyMetas(metas map[ulid.ULID]*metadata.Meta) map[ulid.ULID]*metadata.Meta {
+	c := make(map[ulid.ULID]*metadata.Meta, len(metas))
+	for id, m := range metas {
+		c[id] = m
+	}
+	return c
+}
@@ -0,0 +1,552 @@
+package compact
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/indexheader"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanos/pkg/objstore"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+const (
+	// indexTOCLen is the size of the table of contents at the end of the index file.
+	indexTOCLen = 6*8 + 4
+	// maxRangeSkip is the maximum number of bytes skipped by reading instead of starting a new range request.
+	maxRangeSkip = 1 << 20
+)
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// StreamedCompactor compacts blocks without downloading them. It reads series of source blocks sequentially via range
+// requests from the bucket and writes the compacted block incrementally, so only the compacted block and index caches
+// of source blocks are stored on local disk. Overlapping blocks are not supported.
+// Errors of the object storage are returned as retry errors.
+type StreamedCompactor struct {
+	logger log.Logger
+	bkt    objstore.BucketReader
+	pool   chunkenc.Pool
+}
+
+// NewStreamedCompactor returns a new StreamedCompactor.
+func NewStreamedCompactor(logger log.Logger, bkt objstore.BucketReader) *StreamedCompactor {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &StreamedCompactor{logger: logger, bkt: bkt, pool: downsample.NewPool()}
+}
+
+// IndexIssueStats reads series of the index of the block with the given meta in the bucket and gathers the same stats
+// as block.GatherIndexIssueStats does for a downloaded index. The index cache of the block is stored in its
+// subdirectory of the given directory and reused by Compact.
+func (c *StreamedCompactor) IndexIssueStats(ctx context.Context, dir string, meta *metadata.Meta) (stats block.Stats, err error) {
+	if err := os.MkdirAll(filepath.Join(dir, meta.ULID.String()), 0777); err != nil {
+		return stats, errors.Wrap(err, "create block dir")
+	}
+	b, err := newStreamedBlock(ctx, c.logger, c.bkt, c.pool, dir, meta)
+	if err != nil {
+		return stats, errors.Wrapf(err, "open block %s", meta.ULID)
+	}
+	defer runutil.CloseWithLogOnErr(c.logger, b, "streamed block reader")
+
+	var lastLset labels.Labels
+	for {
+		lset, err := b.readSeries()
+		if err != nil {
+			return stats, errors.Wrapf(err, "read series of block %s", meta.ULID)
+		}
+		if lset == nil {
+			return stats, nil
+		}
+		if err := stats.AddSeries(c.logger, b.ref, lastLset, lset, b.chks, meta.MinTime, meta.MaxTime); err != nil {
+			return stats, errors.Wrapf(err, "block %s", meta.ULID)
+		}
+		lastLset = lset
+	}
+}
+
+// Compact compacts blocks with the given metas into a new block in the given directory and returns its ID. Index
+// caches of source blocks are stored in their subdirectories. Empty ID is returned if the compacted block would have
+// no samples.
+func (c *StreamedCompactor) Compact(ctx context.Context, dir string, metas []*metadata.Meta) (id ulid.ULID, err error) {
+	var blocks []*streamedBlock
+	defer func() {
+		for _, b := range blocks {
+			runutil.CloseWithLogOnErr(c.logger, b, "streamed block reader")
+		}
+	}()
+
+	symbols := map[string]struct{}{}
+	for _, m := range metas {
+		if err := os.MkdirAll(filepath.Join(dir, m.ULID.String()), 0777); err != nil {
+			return id, errors.Wrap(err, "create block dir")
+		}
+		b, err := newStreamedBlock(ctx, c.logger, c.bkt, c.pool, dir, m)
+		if err != nil {
+			return id, errors.Wrapf(err, "open block %s", m.ULID)
+		}
+		blocks = append(blocks, b)
+
+		for _, ln := range b.indexr.LabelNames() {
+			symbols[ln] = struct{}{}
+			for _, lv := range b.indexr.LabelValues(ln) {
+				symbols[lv] = struct{}{}
+			}
+		}
+	}
+	sortedSymbols := make([]string, 0, len(symbols))
+	for s := range symbols {
+		sortedSymbols = append(sortedSymbols, s)
+	}
+	sort.Strings(sortedSymbols)
+
+	id = ulid.MustNew(ulid.Now(), rand.New(rand.NewSource(time.Now().UnixNano())))
+	bdir := filepath.Join(dir, id.String())
+	if err := os.MkdirAll(bdir, 0777); err != nil {
+		return id, errors.Wrap(err, "create compacted block dir")
+	}
+
+	w, err := downsample.NewStreamedBlockWriter(bdir, index.NewStringListIter(sortedSymbols), c.logger, streamedCompactedMeta(id, metas))
+	if err != nil {
+		return id, errors.Wrap(err, "create streamed block writer")
+	}
+	defer runutil.CloseWithErrCapture(&err, w, "close streamed block writer")
+
+	for _, b := range blocks {
+		b.next()
+	}
+
+	var (
+		samples uint64
+		chks    []chunks.Meta
+	)
+	for {
+		var min labels.Labels
+		for _, b := range blocks {
+			if b.err != nil {
+				return id, b.err
+			}
+			if b.lset != nil && (min == nil || labels.Compare(b.lset, min) < 0) {
+				min = b.lset
+			}
+		}
+		if min == nil {
+			break
+		}
+		lset := append(labels.Labels(nil), min...)
+
+		chks = chks[:0]
+		for _, b := range blocks {
+			if b.lset != nil && labels.Equal(b.lset, lset) {
+				chks = append(chks, b.chks...)
+				b.next()
+			}
+		}
+		sort.Slice(chks, func(i, j int) bool { return chks[i].MinTime < chks[j].MinTime })
+		for i := range chks {
+			if i > 0 && chks[i].MinTime <= chks[i-1].MaxTime {
+				return id, halt(errors.Errorf("overlapping chunks of series %s, streamed compaction of overlapping blocks is not supported", lset))
+			}
+			samples += uint64(chks[i].Chunk.NumSamples())
+		}
+
+		if err := w.WriteSeries(lset, chks); err != nil {
+			return id, errors.Wrapf(err, "write series %s", lset)
+		}
+	}
+	if samples == 0 {
+		if err := w.Close(); err != nil {
+			return id, errors.Wrap(err, "close streamed block writer")
+		}
+		if err := os.RemoveAll(bdir); err != nil {
+			return id, errors.Wrap(err, "remove empty compacted block")
+		}
+		return ulid.ULID{}, nil
+	}
+	return id, nil
+}
+
+// streamedCompactedMeta returns meta of a block compacted from the given blocks, the same as the one of the TSDB compactor.
+func streamedCompactedMeta(id ulid.ULID, metas []*metadata.Meta) metadata.Meta {
+	res := metadata.Meta{Thanos: metas[0].Thanos}
+	res.ULID = id
+	res.MinTime, res.MaxTime = metas[0].MinTime, metas[0].MaxTime
+
+	sources := map[ulid.ULID]struct{}{}
+	for _, m := range metas {
+		if m.MinTime < res.MinTime {
+			res.MinTime = m.MinTime
+		}
+		if m.MaxTime > res.MaxTime {
+			res.MaxTime = m.MaxTime
+		}
+		if m.Compaction.Level > res.Compaction.Level {
+			res.Compaction.Level = m.Compaction.Level
+		}
+		for _, s := range m.Compaction.Sources {
+			sources[s] = struct{}{}
+		}
+		res.Compaction.Parents = append(res.Compaction.Parents, tsdb.BlockDesc{
+			ULID:    m.ULID,
+			MinTime: m.MinTime,
+			MaxTime: m.MaxTime,
+		})
+	}
+	res.Compaction.Level++
+	for s := range sources {
+		res.Compaction.Sources = append(res.Compaction.Sources, s)
+	}
+	sort.Slice(res.Compaction.Sources, func(i, j int) bool {
+		return res.Compaction.Sources[i].Compare(res.Compaction.Sources[j]) < 0
+	})
+	res.Thanos.Downsample.Aggregates = commonAggregates(metas)
+	return res
+}
+
+// streamedBlock iterates over series of a block in the bucket, in the order of the index.
+type streamedBlock struct {
+	logger log.Logger
+	meta   *metadata.Meta
+	pool   chunkenc.Pool
+	dec    index.Decoder
+	indexr *indexheader.JSONReader
+
+	series    *rangeReader
+	seriesEnd int64
+	aligned   bool
+	ref       uint64 // Reference of the last read series.
+	chunks    map[uint64]*rangeReader
+	newChunks func(seq uint64) *rangeReader
+
+	lset labels.Labels
+	chks []chunks.Meta
+	err  error
+}
+
+func newStreamedBlock(ctx context.Context, logger log.Logger, bkt objstore.BucketReader, pool chunkenc.Pool, dir string, meta *metadata.Meta) (*streamedBlock, error) {
+	indexr, err := indexheader.NewJSONReader(ctx, logger, bkt, dir, meta.ULID)
+	if err != nil {
+		return nil, retry(errors.Wrap(err, "read index cache"))
+	}
+
+	indexName := path.Join(meta.ULID.String(), block.IndexFilename)
+	size, err := bkt.ObjectSize(ctx, indexName)
+	if err != nil {
+		return nil, retry(errors.Wrap(err, "get index size"))
+	}
+	if size < indexTOCLen {
+		return nil, errors.Errorf("index of size %d too small", size)
+	}
+	toc, err := readTOC(ctx, logger, bkt, indexName, int64(size))
+	if err != nil {
+		return nil, errors.Wrap(err, "read index TOC")
+	}
+
+	b := &streamedBlock{
+		logger:    logger,
+		meta:      meta,
+		pool:      pool,
+		dec:       index.Decoder{LookupSymbol: indexr.LookupSymbol},
+		indexr:    indexr,
+		series:    newRangeReader(ctx, bkt, indexName, int64(toc.LabelIndices)),
+		seriesEnd: int64(toc.LabelIndices),
+		aligned:   indexr.IndexVersion() == index.FormatV2,
+		chunks:    map[uint64]*rangeReader{},
+		newChunks: func(seq uint64) *rangeReader {
+			return newRangeReader(ctx, bkt, path.Join(meta.ULID.String(), block.ChunksDirname, fmt.Sprintf("%0.6d", seq+1)), -1)
+		},
+	}
+	if err := b.series.seek(int64(toc.Series)); err != nil {
+		return nil, errors.Wrap(err, "seek to series")
+	}
+	return b, nil
+}
+
+func readTOC(ctx context.Context, logger log.Logger, bkt objstore.BucketReader, name string, size int64) (*index.TOC, error) {
+	rc, err := bkt.GetRange(ctx, name, size-indexTOCLen, indexTOCLen)
+	if err != nil {
+		return nil, retry(err)
+	}
+	defer runutil.CloseWithLogOnErr(logger, rc, "index TOC reader")
+
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, retry(err)
+	}
+	return index.NewTOCFromByteSlice(realByteSlice(b))
+}
+
+// next moves to the next series and reads its chunks. Labels are nil when there are no more series or on error.
+func (b *streamedBlock) next() {
+	b.lset = nil
+	if b.err != nil {
+		return
+	}
+	lset, err := b.readSeries()
+	if err == nil && lset != nil {
+		err = b.readChunks(lset)
+	}
+	if err != nil {
+		b.err = errors.Wrapf(err, "read series of block %s", b.meta.ULID)
+		return
+	}
+	b.lset = lset
+}
+
+// readSeries reads labels and chunk metas of the next series. Labels are nil when there are no more series.
+func (b *streamedBlock) readSeries() (labels.Labels, error) {
+	if b.aligned {
+		// Series of the v2 index are 16 byte aligned.
+		if err := b.series.seek((b.series.off + 15) / 16 * 16); err != nil {
+			return nil, err
+		}
+	}
+	if b.series.off >= b.seriesEnd {
+		return nil, nil
+	}
+	b.ref = uint64(b.series.off)
+	if b.aligned {
+		b.ref /= 16
+	}
+
+	l, err := binary.ReadUvarint(b.series)
+	if err != nil {
+		return nil, errors.Wrap(err, "read series length")
+	}
+	buf := make([]byte, l+4)
+	if _, err := io.ReadFull(b.series, buf); err != nil {
+		return nil, errors.Wrap(err, "read series")
+	}
+	if crc32.Checksum(buf[:l], castagnoliTable) != binary.BigEndian.Uint32(buf[l:]) {
+		return nil, errors.New("series checksum mismatch")
+	}
+
+	var lset labels.Labels
+	if err := b.dec.Series(buf[:l], &lset, &b.chks); err != nil {
+		return nil, errors.Wrap(err, "decode series")
+	}
+	return lset, nil
+}
+
+// readChunks reads chunks of the last read series. Chunks outside of the block time range are classified the same
+// way as by block.GatherIndexIssueStats.
+func (b *streamedBlock) readChunks(lset labels.Labels) (err error) {
+	for i := range b.chks {
+		chk := &b.chks[i]
+		if chk.MinTime < b.meta.MinTime || chk.MaxTime > b.meta.MaxTime {
+			err := errors.Errorf("chunk of series %s with time range [%d, %d] outside of block time range [%d, %d]",
+				lset, chk.MinTime, chk.MaxTime, b.meta.MinTime, b.meta.MaxTime)
+			if chk.MinTime == b.meta.MaxTime {
+				// Only chunks starting at the end of the block are caused by https://github.com/prometheus/tsdb/issues/347.
+				return issue347Error(err, b.meta.ULID)
+			}
+			return halt(unhealthyBlockError(err, b.meta.ULID))
+		}
+		if chk.Chunk, err = b.readChunk(chk.Ref); err != nil {
+			return errors.Wrapf(err, "read chunk %d of series %s", chk.Ref, lset)
+		}
+	}
+	return nil
+}
+
+func (b *streamedBlock) readChunk(ref uint64) (chunkenc.Chunk, error) {
+	seq, off := ref>>32, int64((ref<<32)>>32)
+	r, ok := b.chunks[seq]
+	if !ok {
+		r = b.newChunks(seq)
+		b.chunks[seq] = r
+	}
+	if err := r.seek(off); err != nil {
+		return nil, err
+	}
+
+	l, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "read chunk length")
+	}
+	// Encoding, data and checksum.
+	buf := make([]byte, 1+l+4)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, errors.Wrap(err, "read chunk")
+	}
+	if crc32.Checksum(buf[:1+l], castagnoliTable) != binary.BigEndian.Uint32(buf[1+l:]) {
+		return nil, errors.New("chunk checksum mismatch")
+	}
+	return b.pool.Get(chunkenc.Encoding(buf[0]), buf[1:1+l])
+}
+
+// Close closes all range readers of the block.
+func (b *streamedBlock) Close() error {
+	if err := b.series.Close(); err != nil {
+		return err
+	}
+	for _, r := range b.chunks {
+		if err := r.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rangeReader reads an object in the bucket forward from the current offset. Seeking backwards or far ahead starts
+// a new range request.
+type rangeReader struct {
+	ctx  context.Context
+	bkt  objstore.BucketReader
+	name string
+	end  int64 // Negative means the end of the object.
+
+	off int64
+	rc  io.ReadCloser
+	r   *bufio.Reader
+}
+
+func newRangeReader(ctx context.Context, bkt objstore.BucketReader, name string, end int64) *rangeReader {
+	return &rangeReader{ctx: ctx, bkt: bkt, name: name, end: end}
+}
+
+func (r *rangeReader) seek(off int64) error {
+	if r.end >= 0 && off >= r.end {
+		r.off = off
+		return r.Close()
+	}
+	if r.rc != nil && off >= r.off && off-r.off <= maxRangeSkip {
+		n, err := r.r.Discard(int(off - r.off))
+		r.off += int64(n)
+		return readErr(err)
+	}
+	if err := r.Close(); err != nil {
+		return err
+	}
+
+	end := r.end
+	if end < 0 {
+		size, err := r.bkt.ObjectSize(r.ctx, r.name)
+		if err != nil {
+			return retry(errors.Wrapf(err, "get size of %s", r.name))
+		}
+		end = int64(size)
+		r.end = end
+	}
+	if off >= end {
+		r.off = off
+		return nil
+	}
+
+	rc, err := r.bkt.GetRange(r.ctx, r.name, off, end-off)
+	if err != nil {
+		return retry(errors.Wrapf(err, "get range of %s", r.name))
+	}
+	r.rc, r.r, r.off = rc, bufio.NewReaderSize(rc, 1<<16), off
+	return nil
+}
+
+func (r *rangeReader) Read(p []byte) (int, error) {
+	if r.rc == nil {
+		return 0, io.EOF
+	}
+	n, err := r.r.Read(p)
+	r.off += int64(n)
+	return n, readErr(err)
+}
+
+func (r *rangeReader) ReadByte() (byte, error) {
+	if r.rc == nil {
+		return 0, io.EOF
+	}
+	c, err := r.r.ReadByte()
+	if err == nil {
+		r.off++
+	}
+	return c, readErr(err)
+}
+
+// readErr returns errors of reading a range request other than the end of the range as retry errors, as they are
+// caused by the object storage.
+func readErr(err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	return retry(err)
+}
+
+// Close closes the current range request, if any.
+func (r *rangeReader) Close() error {
+	if r.rc == nil {
+		return nil
+	}
+	err := r.rc.Close()
+	r.rc, r.r = nil, nil
+	return err
+}
+
+type realByteSlice []byte
+
+func (b realByteSlice) Len() int {
+	return len(b)
+}
+
+func (b realByteSlice) Range(start, end int) []byte {
+	return b[start:end]
+}
+
+// BlockSize returns the size of the index and chunks of the block with the given ID in the bucket.
+func BlockSize(ctx context.Context, bkt objstore.BucketReader, id ulid.ULID) (int64, error) {
+	size, err := bkt.ObjectSize(ctx, path.Join(id.String(), block.IndexFilename))
+	if err != nil {
+		return 0, errors.Wrap(err, "get index size")
+	}
+	total := int64(size)
+
+	if err := bkt.Iter(ctx, path.Join(id.String(), block.ChunksDirname), func(name string) error {
+		size, err := bkt.ObjectSize(ctx, name)
+		if err != nil {
+			return errors.Wrapf(err, "get size of %s", name)
+		}
+		total += int64(size)
+		return nil
+	}); err != nil {
+		return 0, errors.Wrap(err, "iterate chunks")
+	}
+	return total, nil
+}
+
+// indexCacheSize returns the size of the index cache of the block with the given ID in the bucket or the size of its
+// index if the block has no index cache.
+func indexCacheSize(ctx context.Context, bkt objstore.BucketReader, id ulid.ULID) (int64, error) {
+	name := path.Join(id.String(), block.IndexCacheFilename)
+	ok, err := bkt.Exists(ctx, name)
+	if err != nil {
+		return 0, errors.Wrapf(err, "check %s", name)
+	}
+	if !ok {
+		name = path.Join(id.String(), block.IndexFilename)
+	}
+	size, err := bkt.ObjectSize(ctx, name)
+	if err != nil {
+		return 0, errors.Wrapf(err, "get size of %s", name)
+	}
+	return int64(size), nil
+}
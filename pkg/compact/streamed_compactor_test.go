@@ -0,0 +1,209 @@
+package compact
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/oklog/ulid"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/objstore/inmem"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestStreamedCompactor_Compact(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "test-streamed-compact")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	bkt := inmem.NewBucket()
+	extLset := labels.Labels{{Name: "e1", Value: "1"}}
+	metas := createAndUpload(t, bkt, []blockgenSpec{
+		{
+			numSamples: 100, mint: 0, maxt: 1000, extLset: extLset, res: 124,
+			series: []labels.Labels{
+				{{Name: "a", Value: "1"}},
+				{{Name: "a", Value: "2"}, {Name: "b", Value: "2"}},
+				{{Name: "a", Value: "3"}},
+			},
+		},
+		{mint: 1000, maxt: 2000, extLset: extLset, res: 124},
+		{
+			numSamples: 100, mint: 2000, maxt: 3000, extLset: extLset, res: 124,
+			series: []labels.Labels{
+				{{Name: "a", Value: "0"}},
+				{{Name: "a", Value: "2"}, {Name: "b", Value: "2"}},
+				{{Name: "a", Value: "4"}, {Name: "c", Value: "4"}},
+			},
+		},
+	})
+
+	// Index issues are gathered the same way as from downloaded blocks.
+	m := metas[0]
+	d := filepath.Join(dir, "stats", m.ULID.String())
+	testutil.Ok(t, block.Download(ctx, log.NewNopLogger(), bkt, m.ULID, d))
+	exp, err := block.GatherIndexIssueStats(log.NewNopLogger(), filepath.Join(d, block.IndexFilename), m.MinTime, m.MaxTime)
+	testutil.Ok(t, err)
+	stats, err := NewStreamedCompactor(nil, bkt).IndexIssueStats(ctx, filepath.Join(dir, "streamed"), m)
+	testutil.Ok(t, err)
+	testutil.Equals(t, exp, stats)
+	testutil.Equals(t, 3, stats.TotalSeries)
+
+	id, err := NewStreamedCompactor(nil, bkt).Compact(ctx, filepath.Join(dir, "streamed"), metas)
+	testutil.Ok(t, err)
+	streamedDir := filepath.Join(dir, "streamed", id.String())
+	testutil.Ok(t, block.VerifyIndex(log.NewNopLogger(), filepath.Join(streamedDir, block.IndexFilename), 0, 3000))
+
+	// The same blocks compacted by the TSDB compactor.
+	var dirs []string
+	for _, m := range metas {
+		d := filepath.Join(dir, "tsdb", m.ULID.String())
+		testutil.Ok(t, block.Download(ctx, log.NewNopLogger(), bkt, m.ULID, d))
+		dirs = append(dirs, d)
+	}
+	comp, err := tsdb.NewLeveledCompactor(ctx, nil, log.NewNopLogger(), []int64{1000, 3000}, nil)
+	testutil.Ok(t, err)
+	expID, err := comp.Compact(filepath.Join(dir, "tsdb"), dirs, nil)
+	testutil.Ok(t, err)
+	expDir := filepath.Join(dir, "tsdb", expID.String())
+
+	testutil.Equals(t, readBlockSeries(t, expDir), readBlockSeries(t, streamedDir))
+
+	expMeta, err := metadata.Read(expDir)
+	testutil.Ok(t, err)
+	res, err := metadata.Read(streamedDir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, expMeta.MinTime, res.MinTime)
+	testutil.Equals(t, expMeta.MaxTime, res.MaxTime)
+	testutil.Equals(t, expMeta.Stats, res.Stats)
+	testutil.Equals(t, expMeta.Compaction.Level, res.Compaction.Level)
+	testutil.Equals(t, expMeta.Compaction.Sources, res.Compaction.Sources)
+	testutil.Equals(t, expMeta.Compaction.Parents, res.Compaction.Parents)
+	testutil.Equals(t, metas[0].Thanos.Labels, res.Thanos.Labels)
+	testutil.Equals(t, metas[0].Thanos.Downsample.Resolution, res.Thanos.Downsample.Resolution)
+
+	// Blocks without samples are not compacted into empty block.
+	id, err = NewStreamedCompactor(nil, bkt).Compact(ctx, filepath.Join(dir, "empty"), metas[1:2])
+	testutil.Ok(t, err)
+	testutil.Equals(t, ulid.ULID{}, id)
+}
+
+func TestBucketCompactor_DiskBudget(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "test-compact-disk-budget")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	bkt := inmem.NewBucket()
+	extLset := labels.Labels{{Name: "e1", Value: "1"}}
+	series := []labels.Labels{{{Name: "a", Value: "1"}}, {{Name: "a", Value: "2"}}}
+	metas := createAndUpload(t, bkt, []blockgenSpec{
+		{numSamples: 100, mint: 0, maxt: 1000, extLset: extLset, series: series},
+		{numSamples: 100, mint: 1000, maxt: 2000, extLset: extLset, series: series},
+		{numSamples: 100, mint: 2000, maxt: 3000, extLset: extLset, series: series},
+		{numSamples: 100, mint: 3000, maxt: 4000, extLset: extLset, series: series},
+	})
+
+	var planned int64
+	for _, m := range metas[:3] {
+		size, err := BlockSize(ctx, bkt, m.ULID)
+		testutil.Ok(t, err)
+		planned += size
+	}
+
+	metaFetcher, err := block.NewMetaFetcher(nil, 32, bkt, "", nil)
+	testutil.Ok(t, err)
+	sy, err := NewSyncer(nil, nil, bkt, metaFetcher, 1, false, false)
+	testutil.Ok(t, err)
+	comp, err := tsdb.NewLeveledCompactor(ctx, nil, log.NewNopLogger(), []int64{1000, 3000}, nil)
+	testutil.Ok(t, err)
+	planner := NewTSDBBasedPlanner([]int64{1000, 3000})
+
+	// Downloaded blocks and the compacted block do not fit, the group is skipped.
+	bComp, err := NewBucketCompactor(log.NewNopLogger(), sy, planner, comp, dir, bkt, 1, false, nil, nil, false, planned+planned/2)
+	testutil.Ok(t, err)
+	testutil.Ok(t, bComp.Compact(ctx))
+	testutil.Equals(t, 0.0, promtest.ToFloat64(sy.metrics.compactions.WithLabelValues(GroupKey(metas[0].Thanos))))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(sy.metrics.compactionsRefused.WithLabelValues(GroupKey(metas[0].Thanos))))
+
+	groups, err := sy.Groups()
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(groups))
+	testutil.Equals(t, 4, len(groups[0].IDs()))
+
+	// With quarantine enabled, the group is quarantined instead.
+	quarantine := NewQuarantine(nil, nil, time.Minute, time.Hour)
+	bComp, err = NewBucketCompactor(log.NewNopLogger(), sy, planner, comp, dir, bkt, 1, false, nil, quarantine, false, planned+planned/2)
+	testutil.Ok(t, err)
+	testutil.Ok(t, bComp.Compact(ctx))
+	testutil.Equals(t, 2.0, promtest.ToFloat64(sy.metrics.compactionsRefused.WithLabelValues(GroupKey(metas[0].Thanos))))
+	testutil.Equals(t, 1, len(quarantine.groups))
+
+	// Only the compacted block is stored on disk with streaming.
+	bComp, err = NewBucketCompactor(log.NewNopLogger(), sy, planner, comp, dir, bkt, 1, false, nil, nil, true, planned+planned/2)
+	testutil.Ok(t, err)
+	testutil.Ok(t, bComp.Compact(ctx))
+	testutil.Equals(t, 1.0, promtest.ToFloat64(sy.metrics.compactions.WithLabelValues(GroupKey(metas[0].Thanos))))
+
+	groups, err = sy.Groups()
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(groups))
+	testutil.Equals(t, 2, len(groups[0].IDs()))
+}
+
+type seriesSamples struct {
+	lset    labels.Labels
+	samples [][2]float64
+}
+
+func readBlockSeries(t *testing.T, dir string) []seriesSamples {
+	b, err := tsdb.OpenBlock(nil, dir, nil)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, b.Close()) }()
+
+	ir, err := b.Index()
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, ir.Close()) }()
+
+	cr, err := b.Chunks()
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, cr.Close()) }()
+
+	p, err := ir.Postings(index.AllPostingsKey())
+	testutil.Ok(t, err)
+
+	var res []seriesSamples
+	for p.Next() {
+		var s seriesSamples
+		var chks []chunks.Meta
+		testutil.Ok(t, ir.Series(p.At(), &s.lset, &chks))
+		for _, c := range chks {
+			chk, err := cr.Chunk(c.Ref)
+			testutil.Ok(t, err)
+			it := chk.Iterator(nil)
+			for it.Next() {
+				ts, v := it.At()
+				s.samples = append(s.samples, [2]float64{float64(ts), v})
+			}
+			testutil.Ok(t, it.Err())
+		}
+		res = append(res, s)
+	}
+	testutil.Ok(t, p.Err())
+	return res
+}
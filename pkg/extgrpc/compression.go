@@ -0,0 +1,191 @@
+package extgrpc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/encoding/gzip"
+)
+
+const (
+	// CompressionNone disables compression.
+	CompressionNone = "none"
+	// CompressionSnappy is the name of the snappy compressor.
+	CompressionSnappy = "snappy"
+	// CompressionGzip is the name of the gzip compressor.
+	CompressionGzip = gzip.Name
+	// CompressionZstd is the name of the zstd compressor.
+	CompressionZstd = "zstd"
+)
+
+// Compressions are names of all supported compressions, including CompressionNone.
+var Compressions = []string{CompressionNone, CompressionSnappy, CompressionGzip, CompressionZstd}
+
+func init() {
+	c := &snappyCompressor{}
+	c.writers.New = func() interface{} {
+		return &snappyWriter{Writer: snappy.NewBufferedWriter(ioutil.Discard), pool: &c.writers}
+	}
+	encoding.RegisterCompressor(c)
+
+	// Errors are returned only for invalid options.
+	enc, _ := zstd.NewWriter(nil)
+	dec, _ := zstd.NewReader(nil)
+	encoding.RegisterCompressor(&zstdCompressor{enc: enc, dec: dec})
+}
+
+// snappyCompressor implements encoding.Compressor using snappy framing format.
+type snappyCompressor struct {
+	writers sync.Pool
+	readers sync.Pool
+}
+
+func (c *snappyCompressor) Name() string {
+	return CompressionSnappy
+}
+
+func (c *snappyCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	sw := c.writers.Get().(*snappyWriter)
+	sw.Reset(w)
+	return sw, nil
+}
+
+func (c *snappyCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	sr, ok := c.readers.Get().(*snappyReader)
+	if !ok {
+		return &snappyReader{Reader: snappy.NewReader(r), pool: &c.readers}, nil
+	}
+	sr.Reset(r)
+	sr.released = false
+	return sr, nil
+}
+
+type snappyWriter struct {
+	*snappy.Writer
+	pool *sync.Pool
+}
+
+func (w *snappyWriter) Close() error {
+	defer w.pool.Put(w)
+	return w.Writer.Close()
+}
+
+// snappyReader returns itself to the pool once the whole message is read. gRPC reads until io.EOF and never
+// closes the reader.
+type snappyReader struct {
+	*snappy.Reader
+	pool     *sync.Pool
+	released bool
+}
+
+func (r *snappyReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err == io.EOF && !r.released {
+		r.released = true
+		r.pool.Put(r)
+	}
+	return n, err
+}
+
+// zstdCompressor implements encoding.Compressor using zstd. gRPC compresses and decompresses whole messages, so
+// stateless encoding and decoding is used, which is safe for concurrent use of the same encoder and decoder.
+type zstdCompressor struct {
+	enc *zstd.Encoder
+	dec *zstd.Decoder
+}
+
+func (c *zstdCompressor) Name() string {
+	return CompressionZstd
+}
+
+func (c *zstdCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return &zstdWriter{w: w, enc: c.enc}, nil
+}
+
+func (c *zstdCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	b, err = c.dec.DecodeAll(b, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "zstd decode")
+	}
+	return bytes.NewReader(b), nil
+}
+
+// zstdWriter buffers the message and writes it compressed on Close.
+type zstdWriter struct {
+	bytes.Buffer
+
+	w   io.Writer
+	enc *zstd.Encoder
+}
+
+func (w *zstdWriter) Close() error {
+	_, err := w.w.Write(w.enc.EncodeAll(w.Bytes(), nil))
+	return err
+}
+
+// ValidateCompression returns error if the given compression is not supported.
+func ValidateCompression(name string) error {
+	for _, c := range Compressions {
+		if c == name {
+			return nil
+		}
+	}
+	return errors.Errorf("unsupported gRPC compression %q, expected one of %s", name, strings.Join(Compressions, ", "))
+}
+
+// ParseCompressionOverrides parses <address>=<compression> pairs into a map of compressions by address.
+func ParseCompressionOverrides(overrides []string) (map[string]string, error) {
+	res := make(map[string]string, len(overrides))
+	for _, o := range overrides {
+		i := strings.LastIndex(o, "=")
+		if i <= 0 {
+			return nil, errors.Errorf("compression override %q is not in <address>=<compression> format", o)
+		}
+		addr, name := o[:i], o[i+1:]
+		if err := ValidateCompression(name); err != nil {
+			return nil, errors.Wrapf(err, "compression override for %s", addr)
+		}
+		if _, ok := res[addr]; ok {
+			return nil, errors.Errorf("duplicated compression override for %s", addr)
+		}
+		res[addr] = name
+	}
+	return res, nil
+}
+
+// compressionCallOptions returns call options requesting the compression for the given target, or the default
+// compression if there is no override for it.
+func compressionCallOptions(target, compression string, overrides map[string]string) []grpc.CallOption {
+	if c, ok := overrides[target]; ok {
+		compression = c
+	}
+	if compression == CompressionNone {
+		return nil
+	}
+	return []grpc.CallOption{grpc.UseCompressor(compression)}
+}
+
+// ClientCompressionInterceptors returns client interceptors compressing requests with the given compression, or the
+// one overriding it for the target of the connection. Servers respond with the same compression.
+func ClientCompressionInterceptors(compression string, overrides map[string]string) (grpc.UnaryClientInterceptor, grpc.StreamClientInterceptor) {
+	unary := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(ctx, method, req, reply, cc, append(compressionCallOptions(cc.Target(), compression, overrides), opts...)...)
+	}
+	stream := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(ctx, desc, cc, method, append(compressionCallOptions(cc.Target(), compression, overrides), opts...)...)
+	}
+	return unary, stream
+}
@@ -0,0 +1,152 @@
+package extgrpc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// labelValuesServer returns the same highly compressible label values for every request.
+type labelValuesServer struct {
+	storepb.StoreServer
+
+	values []string
+}
+
+func (s *labelValuesServer) LabelValues(context.Context, *storepb.LabelValuesRequest) (*storepb.LabelValuesResponse, error) {
+	return &storepb.LabelValuesResponse{Values: s.values}, nil
+}
+
+func (s *labelValuesServer) Series(_ *storepb.SeriesRequest, srv storepb.Store_SeriesServer) error {
+	for _, v := range s.values {
+		if err := srv.Send(storepb.NewSeriesResponse(&storepb.Series{Labels: []storepb.Label{{Name: "a", Value: v}}})); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestCompression(t *testing.T) {
+	values := make([]string, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		values = append(values, fmt.Sprintf("%s-%d", strings.Repeat("value", 10), i%10))
+	}
+
+	for _, tcase := range []struct {
+		name              string
+		clientCompression string
+		overrides         map[string]string
+
+		compressed bool
+	}{
+		{name: "no compression", clientCompression: CompressionNone},
+		{name: "snappy", clientCompression: CompressionSnappy, compressed: true},
+		{name: "gzip", clientCompression: CompressionGzip, compressed: true},
+		{name: "zstd", clientCompression: CompressionZstd, compressed: true},
+		{name: "override", clientCompression: CompressionNone, overrides: map[string]string{"bufnet": CompressionSnappy}, compressed: true},
+		{name: "override to none", clientCompression: CompressionGzip, overrides: map[string]string{"bufnet": CompressionNone}},
+		{name: "override of other store", clientCompression: CompressionNone, overrides: map[string]string{"other": CompressionGzip}},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			serverMetrics := NewServerPayloadMetrics(prometheus.NewRegistry())
+			srv := grpc.NewServer(grpc.StatsHandler(serverMetrics))
+			storepb.RegisterStoreServer(srv, &labelValuesServer{values: values})
+
+			l := bufconn.Listen(1024 * 1024)
+			go func() { _ = srv.Serve(l) }()
+			defer srv.Stop()
+
+			clientMetrics := NewClientPayloadMetrics(prometheus.NewRegistry())
+			unary, stream := ClientCompressionInterceptors(tcase.clientCompression, tcase.overrides)
+			cc, err := grpc.Dial("bufnet",
+				grpc.WithDialer(func(string, time.Duration) (net.Conn, error) { return l.Dial() }),
+				grpc.WithInsecure(),
+				grpc.WithUnaryInterceptor(unary),
+				grpc.WithStreamInterceptor(stream),
+				grpc.WithStatsHandler(clientMetrics),
+			)
+			testutil.Ok(t, err)
+			defer func() { testutil.Ok(t, cc.Close()) }()
+
+			client := storepb.NewStoreClient(cc)
+			resp, err := client.LabelValues(context.Background(), &storepb.LabelValuesRequest{Label: "a"})
+			testutil.Ok(t, err)
+			testutil.Equals(t, values, resp.Values)
+
+			sc, err := client.Series(context.Background(), &storepb.SeriesRequest{})
+			testutil.Ok(t, err)
+			for i := 0; ; i++ {
+				r, err := sc.Recv()
+				if err != nil {
+					testutil.Equals(t, len(values), i)
+					break
+				}
+				testutil.Equals(t, values[i], r.GetSeries().Labels[0].Value)
+			}
+
+			raw := promtest.ToFloat64(clientMetrics.rawBytes.WithLabelValues("received"))
+			wire := promtest.ToFloat64(clientMetrics.wireBytes.WithLabelValues("received"))
+			testutil.Assert(t, raw > 0, "expected received bytes to be counted")
+			testutil.Equals(t, raw, promtest.ToFloat64(serverMetrics.rawBytes.WithLabelValues("sent")))
+			if tcase.compressed {
+				testutil.Assert(t, wire < raw, "expected compressed response, got %v wire bytes for %v raw bytes", wire, raw)
+				return
+			}
+			testutil.Assert(t, wire >= raw, "expected uncompressed response, got %v wire bytes for %v raw bytes", wire, raw)
+		})
+	}
+}
+
+func TestSnappyReader_ReleasedOnce(t *testing.T) {
+	c := encoding.GetCompressor(CompressionSnappy)
+
+	var buf bytes.Buffer
+	w, err := c.Compress(&buf)
+	testutil.Ok(t, err)
+	_, err = w.Write([]byte("test"))
+	testutil.Ok(t, err)
+	testutil.Ok(t, w.Close())
+
+	r, err := c.Decompress(bytes.NewReader(buf.Bytes()))
+	testutil.Ok(t, err)
+	b, err := ioutil.ReadAll(r)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "test", string(b))
+
+	// Reading past the end must not put the reader into the pool again.
+	_, err = r.Read(make([]byte, 1))
+	testutil.Equals(t, io.EOF, err)
+
+	r1, err := c.Decompress(bytes.NewReader(buf.Bytes()))
+	testutil.Ok(t, err)
+	r2, err := c.Decompress(bytes.NewReader(buf.Bytes()))
+	testutil.Ok(t, err)
+	testutil.Assert(t, r1 != r2, "expected different readers for concurrent messages")
+}
+
+func TestParseCompressionOverrides(t *testing.T) {
+	res, err := ParseCompressionOverrides([]string{"store-1:10901=snappy", "store-2:10901=none"})
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[string]string{"store-1:10901": CompressionSnappy, "store-2:10901": CompressionNone}, res)
+
+	_, err = ParseCompressionOverrides([]string{"store-1:10901"})
+	testutil.NotOk(t, err)
+	_, err = ParseCompressionOverrides([]string{"store-1:10901=lz4"})
+	testutil.NotOk(t, err)
+	_, err = ParseCompressionOverrides([]string{"store-1:10901=gzip", "store-1:10901=snappy"})
+	testutil.NotOk(t, err)
+}
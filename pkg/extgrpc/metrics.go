@@ -0,0 +1,67 @@
+package extgrpc
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/stats"
+)
+
+// PayloadMetrics implements stats.Handler counting raw (uncompressed) and wire (compressed) bytes of messages sent
+// and received over gRPC.
+type PayloadMetrics struct {
+	rawBytes  *prometheus.CounterVec
+	wireBytes *prometheus.CounterVec
+}
+
+// NewClientPayloadMetrics returns PayloadMetrics for gRPC clients.
+func NewClientPayloadMetrics(reg prometheus.Registerer) *PayloadMetrics {
+	return newPayloadMetrics(reg, "client")
+}
+
+// NewServerPayloadMetrics returns PayloadMetrics for gRPC servers.
+func NewServerPayloadMetrics(reg prometheus.Registerer) *PayloadMetrics {
+	return newPayloadMetrics(reg, "server")
+}
+
+func newPayloadMetrics(reg prometheus.Registerer, side string) *PayloadMetrics {
+	m := &PayloadMetrics{
+		rawBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_grpc_" + side + "_msg_raw_bytes_total",
+			Help: "Total number of bytes of gRPC messages before compression, by direction.",
+		}, []string{"direction"}),
+		wireBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_grpc_" + side + "_msg_wire_bytes_total",
+			Help: "Total number of bytes of gRPC messages on the wire, after compression, by direction.",
+		}, []string{"direction"}),
+	}
+	for _, dir := range []string{"sent", "received"} {
+		m.rawBytes.WithLabelValues(dir)
+		m.wireBytes.WithLabelValues(dir)
+	}
+	if reg != nil {
+		reg.MustRegister(m.rawBytes, m.wireBytes)
+	}
+	return m
+}
+
+func (m *PayloadMetrics) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (m *PayloadMetrics) HandleRPC(_ context.Context, s stats.RPCStats) {
+	switch p := s.(type) {
+	case *stats.OutPayload:
+		m.rawBytes.WithLabelValues("sent").Add(float64(p.Length))
+		m.wireBytes.WithLabelValues("sent").Add(float64(p.WireLength))
+	case *stats.InPayload:
+		m.rawBytes.WithLabelValues("received").Add(float64(p.Length))
+		m.wireBytes.WithLabelValues("received").Add(float64(p.WireLength))
+	}
+}
+
+func (m *PayloadMetrics) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (m *PayloadMetrics) HandleConn(context.Context, stats.ConnStats) {}
@@ -0,0 +1,61 @@
+package metadatapb
+
+import (
+	"sort"
+)
+
+// FromMap returns sorted metric metadata for the given metric name to metadata mapping. Duplicated metas of the same
+// metric are merged. If limit is positive, at most limit metrics are returned.
+func FromMap(md map[string][]Meta, limit int) []MetricMetadata {
+	metrics := make([]string, 0, len(md))
+	for m := range md {
+		metrics = append(metrics, m)
+	}
+	sort.Strings(metrics)
+
+	if limit > 0 && len(metrics) > limit {
+		metrics = metrics[:limit]
+	}
+
+	res := make([]MetricMetadata, 0, len(metrics))
+	for _, m := range metrics {
+		res = append(res, MetricMetadata{Metric: m, Metas: dedupMetas(md[m])})
+	}
+	return res
+}
+
+// ToMap returns metric name to metadata mapping for the given metric metadata.
+func ToMap(mds ...[]MetricMetadata) map[string][]Meta {
+	res := map[string][]Meta{}
+	for _, md := range mds {
+		for _, m := range md {
+			res[m.Metric] = append(res[m.Metric], m.Metas...)
+		}
+	}
+	for m, metas := range res {
+		res[m] = dedupMetas(metas)
+	}
+	return res
+}
+
+// dedupMetas sorts and removes duplicated metas.
+func dedupMetas(metas []Meta) []Meta {
+	sort.Slice(metas, func(i, j int) bool {
+		if metas[i].Type != metas[j].Type {
+			return metas[i].Type < metas[j].Type
+		}
+		if metas[i].Help != metas[j].Help {
+			return metas[i].Help < metas[j].Help
+		}
+		return metas[i].Unit < metas[j].Unit
+	})
+
+	res := metas[:0]
+	for _, m := range metas {
+		if len(res) > 0 && m == res[len(res)-1] {
+			continue
+		}
+		res = append(res, m)
+	}
+	return res
+}
@@ -0,0 +1,43 @@
+package metadata
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/go-kit/kit/log"
+	"github.com/thanos-io/thanos/pkg/metadata/metadatapb"
+	"github.com/thanos-io/thanos/pkg/promclient"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Prometheus implements metadatapb.MetadataServer on top of the Prometheus targets metadata API.
+type Prometheus struct {
+	logger log.Logger
+	base   *url.URL
+}
+
+// NewPrometheus creates new metadata.Prometheus.
+func NewPrometheus(logger log.Logger, base *url.URL) *Prometheus {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &Prometheus{
+		logger: logger,
+		base:   base,
+	}
+}
+
+// Metadata returns metadata of all metrics scraped by the Prometheus instance, optionally filtered by metric name.
+func (p *Prometheus) Metadata(ctx context.Context, r *metadatapb.MetadataRequest) (*metadatapb.MetadataResponse, error) {
+	entries, err := promclient.TargetsMetadata(ctx, p.logger, p.base, r.Metric)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	md := map[string][]metadatapb.Meta{}
+	for _, e := range entries {
+		md[e.Metric] = append(md[e.Metric], metadatapb.Meta{Type: e.Type, Help: e.Help, Unit: e.Unit})
+	}
+	return &metadatapb.MetadataResponse{Metadata: metadatapb.FromMap(md, int(r.Limit))}, nil
+}
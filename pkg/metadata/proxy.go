@@ -0,0 +1,99 @@
+package metadata
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/thanos/pkg/metadata/metadatapb"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Client holds a client to a metadata source.
+type Client interface {
+	// Client to access the metadata source.
+	metadatapb.MetadataClient
+
+	String() string
+}
+
+// Proxy implements metadatapb.MetadataServer that fans out requests to all given metadata sources and merges
+// their responses.
+type Proxy struct {
+	logger  log.Logger
+	clients func() []Client
+}
+
+// NewProxy returns a new metadata.Proxy.
+func NewProxy(logger log.Logger, clients func() []Client) *Proxy {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &Proxy{
+		logger:  logger,
+		clients: clients,
+	}
+}
+
+// Metadata returns merged metadata from all metadata sources.
+func (p *Proxy) Metadata(ctx context.Context, r *metadatapb.MetadataRequest) (*metadatapb.MetadataResponse, error) {
+	var (
+		warnings []string
+		all      [][]metadatapb.MetricMetadata
+		mtx      sync.Mutex
+		g, gctx  = errgroup.WithContext(ctx)
+	)
+
+	for _, c := range p.clients() {
+		c := c
+		g.Go(func() error {
+			// Limit is applied after merging, as metrics returned by different sources can overlap.
+			resp, err := c.Metadata(gctx, &metadatapb.MetadataRequest{
+				Metric:                  r.Metric,
+				PartialResponseDisabled: r.PartialResponseDisabled,
+			})
+			if status.Code(err) == codes.Unimplemented {
+				// Source does not expose the Metadata API (e.g. Store Gateway or older versions), so it has no metadata.
+				return nil
+			}
+			if err != nil {
+				err = errors.Wrapf(err, "fetch metadata from %s", c)
+				if r.PartialResponseDisabled {
+					return err
+				}
+
+				mtx.Lock()
+				warnings = append(warnings, err.Error())
+				mtx.Unlock()
+				return nil
+			}
+
+			mtx.Lock()
+			warnings = append(warnings, resp.Warnings...)
+			all = append(all, resp.Metadata)
+			mtx.Unlock()
+
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	return &metadatapb.MetadataResponse{
+		Metadata: metadatapb.FromMap(metadatapb.ToMap(all...), int(r.Limit)),
+		Warnings: warnings,
+	}, nil
+}
+
+// RegisterMetadataServer returns function that registers the given metadata server in the gRPC server.
+func RegisterMetadataServer(metadataSrv metadatapb.MetadataServer) func(*grpc.Server) {
+	return func(s *grpc.Server) {
+		metadatapb.RegisterMetadataServer(s, metadataSrv)
+	}
+}
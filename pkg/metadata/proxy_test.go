@@ -0,0 +1,113 @@
+package metadata
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/thanos-io/thanos/pkg/metadata/metadatapb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type testClient struct {
+	resp *metadatapb.MetadataResponse
+	err  error
+
+	lastReq *metadatapb.MetadataRequest
+}
+
+func (c *testClient) Metadata(_ context.Context, r *metadatapb.MetadataRequest, _ ...grpc.CallOption) (*metadatapb.MetadataResponse, error) {
+	c.lastReq = r
+	return c.resp, c.err
+}
+
+func (c *testClient) String() string {
+	return "test"
+}
+
+func TestProxy_Metadata(t *testing.T) {
+	var (
+		counter = metadatapb.Meta{Type: "counter", Help: "Total requests.", Unit: ""}
+		gauge   = metadatapb.Meta{Type: "gauge", Help: "In-flight requests.", Unit: ""}
+	)
+
+	newClients := func() []*testClient {
+		return []*testClient{
+			{resp: &metadatapb.MetadataResponse{
+				Metadata: []metadatapb.MetricMetadata{
+					{Metric: "http_requests_total", Metas: []metadatapb.Meta{counter}},
+					{Metric: "http_requests_in_flight", Metas: []metadatapb.Meta{gauge}},
+				},
+				Warnings: []string{"warning"},
+			}},
+			{resp: &metadatapb.MetadataResponse{
+				Metadata: []metadatapb.MetricMetadata{
+					{Metric: "http_requests_total", Metas: []metadatapb.Meta{counter}},
+					{Metric: "up", Metas: []metadatapb.Meta{gauge}},
+				},
+			}},
+		}
+	}
+	proxy := func(cls []*testClient) *Proxy {
+		return NewProxy(nil, func() []Client {
+			res := make([]Client, 0, len(cls))
+			for _, c := range cls {
+				res = append(res, c)
+			}
+			return res
+		})
+	}
+
+	t.Run("merge", func(t *testing.T) {
+		cls := newClients()
+		resp, err := proxy(cls).Metadata(context.Background(), &metadatapb.MetadataRequest{Metric: "x", Limit: 2})
+		testutil.Ok(t, err)
+
+		testutil.Equals(t, []metadatapb.MetricMetadata{
+			{Metric: "http_requests_in_flight", Metas: []metadatapb.Meta{gauge}},
+			{Metric: "http_requests_total", Metas: []metadatapb.Meta{counter}},
+		}, resp.Metadata)
+		testutil.Equals(t, []string{"warning"}, resp.Warnings)
+
+		// Limit must not be proxied, as the results of different sources can overlap.
+		for _, c := range cls {
+			testutil.Equals(t, &metadatapb.MetadataRequest{Metric: "x"}, c.lastReq)
+		}
+	})
+	t.Run("partial response", func(t *testing.T) {
+		cls := newClients()
+		cls[1].resp, cls[1].err = nil, errors.New("unavailable")
+
+		resp, err := proxy(cls).Metadata(context.Background(), &metadatapb.MetadataRequest{})
+		testutil.Ok(t, err)
+
+		testutil.Equals(t, []metadatapb.MetricMetadata{
+			{Metric: "http_requests_in_flight", Metas: []metadatapb.Meta{gauge}},
+			{Metric: "http_requests_total", Metas: []metadatapb.Meta{counter}},
+		}, resp.Metadata)
+		testutil.Equals(t, 2, len(resp.Warnings))
+	})
+	t.Run("partial response disabled", func(t *testing.T) {
+		cls := newClients()
+		cls[1].resp, cls[1].err = nil, errors.New("unavailable")
+
+		_, err := proxy(cls).Metadata(context.Background(), &metadatapb.MetadataRequest{PartialResponseDisabled: true})
+		testutil.NotOk(t, err)
+	})
+	t.Run("metadata not implemented", func(t *testing.T) {
+		cls := newClients()
+		cls[1].resp, cls[1].err = nil, status.Error(codes.Unimplemented, "unknown service thanos.Metadata")
+
+		resp, err := proxy(cls).Metadata(context.Background(), &metadatapb.MetadataRequest{PartialResponseDisabled: true})
+		testutil.Ok(t, err)
+
+		testutil.Equals(t, []metadatapb.MetricMetadata{
+			{Metric: "http_requests_in_flight", Metas: []metadatapb.Meta{gauge}},
+			{Metric: "http_requests_total", Metas: []metadatapb.Meta{counter}},
+		}, resp.Metadata)
+		testutil.Equals(t, []string{"warning"}, resp.Warnings)
+	})
+}
@@ -31,6 +31,7 @@ import (
 	"github.com/prometheus/prometheus/promql"
 	"github.com/thanos-io/thanos/pkg/runutil"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/targets/targetspb"
 	"github.com/thanos-io/thanos/pkg/tracing"
 	yaml "gopkg.in/yaml.v2"
 )
@@ -500,3 +501,102 @@ func MetricValues(ctx context.Context, logger log.Logger, base *url.URL, perMetr
 		}
 	}
 }
+
+// TargetMetadata is a single metric metadata entry as returned by the Prometheus targets metadata API.
+type TargetMetadata struct {
+	Target map[string]string `json:"target"`
+	Metric string            `json:"metric"`
+	Type   string            `json:"type"`
+	Help   string            `json:"help"`
+	Unit   string            `json:"unit"`
+}
+
+// TargetsMetadata returns metric metadata from /api/v1/targets/metadata Prometheus endpoint.
+// If metric is not empty, only metadata for the given metric name is returned.
+// Added to Prometheus from v2.4.
+func TargetsMetadata(ctx context.Context, logger log.Logger, base *url.URL, metric string) ([]TargetMetadata, error) {
+	u := *base
+	u.Path = path.Join(u.Path, "/api/v1/targets/metadata")
+
+	if metric != "" {
+		q := u.Query()
+		q.Add("metric", metric)
+		u.RawQuery = q.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "create request")
+	}
+
+	span, ctx := tracing.StartSpan(ctx, "/prom_targets_metadata HTTP[client]")
+	defer span.Finish()
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "request targets metadata against %s", u.String())
+	}
+	defer runutil.ExhaustCloseWithLogOnErr(logger, resp.Body, "targets metadata body")
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.New("failed to read body")
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, errors.Errorf("got non-200 response code: %v, response: %v", resp.StatusCode, string(b))
+	}
+
+	var d struct {
+		Data []TargetMetadata `json:"data"`
+	}
+	if err := json.Unmarshal(b, &d); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal response: %v", string(b))
+	}
+	return d.Data, nil
+}
+
+// Targets returns scrape targets from /api/v1/targets Prometheus endpoint. If state is not empty, only targets
+// in the given state ("active" or "dropped") are returned.
+// Added to Prometheus from v2.1, state filter from v2.14.
+func Targets(ctx context.Context, logger log.Logger, base *url.URL, state string) (*targetspb.TargetDiscovery, error) {
+	u := *base
+	u.Path = path.Join(u.Path, "/api/v1/targets")
+
+	if state != "" {
+		q := u.Query()
+		q.Add("state", state)
+		u.RawQuery = q.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "create request")
+	}
+
+	span, ctx := tracing.StartSpan(ctx, "/prom_targets HTTP[client]")
+	defer span.Finish()
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "request targets against %s", u.String())
+	}
+	defer runutil.ExhaustCloseWithLogOnErr(logger, resp.Body, "targets body")
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.New("failed to read body")
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, errors.Errorf("got non-200 response code: %v, response: %v", resp.StatusCode, string(b))
+	}
+
+	var d struct {
+		Data targetspb.TargetDiscovery `json:"data"`
+	}
+	if err := json.Unmarshal(b, &d); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal response: %v", string(b))
+	}
+	return &d.Data, nil
+}
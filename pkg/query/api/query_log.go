@@ -0,0 +1,133 @@
+package v1
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/thanos/pkg/query"
+)
+
+// QueryLogger logs executed PromQL queries along with their parameters and statistics of fetched data.
+type QueryLogger struct {
+	queryLogger   log.Logger
+	closer        io.Closer
+	slowLogger    log.Logger
+	slowThreshold time.Duration
+}
+
+// NewQueryLogger returns a QueryLogger logging all queries as JSON lines into the file under the given path,
+// or to standard output if path is "-". Empty path disables the query log. Queries taking longer than
+// slowQueryThreshold are additionally logged as warnings via the given logger. Zero threshold disables the
+// slow query log. Nil is returned if both are disabled.
+func NewQueryLogger(logger log.Logger, path string, slowQueryThreshold time.Duration) (*QueryLogger, error) {
+	if path == "" && slowQueryThreshold <= 0 {
+		return nil, nil
+	}
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+
+	l := &QueryLogger{
+		slowLogger:    logger,
+		slowThreshold: slowQueryThreshold,
+	}
+	switch path {
+	case "":
+	case "-":
+		l.queryLogger = log.NewJSONLogger(log.NewSyncWriter(os.Stdout))
+	default:
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, errors.Wrapf(err, "open query log file %s", path)
+		}
+		l.queryLogger = log.NewJSONLogger(log.NewSyncWriter(f))
+		l.closer = f
+	}
+	if l.queryLogger != nil {
+		l.queryLogger = log.With(l.queryLogger, "ts", log.DefaultTimestampUTC)
+	}
+	return l, nil
+}
+
+// Close closes the underlying query log file, if any.
+func (l *QueryLogger) Close() error {
+	if l == nil || l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+// queryLogEntry describes single executed query.
+type queryLogEntry struct {
+	query string
+	// start and end are equal for instant queries.
+	start, end time.Time
+	// step is zero for instant queries.
+	step                time.Duration
+	dedup               bool
+	partialResponse     bool
+	maxSourceResolution time.Duration
+	stats               *query.Stats
+	duration            time.Duration
+	err                 error
+}
+
+func (l *QueryLogger) log(r *http.Request, e queryLogEntry) {
+	if l == nil {
+		return
+	}
+
+	kvs := []interface{}{
+		"remote_addr", r.RemoteAddr,
+		"path", r.URL.Path,
+		"query", e.query,
+		"start", e.start.UTC().Format(time.RFC3339Nano),
+		"end", e.end.UTC().Format(time.RFC3339Nano),
+		"step", e.step.String(),
+		"dedup", e.dedup,
+		"partial_response", e.partialResponse,
+		"max_source_resolution", e.maxSourceResolution.String(),
+		"duration", e.duration.String(),
+	}
+	if e.stats != nil {
+		kvs = append(kvs,
+			"stores", e.stats.Stores(),
+			"series_fetched", e.stats.Series(),
+			"samples_fetched", e.stats.Samples(),
+		)
+	}
+	if e.err != nil {
+		kvs = append(kvs, "err", e.err.Error())
+	}
+
+	if l.queryLogger != nil {
+		if err := l.queryLogger.Log(kvs...); err != nil {
+			level.Warn(l.slowLogger).Log("msg", "failed to write query log", "err", err)
+		}
+	}
+	if l.slowThreshold > 0 && e.duration >= l.slowThreshold {
+		level.Warn(l.slowLogger).Log(append([]interface{}{"msg", "slow query detected"}, kvs...)...)
+	}
+}
+
+// queryStats are statistics of a query returned in the API response if requested.
+type queryStats struct {
+	Stores          []string `json:"stores"`
+	SeriesFetched   int64    `json:"seriesFetched"`
+	SamplesFetched  int64    `json:"samplesFetched"`
+	ExecTimeSeconds float64  `json:"execTimeSeconds"`
+}
+
+func newQueryStats(s *query.Stats, d time.Duration) *queryStats {
+	return &queryStats{
+		Stores:          s.Stores(),
+		SeriesFetched:   s.Series(),
+		SamplesFetched:  s.Samples(),
+		ExecTimeSeconds: d.Seconds(),
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/NYTimes/gziphandler"
@@ -37,8 +38,14 @@ import (
 	"github.com/prometheus/prometheus/promql"
 	"github.com/prometheus/prometheus/storage"
 	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
+	"github.com/thanos-io/thanos/pkg/gate"
+	"github.com/thanos-io/thanos/pkg/metadata/metadatapb"
 	"github.com/thanos-io/thanos/pkg/query"
 	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/strutil"
+	"github.com/thanos-io/thanos/pkg/targets/targetspb"
+	"github.com/thanos-io/thanos/pkg/tenancy"
 	"github.com/thanos-io/thanos/pkg/tracing"
 )
 
@@ -52,12 +59,13 @@ const (
 type ErrorType string
 
 const (
-	errorNone     ErrorType = ""
-	errorTimeout  ErrorType = "timeout"
-	errorCanceled ErrorType = "canceled"
-	errorExec     ErrorType = "execution"
-	errorBadData  ErrorType = "bad_data"
-	ErrorInternal ErrorType = "internal"
+	errorNone      ErrorType = ""
+	errorTimeout   ErrorType = "timeout"
+	errorCanceled  ErrorType = "canceled"
+	errorExec      ErrorType = "execution"
+	errorBadData   ErrorType = "bad_data"
+	errorForbidden ErrorType = "forbidden"
+	ErrorInternal  ErrorType = "internal"
 )
 
 var corsHeaders = map[string]string{
@@ -99,16 +107,48 @@ type API struct {
 	logger          log.Logger
 	queryableCreate query.QueryableCreator
 	queryEngine     *promql.Engine
+	// queryTimeout and queryGate apply to both locally evaluated and pushed down queries.
+	queryTimeout time.Duration
+	queryGate    *gate.Gate
+	metadatas    metadatapb.MetadataServer
+	targets      targetspb.TargetsServer
+	queryLogger  *QueryLogger
+	// distributedEngine is used to push down queries to leaf queriers if not nil.
+	distributedEngine *query.DistributedEngine
+	// tenancy limits requests to data of their tenants if not nil.
+	tenancy *tenancy.Enforcer
 
 	enableAutodownsampling                 bool
 	enablePartialResponse                  bool
 	replicaLabels                          []string
+	dedupAlgorithm                         query.DedupAlgorithm
 	reg                                    prometheus.Registerer
 	defaultInstantQueryMaxSourceResolution time.Duration
+	// downsamplingResolutions returns sorted resolutions of downsampled data in milliseconds available in stores.
+	// If set, automatic max source resolution is rounded down to one of them.
+	downsamplingResolutions func() []int64
 
 	now func() time.Time
 }
 
+// Options holds optional settings of the API.
+type Options struct {
+	// QueryTimeout and QueryGate apply to both locally evaluated and pushed down queries if set.
+	QueryTimeout time.Duration
+	QueryGate    *gate.Gate
+	// DedupAlgorithm is used for deduplication unless overridden by the dedup_algorithm parameter. Defaults to penalty.
+	DedupAlgorithm query.DedupAlgorithm
+	// DownsamplingResolutions returns sorted resolutions of downsampled data in milliseconds available in stores.
+	DownsamplingResolutions func() []int64
+	Metadatas               metadatapb.MetadataServer
+	Targets                 targetspb.TargetsServer
+	QueryLogger             *QueryLogger
+	// DistributedEngine pushes down queries to leaf queriers if set.
+	DistributedEngine *query.DistributedEngine
+	// TenantEnforcer limits requests to data of their tenants if set.
+	TenantEnforcer *tenancy.Enforcer
+}
+
 // NewAPI returns an initialized API type.
 func NewAPI(
 	logger log.Logger,
@@ -119,16 +159,26 @@ func NewAPI(
 	enablePartialResponse bool,
 	replicaLabels []string,
 	defaultInstantQueryMaxSourceResolution time.Duration,
+	opts Options,
 ) *API {
 	return &API{
 		logger:                                 logger,
 		queryEngine:                            qe,
+		queryTimeout:                           opts.QueryTimeout,
+		queryGate:                              opts.QueryGate,
 		queryableCreate:                        c,
+		metadatas:                              opts.Metadatas,
+		targets:                                opts.Targets,
+		queryLogger:                            opts.QueryLogger,
+		distributedEngine:                      opts.DistributedEngine,
+		tenancy:                                opts.TenantEnforcer,
 		enableAutodownsampling:                 enableAutodownsampling,
 		enablePartialResponse:                  enablePartialResponse,
 		replicaLabels:                          replicaLabels,
+		dedupAlgorithm:                         opts.DedupAlgorithm,
 		reg:                                    reg,
 		defaultInstantQueryMaxSourceResolution: defaultInstantQueryMaxSourceResolution,
+		downsamplingResolutions:                opts.DownsamplingResolutions,
 
 		now: time.Now,
 	}
@@ -139,7 +189,7 @@ func (api *API) Register(r *route.Router, tracer opentracing.Tracer, logger log.
 	instr := func(name string, f ApiFunc) http.HandlerFunc {
 		hf := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			SetCORS(w)
-			if data, warnings, err := f(r); err != nil {
+			if data, warnings, err := api.enforceTenant(f)(r); err != nil {
 				RespondError(w, err, data)
 			} else if data != nil {
 				Respond(w, data, warnings)
@@ -165,6 +215,27 @@ func (api *API) Register(r *route.Router, tracer opentracing.Tracer, logger log.
 
 	r.Get("/labels", instr("label_names", api.labelNames))
 	r.Post("/labels", instr("label_names", api.labelNames))
+
+	r.Get("/metadata", instr("metadata", api.metricMetadata))
+
+	r.Get("/targets", instr("targets", api.scrapeTargets))
+}
+
+// enforceTenant wraps the API function to limit the request to data of its tenant, if tenant enforcement is enabled.
+func (api *API) enforceTenant(f ApiFunc) ApiFunc {
+	if api.tenancy == nil {
+		return f
+	}
+	return func(r *http.Request) (interface{}, []error, *ApiError) {
+		if r.Method == http.MethodOptions {
+			return f(r)
+		}
+		t, err := api.tenancy.Tenant(r)
+		if err != nil {
+			return nil, nil, &ApiError{errorForbidden, err}
+		}
+		return f(r.WithContext(tenancy.ContextWithTenant(r.Context(), t)))
+	}
 }
 
 type queryData struct {
@@ -173,6 +244,10 @@ type queryData struct {
 
 	// Additional Thanos Response field.
 	Warnings []error `json:"warnings,omitempty"`
+	// Stats are returned only if requested by the stats parameter.
+	Stats *queryStats `json:"stats,omitempty"`
+	// Explanation of store selection is returned only if requested by the explain parameter.
+	Explanation []*store.SeriesExplanation `json:"explanation,omitempty"`
 }
 
 func (api *API) parseEnableDedupParam(r *http.Request) (enableDeduplication bool, _ *ApiError) {
@@ -204,13 +279,27 @@ func (api *API) parseReplicaLabelsParam(r *http.Request) (replicaLabels []string
 	return replicaLabels, nil
 }
 
+func (api *API) parseDedupAlgorithmParam(r *http.Request) (query.DedupAlgorithm, *ApiError) {
+	const dedupAlgorithmParam = "dedup_algorithm"
+	val := r.FormValue(dedupAlgorithmParam)
+	if val == "" {
+		return api.dedupAlgorithm, nil
+	}
+
+	algorithm, err := query.ParseDedupAlgorithm(val)
+	if err != nil {
+		return "", &ApiError{errorBadData, errors.Wrapf(err, "'%s' parameter", dedupAlgorithmParam)}
+	}
+	return algorithm, nil
+}
+
 func (api *API) parseDownsamplingParamMillis(r *http.Request, defaultVal time.Duration) (maxResolutionMillis int64, _ *ApiError) {
 	const maxSourceResolutionParam = "max_source_resolution"
 	maxSourceResolution := 0 * time.Second
 
 	val := r.FormValue(maxSourceResolutionParam)
 	if api.enableAutodownsampling || (val == "auto") {
-		maxSourceResolution = defaultVal
+		maxSourceResolution = api.roundToDownsamplingResolution(defaultVal)
 	} else if val != "" {
 		var err error
 		maxSourceResolution, err = parseDuration(val)
@@ -226,6 +315,25 @@ func (api *API) parseDownsamplingParamMillis(r *http.Request, defaultVal time.Du
 	return int64(maxSourceResolution / time.Millisecond), nil
 }
 
+// roundToDownsamplingResolution rounds the given resolution down to the biggest resolution of downsampled data not
+// bigger than it, or to raw data if there is none. The resolution is unchanged if no downsampled data is available.
+func (api *API) roundToDownsamplingResolution(res time.Duration) time.Duration {
+	if api.downsamplingResolutions == nil {
+		return res
+	}
+	resolutions := api.downsamplingResolutions()
+	if len(resolutions) == 0 {
+		return res
+	}
+	rounded := time.Duration(0)
+	for _, r := range resolutions {
+		if d := time.Duration(r) * time.Millisecond; d <= res {
+			rounded = d
+		}
+	}
+	return rounded
+}
+
 func (api *API) parsePartialResponseParam(r *http.Request) (enablePartialResponse bool, _ *ApiError) {
 	const partialResponseParam = "partial_response"
 	enablePartialResponse = api.enablePartialResponse
@@ -241,11 +349,108 @@ func (api *API) parsePartialResponseParam(r *http.Request) (enablePartialRespons
 	return enablePartialResponse, nil
 }
 
+func parseStatsParam(r *http.Request) (returnStats bool, _ *ApiError) {
+	const statsParam = "stats"
+
+	if val := r.FormValue(statsParam); val != "" {
+		var err error
+		returnStats, err = strconv.ParseBool(val)
+		if err != nil {
+			return false, &ApiError{errorBadData, errors.Wrapf(err, "'%s' parameter", statsParam)}
+		}
+	}
+	return returnStats, nil
+}
+
+func parseExplainParam(r *http.Request) (explain bool, _ *ApiError) {
+	const explainParam = "explain"
+
+	if val := r.FormValue(explainParam); val != "" {
+		var err error
+		explain, err = strconv.ParseBool(val)
+		if err != nil {
+			return false, &ApiError{errorBadData, errors.Wrapf(err, "'%s' parameter", explainParam)}
+		}
+	}
+	return explain, nil
+}
+
+// withExplanation returns context recording store selection of the query if requested.
+func withExplanation(ctx context.Context, explain bool) (context.Context, *store.Explanation) {
+	if !explain {
+		return ctx, nil
+	}
+	expl := &store.Explanation{}
+	return store.ContextWithExplanation(ctx, expl), expl
+}
+
+// withQueryStats returns context recording query statistics if they are needed either by
+// the query log or by the caller.
+func (api *API) withQueryStats(ctx context.Context, returnStats bool) (context.Context, *query.Stats) {
+	if api.queryLogger == nil && !returnStats {
+		return ctx, nil
+	}
+	stats := &query.Stats{}
+	return query.ContextWithStats(ctx, stats), stats
+}
+
+// exec evaluates the query between start and end with the given step, or as an instant query at start if step is
+// zero. The query is pushed down to leaf queriers if the distributed engine is enabled and able to do so.
+func (api *API) exec(ctx context.Context, qs string, start, end time.Time, step time.Duration, opts query.DistributedQueryOptions) (*promql.Result, *ApiError) {
+	// Same as the query engine, waiting for the turn counts into the query timeout.
+	if api.queryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, api.queryTimeout)
+		defer cancel()
+	}
+	if api.queryGate != nil {
+		if err := api.queryGate.IsMyTurn(ctx); err != nil {
+			if err == context.DeadlineExceeded {
+				return &promql.Result{Err: promql.ErrQueryTimeout("query queue")}, nil
+			}
+			return &promql.Result{Err: promql.ErrQueryCanceled("query queue")}, nil
+		}
+		defer api.queryGate.Done()
+	}
+
+	// Tenant matchers are enforced only by this querier, so queries of tenants are never pushed down. Neither are
+	// explained queries, as the store selection is done by the leaves then.
+	if api.distributedEngine != nil && tenancy.TenantFromContext(ctx) == nil && store.ExplanationFromContext(ctx) == nil {
+		if res := api.distributedEngine.Exec(ctx, qs, start, end, step, opts); res != nil {
+			return res, nil
+		}
+	}
+
+	var (
+		queryable = api.queryableCreate(opts.Deduplicate, opts.ReplicaLabels, opts.DedupAlgorithm, opts.MaxResolutionMillis, opts.PartialResponse, false)
+		qry       promql.Query
+		err       error
+	)
+	if step == 0 {
+		qry, err = api.queryEngine.NewInstantQuery(queryable, qs, start)
+	} else {
+		qry, err = api.queryEngine.NewRangeQuery(queryable, qs, start, end, step)
+	}
+	if err != nil {
+		return nil, &ApiError{errorBadData, err}
+	}
+	return qry.Exec(ctx), nil
+}
+
 func (api *API) options(r *http.Request) (interface{}, []error, *ApiError) {
 	return nil, nil, nil
 }
 
-func (api *API) query(r *http.Request) (interface{}, []error, *ApiError) {
+func (api *API) query(r *http.Request) (_ interface{}, _ []error, apiErr *ApiError) {
+	// The query is logged on every exit path, including invalid parameters.
+	entry := queryLogEntry{query: r.FormValue("query")}
+	defer func() {
+		if apiErr != nil {
+			entry.err = apiErr.Err
+		}
+		api.queryLogger.log(r, entry)
+	}()
+
 	var ts time.Time
 	if t := r.FormValue("time"); t != "" {
 		var err error
@@ -256,6 +461,7 @@ func (api *API) query(r *http.Request) (interface{}, []error, *ApiError) {
 	} else {
 		ts = api.now()
 	}
+	entry.start, entry.end = ts, ts
 
 	ctx := r.Context()
 	if to := r.FormValue("timeout"); to != "" {
@@ -273,32 +479,61 @@ func (api *API) query(r *http.Request) (interface{}, []error, *ApiError) {
 	if apiErr != nil {
 		return nil, nil, apiErr
 	}
+	entry.dedup = enableDedup
 
 	replicaLabels, apiErr := api.parseReplicaLabelsParam(r)
 	if apiErr != nil {
 		return nil, nil, apiErr
 	}
 
+	dedupAlgorithm, apiErr := api.parseDedupAlgorithmParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
 	enablePartialResponse, apiErr := api.parsePartialResponseParam(r)
 	if apiErr != nil {
 		return nil, nil, apiErr
 	}
+	entry.partialResponse = enablePartialResponse
 
 	maxSourceResolution, apiErr := api.parseDownsamplingParamMillis(r, api.defaultInstantQueryMaxSourceResolution)
 	if apiErr != nil {
 		return nil, nil, apiErr
 	}
+	entry.maxSourceResolution = time.Duration(maxSourceResolution) * time.Millisecond
+
+	returnStats, apiErr := parseStatsParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	ctx, stats := api.withQueryStats(ctx, returnStats)
+	entry.stats = stats
+
+	explain, apiErr := parseExplainParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	ctx, expl := withExplanation(ctx, explain)
 
 	// We are starting promQL tracing span here, because we have no control over promQL code.
 	span, ctx := tracing.StartSpan(ctx, "promql_instant_query")
 	defer span.Finish()
 
-	qry, err := api.queryEngine.NewInstantQuery(api.queryableCreate(enableDedup, replicaLabels, maxSourceResolution, enablePartialResponse, false), r.FormValue("query"), ts)
-	if err != nil {
-		return nil, nil, &ApiError{errorBadData, err}
+	begin := time.Now()
+	res, apiErr := api.exec(ctx, r.FormValue("query"), ts, ts, 0, query.DistributedQueryOptions{
+		Deduplicate:         enableDedup,
+		ReplicaLabels:       replicaLabels,
+		DedupAlgorithm:      dedupAlgorithm,
+		MaxResolutionMillis: maxSourceResolution,
+		PartialResponse:     enablePartialResponse,
+	})
+	duration := time.Since(begin)
+	entry.duration = duration
+	if apiErr != nil {
+		return nil, nil, apiErr
 	}
 
-	res := qry.Exec(ctx)
 	if res.Err != nil {
 		switch res.Err.(type) {
 		case promql.ErrQueryCanceled:
@@ -311,13 +546,29 @@ func (api *API) query(r *http.Request) (interface{}, []error, *ApiError) {
 		return nil, nil, &ApiError{errorExec, res.Err}
 	}
 
-	return &queryData{
+	qd := &queryData{
 		ResultType: res.Value.Type(),
 		Result:     res.Value,
-	}, res.Warnings, nil
+	}
+	if returnStats {
+		qd.Stats = newQueryStats(stats, duration)
+	}
+	if explain {
+		qd.Explanation = expl.Series()
+	}
+	return qd, res.Warnings, nil
 }
 
-func (api *API) queryRange(r *http.Request) (interface{}, []error, *ApiError) {
+func (api *API) queryRange(r *http.Request) (_ interface{}, _ []error, apiErr *ApiError) {
+	// The query is logged on every exit path, including invalid parameters.
+	entry := queryLogEntry{query: r.FormValue("query")}
+	defer func() {
+		if apiErr != nil {
+			entry.err = apiErr.Err
+		}
+		api.queryLogger.log(r, entry)
+	}()
+
 	start, err := parseTime(r.FormValue("start"))
 	if err != nil {
 		return nil, nil, &ApiError{errorBadData, err}
@@ -331,10 +582,13 @@ func (api *API) queryRange(r *http.Request) (interface{}, []error, *ApiError) {
 		return nil, nil, &ApiError{errorBadData, err}
 	}
 
+	entry.start, entry.end = start, end
+
 	step, err := parseDuration(r.FormValue("step"))
 	if err != nil {
 		return nil, nil, &ApiError{errorBadData, errors.Wrap(err, "param step")}
 	}
+	entry.step = step
 
 	if step <= 0 {
 		err := errors.New("zero or negative query resolution step widths are not accepted. Try a positive integer")
@@ -364,39 +618,62 @@ func (api *API) queryRange(r *http.Request) (interface{}, []error, *ApiError) {
 	if apiErr != nil {
 		return nil, nil, apiErr
 	}
+	entry.dedup = enableDedup
 
 	replicaLabels, apiErr := api.parseReplicaLabelsParam(r)
 	if apiErr != nil {
 		return nil, nil, apiErr
 	}
 
+	dedupAlgorithm, apiErr := api.parseDedupAlgorithmParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
 	// If no max_source_resolution is specified fit at least 5 samples between steps.
 	maxSourceResolution, apiErr := api.parseDownsamplingParamMillis(r, step/5)
 	if apiErr != nil {
 		return nil, nil, apiErr
 	}
+	entry.maxSourceResolution = time.Duration(maxSourceResolution) * time.Millisecond
 
 	enablePartialResponse, apiErr := api.parsePartialResponseParam(r)
 	if apiErr != nil {
 		return nil, nil, apiErr
 	}
+	entry.partialResponse = enablePartialResponse
+
+	returnStats, apiErr := parseStatsParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	ctx, stats := api.withQueryStats(ctx, returnStats)
+	entry.stats = stats
+
+	explain, apiErr := parseExplainParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+	ctx, expl := withExplanation(ctx, explain)
 
 	// We are starting promQL tracing span here, because we have no control over promQL code.
 	span, ctx := tracing.StartSpan(ctx, "promql_range_query")
 	defer span.Finish()
 
-	qry, err := api.queryEngine.NewRangeQuery(
-		api.queryableCreate(enableDedup, replicaLabels, maxSourceResolution, enablePartialResponse, false),
-		r.FormValue("query"),
-		start,
-		end,
-		step,
-	)
-	if err != nil {
-		return nil, nil, &ApiError{errorBadData, err}
+	begin := time.Now()
+	res, apiErr := api.exec(ctx, r.FormValue("query"), start, end, step, query.DistributedQueryOptions{
+		Deduplicate:         enableDedup,
+		ReplicaLabels:       replicaLabels,
+		DedupAlgorithm:      dedupAlgorithm,
+		MaxResolutionMillis: maxSourceResolution,
+		PartialResponse:     enablePartialResponse,
+	})
+	duration := time.Since(begin)
+	entry.duration = duration
+	if apiErr != nil {
+		return nil, nil, apiErr
 	}
 
-	res := qry.Exec(ctx)
 	if res.Err != nil {
 		switch res.Err.(type) {
 		case promql.ErrQueryCanceled:
@@ -407,10 +684,17 @@ func (api *API) queryRange(r *http.Request) (interface{}, []error, *ApiError) {
 		return nil, nil, &ApiError{errorExec, res.Err}
 	}
 
-	return &queryData{
+	qd := &queryData{
 		ResultType: res.Value.Type(),
 		Result:     res.Value,
-	}, res.Warnings, nil
+	}
+	if returnStats {
+		qd.Stats = newQueryStats(stats, duration)
+	}
+	if explain {
+		qd.Explanation = expl.Series()
+	}
+	return qd, res.Warnings, nil
 }
 
 func (api *API) labelValues(r *http.Request) (interface{}, []error, *ApiError) {
@@ -421,25 +705,49 @@ func (api *API) labelValues(r *http.Request) (interface{}, []error, *ApiError) {
 		return nil, nil, &ApiError{errorBadData, fmt.Errorf("invalid label name: %q", name)}
 	}
 
+	start, end, matcherSets, apiErr := parseLabelsParams(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
 	enablePartialResponse, apiErr := api.parsePartialResponseParam(r)
 	if apiErr != nil {
 		return nil, nil, apiErr
 	}
 
-	q, err := api.queryableCreate(true, nil, 0, enablePartialResponse, false).Querier(ctx, math.MinInt64, math.MaxInt64)
+	q, err := api.queryableCreate(true, nil, api.dedupAlgorithm, 0, enablePartialResponse, true).
+		Querier(ctx, timestamp.FromTime(start), timestamp.FromTime(end))
 	if err != nil {
 		return nil, nil, &ApiError{errorExec, err}
 	}
 	defer runutil.CloseWithLogOnErr(api.logger, q, "queryable labelValues")
 
-	// TODO(fabxc): add back request context.
+	if len(matcherSets) == 0 {
+		vals, warnings, err := q.LabelValues(name)
+		if err != nil {
+			return nil, nil, &ApiError{errorExec, err}
+		}
+		return vals, warnings, nil
+	}
 
-	vals, warnings, err := q.LabelValues(name)
-	if err != nil {
-		return nil, nil, &ApiError{errorExec, err}
+	lq, ok := q.(query.LabelQuerier)
+	if !ok {
+		return nil, nil, &ApiError{errorExec, errors.New("querier does not support match[] for label values")}
 	}
 
-	return vals, warnings, nil
+	var (
+		sets     [][]string
+		warnings []error
+	)
+	for _, ms := range matcherSets {
+		vals, warns, err := lq.LabelValuesWithMatchers(name, ms...)
+		if err != nil {
+			return nil, nil, &ApiError{errorExec, err}
+		}
+		warnings = append(warnings, warns...)
+		sets = append(sets, vals)
+	}
+	return strutil.MergeSlices(sets...), warnings, nil
 }
 
 var (
@@ -456,35 +764,18 @@ func (api *API) series(r *http.Request) (interface{}, []error, *ApiError) {
 		return nil, nil, &ApiError{errorBadData, fmt.Errorf("no match[] parameter provided")}
 	}
 
-	var start time.Time
-	if t := r.FormValue("start"); t != "" {
-		var err error
-		start, err = parseTime(t)
-		if err != nil {
-			return nil, nil, &ApiError{errorBadData, err}
-		}
-	} else {
-		start = minTime
+	start, err := parseTimeParam(r, "start", minTime)
+	if err != nil {
+		return nil, nil, &ApiError{errorBadData, err}
 	}
-
-	var end time.Time
-	if t := r.FormValue("end"); t != "" {
-		var err error
-		end, err = parseTime(t)
-		if err != nil {
-			return nil, nil, &ApiError{errorBadData, err}
-		}
-	} else {
-		end = maxTime
+	end, err := parseTimeParam(r, "end", maxTime)
+	if err != nil {
+		return nil, nil, &ApiError{errorBadData, err}
 	}
 
-	var matcherSets [][]*labels.Matcher
-	for _, s := range r.Form["match[]"] {
-		matchers, err := promql.ParseMetricSelector(s)
-		if err != nil {
-			return nil, nil, &ApiError{errorBadData, err}
-		}
-		matcherSets = append(matcherSets, matchers)
+	matcherSets, err := parseMatchersParam(r.Form["match[]"])
+	if err != nil {
+		return nil, nil, &ApiError{errorBadData, err}
 	}
 
 	enableDedup, apiErr := api.parseEnableDedupParam(r)
@@ -503,7 +794,7 @@ func (api *API) series(r *http.Request) (interface{}, []error, *ApiError) {
 	}
 
 	// TODO(bwplotka): Support downsampling?
-	q, err := api.queryableCreate(enableDedup, replicaLabels, 0, enablePartialResponse, true).
+	q, err := api.queryableCreate(enableDedup, replicaLabels, api.dedupAlgorithm, 0, enablePartialResponse, true).
 		Querier(r.Context(), timestamp.FromTime(start), timestamp.FromTime(end))
 	if err != nil {
 		return nil, nil, &ApiError{errorExec, err}
@@ -555,6 +846,8 @@ func RespondError(w http.ResponseWriter, apiErr *ApiError, data interface{}) {
 	switch apiErr.Typ {
 	case errorBadData:
 		code = http.StatusBadRequest
+	case errorForbidden:
+		code = http.StatusForbidden
 	case errorExec:
 		code = 422
 	case errorCanceled, errorTimeout:
@@ -574,6 +867,30 @@ func RespondError(w http.ResponseWriter, apiErr *ApiError, data interface{}) {
 	})
 }
 
+func parseTimeParam(r *http.Request, paramName string, defaultValue time.Time) (time.Time, error) {
+	val := r.FormValue(paramName)
+	if val == "" {
+		return defaultValue, nil
+	}
+	result, err := parseTime(val)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "invalid time value for '%s'", paramName)
+	}
+	return result, nil
+}
+
+func parseMatchersParam(matchers []string) ([][]*labels.Matcher, error) {
+	var matcherSets [][]*labels.Matcher
+	for _, s := range matchers {
+		ms, err := promql.ParseMetricSelector(s)
+		if err != nil {
+			return nil, err
+		}
+		matcherSets = append(matcherSets, ms)
+	}
+	return matcherSets, nil
+}
+
 func parseTime(s string) (time.Time, error) {
 	if t, err := strconv.ParseFloat(s, 64); err == nil {
 		s, ns := math.Modf(t)
@@ -602,21 +919,147 @@ func parseDuration(s string) (time.Duration, error) {
 func (api *API) labelNames(r *http.Request) (interface{}, []error, *ApiError) {
 	ctx := r.Context()
 
+	start, end, matcherSets, apiErr := parseLabelsParams(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
 	enablePartialResponse, apiErr := api.parsePartialResponseParam(r)
 	if apiErr != nil {
 		return nil, nil, apiErr
 	}
 
-	q, err := api.queryableCreate(true, nil, 0, enablePartialResponse, false).Querier(ctx, math.MinInt64, math.MaxInt64)
+	q, err := api.queryableCreate(true, nil, api.dedupAlgorithm, 0, enablePartialResponse, true).
+		Querier(ctx, timestamp.FromTime(start), timestamp.FromTime(end))
 	if err != nil {
 		return nil, nil, &ApiError{errorExec, err}
 	}
 	defer runutil.CloseWithLogOnErr(api.logger, q, "queryable labelNames")
 
-	names, warnings, err := q.LabelNames()
+	if len(matcherSets) == 0 {
+		names, warnings, err := q.LabelNames()
+		if err != nil {
+			return nil, nil, &ApiError{errorExec, err}
+		}
+		return names, warnings, nil
+	}
+
+	lq, ok := q.(query.LabelQuerier)
+	if !ok {
+		return nil, nil, &ApiError{errorExec, errors.New("querier does not support match[] for label names")}
+	}
+
+	var (
+		sets     [][]string
+		warnings []error
+	)
+	for _, ms := range matcherSets {
+		names, warns, err := lq.LabelNamesWithMatchers(ms...)
+		if err != nil {
+			return nil, nil, &ApiError{errorExec, err}
+		}
+		warnings = append(warnings, warns...)
+		sets = append(sets, names)
+	}
+	return strutil.MergeSlices(sets...), warnings, nil
+}
+
+// parseLabelsParams parses optional time range and match[] parameters of label names and values requests.
+func parseLabelsParams(r *http.Request) (start, end time.Time, matcherSets [][]*labels.Matcher, _ *ApiError) {
+	if err := r.ParseForm(); err != nil {
+		return start, end, nil, &ApiError{ErrorInternal, errors.Wrap(err, "parse form")}
+	}
+
+	start, err := parseTimeParam(r, "start", minTime)
+	if err != nil {
+		return start, end, nil, &ApiError{errorBadData, err}
+	}
+	end, err = parseTimeParam(r, "end", maxTime)
+	if err != nil {
+		return start, end, nil, &ApiError{errorBadData, err}
+	}
+
+	matcherSets, err = parseMatchersParam(r.Form["match[]"])
+	if err != nil {
+		return start, end, nil, &ApiError{errorBadData, err}
+	}
+	return start, end, matcherSets, nil
+}
+
+func (api *API) metricMetadata(r *http.Request) (interface{}, []error, *ApiError) {
+	if api.tenancy != nil {
+		return nil, nil, &ApiError{errorForbidden, errors.New("metric metadata is not available with tenant enforcement")}
+	}
+	limit := -1
+	if s := r.FormValue("limit"); s != "" {
+		var err error
+		if limit, err = strconv.Atoi(s); err != nil {
+			return nil, nil, &ApiError{errorBadData, errors.New("limit must be a number")}
+		}
+	}
+
+	enablePartialResponse, apiErr := api.parsePartialResponseParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	res := map[string][]metadatapb.Meta{}
+	// Same as in Prometheus, zero limit means no results.
+	if limit == 0 {
+		return res, nil, nil
+	}
+	if limit < 0 {
+		limit = 0
+	}
+
+	resp, err := api.metadatas.Metadata(r.Context(), &metadatapb.MetadataRequest{
+		Metric:                  r.FormValue("metric"),
+		Limit:                   int32(limit),
+		PartialResponseDisabled: !enablePartialResponse,
+	})
 	if err != nil {
 		return nil, nil, &ApiError{errorExec, err}
 	}
 
-	return names, warnings, nil
+	var warnings []error
+	for _, w := range resp.Warnings {
+		warnings = append(warnings, errors.New(w))
+	}
+	for _, md := range resp.Metadata {
+		res[md.Metric] = md.Metas
+	}
+	return res, warnings, nil
+}
+
+func (api *API) scrapeTargets(r *http.Request) (interface{}, []error, *ApiError) {
+	if api.tenancy != nil {
+		return nil, nil, &ApiError{errorForbidden, errors.New("scrape targets are not available with tenant enforcement")}
+	}
+	state := targetspb.TargetsRequest_ANY
+	if s := r.FormValue("state"); s != "" {
+		v, ok := targetspb.TargetsRequest_State_value[strings.ToUpper(s)]
+		if !ok {
+			return nil, nil, &ApiError{errorBadData, errors.Errorf("invalid state %q, must be one of 'any', 'active' or 'dropped'", s)}
+		}
+		state = targetspb.TargetsRequest_State(v)
+	}
+
+	enablePartialResponse, apiErr := api.parsePartialResponseParam(r)
+	if apiErr != nil {
+		return nil, nil, apiErr
+	}
+
+	resp, err := api.targets.Targets(r.Context(), &targetspb.TargetsRequest{
+		State:                   state,
+		PartialResponseDisabled: !enablePartialResponse,
+	})
+	if err != nil {
+		return nil, nil, &ApiError{errorExec, err}
+	}
+
+	var warnings []error
+	for _, w := range resp.Warnings {
+		warnings = append(warnings, errors.New(w))
+	}
+	return resp.Targets, warnings, nil
 }
@@ -24,6 +24,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -39,8 +41,11 @@ import (
 	"github.com/thanos-io/thanos/pkg/compact"
 	"github.com/thanos-io/thanos/pkg/component"
 	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
+	"github.com/thanos-io/thanos/pkg/gate"
+	"github.com/thanos-io/thanos/pkg/metadata/metadatapb"
 	"github.com/thanos-io/thanos/pkg/query"
 	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/tenancy"
 	"github.com/thanos-io/thanos/pkg/testutil"
 )
 
@@ -387,6 +392,14 @@ func TestEndpoints(t *testing.T) {
 			},
 			errType: errorBadData,
 		},
+		{
+			endpoint: api.query,
+			query: url.Values{
+				"query":           []string{"0.333"},
+				"dedup_algorithm": []string{"sdfsf"},
+			},
+			errType: errorBadData,
+		},
 		{
 			endpoint: api.queryRange,
 			query: url.Values{
@@ -501,6 +514,17 @@ func TestEndpoints(t *testing.T) {
 			},
 			errType: errorBadData,
 		},
+		{
+			endpoint: api.queryRange,
+			query: url.Values{
+				"query":           []string{"time()"},
+				"start":           []string{"0"},
+				"end":             []string{"2"},
+				"step":            []string{"1"},
+				"dedup_algorithm": []string{"sdfsf-range"},
+			},
+			errType: errorBadData,
+		},
 		{
 			endpoint: api.labelValues,
 			params: map[string]string{
@@ -530,6 +554,93 @@ func TestEndpoints(t *testing.T) {
 			},
 			errType: errorBadData,
 		},
+		{
+			endpoint: api.labelValues,
+			params: map[string]string{
+				"name": "foo",
+			},
+			query: url.Values{
+				"match[]": []string{"test_metric2"},
+			},
+			response: []string{
+				"boo",
+			},
+		},
+		{
+			endpoint: api.labelValues,
+			params: map[string]string{
+				"name": "replica",
+			},
+			query: url.Values{
+				"match[]": []string{`test_metric_replica1{foo="bar"}`, `test_metric_replica1{replica="b"}`},
+			},
+			response: []string{
+				"a",
+				"b",
+			},
+		},
+		// Matching series have no samples within the time range.
+		{
+			endpoint: api.labelValues,
+			params: map[string]string{
+				"name": "foo",
+			},
+			query: url.Values{
+				"match[]": []string{"test_metric2"},
+				"start":   []string{"1000"},
+				"end":     []string{"2000"},
+			},
+			response: []string{},
+		},
+		{
+			endpoint: api.labelValues,
+			params: map[string]string{
+				"name": "foo",
+			},
+			query: url.Values{
+				"match[]": []string{"{foo"},
+			},
+			errType: errorBadData,
+		},
+		{
+			endpoint: api.labelNames,
+			response: []string{
+				"__name__",
+				"foo",
+				"replica",
+				"replica1",
+			},
+		},
+		{
+			endpoint: api.labelNames,
+			query: url.Values{
+				"match[]": []string{"test_metric2"},
+			},
+			response: []string{
+				"__name__",
+				"foo",
+			},
+		},
+		{
+			endpoint: api.labelNames,
+			query: url.Values{
+				"match[]": []string{`test_metric_replica1{replica1="a"}`},
+				"start":   []string{"0"},
+				"end":     []string{"600"},
+			},
+			response: []string{
+				"__name__",
+				"foo",
+				"replica1",
+			},
+		},
+		{
+			endpoint: api.labelNames,
+			query: url.Values{
+				"start": []string{"foo"},
+			},
+			errType: errorBadData,
+		},
 		{
 			endpoint: api.series,
 			query: url.Values{
@@ -1046,6 +1157,87 @@ func TestOptionsMethod(t *testing.T) {
 	}
 }
 
+type testMetadataServer struct {
+	resp *metadatapb.MetadataResponse
+	err  error
+
+	lastReq *metadatapb.MetadataRequest
+}
+
+func (s *testMetadataServer) Metadata(_ context.Context, r *metadatapb.MetadataRequest) (*metadatapb.MetadataResponse, error) {
+	s.lastReq = r
+	return s.resp, s.err
+}
+
+func TestMetricMetadata(t *testing.T) {
+	srv := &testMetadataServer{resp: &metadatapb.MetadataResponse{
+		Metadata: []metadatapb.MetricMetadata{
+			{Metric: "http_requests_total", Metas: []metadatapb.Meta{{Type: "counter", Help: "Total requests."}}},
+			{Metric: "up", Metas: []metadatapb.Meta{{Type: "gauge", Help: "Target is up."}}},
+		},
+		Warnings: []string{"store unavailable"},
+	}}
+
+	r := route.New()
+	api := &API{metadatas: srv, enablePartialResponse: true}
+	api.Register(r, &opentracing.NoopTracer{}, log.NewNopLogger(), extpromhttp.NewNopInstrumentationMiddleware())
+
+	s := httptest.NewServer(r)
+	defer s.Close()
+
+	get := func(t *testing.T, query string) (int, *response, map[string][]metadatapb.Meta) {
+		resp, err := http.Get(s.URL + "/metadata" + query)
+		testutil.Ok(t, err)
+		defer func() { testutil.Ok(t, resp.Body.Close()) }()
+
+		var res struct {
+			response
+			Data map[string][]metadatapb.Meta `json:"data"`
+		}
+		testutil.Ok(t, json.NewDecoder(resp.Body).Decode(&res))
+		return resp.StatusCode, &res.response, res.Data
+	}
+
+	t.Run("all", func(t *testing.T) {
+		code, resp, data := get(t, "")
+		testutil.Equals(t, http.StatusOK, code)
+		testutil.Equals(t, statusSuccess, resp.Status)
+		testutil.Equals(t, []string{"store unavailable"}, resp.Warnings)
+		testutil.Equals(t, map[string][]metadatapb.Meta{
+			"http_requests_total": {{Type: "counter", Help: "Total requests."}},
+			"up":                  {{Type: "gauge", Help: "Target is up."}},
+		}, data)
+		testutil.Equals(t, &metadatapb.MetadataRequest{}, srv.lastReq)
+	})
+	t.Run("metric and limit", func(t *testing.T) {
+		srv.lastReq = nil
+		code, _, _ := get(t, "?metric=up&limit=1&partial_response=false")
+		testutil.Equals(t, http.StatusOK, code)
+		testutil.Equals(t, &metadatapb.MetadataRequest{Metric: "up", Limit: 1, PartialResponseDisabled: true}, srv.lastReq)
+	})
+	t.Run("zero limit", func(t *testing.T) {
+		srv.lastReq = nil
+		code, _, data := get(t, "?limit=0")
+		testutil.Equals(t, http.StatusOK, code)
+		testutil.Equals(t, 0, len(data))
+		testutil.Assert(t, srv.lastReq == nil, "expected no request for zero limit")
+	})
+	t.Run("bad limit", func(t *testing.T) {
+		code, resp, _ := get(t, "?limit=x")
+		testutil.Equals(t, http.StatusBadRequest, code)
+		testutil.Equals(t, statusError, resp.Status)
+		testutil.Equals(t, errorBadData, resp.ErrorType)
+	})
+	t.Run("error", func(t *testing.T) {
+		srv.err = errors.New("unavailable")
+		defer func() { srv.err = nil }()
+
+		code, resp, _ := get(t, "?partial_response=false")
+		testutil.Equals(t, http.StatusUnprocessableEntity, code)
+		testutil.Equals(t, errorExec, resp.ErrorType)
+	})
+}
+
 func BenchmarkQueryResultEncoding(b *testing.B) {
 	var mat promql.Matrix
 	for i := 0; i < 1000; i++ {
@@ -1149,3 +1341,231 @@ func TestParseDownsamplingParamMillis(t *testing.T) {
 
 	}
 }
+
+func TestParseDownsamplingParamMillis_customResolutions(t *testing.T) {
+	api := API{
+		enableAutodownsampling: true,
+		downsamplingResolutions: func() []int64 {
+			return []int64{int64(time.Minute / time.Millisecond), int64(10 * time.Minute / time.Millisecond)}
+		},
+	}
+	for _, tcase := range []struct {
+		step     time.Duration
+		expected time.Duration
+	}{
+		{step: 4 * time.Minute, expected: 0},
+		{step: 5 * time.Minute, expected: time.Minute},
+		{step: 45 * time.Minute, expected: time.Minute},
+		{step: time.Hour, expected: 10 * time.Minute},
+		{step: 24 * time.Hour, expected: 10 * time.Minute},
+	} {
+		t.Run(tcase.step.String(), func(t *testing.T) {
+			r := http.Request{PostForm: url.Values{}}
+			maxResMillis, apiErr := api.parseDownsamplingParamMillis(&r, tcase.step/5)
+			testutil.Assert(t, apiErr == nil, "unexpected error %v", apiErr)
+			testutil.Equals(t, int64(tcase.expected/time.Millisecond), maxResMillis)
+		})
+	}
+}
+
+func TestQueryStatsAndLog(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	db, err := testutil.NewTSDB()
+	defer func() { testutil.Ok(t, db.Close()) }()
+	testutil.Ok(t, err)
+
+	app := db.Appender()
+	for i := int64(0); i < 10; i++ {
+		_, err := app.Add(labels.FromStrings("__name__", "test_metric1", "foo", "bar"), i*60000, float64(i))
+		testutil.Ok(t, err)
+	}
+	testutil.Ok(t, app.Commit())
+
+	dir, err := ioutil.TempDir("", "query-log")
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, os.RemoveAll(dir)) }()
+
+	logFile := filepath.Join(dir, "query.log")
+	queryLogger, err := NewQueryLogger(nil, logFile, 0)
+	testutil.Ok(t, err)
+
+	api := &API{
+		queryableCreate: query.NewQueryableCreator(nil, store.NewTSDBStore(nil, nil, db, component.Query, nil)),
+		queryEngine: promql.NewEngine(promql.EngineOpts{
+			MaxConcurrent: 20,
+			MaxSamples:    10000,
+			Timeout:       100 * time.Second,
+		}),
+		queryLogger: queryLogger,
+		now:         time.Now,
+	}
+
+	req, err := http.NewRequest("GET", "http://example.com?query=test_metric1&time=540&stats=true", nil)
+	testutil.Ok(t, err)
+	data, _, apiErr := api.query(req)
+	testutil.Assert(t, apiErr == nil, "unexpected error %v", apiErr)
+
+	stats := data.(*queryData).Stats
+	testutil.Assert(t, stats != nil, "expected stats in response")
+	testutil.Equals(t, int64(1), stats.SeriesFetched)
+	// Only samples within the lookback delta are fetched.
+	testutil.Equals(t, int64(6), stats.SamplesFetched)
+
+	// Stats are not returned unless requested.
+	req, err = http.NewRequest("GET", "http://example.com?query=sum(test_metric1)&start=0&end=540&step=60", nil)
+	testutil.Ok(t, err)
+	data, _, apiErr = api.queryRange(req)
+	testutil.Assert(t, apiErr == nil, "unexpected error %v", apiErr)
+	testutil.Assert(t, data.(*queryData).Stats == nil, "expected no stats in response")
+
+	// Rejected queries are logged as well.
+	req, err = http.NewRequest("GET", "http://example.com?query=test_metric1&start=0&end=540&step=0", nil)
+	testutil.Ok(t, err)
+	_, _, apiErr = api.queryRange(req)
+	testutil.Assert(t, apiErr != nil, "expected error")
+
+	testutil.Ok(t, queryLogger.Close())
+
+	b, err := ioutil.ReadFile(logFile)
+	testutil.Ok(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	testutil.Equals(t, 3, len(lines))
+
+	rejected := map[string]interface{}{}
+	testutil.Ok(t, json.Unmarshal([]byte(lines[2]), &rejected))
+	testutil.Equals(t, "test_metric1", rejected["query"])
+	testutil.Equals(t, apiErr.Err.Error(), rejected["err"])
+
+	for i, exp := range []struct {
+		query   string
+		step    string
+		samples float64
+	}{
+		{query: "test_metric1", step: "0s", samples: 6},
+		{query: "sum(test_metric1)", step: "1m0s", samples: 10},
+	} {
+		entry := map[string]interface{}{}
+		testutil.Ok(t, json.Unmarshal([]byte(lines[i]), &entry))
+		testutil.Equals(t, exp.query, entry["query"])
+		testutil.Equals(t, exp.step, entry["step"])
+		testutil.Equals(t, float64(1), entry["series_fetched"])
+		testutil.Equals(t, exp.samples, entry["samples_fetched"])
+	}
+}
+
+func TestTenantEnforcement(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	db, err := testutil.NewTSDB()
+	defer func() { testutil.Ok(t, db.Close()) }()
+	testutil.Ok(t, err)
+
+	app := db.Appender()
+	for _, team := range []string{"a", "b"} {
+		_, err := app.Add(labels.FromStrings("__name__", "test_metric1", "team", team), 0, 1)
+		testutil.Ok(t, err)
+	}
+	testutil.Ok(t, app.Commit())
+
+	enforcer, err := tenancy.NewEnforcer("X-Tenant", []byte(`tenants: [{name: team-a, matchers: '{team="a"}'}]`))
+	testutil.Ok(t, err)
+
+	api := &API{
+		queryableCreate: query.NewQueryableCreator(nil, store.NewTSDBStore(nil, nil, db, component.Query, nil)),
+		queryEngine: promql.NewEngine(promql.EngineOpts{
+			MaxConcurrent: 20,
+			MaxSamples:    10000,
+			Timeout:       100 * time.Second,
+		}),
+		tenancy: enforcer,
+		now:     time.Now,
+	}
+
+	newRequest := func(u, tenant string) *http.Request {
+		req, err := http.NewRequest("GET", u, nil)
+		testutil.Ok(t, err)
+		if tenant != "" {
+			req.Header.Set("X-Tenant", tenant)
+		}
+		return req
+	}
+
+	data, _, apiErr := api.enforceTenant(api.query)(newRequest("http://example.com?query=sum+by+(team)(test_metric1)&time=0", "team-a"))
+	testutil.Assert(t, apiErr == nil, "unexpected error %v", apiErr)
+	testutil.Equals(t, promql.Vector{{Metric: labels.FromStrings("team", "a"), Point: promql.Point{T: 0, V: 1}}}, data.(*queryData).Result)
+
+	data, _, apiErr = api.enforceTenant(api.series)(newRequest("http://example.com?match[]=test_metric1&start=0&end=1", "team-a"))
+	testutil.Assert(t, apiErr == nil, "unexpected error %v", apiErr)
+	testutil.Equals(t, []labels.Labels{labels.FromStrings("__name__", "test_metric1", "team", "a")}, data)
+
+	for _, tenant := range []string{"", "team-b"} {
+		_, _, apiErr = api.enforceTenant(api.query)(newRequest("http://example.com?query=test_metric1&time=0", tenant))
+		testutil.Assert(t, apiErr != nil && apiErr.Typ == errorForbidden, "expected forbidden error for tenant %q, got %v", tenant, apiErr)
+	}
+
+	_, _, apiErr = api.enforceTenant(api.metricMetadata)(newRequest("http://example.com", "team-a"))
+	testutil.Assert(t, apiErr != nil && apiErr.Typ == errorForbidden, "expected forbidden error, got %v", apiErr)
+}
+
+func TestQueryGateAndTimeout(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	api := &API{
+		queryableCreate: query.NewQueryableCreator(nil, store.NewProxyStore(nil, func() []store.Client { return nil }, component.Query, nil, 0)),
+		queryEngine: promql.NewEngine(promql.EngineOpts{
+			MaxConcurrent: 20,
+			MaxSamples:    10000,
+			Timeout:       100 * time.Second,
+		}),
+		queryTimeout: 100 * time.Millisecond,
+		queryGate:    gate.NewGate(1, nil),
+		now:          time.Now,
+	}
+
+	req, err := http.NewRequest("GET", "http://example.com?query=test_metric1&time=0", nil)
+	testutil.Ok(t, err)
+	_, _, apiErr := api.query(req)
+	testutil.Assert(t, apiErr == nil, "unexpected error %v", apiErr)
+
+	// Query waiting for its turn longer than the query timeout times out.
+	testutil.Ok(t, api.queryGate.IsMyTurn(context.Background()))
+	defer api.queryGate.Done()
+
+	_, _, apiErr = api.query(req)
+	testutil.Assert(t, apiErr != nil && apiErr.Typ == errorTimeout, "expected timeout error, got %v", apiErr)
+}
+
+func TestQueryExplain(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	api := &API{
+		queryableCreate: query.NewQueryableCreator(nil, store.NewProxyStore(nil, func() []store.Client { return nil }, component.Query, nil, 0)),
+		queryEngine: promql.NewEngine(promql.EngineOpts{
+			MaxConcurrent: 20,
+			MaxSamples:    10000,
+			Timeout:       100 * time.Second,
+		}),
+		enableAutodownsampling: true,
+		now:                    time.Now,
+	}
+
+	req, err := http.NewRequest("GET", "http://example.com?query=sum(rate(test_metric1[5m]))&start=0&end=600&step=60&explain=true", nil)
+	testutil.Ok(t, err)
+	data, _, apiErr := api.queryRange(req)
+	testutil.Assert(t, apiErr == nil, "unexpected error %v", apiErr)
+
+	expl := data.(*queryData).Explanation
+	testutil.Equals(t, 1, len(expl))
+	testutil.Equals(t, `{__name__="test_metric1"}`, expl[0].Matchers)
+	testutil.Equals(t, []string{"COUNTER"}, expl[0].Aggregates)
+	testutil.Equals(t, int64(12000), expl[0].MaxResolutionWindow)
+	testutil.Equals(t, 0, len(expl[0].Stores))
+
+	// Explanation is not returned unless requested.
+	req, err = http.NewRequest("GET", "http://example.com?query=test_metric1&time=0", nil)
+	testutil.Ok(t, err)
+	data, _, apiErr = api.query(req)
+	testutil.Assert(t, apiErr == nil, "unexpected error %v", apiErr)
+	testutil.Assert(t, data.(*queryData).Explanation == nil, "expected no explanation in response")
+}
@@ -0,0 +1,378 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/thanos-io/thanos/pkg/query/querypb"
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/tracing"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// QueryClient holds a client to a querier which is able to evaluate PromQL queries on its own (leaf querier).
+type QueryClient interface {
+	store.Client
+
+	// Client to access the query API of the querier.
+	querypb.QueryClient
+}
+
+// DistributedQueryOptions are options of a query evaluated by the DistributedEngine.
+type DistributedQueryOptions struct {
+	Deduplicate         bool
+	ReplicaLabels       []string
+	DedupAlgorithm      DedupAlgorithm
+	MaxResolutionMillis int64
+	PartialResponse     bool
+}
+
+// DistributedEngine evaluates aggregations by pushing them down to leaf queriers selected by their external labels,
+// and merging their partial aggregates. This way only aggregated results are transferred from leaves instead of
+// raw series.
+type DistributedEngine struct {
+	logger     log.Logger
+	stores     func() []store.Client
+	leaves     func() []QueryClient
+	maxSamples int
+}
+
+// NewDistributedEngine returns a new DistributedEngine. The stores function returns all stores the querier is
+// connected to, the leaves function returns the ones which are queriers able to evaluate queries. Same as
+// promql.EngineOpts.MaxSamples, maxSamples limits the number of samples of leaf responses held by a single query.
+func NewDistributedEngine(logger log.Logger, stores func() []store.Client, leaves func() []QueryClient, maxSamples int) *DistributedEngine {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &DistributedEngine{
+		logger:     logger,
+		stores:     stores,
+		leaves:     leaves,
+		maxSamples: maxSamples,
+	}
+}
+
+// Exec evaluates the given query between start and end with the given step, or as an instant query at start if step
+// is zero. It returns nil if the query can't be pushed down, because it can't be decomposed or some of the stores
+// holding its data are not leaf queriers. The caller is expected to evaluate such queries locally.
+// The caller is expected to apply the query timeout to the context and to limit the query concurrency, same as for
+// locally evaluated queries. Query statistics are recorded into the Stats of the context, if any.
+func (e *DistributedEngine) Exec(ctx context.Context, qs string, start, end time.Time, step time.Duration, opts DistributedQueryOptions) *promql.Result {
+	expr, err := promql.ParseExpr(qs)
+	if err != nil {
+		// Leave reporting of the error to the local engine.
+		return nil
+	}
+	plan, ok := newPushdownPlan(expr)
+	if !ok {
+		return nil
+	}
+
+	var replicaLabels []string
+	if opts.Deduplicate {
+		replicaLabels = opts.ReplicaLabels
+	}
+	groups, ok := e.leafGroups(plan, timestamp.FromTime(start.Add(-plan.lookback)), timestamp.FromTime(end), replicaLabels)
+	if !ok {
+		return nil
+	}
+
+	span, ctx := tracing.StartSpan(ctx, "distributed_query")
+	defer span.Finish()
+
+	var (
+		warnings storage.Warnings
+		merger   = newPushdownMerger(plan)
+		samples  int
+		stats    = statsFromContext(ctx)
+		mtx      sync.Mutex
+		g, gctx  = errgroup.WithContext(ctx)
+	)
+	for _, group := range groups {
+		for i, q := range plan.queries {
+			group, i, req := group, i, &querypb.QueryRequest{
+				Query:                   q,
+				Start:                   timestamp.FromTime(start),
+				End:                     timestamp.FromTime(end),
+				Step:                    int64(step / time.Millisecond),
+				EnableDedup:             opts.Deduplicate,
+				ReplicaLabels:           opts.ReplicaLabels,
+				DedupAlgorithm:          string(opts.DedupAlgorithm),
+				MaxResolutionWindow:     opts.MaxResolutionMillis,
+				PartialResponseDisabled: !opts.PartialResponse,
+			}
+			g.Go(func() error {
+				resp, leaf, err := e.queryGroup(gctx, group, req)
+				if err != nil {
+					if !opts.PartialResponse {
+						return err
+					}
+					level.Warn(e.logger).Log("msg", "distributed query failed", "err", err)
+
+					mtx.Lock()
+					warnings = append(warnings, err)
+					mtx.Unlock()
+					return nil
+				}
+
+				if stats != nil {
+					stats.addQueryResponse(leaf.Addr(), resp)
+				}
+
+				mtx.Lock()
+				defer mtx.Unlock()
+				for _, s := range resp.Series {
+					samples += len(s.Samples)
+				}
+				if e.maxSamples > 0 && samples > e.maxSamples {
+					return promql.ErrTooManySamples("distributed query")
+				}
+				for _, w := range resp.Warnings {
+					warnings = append(warnings, errors.New(w))
+				}
+				merger.add(i, resp.Series)
+				return nil
+			})
+		}
+	}
+	err = g.Wait()
+	// Failures of leaves caused by the expired or cancelled query are reported same as by the local engine,
+	// even with partial response enabled.
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return &promql.Result{Err: promql.ErrQueryTimeout("distributed query")}
+	case context.Canceled:
+		return &promql.Result{Err: promql.ErrQueryCanceled("distributed query")}
+	}
+	if err != nil {
+		return &promql.Result{Err: err}
+	}
+
+	if step == 0 {
+		return &promql.Result{Value: merger.vector(timestamp.FromTime(start)), Warnings: warnings}
+	}
+	return &promql.Result{Value: merger.matrix(), Warnings: warnings}
+}
+
+// leafGroups returns leaf queriers holding data matching the plan selectors within the given time range, grouped by
+// their label sets without the given replica labels. Leaves in the same group are replicas of each other, so only one
+// of them needs to be queried. It returns false if any store holding such data is not a leaf querier, or a leaf querier
+// without label sets, which can't be told apart from others.
+func (e *DistributedEngine) leafGroups(plan *pushdownPlan, mint, maxt int64, replicaLabels []string) ([][]QueryClient, bool) {
+	leaves := map[string]QueryClient{}
+	for _, l := range e.leaves() {
+		leaves[l.Addr()] = l
+	}
+
+	var (
+		groups [][]QueryClient
+		byKey  = map[string]int{}
+	)
+	for _, st := range e.stores() {
+		if !leafMatches(st, plan.selectors, mint, maxt) {
+			continue
+		}
+		l, ok := leaves[st.Addr()]
+		if !ok || len(l.LabelSets()) == 0 {
+			return nil, false
+		}
+
+		key := leafGroupKey(l, replicaLabels)
+		if i, ok := byKey[key]; ok {
+			groups[i] = append(groups[i], l)
+			continue
+		}
+		byKey[key] = len(groups)
+		groups = append(groups, []QueryClient{l})
+	}
+	if len(groups) == 0 {
+		return nil, false
+	}
+
+	for _, g := range groups {
+		sort.Slice(g, func(i, j int) bool { return g[i].Addr() < g[j].Addr() })
+	}
+	return groups, true
+}
+
+// leafMatches returns true if the store may hold data matching any of the given selectors within the time range.
+func leafMatches(st store.Client, selectors [][]*labels.Matcher, mint, maxt int64) bool {
+	storeMinTime, storeMaxTime := st.TimeRange()
+	if mint > storeMaxTime || maxt < storeMinTime {
+		return false
+	}
+
+	lsets := st.LabelSets()
+	if len(lsets) == 0 {
+		return true
+	}
+	for _, ms := range selectors {
+		for _, ls := range lsets {
+			if labelSetMatches(ls, ms) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// labelSetMatches returns false if any matcher matches negatively against the respective label-value for the
+// matcher's label-name.
+func labelSetMatches(ls storepb.LabelSet, ms []*labels.Matcher) bool {
+	for _, m := range ms {
+		for _, l := range ls.Labels {
+			if l.Name == m.Name && !m.Matches(l.Value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func leafGroupKey(l QueryClient, replicaLabels []string) string {
+	strs := make([]string, 0, len(l.LabelSets()))
+	for _, ls := range l.LabelSets() {
+		lset := make([]storepb.Label, 0, len(ls.Labels))
+	Outer:
+		for _, lbl := range ls.Labels {
+			for _, rl := range replicaLabels {
+				if lbl.Name == rl {
+					continue Outer
+				}
+			}
+			lset = append(lset, lbl)
+		}
+		strs = append(strs, storepb.LabelsToString(lset))
+	}
+	sort.Strings(strs)
+	return strings.Join(strs, ",")
+}
+
+// queryGroup evaluates the query on one of the replicas in the group, trying the next one if it fails. It returns
+// the response along with the replica which responded.
+func (e *DistributedEngine) queryGroup(ctx context.Context, group []QueryClient, r *querypb.QueryRequest) (*querypb.QueryResponse, QueryClient, error) {
+	var errs []string
+	for _, l := range group {
+		resp, err := l.Query(ctx, r)
+		if err == nil {
+			return resp, l, nil
+		}
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		level.Debug(e.logger).Log("msg", "leaf querier failed", "leaf", l.Addr(), "err", err)
+		errs = append(errs, fmt.Sprintf("%s: %s", l.Addr(), err))
+	}
+	return nil, nil, errors.Errorf("query %s failed on all leaf queriers: %s", r.Query, strings.Join(errs, "; "))
+}
+
+// QueryServer implements querypb.QueryServer evaluating queries with the given engine against data of all stores
+// the querier is connected to.
+type QueryServer struct {
+	engine          *promql.Engine
+	queryableCreate QueryableCreator
+}
+
+// NewQueryServer returns a new QueryServer.
+func NewQueryServer(engine *promql.Engine, queryableCreate QueryableCreator) *QueryServer {
+	return &QueryServer{
+		engine:          engine,
+		queryableCreate: queryableCreate,
+	}
+}
+
+// Query evaluates the requested query and returns its result as series.
+func (s *QueryServer) Query(ctx context.Context, r *querypb.QueryRequest) (*querypb.QueryResponse, error) {
+	dedupAlgorithm := DedupPenalty
+	if r.DedupAlgorithm != "" {
+		a, err := ParseDedupAlgorithm(r.DedupAlgorithm)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		dedupAlgorithm = a
+	}
+	queryable := s.queryableCreate(r.EnableDedup, r.ReplicaLabels, dedupAlgorithm, r.MaxResolutionWindow, !r.PartialResponseDisabled, false)
+	start, end := timestamp.Time(r.Start), timestamp.Time(r.End)
+
+	var (
+		qry promql.Query
+		err error
+	)
+	if r.Step == 0 {
+		qry, err = s.engine.NewInstantQuery(queryable, r.Query, start)
+	} else {
+		qry, err = s.engine.NewRangeQuery(queryable, r.Query, start, end, time.Duration(r.Step)*time.Millisecond)
+	}
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	defer qry.Close()
+
+	res := qry.Exec(ctx)
+	if res.Err != nil {
+		return nil, status.Error(codes.Aborted, res.Err.Error())
+	}
+
+	resp := &querypb.QueryResponse{}
+	for _, w := range res.Warnings {
+		resp.Warnings = append(resp.Warnings, w.Error())
+	}
+
+	switch v := res.Value.(type) {
+	case promql.Matrix:
+		for _, s := range v {
+			ts := querypb.TimeSeries{Labels: promLabelsToLabels(s.Metric)}
+			for _, p := range s.Points {
+				ts.Samples = append(ts.Samples, querypb.Sample{Timestamp: p.T, Value: p.V})
+			}
+			resp.Series = append(resp.Series, ts)
+		}
+	case promql.Vector:
+		for _, s := range v {
+			resp.Series = append(resp.Series, querypb.TimeSeries{
+				Labels:  promLabelsToLabels(s.Metric),
+				Samples: []querypb.Sample{{Timestamp: s.T, Value: s.V}},
+			})
+		}
+	case promql.Scalar:
+		resp.Series = append(resp.Series, querypb.TimeSeries{
+			Samples: []querypb.Sample{{Timestamp: v.T, Value: v.V}},
+		})
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unsupported result type %s", res.Value.Type())
+	}
+	return resp, nil
+}
+
+// RegisterQueryServer returns function that registers the given query server in the gRPC server.
+func RegisterQueryServer(querySrv querypb.QueryServer) func(*grpc.Server) {
+	return func(s *grpc.Server) {
+		querypb.RegisterQueryServer(s, querySrv)
+	}
+}
+
+func promLabelsToLabels(lset labels.Labels) []storepb.Label {
+	if len(lset) == 0 {
+		return nil
+	}
+	res := make([]storepb.Label, 0, len(lset))
+	for _, l := range lset {
+		res = append(res, storepb.Label{Name: l.Name, Value: l.Value})
+	}
+	return res
+}
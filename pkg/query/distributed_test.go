@@ -0,0 +1,373 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/query/querypb"
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"google.golang.org/grpc"
+)
+
+func TestNewPushdownPlan(t *testing.T) {
+	for _, tcase := range []struct {
+		query   string
+		queries []string
+	}{
+		{query: `sum by (job) (rate(a[5m]))`, queries: []string{`sum by(job) (rate(a[5m]))`}},
+		{query: `(count without (instance) (a > 1))`, queries: []string{`count without(instance) (a > 1)`}},
+		{query: `max(a offset 1h * 2)`, queries: []string{`max(a offset 1h * 2)`}},
+		{query: `min(histogram_quantile(0.9, rate(a[1m])))`, queries: []string{`min(histogram_quantile(0.9, rate(a[1m])))`}},
+		{query: `avg by (job) (a)`, queries: []string{`sum by(job) (a)`, `count by(job) (a)`}},
+		{query: `sum(max_over_time(rate(a[1m])[10m:1m]))`, queries: []string{`sum(max_over_time(rate(a[1m])[10m:1m]))`}},
+		// Not decomposable.
+		{query: `a`},
+		{query: `sum(a) / sum(b)`},
+		{query: `topk(1, a)`},
+		{query: `sum(max by (job) (a))`},
+		{query: `sum(a / b)`},
+		{query: `sum(absent(a))`},
+		{query: `sum(a * scalar(b))`},
+	} {
+		t.Run(tcase.query, func(t *testing.T) {
+			expr, err := promql.ParseExpr(tcase.query)
+			testutil.Ok(t, err)
+
+			plan, ok := newPushdownPlan(expr)
+			if tcase.queries == nil {
+				testutil.Assert(t, !ok, "expected query not to be decomposable")
+				return
+			}
+			testutil.Assert(t, ok, "expected query to be decomposable")
+			testutil.Equals(t, tcase.queries, plan.queries)
+		})
+	}
+}
+
+func TestNewPushdownPlan_Lookback(t *testing.T) {
+	expr, err := promql.ParseExpr(`sum(max_over_time(rate(a[10m] offset 1h)[30m:1m]))`)
+	testutil.Ok(t, err)
+	plan, ok := newPushdownPlan(expr)
+	testutil.Assert(t, ok, "expected query to be decomposable")
+	testutil.Equals(t, 100*time.Minute, plan.lookback)
+	testutil.Equals(t, 1, len(plan.selectors))
+}
+
+// testLeaf is a leaf querier evaluating queries with the given server.
+type testLeaf struct {
+	storepb.StoreClient
+
+	addr       string
+	labelSets  []storepb.LabelSet
+	mint, maxt int64
+
+	srv *QueryServer
+	err error
+}
+
+func (l *testLeaf) LabelSets() []storepb.LabelSet       { return l.labelSets }
+func (l *testLeaf) TimeRange() (mint int64, maxt int64) { return l.mint, l.maxt }
+func (l *testLeaf) Resolutions() []int64                { return nil }
+func (l *testLeaf) String() string                      { return l.addr }
+func (l *testLeaf) Addr() string                        { return l.addr }
+
+func (l *testLeaf) Query(ctx context.Context, r *querypb.QueryRequest, _ ...grpc.CallOption) (*querypb.QueryResponse, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+	return l.srv.Query(ctx, r)
+}
+
+func TestDistributedEngine_Exec(t *testing.T) {
+	engine := promql.NewEngine(promql.EngineOpts{
+		MaxConcurrent: 10,
+		MaxSamples:    math.MaxInt32,
+		Timeout:       10 * time.Second,
+	})
+
+	// All data is stored in the global DB as well, to compare results of the pushdown with the local evaluation.
+	global, err := testutil.NewTSDB()
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, global.Close()) }()
+	globalApp := global.Appender()
+
+	var leaves []*testLeaf
+	for r, region := range []string{"eu", "us"} {
+		db, err := testutil.NewTSDB()
+		testutil.Ok(t, err)
+		defer func() { testutil.Ok(t, db.Close()) }()
+
+		app := db.Appender()
+		for i := 0; i < 4; i++ {
+			lset := labels.FromStrings("__name__", "a", "job", fmt.Sprintf("job%d", i%2), "instance", fmt.Sprintf("%s%d", region, i))
+			for s := int64(0); s < 30; s++ {
+				v := float64((r+1)*(i+1)) * float64(s)
+				_, err := app.Add(lset, s*30000, v)
+				testutil.Ok(t, err)
+				_, err = globalApp.Add(append(labels.FromStrings("region", region), lset...), s*30000, v)
+				testutil.Ok(t, err)
+			}
+		}
+		testutil.Ok(t, app.Commit())
+
+		extLset := labels.FromStrings("region", region)
+		leaves = append(leaves, &testLeaf{
+			addr:      region,
+			labelSets: []storepb.LabelSet{{Labels: []storepb.Label{{Name: "region", Value: region}}}},
+			mint:      math.MinInt64,
+			maxt:      math.MaxInt64,
+			srv:       NewQueryServer(engine, NewQueryableCreator(nil, store.NewTSDBStore(nil, nil, db, component.Query, extLset))),
+		})
+	}
+	testutil.Ok(t, globalApp.Commit())
+
+	// Replica of the first region which must be queried instead of the first one, as it sorts first.
+	failing := &testLeaf{
+		addr:      "eu-0",
+		labelSets: leaves[0].labelSets,
+		mint:      math.MinInt64,
+		maxt:      math.MaxInt64,
+		err:       errors.New("unavailable"),
+	}
+
+	clients := func(ls ...*testLeaf) (func() []store.Client, func() []QueryClient) {
+		return func() []store.Client {
+				var res []store.Client
+				for _, l := range ls {
+					res = append(res, l)
+				}
+				return res
+			}, func() []QueryClient {
+				var res []QueryClient
+				for _, l := range ls {
+					res = append(res, l)
+				}
+				return res
+			}
+	}
+
+	local := NewQueryableCreator(nil, store.NewTSDBStore(nil, nil, global, component.Query, nil))(false, nil, DedupPenalty, 0, false, false)
+	start, end := timestamp.Time(0), timestamp.Time(14*60*1000)
+
+	stores, leafs := clients(failing, leaves[0], leaves[1])
+	e := NewDistributedEngine(nil, stores, leafs, 0)
+	for _, q := range []string{
+		`sum(a)`,
+		`sum by (job) (rate(a[2m]))`,
+		`sum by (region) (a)`,
+		`count without (instance) (a > 100)`,
+		`min by (job) (a * 2)`,
+		`max(a)`,
+		`avg by (job) (a)`,
+		`avg(irate(a[1m]))`,
+	} {
+		t.Run(q, func(t *testing.T) {
+			res := e.Exec(context.Background(), q, start, end, time.Minute, DistributedQueryOptions{})
+			testutil.Assert(t, res != nil, "expected query to be pushed down")
+			testutil.Ok(t, res.Err)
+			testutil.Equals(t, 0, len(res.Warnings))
+
+			qry, err := engine.NewRangeQuery(local, q, start, end, time.Minute)
+			testutil.Ok(t, err)
+			exp := qry.Exec(context.Background())
+			testutil.Ok(t, exp.Err)
+			testutil.Assert(t, len(exp.Value.(promql.Matrix)) > 0, "expected non-empty result")
+			testMatrixEquals(t, exp.Value.(promql.Matrix), res.Value.(promql.Matrix))
+
+			res = e.Exec(context.Background(), q, end, end, 0, DistributedQueryOptions{})
+			testutil.Assert(t, res != nil, "expected query to be pushed down")
+			testutil.Ok(t, res.Err)
+
+			qry, err = engine.NewInstantQuery(local, q, end)
+			testutil.Ok(t, err)
+			exp = qry.Exec(context.Background())
+			testutil.Ok(t, exp.Err)
+			testVectorEquals(t, exp.Value.(promql.Vector), res.Value.(promql.Vector))
+		})
+	}
+
+	t.Run("not decomposable", func(t *testing.T) {
+		testutil.Assert(t, e.Exec(context.Background(), `sum(a) / sum(a)`, start, end, time.Minute, DistributedQueryOptions{}) == nil, "expected no pushdown")
+	})
+	t.Run("store which is not a leaf", func(t *testing.T) {
+		stores, leafs := clients(leaves...)
+		e := NewDistributedEngine(nil, func() []store.Client {
+			return append(stores(), &testLeaf{addr: "store", mint: math.MinInt64, maxt: math.MaxInt64})
+		}, leafs, 0)
+		testutil.Assert(t, e.Exec(context.Background(), `sum(a)`, start, end, time.Minute, DistributedQueryOptions{}) == nil, "expected no pushdown")
+	})
+	t.Run("leaves filtered by external labels", func(t *testing.T) {
+		stores, leafs := clients(leaves...)
+		e := NewDistributedEngine(nil, func() []store.Client {
+			// Store of other region is not queried, so it does not prevent the pushdown.
+			return append(stores(), &testLeaf{
+				addr:      "store",
+				labelSets: []storepb.LabelSet{{Labels: []storepb.Label{{Name: "region", Value: "ap"}}}},
+				mint:      math.MinInt64,
+				maxt:      math.MaxInt64,
+			})
+		}, leafs, 0)
+		res := e.Exec(context.Background(), `sum by (region) (a{region="eu"})`, end, end, 0, DistributedQueryOptions{})
+		testutil.Assert(t, res != nil, "expected query to be pushed down")
+		testutil.Ok(t, res.Err)
+		testutil.Equals(t, promql.Vector{{Metric: labels.FromStrings("region", "eu"), Point: promql.Point{T: timestamp.FromTime(end), V: 280}}}, res.Value)
+	})
+	t.Run("failed leaf", func(t *testing.T) {
+		stores, leafs := clients(failing, leaves[1])
+		e := NewDistributedEngine(nil, stores, leafs, 0)
+
+		res := e.Exec(context.Background(), `sum(a)`, end, end, 0, DistributedQueryOptions{PartialResponse: true})
+		testutil.Assert(t, res != nil, "expected query to be pushed down")
+		testutil.Ok(t, res.Err)
+		testutil.Equals(t, 1, len(res.Warnings))
+		testutil.Equals(t, promql.Vector{{Metric: labels.Labels{}, Point: promql.Point{T: timestamp.FromTime(end), V: 560}}}, res.Value)
+
+		res = e.Exec(context.Background(), `sum(a)`, end, end, 0, DistributedQueryOptions{})
+		testutil.Assert(t, res != nil, "expected query to be pushed down")
+		testutil.NotOk(t, res.Err)
+	})
+	t.Run("stats", func(t *testing.T) {
+		stores, leafs := clients(leaves...)
+		e := NewDistributedEngine(nil, stores, leafs, 0)
+
+		stats := &Stats{}
+		res := e.Exec(ContextWithStats(context.Background(), stats), `sum by (job) (a)`, start, end, time.Minute, DistributedQueryOptions{})
+		testutil.Assert(t, res != nil, "expected query to be pushed down")
+		testutil.Ok(t, res.Err)
+		testutil.Equals(t, []string{"eu", "us"}, stats.Stores())
+		testutil.Assert(t, stats.Samples() > 0, "expected samples of leaf responses to be recorded")
+	})
+	t.Run("max samples", func(t *testing.T) {
+		stores, leafs := clients(leaves...)
+		e := NewDistributedEngine(nil, stores, leafs, 10)
+
+		res := e.Exec(context.Background(), `sum by (job) (a)`, start, end, time.Minute, DistributedQueryOptions{PartialResponse: true})
+		testutil.Assert(t, res != nil, "expected query to be pushed down")
+		_, ok := res.Err.(promql.ErrTooManySamples)
+		testutil.Assert(t, ok, "expected too many samples error, got %v", res.Err)
+	})
+	t.Run("timeout", func(t *testing.T) {
+		stores, leafs := clients(leaves...)
+		e := NewDistributedEngine(nil, stores, leafs, 0)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 0)
+		defer cancel()
+		res := e.Exec(ctx, `sum(a)`, end, end, 0, DistributedQueryOptions{PartialResponse: true})
+		testutil.Assert(t, res != nil, "expected query to be pushed down")
+		_, ok := res.Err.(promql.ErrQueryTimeout)
+		testutil.Assert(t, ok, "expected timeout error, got %v", res.Err)
+	})
+}
+
+func TestDistributedEngine_Exec_Replicas(t *testing.T) {
+	engine := promql.NewEngine(promql.EngineOpts{
+		MaxConcurrent: 10,
+		MaxSamples:    math.MaxInt32,
+		Timeout:       10 * time.Second,
+	})
+
+	global, err := testutil.NewTSDB()
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, global.Close()) }()
+	globalApp := global.Appender()
+
+	// Leaves differing only by the replica label hold the same data.
+	var leaves []*testLeaf
+	for _, replica := range []string{"0", "1"} {
+		db, err := testutil.NewTSDB()
+		testutil.Ok(t, err)
+		defer func() { testutil.Ok(t, db.Close()) }()
+
+		app := db.Appender()
+		for i := 0; i < 4; i++ {
+			lset := labels.FromStrings("__name__", "a", "job", fmt.Sprintf("job%d", i%2), "instance", fmt.Sprintf("eu%d", i))
+			for s := int64(0); s < 30; s++ {
+				v := float64(i+1) * float64(s)
+				_, err := app.Add(lset, s*30000, v)
+				testutil.Ok(t, err)
+				_, err = globalApp.Add(append(labels.FromStrings("region", "eu", "replica", replica), lset...), s*30000, v)
+				testutil.Ok(t, err)
+			}
+		}
+		testutil.Ok(t, app.Commit())
+
+		extLset := labels.FromStrings("region", "eu", "replica", replica)
+		leaves = append(leaves, &testLeaf{
+			addr:      "eu-" + replica,
+			labelSets: []storepb.LabelSet{{Labels: []storepb.Label{{Name: "region", Value: "eu"}, {Name: "replica", Value: replica}}}},
+			mint:      math.MinInt64,
+			maxt:      math.MaxInt64,
+			srv:       NewQueryServer(engine, NewQueryableCreator(nil, store.NewTSDBStore(nil, nil, db, component.Query, extLset))),
+		})
+	}
+	testutil.Ok(t, globalApp.Commit())
+
+	e := NewDistributedEngine(nil, func() []store.Client {
+		return []store.Client{leaves[0], leaves[1]}
+	}, func() []QueryClient {
+		return []QueryClient{leaves[0], leaves[1]}
+	}, 0)
+
+	local := NewQueryableCreator(nil, store.NewTSDBStore(nil, nil, global, component.Query, nil))(true, []string{"replica"}, DedupChain, 0, false, false)
+	start, end := timestamp.Time(0), timestamp.Time(14*60*1000)
+	opts := DistributedQueryOptions{Deduplicate: true, ReplicaLabels: []string{"replica"}, DedupAlgorithm: DedupChain}
+	for _, q := range []string{
+		`sum(a)`,
+		`count by (job) (a)`,
+		`avg(a)`,
+	} {
+		t.Run(q, func(t *testing.T) {
+			stats := &Stats{}
+			res := e.Exec(ContextWithStats(context.Background(), stats), q, start, end, time.Minute, opts)
+			testutil.Assert(t, res != nil, "expected query to be pushed down")
+			testutil.Ok(t, res.Err)
+			testutil.Equals(t, []string{"eu-0"}, stats.Stores())
+
+			qry, err := engine.NewRangeQuery(local, q, start, end, time.Minute)
+			testutil.Ok(t, err)
+			exp := qry.Exec(context.Background())
+			testutil.Ok(t, exp.Err)
+			testutil.Assert(t, len(exp.Value.(promql.Matrix)) > 0, "expected non-empty result")
+			testMatrixEquals(t, exp.Value.(promql.Matrix), res.Value.(promql.Matrix))
+		})
+	}
+}
+
+func testMatrixEquals(t *testing.T, exp, got promql.Matrix) {
+	t.Helper()
+
+	testutil.Equals(t, len(exp), len(got))
+	for i := range exp {
+		testutil.Equals(t, exp[i].Metric, got[i].Metric)
+		testutil.Equals(t, len(exp[i].Points), len(got[i].Points))
+		for j := range exp[i].Points {
+			testutil.Equals(t, exp[i].Points[j].T, got[i].Points[j].T)
+			testutil.Assert(t, math.Abs(exp[i].Points[j].V-got[i].Points[j].V) < 1e-9, "%v: expected %v, got %v", exp[i].Metric, exp[i].Points[j], got[i].Points[j])
+		}
+	}
+}
+
+func testVectorEquals(t *testing.T, exp, got promql.Vector) {
+	t.Helper()
+
+	// Order of instant query results is not defined.
+	sort.Slice(exp, func(i, j int) bool { return labels.Compare(exp[i].Metric, exp[j].Metric) < 0 })
+
+	testutil.Equals(t, len(exp), len(got))
+	for i := range exp {
+		testutil.Equals(t, exp[i].Metric, got[i].Metric)
+		testutil.Equals(t, exp[i].T, got[i].T)
+		testutil.Assert(t, math.Abs(exp[i].V-got[i].V) < 1e-9, "%v: expected %v, got %v", exp[i].Metric, exp[i].Point, got[i].Point)
+	}
+}
@@ -194,6 +194,11 @@ func (s *storeRef) LabelSets() []storepb.LabelSet {
 	return s.labelSets
 }
 
+// Resolutions returns nil as stores of this version did not advertise resolutions.
+func (s *storeRef) Resolutions() []int64 {
+	return nil
+}
+
 func (s *storeRef) TimeRange() (int64, int64) {
 	s.mtx.RLock()
 	defer s.mtx.RUnlock()
@@ -3,6 +3,7 @@ package query
 import (
 	"math"
 	"sort"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/prometheus/prometheus/pkg/labels"
@@ -130,18 +131,46 @@ type chunkSeries struct {
 
 func newChunkSeries(lset []storepb.Label, chunks []storepb.AggrChunk, mint, maxt int64, aggr resAggr) *chunkSeries {
 	sort.Slice(chunks, func(i, j int) bool {
+		if chunks[i].MinTime == chunks[j].MinTime {
+			// Downsampled chunks go first, see dropCoveredRawChunks.
+			return chunks[i].Raw == nil && chunks[j].Raw != nil
+		}
 		return chunks[i].MinTime < chunks[j].MinTime
 	})
 
 	return &chunkSeries{
 		lset:   storepb.LabelsToPromLabels(lset),
-		chunks: chunks,
+		chunks: dropCoveredRawChunks(chunks),
 		mint:   mint,
 		maxt:   maxt,
 		aggr:   aggr,
 	}
 }
 
+// dropCoveredRawChunks removes raw chunks fully covered by downsampled chunks from the given chunks sorted by their
+// min time. Such chunks come from stores which have no downsampled data for their time range yet, while others do.
+// Removing them keeps the resolution of the stitched series consistent.
+func dropCoveredRawChunks(chunks []storepb.AggrChunk) []storepb.AggrChunk {
+	var (
+		res        = make([]storepb.AggrChunk, 0, len(chunks))
+		maxAggrEnd = int64(math.MinInt64)
+	)
+	for _, c := range chunks {
+		if c.Raw == nil {
+			if c.MaxTime > maxAggrEnd {
+				maxAggrEnd = c.MaxTime
+			}
+			res = append(res, c)
+			continue
+		}
+		if c.MaxTime <= maxAggrEnd {
+			continue
+		}
+		res = append(res, c)
+	}
+	return res
+}
+
 func (s *chunkSeries) Labels() labels.Labels {
 	return s.lset
 }
@@ -178,12 +207,17 @@ func (s *chunkSeries) Iterator() storage.SeriesIterator {
 		sit = downsample.NewCounterSeriesIterator(its...)
 	case resAggrAvg:
 		for _, c := range s.chunks {
-			if c.Raw != nil {
-				its = append(its, getFirstIterator(c.Raw))
-			} else {
-				sum, cnt := getFirstIterator(c.Sum), getFirstIterator(c.Count)
-				its = append(its, downsample.NewAverageChunkIterator(cnt, sum))
-			}
+			its = append(its, getOptionalIterator(nil, c))
+		}
+		sit = newChunkSeriesIterator(its)
+	case resAggrLast:
+		for _, c := range s.chunks {
+			its = append(its, getOptionalIterator(c.Last, c))
+		}
+		sit = newChunkSeriesIterator(its)
+	case resAggrQuantiles:
+		for _, c := range s.chunks {
+			its = append(its, getOptionalIterator(c.Quantiles, c))
 		}
 		sit = newChunkSeriesIterator(its)
 	default:
@@ -192,6 +226,19 @@ func (s *chunkSeries) Iterator() storage.SeriesIterator {
 	return newBoundedSeriesIterator(sit, s.mint, s.maxt)
 }
 
+// getOptionalIterator returns an iterator over the given optional aggregate of the chunk. Chunks of blocks downsampled
+// without the aggregate fall back to raw samples or averages of windows.
+func getOptionalIterator(optional *storepb.Chunk, c storepb.AggrChunk) chunkenc.Iterator {
+	if optional != nil {
+		return getFirstIterator(optional)
+	}
+	if c.Raw != nil {
+		return getFirstIterator(c.Raw)
+	}
+	sum, cnt := getFirstIterator(c.Sum), getFirstIterator(c.Count)
+	return downsample.NewAverageChunkIterator(cnt, sum)
+}
+
 func getFirstIterator(cs ...*storepb.Chunk) chunkenc.Iterator {
 	for _, c := range cs {
 		if c == nil {
@@ -326,9 +373,42 @@ func (it *chunkSeriesIterator) Err() error {
 	return it.chunks[it.i].Err()
 }
 
+// DedupAlgorithm selects how samples of replicas of the same series are merged during deduplication.
+type DedupAlgorithm string
+
+const (
+	// DedupPenalty switches between replicas based on the timestamps of their samples, penalizing the replica not used
+	// for the last sample. It works for any series, but may produce gaps and spikes when replicas are scraped at
+	// different intervals.
+	DedupPenalty DedupAlgorithm = "penalty"
+	// DedupChain uses samples of the most complete replica, filling its gaps with samples of the others.
+	DedupChain DedupAlgorithm = "chain"
+	// DedupCounter is DedupPenalty for counters, which adjusts values of replicas switched to, so that switching to
+	// a replica with lower value does not look like a counter reset.
+	DedupCounter DedupAlgorithm = "counter"
+)
+
+// initialPenalty is the sample interval assumed by deduplication before it knows one. It is based on the knowledge
+// that timestamps are in milliseconds and sampling frequencies typically multiple seconds long.
+const initialPenalty = 5000
+
+// DedupAlgorithms are names of all supported deduplication algorithms.
+var DedupAlgorithms = []string{string(DedupPenalty), string(DedupChain), string(DedupCounter)}
+
+// ParseDedupAlgorithm returns the deduplication algorithm of the given name.
+func ParseDedupAlgorithm(name string) (DedupAlgorithm, error) {
+	for _, a := range DedupAlgorithms {
+		if a == name {
+			return DedupAlgorithm(name), nil
+		}
+	}
+	return "", errors.Errorf("unknown deduplication algorithm %q, expected one of %s", name, strings.Join(DedupAlgorithms, ", "))
+}
+
 type dedupSeriesSet struct {
 	set           storage.SeriesSet
 	replicaLabels map[string]struct{}
+	algorithm     DedupAlgorithm
 
 	replicas []storage.Series
 	lset     labels.Labels
@@ -336,8 +416,8 @@ type dedupSeriesSet struct {
 	ok       bool
 }
 
-func newDedupSeriesSet(set storage.SeriesSet, replicaLabels map[string]struct{}) storage.SeriesSet {
-	s := &dedupSeriesSet{set: set, replicaLabels: replicaLabels}
+func newDedupSeriesSet(set storage.SeriesSet, replicaLabels map[string]struct{}, algorithm DedupAlgorithm) storage.SeriesSet {
+	s := &dedupSeriesSet{set: set, replicaLabels: replicaLabels, algorithm: algorithm}
 	s.ok = s.set.Next()
 	if s.ok {
 		s.peek = s.set.At()
@@ -401,7 +481,7 @@ func (s *dedupSeriesSet) At() storage.Series {
 	// before advancing.
 	repl := make([]storage.Series, len(s.replicas))
 	copy(repl, s.replicas)
-	return newDedupSeries(s.lset, repl...)
+	return newDedupSeries(s.lset, s.algorithm, repl...)
 }
 
 func (s *dedupSeriesSet) Err() error {
@@ -416,12 +496,13 @@ type seriesWithLabels struct {
 func (s seriesWithLabels) Labels() labels.Labels { return s.lset }
 
 type dedupSeries struct {
-	lset     labels.Labels
-	replicas []storage.Series
+	lset      labels.Labels
+	algorithm DedupAlgorithm
+	replicas  []storage.Series
 }
 
-func newDedupSeries(lset labels.Labels, replicas ...storage.Series) *dedupSeries {
-	return &dedupSeries{lset: lset, replicas: replicas}
+func newDedupSeries(lset labels.Labels, algorithm DedupAlgorithm, replicas ...storage.Series) *dedupSeries {
+	return &dedupSeries{lset: lset, algorithm: algorithm, replicas: replicas}
 }
 
 func (s *dedupSeries) Labels() labels.Labels {
@@ -429,6 +510,17 @@ func (s *dedupSeries) Labels() labels.Labels {
 }
 
 func (s *dedupSeries) Iterator() (it storage.SeriesIterator) {
+	switch s.algorithm {
+	case DedupChain:
+		return newChainIterator(s.replicas)
+	case DedupCounter:
+		it = &counterAdjustSeriesIterator{SeriesIterator: s.replicas[0].Iterator()}
+		for _, o := range s.replicas[1:] {
+			it = newDedupSeriesIterator(it, &counterAdjustSeriesIterator{SeriesIterator: o.Iterator()})
+		}
+		return it
+	}
+
 	it = s.replicas[0].Iterator()
 	for _, o := range s.replicas[1:] {
 		it = newDedupSeriesIterator(it, o.Iterator())
@@ -436,19 +528,61 @@ func (s *dedupSeries) Iterator() (it storage.SeriesIterator) {
 	return it
 }
 
+// adjustableSeriesIterator is a storage.SeriesIterator able to adjust its values when deduplication switches to it.
+type adjustableSeriesIterator interface {
+	storage.SeriesIterator
+
+	// adjustAtValue adjusts the current and all following values given the last value returned before switching to
+	// this iterator.
+	adjustAtValue(lastValue float64)
+}
+
+type noopAdjustableSeriesIterator struct {
+	storage.SeriesIterator
+}
+
+func (it noopAdjustableSeriesIterator) adjustAtValue(float64) {}
+
+func adjustable(it storage.SeriesIterator) adjustableSeriesIterator {
+	if a, ok := it.(adjustableSeriesIterator); ok {
+		return a
+	}
+	return noopAdjustableSeriesIterator{SeriesIterator: it}
+}
+
+// counterAdjustSeriesIterator adjusts values of a counter, so that switching to it from a replica with higher value
+// does not look like a counter reset. A replica with lower value has most likely missed some increments.
+type counterAdjustSeriesIterator struct {
+	storage.SeriesIterator
+
+	adjust float64
+}
+
+func (it *counterAdjustSeriesIterator) adjustAtValue(lastValue float64) {
+	if _, v := it.At(); v < lastValue {
+		it.adjust += lastValue - v
+	}
+}
+
+func (it *counterAdjustSeriesIterator) At() (int64, float64) {
+	t, v := it.SeriesIterator.At()
+	return t, v + it.adjust
+}
+
 type dedupSeriesIterator struct {
-	a, b storage.SeriesIterator
+	a, b adjustableSeriesIterator
 
 	aok, bok   bool
 	lastT      int64
+	lastV      float64
 	penA, penB int64
 	useA       bool
 }
 
 func newDedupSeriesIterator(a, b storage.SeriesIterator) *dedupSeriesIterator {
 	return &dedupSeriesIterator{
-		a:     a,
-		b:     b,
+		a:     adjustable(a),
+		b:     adjustable(b),
 		lastT: math.MinInt64,
 		aok:   true,
 		bok:   true,
@@ -456,6 +590,27 @@ func newDedupSeriesIterator(a, b storage.SeriesIterator) *dedupSeriesIterator {
 }
 
 func (it *dedupSeriesIterator) Next() bool {
+	prevT, prevUseA := it.lastT, it.useA
+	if !it.next() {
+		return false
+	}
+	// Let the iterator we switched to adjust its values, e.g. to avoid counter resets.
+	if prevT != math.MinInt64 && it.useA != prevUseA {
+		it.adjustAtValue(it.lastV)
+	}
+	_, it.lastV = it.At()
+	return true
+}
+
+func (it *dedupSeriesIterator) adjustAtValue(lastValue float64) {
+	if it.useA {
+		it.a.adjustAtValue(lastValue)
+		return
+	}
+	it.b.adjustAtValue(lastValue)
+}
+
+func (it *dedupSeriesIterator) next() bool {
 	// Advance both iterators to at least the next highest timestamp plus the potential penalty.
 	if it.aok {
 		it.aok = it.a.Seek(it.lastT + 1 + it.penA)
@@ -492,15 +647,11 @@ func (it *dedupSeriesIterator) Next() bool {
 	// This ensures that we don't pick a sample too close, which would increase the overall
 	// sample frequency. It also guards against clock drift and inaccuracies during
 	// timestamp assignment.
-	// If we don't know a delta yet, we pick 5000 as a constant, which is based on the knowledge
-	// that timestamps are in milliseconds and sampling frequencies typically multiple seconds long.
-	const initialPenality = 5000
-
 	if it.useA {
 		if it.lastT != math.MinInt64 {
 			it.penB = 2 * (ta - it.lastT)
 		} else {
-			it.penB = initialPenality
+			it.penB = initialPenalty
 		}
 		it.penA = 0
 		it.lastT = ta
@@ -509,7 +660,7 @@ func (it *dedupSeriesIterator) Next() bool {
 	if it.lastT != math.MinInt64 {
 		it.penA = 2 * (tb - it.lastT)
 	} else {
-		it.penA = initialPenality
+		it.penA = initialPenalty
 	}
 	it.penB = 0
 	it.lastT = tb
@@ -541,3 +692,256 @@ func (it *dedupSeriesIterator) Err() error {
 	}
 	return it.b.Err()
 }
+
+// newChainIterator returns iterator selecting, for every time range, the chunk with most samples among overlapping
+// chunks of all replicas. Sample counts are taken from chunk headers, so chunks are decoded only once selected.
+// Replicas not backed by chunks are chained in the given order, filling gaps of the first one with the others.
+func newChainIterator(replicas []storage.Series) storage.SeriesIterator {
+	css := make([]*chunkSeries, 0, len(replicas))
+	for _, r := range replicas {
+		cs, ok := r.(*chunkSeries)
+		if !ok {
+			it := replicas[0].Iterator()
+			for _, o := range replicas[1:] {
+				it = newChainSeriesIterator(it, o.Iterator())
+			}
+			return it
+		}
+		css = append(css, cs)
+	}
+
+	var its []storage.SeriesIterator
+	for _, c := range selectChainChunks(css) {
+		s := css[0]
+		mint, maxt := c.mint, c.maxt
+		if mint < s.mint {
+			mint = s.mint
+		}
+		if maxt > s.maxt {
+			maxt = s.maxt
+		}
+		if mint > maxt {
+			continue
+		}
+		cs := &chunkSeries{lset: s.lset, chunks: []storepb.AggrChunk{c.chunk}, mint: mint, maxt: maxt, aggr: s.aggr}
+		its = append(its, cs.Iterator())
+	}
+	return &concatSeriesIterator{its: its}
+}
+
+// chainChunk is a chunk selected by the chain deduplication, used only within the given time range.
+type chainChunk struct {
+	chunk      storepb.AggrChunk
+	samples    int
+	mint, maxt int64
+}
+
+// selectChainChunks returns time sorted, non-overlapping chunks of the given replicas. Starting with the earliest
+// chunk not used yet, it picks the chunk with most samples estimated within its time range among chunks overlapping
+// with it. Parts of chunks already covered by previously selected ones are cut off.
+func selectChainChunks(replicas []*chunkSeries) []chainChunk {
+	var cands []chainChunk
+	for _, r := range replicas {
+		for _, c := range r.chunks {
+			cands = append(cands, chainChunk{chunk: c, samples: numSamples(c.Raw, c.Count), mint: c.MinTime, maxt: c.MaxTime})
+		}
+	}
+
+	var (
+		res []chainChunk
+		t   = int64(math.MinInt64)
+	)
+	for {
+		first := -1
+		for i, c := range cands {
+			if c.maxt <= t {
+				continue
+			}
+			if first == -1 || c.mint < cands[first].mint {
+				first = i
+			}
+		}
+		if first == -1 {
+			return res
+		}
+
+		start := cands[first].mint
+		if start <= t {
+			start = t + 1
+		}
+		end := cands[first].maxt
+		best, bestSamples := first, estimateSamples(cands[first], start, end)
+		for i, c := range cands {
+			if c.maxt <= t || c.mint > end {
+				continue
+			}
+			if n := estimateSamples(c, start, end); n > bestSamples {
+				best, bestSamples = i, n
+			}
+		}
+
+		sel := cands[best]
+		if sel.mint > start {
+			// Use the earliest chunk until the better one starts.
+			sel = cands[first]
+			sel.maxt = cands[best].mint - 1
+		}
+		if sel.mint < start {
+			sel.mint = start
+		}
+		res = append(res, sel)
+		t = sel.maxt
+	}
+}
+
+// estimateSamples returns the number of samples of the chunk within the given time range, assuming they are evenly
+// distributed.
+func estimateSamples(c chainChunk, mint, maxt int64) float64 {
+	if c.mint > mint {
+		mint = c.mint
+	}
+	if c.maxt < maxt {
+		maxt = c.maxt
+	}
+	if mint > maxt {
+		return 0
+	}
+	return float64(c.samples) * float64(maxt-mint+1) / float64(c.chunk.MaxTime-c.chunk.MinTime+1)
+}
+
+// concatSeriesIterator returns samples of the given time sorted, non-overlapping iterators one after another.
+type concatSeriesIterator struct {
+	its []storage.SeriesIterator
+	i   int
+}
+
+func (it *concatSeriesIterator) Next() bool {
+	for ; it.i < len(it.its); it.i++ {
+		if it.its[it.i].Next() {
+			return true
+		}
+		if it.its[it.i].Err() != nil {
+			return false
+		}
+	}
+	return false
+}
+
+func (it *concatSeriesIterator) Seek(t int64) bool {
+	for ; it.i < len(it.its); it.i++ {
+		if it.its[it.i].Seek(t) {
+			return true
+		}
+		if it.its[it.i].Err() != nil {
+			return false
+		}
+	}
+	return false
+}
+
+func (it *concatSeriesIterator) At() (int64, float64) {
+	return it.its[it.i].At()
+}
+
+func (it *concatSeriesIterator) Err() error {
+	if it.i < len(it.its) {
+		return it.its[it.i].Err()
+	}
+	return nil
+}
+
+// chainSeriesIterator returns samples of the preferred iterator a. Samples of b are used only within gaps of a,
+// i.e. where a has no sample for more than twice its last sample interval.
+type chainSeriesIterator struct {
+	a, b storage.SeriesIterator
+
+	aok, bok bool
+	lastT    int64
+	deltaA   int64
+	useA     bool
+}
+
+func newChainSeriesIterator(a, b storage.SeriesIterator) *chainSeriesIterator {
+	return &chainSeriesIterator{
+		a:     a,
+		b:     b,
+		lastT: math.MinInt64,
+		aok:   true,
+		bok:   true,
+	}
+}
+
+func (it *chainSeriesIterator) Next() bool {
+	delta := int64(initialPenalty)
+	if it.deltaA > 0 {
+		delta = it.deltaA
+	}
+	// Skip samples of b too close to the last one of a, which would increase the sample frequency.
+	var penB int64
+	if it.useA {
+		penB = delta / 2
+	}
+
+	if it.aok {
+		it.aok = it.a.Seek(it.lastT + 1)
+	}
+	if it.bok {
+		it.bok = it.b.Seek(it.lastT + 1 + penB)
+	}
+	if !it.aok {
+		it.useA = false
+		if it.bok {
+			it.lastT, _ = it.b.At()
+		}
+		return it.bok
+	}
+
+	ta, _ := it.a.At()
+	if it.bok {
+		ref := it.lastT
+		tb, _ := it.b.At()
+		if ref == math.MinInt64 {
+			ref = tb
+		}
+		// Use b within gaps of a bigger than 2 deltas, unless its sample is too close to the next one of a, which
+		// would increase the sample frequency.
+		if ta-ref > 2*delta && ta-tb > delta {
+			it.useA = false
+			it.lastT = tb
+			return true
+		}
+	}
+
+	if it.useA && it.lastT != math.MinInt64 {
+		it.deltaA = ta - it.lastT
+	}
+	it.useA = true
+	it.lastT = ta
+	return true
+}
+
+func (it *chainSeriesIterator) Seek(t int64) bool {
+	for {
+		ts, _ := it.At()
+		if ts > 0 && ts >= t {
+			return true
+		}
+		if !it.Next() {
+			return false
+		}
+	}
+}
+
+func (it *chainSeriesIterator) At() (int64, float64) {
+	if it.useA {
+		return it.a.At()
+	}
+	return it.b.At()
+}
+
+func (it *chainSeriesIterator) Err() error {
+	if it.a.Err() != nil {
+		return it.a.Err()
+	}
+	return it.b.Err()
+}
@@ -0,0 +1,231 @@
+package query
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/thanos-io/thanos/pkg/query/querypb"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+// pushdownPlan describes how a query is evaluated by leaf queriers and how their partial results are merged.
+type pushdownPlan struct {
+	// queries are evaluated by every leaf querier.
+	queries []string
+	// merge merges values of the same series and query returned by different leaf queriers.
+	merge func(a, b float64) float64
+	// result computes the final value from merged values of all queries. Nil means the value of the single query is
+	// returned as is.
+	result func(values []float64) float64
+	// selectors are label matchers of all selectors of the query.
+	selectors [][]*labels.Matcher
+	// lookback is the maximum time before query start which is read by the query.
+	lookback time.Duration
+}
+
+// nonLocalFuncs are functions which results depend on series of other leaves, or which return series without
+// relation to the input series.
+var nonLocalFuncs = map[string]struct{}{
+	"absent":           {},
+	"absent_over_time": {},
+	"scalar":           {},
+	"vector":           {},
+}
+
+// newPushdownPlan returns a plan for pushing down the given expression to leaf queriers. It returns false if the
+// expression can not be decomposed. Only aggregations with sum, min, max, count or avg on the top level are
+// supported, and only if their inner expression can be evaluated on every leaf independently, which is true as long
+// as no series of two different leaves are combined together.
+func newPushdownPlan(expr promql.Expr) (*pushdownPlan, bool) {
+	for {
+		p, ok := expr.(*promql.ParenExpr)
+		if !ok {
+			break
+		}
+		expr = p.Expr
+	}
+
+	aggr, ok := expr.(*promql.AggregateExpr)
+	if !ok || !isLocalExpr(aggr.Expr) {
+		return nil, false
+	}
+
+	plan := &pushdownPlan{}
+	leafAggr := func(op promql.ItemType) string {
+		return (&promql.AggregateExpr{Op: op, Expr: aggr.Expr, Grouping: aggr.Grouping, Without: aggr.Without}).String()
+	}
+	switch aggr.Op {
+	case promql.SUM, promql.COUNT:
+		plan.queries = []string{leafAggr(aggr.Op)}
+		plan.merge = func(a, b float64) float64 { return a + b }
+	case promql.MIN:
+		plan.queries = []string{leafAggr(aggr.Op)}
+		plan.merge = math.Min
+	case promql.MAX:
+		plan.queries = []string{leafAggr(aggr.Op)}
+		plan.merge = math.Max
+	case promql.AVG:
+		// Average is not associative, so sum and count are requested and the average is computed from their totals.
+		plan.queries = []string{leafAggr(promql.SUM), leafAggr(promql.COUNT)}
+		plan.merge = func(a, b float64) float64 { return a + b }
+		plan.result = func(values []float64) float64 { return values[0] / values[1] }
+	default:
+		return nil, false
+	}
+
+	promql.Inspect(aggr.Expr, func(node promql.Node, path []promql.Node) error {
+		var subqOffset time.Duration
+		for _, n := range path {
+			if sq, ok := n.(*promql.SubqueryExpr); ok {
+				subqOffset += sq.Range + sq.Offset
+			}
+		}
+
+		switch n := node.(type) {
+		case *promql.VectorSelector:
+			plan.selectors = append(plan.selectors, n.LabelMatchers)
+			if d := n.Offset + promql.LookbackDelta + subqOffset; d > plan.lookback {
+				plan.lookback = d
+			}
+		case *promql.MatrixSelector:
+			plan.selectors = append(plan.selectors, n.LabelMatchers)
+			if d := n.Offset + n.Range + subqOffset; d > plan.lookback {
+				plan.lookback = d
+			}
+		}
+		return nil
+	})
+	return plan, true
+}
+
+// isLocalExpr returns true if the expression never combines different series together, so evaluating it on each leaf
+// querier gives the same series as evaluating it on all data at once.
+func isLocalExpr(expr promql.Expr) bool {
+	local := true
+	promql.Inspect(expr, func(node promql.Node, _ []promql.Node) error {
+		switch n := node.(type) {
+		case *promql.AggregateExpr:
+			local = false
+		case *promql.Call:
+			if _, ok := nonLocalFuncs[n.Func.Name]; ok {
+				local = false
+			}
+		case *promql.BinaryExpr:
+			if isVectorExpr(n.LHS) && isVectorExpr(n.RHS) {
+				local = false
+			}
+		}
+		return nil
+	})
+	return local
+}
+
+func isVectorExpr(expr promql.Expr) bool {
+	t := expr.Type()
+	return t == promql.ValueTypeVector || t == promql.ValueTypeMatrix
+}
+
+// mergedSeries holds values of a single output series aggregated across leaves for each timestamp.
+type mergedSeries struct {
+	lset   labels.Labels
+	points map[int64]*mergedPoint
+}
+
+// mergedPoint holds values for every query of the plan at a single timestamp.
+type mergedPoint struct {
+	values []float64
+	seen   []bool
+}
+
+// pushdownMerger merges partial results of leaf queriers.
+type pushdownMerger struct {
+	plan   *pushdownPlan
+	series map[string]*mergedSeries
+}
+
+func newPushdownMerger(plan *pushdownPlan) *pushdownMerger {
+	return &pushdownMerger{plan: plan, series: map[string]*mergedSeries{}}
+}
+
+// add merges the result of the plan query with the given index returned by a single leaf.
+func (m *pushdownMerger) add(query int, series []querypb.TimeSeries) {
+	for _, s := range series {
+		lset := storepb.LabelsToPromLabels(s.Labels)
+		key := lset.String()
+
+		ms, ok := m.series[key]
+		if !ok {
+			ms = &mergedSeries{lset: lset, points: map[int64]*mergedPoint{}}
+			m.series[key] = ms
+		}
+		for _, smpl := range s.Samples {
+			p, ok := ms.points[smpl.Timestamp]
+			if !ok {
+				p = &mergedPoint{
+					values: make([]float64, len(m.plan.queries)),
+					seen:   make([]bool, len(m.plan.queries)),
+				}
+				ms.points[smpl.Timestamp] = p
+			}
+			if !p.seen[query] {
+				p.values[query] = smpl.Value
+				p.seen[query] = true
+				continue
+			}
+			p.values[query] = m.plan.merge(p.values[query], smpl.Value)
+		}
+	}
+}
+
+// matrix returns merged results as a matrix sorted by labels.
+func (m *pushdownMerger) matrix() promql.Matrix {
+	mat := make(promql.Matrix, 0, len(m.series))
+	for _, ms := range m.series {
+		s := promql.Series{Metric: ms.lset}
+		for t, p := range ms.points {
+			v, ok := m.value(p)
+			if !ok {
+				continue
+			}
+			s.Points = append(s.Points, promql.Point{T: t, V: v})
+		}
+		if len(s.Points) == 0 {
+			continue
+		}
+		sort.Slice(s.Points, func(i, j int) bool { return s.Points[i].T < s.Points[j].T })
+		mat = append(mat, s)
+	}
+	sort.Sort(mat)
+	return mat
+}
+
+// vector returns merged results evaluated at the given timestamp as a vector.
+func (m *pushdownMerger) vector(t int64) promql.Vector {
+	vec := make(promql.Vector, 0, len(m.series))
+	for _, s := range m.matrix() {
+		for _, p := range s.Points {
+			if p.T != t {
+				continue
+			}
+			vec = append(vec, promql.Sample{Metric: s.Metric, Point: p})
+		}
+	}
+	return vec
+}
+
+func (m *pushdownMerger) value(p *mergedPoint) (float64, bool) {
+	for _, seen := range p.seen {
+		// A point present only in results of some of the queries can't be completed. It should not happen for
+		// queries of the same expression.
+		if !seen {
+			return 0, false
+		}
+	}
+	if m.plan.result == nil {
+		return p.values[0], true
+	}
+	return m.plan.result(p.values), true
+}
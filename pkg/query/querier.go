@@ -3,13 +3,13 @@ package query
 import (
 	"context"
 	"sort"
-	"strings"
 
 	"github.com/go-kit/kit/log"
 	"github.com/pkg/errors"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/tenancy"
 	"github.com/thanos-io/thanos/pkg/tracing"
 )
 
@@ -17,16 +17,18 @@ import (
 // If deduplication is enabled, all data retrieved from it will be deduplicated along all replicaLabels by default.
 // When the replicaLabels argument is not empty it overwrites the global replicaLabels flag. This allows specifying
 // replicaLabels at query time.
+// dedupAlgorithm controls how samples of replicas are merged during deduplication.
 // maxResolutionMillis controls downsampling resolution that is allowed (specified in milliseconds).
 // partialResponse controls `partialResponseDisabled` option of StoreAPI and partial response behaviour of proxy.
-type QueryableCreator func(deduplicate bool, replicaLabels []string, maxResolutionMillis int64, partialResponse, skipChunks bool) storage.Queryable
+type QueryableCreator func(deduplicate bool, replicaLabels []string, dedupAlgorithm DedupAlgorithm, maxResolutionMillis int64, partialResponse, skipChunks bool) storage.Queryable
 
 // NewQueryableCreator creates QueryableCreator.
 func NewQueryableCreator(logger log.Logger, proxy storepb.StoreServer) QueryableCreator {
-	return func(deduplicate bool, replicaLabels []string, maxResolutionMillis int64, partialResponse, skipChunks bool) storage.Queryable {
+	return func(deduplicate bool, replicaLabels []string, dedupAlgorithm DedupAlgorithm, maxResolutionMillis int64, partialResponse, skipChunks bool) storage.Queryable {
 		return &queryable{
 			logger:              logger,
 			replicaLabels:       replicaLabels,
+			dedupAlgorithm:      dedupAlgorithm,
 			proxy:               proxy,
 			deduplicate:         deduplicate,
 			maxResolutionMillis: maxResolutionMillis,
@@ -39,6 +41,7 @@ func NewQueryableCreator(logger log.Logger, proxy storepb.StoreServer) Queryable
 type queryable struct {
 	logger              log.Logger
 	replicaLabels       []string
+	dedupAlgorithm      DedupAlgorithm
 	proxy               storepb.StoreServer
 	deduplicate         bool
 	maxResolutionMillis int64
@@ -48,7 +51,18 @@ type queryable struct {
 
 // Querier returns a new storage querier against the underlying proxy store API.
 func (q *queryable) Querier(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
-	return newQuerier(ctx, q.logger, mint, maxt, q.replicaLabels, q.proxy, q.deduplicate, int64(q.maxResolutionMillis), q.partialResponse, q.skipChunks), nil
+	return newQuerier(ctx, q.logger, mint, maxt, q.replicaLabels, q.dedupAlgorithm, q.proxy, q.deduplicate, int64(q.maxResolutionMillis), q.partialResponse, q.skipChunks), nil
+}
+
+// LabelQuerier is a storage.Querier able to limit label names and values to the ones of series matching
+// given matchers.
+type LabelQuerier interface {
+	storage.Querier
+
+	// LabelValuesWithMatchers returns all potential values for a label name of series matching the given matchers.
+	LabelValuesWithMatchers(name string, ms ...*labels.Matcher) ([]string, storage.Warnings, error)
+	// LabelNamesWithMatchers returns all the unique label names of series matching the given matchers in sorted order.
+	LabelNamesWithMatchers(ms ...*labels.Matcher) ([]string, storage.Warnings, error)
 }
 
 type querier struct {
@@ -57,6 +71,7 @@ type querier struct {
 	cancel              func()
 	mint, maxt          int64
 	replicaLabels       map[string]struct{}
+	dedupAlgorithm      DedupAlgorithm
 	proxy               storepb.StoreServer
 	deduplicate         bool
 	maxResolutionMillis int64
@@ -71,6 +86,7 @@ func newQuerier(
 	logger log.Logger,
 	mint, maxt int64,
 	replicaLabels []string,
+	dedupAlgorithm DedupAlgorithm,
 	proxy storepb.StoreServer,
 	deduplicate bool,
 	maxResolutionMillis int64,
@@ -93,6 +109,7 @@ func newQuerier(
 		mint:                mint,
 		maxt:                maxt,
 		replicaLabels:       rl,
+		dedupAlgorithm:      dedupAlgorithm,
 		proxy:               proxy,
 		deduplicate:         deduplicate,
 		maxResolutionMillis: maxResolutionMillis,
@@ -120,6 +137,11 @@ func (s *seriesServer) Send(r *storepb.SeriesResponse) error {
 		return nil
 	}
 
+	if b := r.GetBatch(); b != nil {
+		s.seriesSet = append(s.seriesSet, b.Series...)
+		return nil
+	}
+
 	if r.GetSeries() == nil {
 		return errors.New("no seriesSet")
 	}
@@ -140,28 +162,37 @@ const (
 	resAggrMin
 	resAggrMax
 	resAggrCounter
+	resAggrLast
+	resAggrQuantiles
 )
 
 // aggrsFromFunc infers aggregates of the underlying data based on the wrapping
-// function of a series selection.
+// function or aggregation of a series selection. As each selector of a query is
+// selected separately, different functions over the same metric get different aggregates.
 func aggrsFromFunc(f string) ([]storepb.Aggr, resAggr) {
-	if f == "min" || strings.HasPrefix(f, "min_") {
+	switch f {
+	case "min", "min_over_time":
 		return []storepb.Aggr{storepb.Aggr_MIN}, resAggrMin
-	}
-	if f == "max" || strings.HasPrefix(f, "max_") {
+	case "max", "max_over_time":
 		return []storepb.Aggr{storepb.Aggr_MAX}, resAggrMax
-	}
-	if f == "count" || strings.HasPrefix(f, "count_") {
+	case "count", "count_over_time":
 		return []storepb.Aggr{storepb.Aggr_COUNT}, resAggrCount
-	}
-	// f == "sum" falls through here since we want the actual samples.
-	if strings.HasPrefix(f, "sum_") {
+	case "sum_over_time":
+		// f == "sum" falls through to the default since we want the actual samples.
 		return []storepb.Aggr{storepb.Aggr_SUM}, resAggrSum
-	}
-	if f == "increase" || f == "rate" {
+	case "rate", "irate", "increase":
 		return []storepb.Aggr{storepb.Aggr_COUNTER}, resAggrCounter
+	case "quantile_over_time":
+		// Quantile sketches are optional, count and sum are a fallback for blocks without them.
+		return []storepb.Aggr{storepb.Aggr_QUANTILES, storepb.Aggr_COUNT, storepb.Aggr_SUM}, resAggrQuantiles
+	case "delta", "idelta":
+		// Last values are optional, count and sum are a fallback for blocks without them.
+		return []storepb.Aggr{storepb.Aggr_LAST, storepb.Aggr_COUNT, storepb.Aggr_SUM}, resAggrLast
 	}
-	// In the default case, we retrieve count and sum to compute an average.
+	// In the default case, we retrieve count and sum to compute an average. This is the best
+	// approximation of raw samples for functions depending on their values, like avg_over_time,
+	// stddev_over_time, stdvar_over_time, changes or resets, as well as for aggregations like count_values,
+	// which must not count the count aggregate.
 	return []storepb.Aggr{storepb.Aggr_COUNT, storepb.Aggr_SUM}, resAggrAvg
 }
 
@@ -173,6 +204,7 @@ func (q *querier) Select(params *storage.SelectParams, ms ...*labels.Matcher) (s
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "convert matchers")
 	}
+	sms = tenancy.EnforceMatchers(q.ctx, sms)
 
 	if params == nil {
 		params = &storage.SelectParams{
@@ -194,6 +226,9 @@ func (q *querier) Select(params *storage.SelectParams, ms ...*labels.Matcher) (s
 	}, resp); err != nil {
 		return nil, nil, errors.Wrap(err, "proxy Series()")
 	}
+	if stats := statsFromContext(ctx); stats != nil {
+		stats.addSeries(resp.seriesSet)
+	}
 
 	var warns storage.Warnings
 	for _, w := range resp.warnings {
@@ -224,7 +259,7 @@ func (q *querier) Select(params *storage.SelectParams, ms ...*labels.Matcher) (s
 	// The merged series set assembles all potentially-overlapping time ranges
 	// of the same series into a single one. The series are ordered so that equal series
 	// from different replicas are sequential. We can now deduplicate those.
-	return newDedupSeriesSet(set, q.replicaLabels), warns, nil
+	return newDedupSeriesSet(set, q.replicaLabels, q.dedupAlgorithm), warns, nil
 }
 
 // sortDedupLabels re-sorts the set so that the same series with different replica
@@ -251,10 +286,28 @@ func sortDedupLabels(set []storepb.Series, replicaLabels map[string]struct{}) {
 
 // LabelValues returns all potential values for a label name.
 func (q *querier) LabelValues(name string) ([]string, storage.Warnings, error) {
+	return q.LabelValuesWithMatchers(name)
+}
+
+// LabelValuesWithMatchers returns all potential values for a label name of series matching the given matchers
+// within the querier time range.
+func (q *querier) LabelValuesWithMatchers(name string, ms ...*labels.Matcher) ([]string, storage.Warnings, error) {
 	span, ctx := tracing.StartSpan(q.ctx, "querier_label_values")
 	defer span.Finish()
 
-	resp, err := q.proxy.LabelValues(ctx, &storepb.LabelValuesRequest{Label: name, PartialResponseDisabled: !q.partialResponse})
+	sms, err := translateMatchers(ms...)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "convert matchers")
+	}
+	sms = tenancy.EnforceMatchers(q.ctx, sms)
+
+	resp, err := q.proxy.LabelValues(ctx, &storepb.LabelValuesRequest{
+		Label:                   name,
+		PartialResponseDisabled: !q.partialResponse,
+		Start:                   q.mint,
+		End:                     q.maxt,
+		Matchers:                sms,
+	})
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "proxy LabelValues()")
 	}
@@ -269,10 +322,27 @@ func (q *querier) LabelValues(name string) ([]string, storage.Warnings, error) {
 
 // LabelNames returns all the unique label names present in the block in sorted order.
 func (q *querier) LabelNames() ([]string, storage.Warnings, error) {
+	return q.LabelNamesWithMatchers()
+}
+
+// LabelNamesWithMatchers returns all the unique label names of series matching the given matchers within
+// the querier time range in sorted order.
+func (q *querier) LabelNamesWithMatchers(ms ...*labels.Matcher) ([]string, storage.Warnings, error) {
 	span, ctx := tracing.StartSpan(q.ctx, "querier_label_names")
 	defer span.Finish()
 
-	resp, err := q.proxy.LabelNames(ctx, &storepb.LabelNamesRequest{PartialResponseDisabled: !q.partialResponse})
+	sms, err := translateMatchers(ms...)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "convert matchers")
+	}
+	sms = tenancy.EnforceMatchers(q.ctx, sms)
+
+	resp, err := q.proxy.LabelNames(ctx, &storepb.LabelNamesRequest{
+		PartialResponseDisabled: !q.partialResponse,
+		Start:                   q.mint,
+		End:                     q.maxt,
+		Matchers:                sms,
+	})
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "proxy LabelNames()")
 	}
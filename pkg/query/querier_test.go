@@ -28,7 +28,7 @@ func TestQueryableCreator_MaxResolution(t *testing.T) {
 	queryableCreator := NewQueryableCreator(nil, testProxy)
 
 	oneHourMillis := int64(1*time.Hour) / int64(time.Millisecond)
-	queryable := queryableCreator(false, nil, oneHourMillis, false, false)
+	queryable := queryableCreator(false, nil, DedupPenalty, oneHourMillis, false, false)
 
 	q, err := queryable.Querier(context.Background(), 0, 42)
 	testutil.Ok(t, err)
@@ -55,7 +55,7 @@ func TestQuerier_DownsampledData(t *testing.T) {
 		},
 	}
 
-	q := NewQueryableCreator(nil, testProxy)(false, nil, 9999999, false, false)
+	q := NewQueryableCreator(nil, testProxy)(false, nil, DedupPenalty, 9999999, false, false)
 
 	engine := promql.NewEngine(
 		promql.EngineOpts{
@@ -158,6 +158,270 @@ func TestQuerier_DownsampledData(t *testing.T) {
 	}
 }
 
+func TestQuerier_DownsampledAggregates(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	testProxy := &aggrStoreServer{
+		series: storepb.Series{
+			Labels: []storepb.Label{{Name: "__name__", Value: "a"}},
+			Chunks: []storepb.AggrChunk{{
+				MinTime: 30000,
+				MaxTime: 60000,
+				Count:   xorChunk(t, sample{30000, 2}, sample{60000, 2}),
+				Sum:     xorChunk(t, sample{30000, 10}, sample{60000, 20}),
+				Min:     xorChunk(t, sample{30000, 1}, sample{60000, 3}),
+				Max:     xorChunk(t, sample{30000, 9}, sample{60000, 11}),
+				Counter: xorChunk(t, sample{30000, 100}, sample{60000, 160}),
+			}},
+		},
+	}
+	q := NewQueryableCreator(nil, testProxy)(false, nil, DedupPenalty, 9999999, false, false)
+
+	engine := promql.NewEngine(
+		promql.EngineOpts{
+			MaxConcurrent: 10,
+			MaxSamples:    math.MaxInt32,
+			Timeout:       10 * time.Second,
+		},
+	)
+
+	for _, tcase := range []struct {
+		query string
+		aggrs [][]storepb.Aggr
+		exp   float64
+	}{
+		{
+			query: "min_over_time(a[1m])",
+			aggrs: [][]storepb.Aggr{{storepb.Aggr_MIN}},
+			exp:   1,
+		},
+		{
+			query: "max_over_time(a[1m])",
+			aggrs: [][]storepb.Aggr{{storepb.Aggr_MAX}},
+			exp:   11,
+		},
+		{
+			query: "sum_over_time(a[1m])",
+			aggrs: [][]storepb.Aggr{{storepb.Aggr_SUM}},
+			exp:   30,
+		},
+		{
+			query: "avg_over_time(a[1m])",
+			aggrs: [][]storepb.Aggr{{storepb.Aggr_COUNT, storepb.Aggr_SUM}},
+			exp:   7.5,
+		},
+		{
+			query: "stddev_over_time(a[1m])",
+			aggrs: [][]storepb.Aggr{{storepb.Aggr_COUNT, storepb.Aggr_SUM}},
+			exp:   2.5,
+		},
+		{
+			query: "increase(a[1m])",
+			aggrs: [][]storepb.Aggr{{storepb.Aggr_COUNTER}},
+			exp:   120,
+		},
+		{
+			query: "resets(a[1m])",
+			aggrs: [][]storepb.Aggr{{storepb.Aggr_COUNT, storepb.Aggr_SUM}},
+			exp:   0,
+		},
+		{
+			// Each selector gets aggregates of its own function, even for the same metric.
+			query: "min_over_time(a[1m]) + max_over_time(a[1m]) + sum_over_time(a[1m])",
+			aggrs: [][]storepb.Aggr{{storepb.Aggr_MIN}, {storepb.Aggr_MAX}, {storepb.Aggr_SUM}},
+			exp:   42,
+		},
+	} {
+		t.Run(tcase.query, func(t *testing.T) {
+			testProxy.aggrs = nil
+
+			qry, err := engine.NewInstantQuery(q, tcase.query, time.Unix(60, 0))
+			testutil.Ok(t, err)
+			defer qry.Close()
+
+			res := qry.Exec(context.Background())
+			testutil.Ok(t, res.Err)
+			v, err := res.Vector()
+			testutil.Ok(t, err)
+			testutil.Equals(t, 1, len(v))
+			testutil.Equals(t, tcase.exp, v[0].V)
+			testutil.Equals(t, tcase.aggrs, testProxy.aggrs)
+		})
+	}
+}
+
+func TestQuerier_DownsampledResets(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	// Counter scraped every 10s, reset after 5m.
+	var raw []sample
+	for ts := int64(0); ts <= 600000; ts += 10000 {
+		v := float64(ts / 1000)
+		if ts >= 300000 {
+			v = float64((ts - 300000) / 1000)
+		}
+		raw = append(raw, sample{ts, v})
+	}
+
+	// Downsample into 1m windows, each aggregate sample at the time of the last raw sample of its window.
+	var cnts, sums, mins []sample
+	for i := 0; i < len(raw); {
+		var (
+			w              = raw[i].t / 60000
+			cnt, sum, minv = 0.0, 0.0, math.MaxFloat64
+			last           int64
+		)
+		for ; i < len(raw) && raw[i].t/60000 == w; i++ {
+			cnt++
+			sum += raw[i].v
+			minv = math.Min(minv, raw[i].v)
+			last = raw[i].t
+		}
+		cnts = append(cnts, sample{last, cnt})
+		sums = append(sums, sample{last, sum})
+		mins = append(mins, sample{last, minv})
+	}
+
+	engine := promql.NewEngine(
+		promql.EngineOpts{
+			MaxConcurrent: 10,
+			MaxSamples:    math.MaxInt32,
+			Timeout:       10 * time.Second,
+		},
+	)
+	resets := func(q storage.Queryable) float64 {
+		qry, err := engine.NewInstantQuery(q, "resets(a[10m])", time.Unix(600, 0))
+		testutil.Ok(t, err)
+		defer qry.Close()
+
+		res := qry.Exec(context.Background())
+		testutil.Ok(t, res.Err)
+		v, err := res.Vector()
+		testutil.Ok(t, err)
+		testutil.Equals(t, 1, len(v))
+		return v[0].V
+	}
+
+	rawProxy := &storeServer{
+		resps: []*storepb.SeriesResponse{storeSeriesResponse(t, labels.FromStrings("__name__", "a"), raw)},
+	}
+	exp := resets(NewQueryableCreator(nil, rawProxy)(false, nil, DedupPenalty, 0, false, false))
+	testutil.Equals(t, 1.0, exp)
+
+	aggrProxy := &aggrStoreServer{
+		series: storepb.Series{
+			Labels: []storepb.Label{{Name: "__name__", Value: "a"}},
+			Chunks: []storepb.AggrChunk{{
+				MinTime: raw[0].t,
+				MaxTime: raw[len(raw)-1].t,
+				Count:   xorChunk(t, cnts...),
+				Sum:     xorChunk(t, sums...),
+				Min:     xorChunk(t, mins...),
+			}},
+		},
+	}
+	testutil.Equals(t, exp, resets(NewQueryableCreator(nil, aggrProxy)(false, nil, DedupPenalty, 9999999, false, false)))
+	testutil.Equals(t, [][]storepb.Aggr{{storepb.Aggr_COUNT, storepb.Aggr_SUM}}, aggrProxy.aggrs)
+}
+
+func TestQuerier_DownsampledOptionalAggregates(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	chk := storepb.AggrChunk{
+		MinTime: 30000,
+		MaxTime: 60000,
+		Count:   xorChunk(t, sample{30000, 2}, sample{60000, 2}),
+		Sum:     xorChunk(t, sample{30000, 10}, sample{60000, 20}),
+	}
+	withOptional := chk
+	withOptional.Last = xorChunk(t, sample{30000, 8}, sample{60000, 15})
+	withOptional.Quantiles = xorChunk(t, sample{29999, 1}, sample{30000, 9}, sample{59999, 3}, sample{60000, 11})
+
+	engine := promql.NewEngine(
+		promql.EngineOpts{
+			MaxConcurrent: 10,
+			MaxSamples:    math.MaxInt32,
+			Timeout:       10 * time.Second,
+		},
+	)
+
+	for _, tcase := range []struct {
+		query string
+		chunk storepb.AggrChunk
+		aggrs [][]storepb.Aggr
+		exp   float64
+	}{
+		{
+			query: "quantile_over_time(0.5, a[1m])",
+			chunk: withOptional,
+			aggrs: [][]storepb.Aggr{{storepb.Aggr_QUANTILES, storepb.Aggr_COUNT, storepb.Aggr_SUM}},
+			exp:   6,
+		},
+		{
+			query: "idelta(a[1m])",
+			chunk: withOptional,
+			aggrs: [][]storepb.Aggr{{storepb.Aggr_LAST, storepb.Aggr_COUNT, storepb.Aggr_SUM}},
+			exp:   7,
+		},
+		{
+			// Blocks downsampled without optional aggregates fall back to averages.
+			query: "quantile_over_time(0.5, a[1m])",
+			chunk: chk,
+			aggrs: [][]storepb.Aggr{{storepb.Aggr_QUANTILES, storepb.Aggr_COUNT, storepb.Aggr_SUM}},
+			exp:   7.5,
+		},
+		{
+			query: "idelta(a[1m])",
+			chunk: chk,
+			aggrs: [][]storepb.Aggr{{storepb.Aggr_LAST, storepb.Aggr_COUNT, storepb.Aggr_SUM}},
+			exp:   5,
+		},
+	} {
+		t.Run(tcase.query, func(t *testing.T) {
+			testProxy := &aggrStoreServer{
+				series: storepb.Series{
+					Labels: []storepb.Label{{Name: "__name__", Value: "a"}},
+					Chunks: []storepb.AggrChunk{tcase.chunk},
+				},
+			}
+			q := NewQueryableCreator(nil, testProxy)(false, nil, DedupPenalty, 9999999, false, false)
+
+			qry, err := engine.NewInstantQuery(q, tcase.query, time.Unix(60, 0))
+			testutil.Ok(t, err)
+			defer qry.Close()
+
+			res := qry.Exec(context.Background())
+			testutil.Ok(t, res.Err)
+			v, err := res.Vector()
+			testutil.Ok(t, err)
+			testutil.Equals(t, 1, len(v))
+			testutil.Equals(t, tcase.exp, v[0].V)
+			testutil.Equals(t, tcase.aggrs, testProxy.aggrs)
+		})
+	}
+}
+
+func TestDropCoveredRawChunks(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	raw := func(mint, maxt int64) storepb.AggrChunk {
+		return storepb.AggrChunk{MinTime: mint, MaxTime: maxt, Raw: &storepb.Chunk{}}
+	}
+	aggr := func(mint, maxt int64) storepb.AggrChunk {
+		return storepb.AggrChunk{MinTime: mint, MaxTime: maxt, Count: &storepb.Chunk{}, Sum: &storepb.Chunk{}}
+	}
+
+	// Raw chunks overlapping downsampled ones only partially are kept, as they hold data missing in the downsampled ones.
+	s := newChunkSeries(nil, []storepb.AggrChunk{
+		raw(400, 500),
+		raw(0, 100),
+		aggr(0, 300),
+		raw(100, 200),
+		raw(250, 350),
+	}, 0, 500, resAggrAvg)
+	testutil.Equals(t, []storepb.AggrChunk{aggr(0, 300), raw(250, 350), raw(400, 500)}, s.chunks)
+}
+
 func TestQuerier_Series(t *testing.T) {
 	defer leaktest.CheckTimeout(t, 10*time.Second)()
 
@@ -176,7 +440,7 @@ func TestQuerier_Series(t *testing.T) {
 
 	// Querier clamps the range to [1,300], which should drop some samples of the result above.
 	// The store API allows endpoints to send more data then initially requested.
-	q := newQuerier(context.Background(), nil, 1, 300, []string{""}, testProxy, false, 0, true, false)
+	q := newQuerier(context.Background(), nil, 1, 300, []string{""}, DedupPenalty, testProxy, false, 0, true, false)
 	defer func() { testutil.Ok(t, q.Close()) }()
 
 	res, _, err := q.Select(&storage.SelectParams{})
@@ -549,7 +813,7 @@ func TestDedupSeriesSet(t *testing.T) {
 				maxt: math.MaxInt64,
 				set:  newStoreSeriesSet(series),
 			}
-			dedupSet := newDedupSeriesSet(set, test.dedupLabels)
+			dedupSet := newDedupSeriesSet(set, test.dedupLabels, DedupPenalty)
 
 			i := 0
 			for dedupSet.Next() {
@@ -609,6 +873,116 @@ func TestDedupSeriesIterator(t *testing.T) {
 	}
 }
 
+func TestDedupSeriesIterator_Counter(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	cases := []struct {
+		a, b, exp []sample
+	}{
+		{ // Values of the replica switched to are adjusted to not look like a counter reset.
+			a:   []sample{{10000, 10}, {20000, 11}, {30000, 12}, {60000, 15}, {70000, 16}},
+			b:   []sample{{10100, 5}, {20100, 6}, {30100, 7}, {40100, 8}, {50100, 9}, {60100, 10}},
+			exp: []sample{{10000, 10}, {20000, 11}, {30000, 12}, {50100, 12}, {60100, 13}},
+		},
+		{ // Higher values of the replica switched to are kept.
+			a:   []sample{{10000, 10}, {20000, 11}, {30000, 12}, {60000, 15}, {70000, 16}},
+			b:   []sample{{10100, 15}, {20100, 16}, {30100, 17}, {40100, 18}, {50100, 19}, {60100, 20}},
+			exp: []sample{{10000, 10}, {20000, 11}, {30000, 12}, {50100, 19}, {60100, 20}},
+		},
+	}
+	for i, c := range cases {
+		t.Logf("case %d:", i)
+		it := newDedupSeriesIterator(
+			&counterAdjustSeriesIterator{SeriesIterator: &SampleIterator{l: c.a, i: -1}},
+			&counterAdjustSeriesIterator{SeriesIterator: &SampleIterator{l: c.b, i: -1}},
+		)
+		res := expandSeries(t, it)
+		testutil.Equals(t, c.exp, res)
+	}
+}
+
+func TestChainSeriesIterator(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	cases := []struct {
+		a, b, exp []sample
+	}{
+		{ // Prefer the first series.
+			a:   []sample{{10000, 1}, {20000, 1}, {30000, 1}, {40000, 1}},
+			b:   []sample{{9000, 2}, {19000, 2}, {29000, 2}, {39000, 2}},
+			exp: []sample{{10000, 1}, {20000, 1}, {30000, 1}, {40000, 1}},
+		},
+		{ // Fill gaps bigger than 2 deltas with the second series, but return to the first one.
+			a:   []sample{{10000, 1}, {20000, 1}, {30000, 1}, {70000, 1}, {80000, 1}},
+			b:   []sample{{10100, 2}, {20100, 2}, {30100, 2}, {40100, 2}, {50100, 2}, {60100, 2}, {70100, 2}, {80100, 2}},
+			exp: []sample{{10000, 1}, {20000, 1}, {30000, 1}, {40100, 2}, {50100, 2}, {70000, 1}, {80000, 1}},
+		},
+		{ // Use the second series before the first one starts.
+			a:   []sample{{40000, 1}, {50000, 1}},
+			b:   []sample{{10000, 2}, {20000, 2}, {30000, 2}, {40000, 2}, {50000, 2}, {60000, 2}},
+			exp: []sample{{10000, 2}, {20000, 2}, {30000, 2}, {40000, 1}, {50000, 1}, {60000, 2}},
+		},
+	}
+	for i, c := range cases {
+		t.Logf("case %d:", i)
+		it := newChainSeriesIterator(
+			&SampleIterator{l: c.a, i: -1},
+			&SampleIterator{l: c.b, i: -1},
+		)
+		res := expandSeries(t, it)
+		testutil.Equals(t, c.exp, res)
+	}
+}
+
+func TestChainIterator(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	every := func(mint, maxt, step int64, v float64) []sample {
+		var res []sample
+		for ts := mint; ts <= maxt; ts += step {
+			res = append(res, sample{ts, v})
+		}
+		return res
+	}
+	series := func(chunks ...[]sample) storage.Series {
+		var cs []storepb.AggrChunk
+		for _, smpls := range chunks {
+			cs = append(cs, storepb.AggrChunk{MinTime: smpls[0].t, MaxTime: smpls[len(smpls)-1].t, Raw: xorChunk(t, smpls...)})
+		}
+		return newChunkSeries(nil, cs, math.MinInt64, math.MaxInt64, resAggrCount)
+	}
+
+	for _, tcase := range []struct {
+		name     string
+		a, b     storage.Series
+		expected []sample
+	}{
+		{
+			name:     "chunk with most samples is used, other replica fills time ranges without chunks",
+			a:        series(every(0, 90000, 10000, 1)),
+			b:        series([]sample{{0, 2}, {10000, 2}, {80000, 2}, {90000, 2}}, every(100000, 120000, 10000, 2)),
+			expected: append(every(0, 90000, 10000, 1), every(100000, 120000, 10000, 2)...),
+		},
+		{
+			name:     "partially overlapping chunk is used after the selected one",
+			a:        series(every(0, 50000, 10000, 1)),
+			b:        series(every(30000, 100000, 10000, 2)),
+			expected: append(every(0, 50000, 10000, 1), every(60000, 100000, 10000, 2)...),
+		},
+		{
+			name:     "earlier chunk is used until the better one starts",
+			a:        series([]sample{{0, 1}, {100000, 1}}),
+			b:        series(every(20000, 100000, 10000, 2)),
+			expected: append([]sample{{0, 1}}, every(20000, 100000, 10000, 2)...),
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			testutil.Equals(t, tcase.expected, expandSeries(t, newChainIterator([]storage.Series{tcase.a, tcase.b})))
+			testutil.Equals(t, tcase.expected, expandSeries(t, newChainIterator([]storage.Series{tcase.b, tcase.a})))
+		})
+	}
+}
+
 func BenchmarkDedupSeriesIterator(b *testing.B) {
 	run := func(b *testing.B, s1, s2 []sample) {
 		it := newDedupSeriesIterator(
@@ -717,6 +1091,55 @@ func (s *storeServer) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesS
 	return nil
 }
 
+// aggrStoreServer returns its series with only the requested aggregates, like a store with downsampled blocks.
+type aggrStoreServer struct {
+	// This field just exist to pseudo-implement the unused methods of the interface.
+	storepb.StoreServer
+
+	series storepb.Series
+	aggrs  [][]storepb.Aggr
+}
+
+func (s *aggrStoreServer) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesServer) error {
+	s.aggrs = append(s.aggrs, r.Aggregates)
+
+	series := storepb.Series{Labels: s.series.Labels}
+	for _, c := range s.series.Chunks {
+		res := storepb.AggrChunk{MinTime: c.MinTime, MaxTime: c.MaxTime}
+		for _, a := range r.Aggregates {
+			switch a {
+			case storepb.Aggr_COUNT:
+				res.Count = c.Count
+			case storepb.Aggr_SUM:
+				res.Sum = c.Sum
+			case storepb.Aggr_MIN:
+				res.Min = c.Min
+			case storepb.Aggr_MAX:
+				res.Max = c.Max
+			case storepb.Aggr_COUNTER:
+				res.Counter = c.Counter
+			case storepb.Aggr_LAST:
+				res.Last = c.Last
+			case storepb.Aggr_QUANTILES:
+				res.Quantiles = c.Quantiles
+			}
+		}
+		series.Chunks = append(series.Chunks, res)
+	}
+	return srv.Send(storepb.NewSeriesResponse(&series))
+}
+
+func xorChunk(t testing.TB, smpls ...sample) *storepb.Chunk {
+	c := chunkenc.NewXORChunk()
+	a, err := c.Appender()
+	testutil.Ok(t, err)
+
+	for _, smpl := range smpls {
+		a.Append(smpl.t, smpl.v)
+	}
+	return &storepb.Chunk{Type: storepb.Chunk_XOR, Data: c.Bytes()}
+}
+
 // storeSeriesResponse creates test storepb.SeriesResponse that includes series with single chunk that stores all the given samples.
 func storeSeriesResponse(t testing.TB, lset labels.Labels, smplChunks ...[]sample) *storepb.SeriesResponse {
 	var s storepb.Series
@@ -0,0 +1,89 @@
+package query
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/thanos-io/thanos/pkg/query/querypb"
+	"github.com/thanos-io/thanos/pkg/store"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+type statsKey struct{}
+
+// Stats holds statistics about data fetched from stores while evaluating a single query.
+// It is safe for concurrent use.
+type Stats struct {
+	stores store.QueriedStores
+
+	series  int64
+	samples int64
+}
+
+// ContextWithStats returns a context which makes queriers created with it record their statistics
+// into the given Stats.
+func ContextWithStats(ctx context.Context, s *Stats) context.Context {
+	ctx = context.WithValue(ctx, statsKey{}, s)
+	return store.ContextWithQueriedStores(ctx, &s.stores)
+}
+
+func statsFromContext(ctx context.Context) *Stats {
+	s, _ := ctx.Value(statsKey{}).(*Stats)
+	return s
+}
+
+// Stores returns sorted addresses of stores queried for series.
+func (s *Stats) Stores() []string {
+	return s.stores.Stores()
+}
+
+// Series returns the number of series fetched from stores, before deduplication. For queries pushed down to leaf
+// queriers it is the number of series returned by the leaves.
+func (s *Stats) Series() int64 {
+	return atomic.LoadInt64(&s.series)
+}
+
+// Samples returns the number of samples fetched from stores, before deduplication.
+// For downsampled data it is the number of aggregated samples. For queries pushed down to leaf queriers it is
+// the number of samples returned by the leaves.
+func (s *Stats) Samples() int64 {
+	return atomic.LoadInt64(&s.samples)
+}
+
+func (s *Stats) addSeries(series []storepb.Series) {
+	var samples int64
+	for _, ser := range series {
+		for _, c := range ser.Chunks {
+			samples += int64(numSamples(c.Raw, c.Count, c.Sum, c.Min, c.Max, c.Counter, c.Last, c.Quantiles))
+		}
+	}
+	atomic.AddInt64(&s.series, int64(len(series)))
+	atomic.AddInt64(&s.samples, samples)
+}
+
+// addQueryResponse records series and samples of the response of a leaf querier evaluating a pushed down query.
+func (s *Stats) addQueryResponse(addr string, resp *querypb.QueryResponse) {
+	var samples int64
+	for _, ser := range resp.Series {
+		samples += int64(len(ser.Samples))
+	}
+	s.stores.Add(addr)
+	atomic.AddInt64(&s.series, int64(len(resp.Series)))
+	atomic.AddInt64(&s.samples, samples)
+}
+
+// numSamples returns number of samples in the first non-nil chunk.
+func numSamples(cs ...*storepb.Chunk) int {
+	for _, c := range cs {
+		if c == nil {
+			continue
+		}
+		chk, err := chunkenc.FromData(chunkEncoding(c.Type), c.Data)
+		if err != nil {
+			return 0
+		}
+		return chk.NumSamples()
+	}
+	return 0
+}
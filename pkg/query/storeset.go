@@ -3,6 +3,7 @@ package query
 import (
 	"context"
 	"fmt"
+	"math"
 	"sort"
 	"strings"
 	"sync"
@@ -14,9 +15,14 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/metadata"
+	"github.com/thanos-io/thanos/pkg/metadata/metadatapb"
+	"github.com/thanos-io/thanos/pkg/query/querypb"
 	"github.com/thanos-io/thanos/pkg/runutil"
 	"github.com/thanos-io/thanos/pkg/store"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/targets"
+	"github.com/thanos-io/thanos/pkg/targets/targetspb"
 	"google.golang.org/grpc"
 )
 
@@ -27,32 +33,68 @@ const (
 type StoreSpec interface {
 	// Addr returns StoreAPI Address for the store spec. It is used as ID for store.
 	Addr() string
-	// Metadata returns current labels, store type and min, max ranges for store.
+	// StrictStatic returns true if the store was statically configured as strict. Strict stores are never removed from
+	// the store set, even if their health check fails, so queries always hit them and report them as failed when
+	// they are not reachable.
+	StrictStatic() bool
+	// Metadata returns current labels, store type, min, max ranges and resolutions of data for store.
 	// It can change for every call for this method.
-	// If metadata call fails we assume that store is no longer accessible and we should not use it.
+	// If metadata call fails we assume that store is no longer accessible and we should not use it, unless it is strict.
 	// NOTE: It is implementation responsibility to retry until context timeout, but a caller responsibility to manage
 	// given store connection.
-	Metadata(ctx context.Context, client storepb.StoreClient) (labelSets []storepb.LabelSet, mint int64, maxt int64, storeType component.StoreAPI, err error)
+	Metadata(ctx context.Context, client storepb.StoreClient) (labelSets []storepb.LabelSet, mint int64, maxt int64, storeType component.StoreAPI, resolutions []int64, err error)
+}
+
+// StoreHealth is a health state of the store as seen by the StoreSet.
+type StoreHealth int
+
+const (
+	// StoreConnecting means that the first health check of the store has not finished yet.
+	StoreConnecting StoreHealth = iota
+	// StoreHealthy means that the last health check of the store succeeded.
+	StoreHealthy
+	// StoreDegraded means that the last health check of a strict store failed. The store is still used for queries,
+	// which report it as failed.
+	StoreDegraded
+	// StoreDown means that the last health check of the store failed and the store is not used for queries.
+	StoreDown
+)
+
+func (h StoreHealth) String() string {
+	switch h {
+	case StoreConnecting:
+		return "connecting"
+	case StoreHealthy:
+		return "healthy"
+	case StoreDegraded:
+		return "degraded"
+	case StoreDown:
+		return "down"
+	}
+	return "unknown"
 }
 
 type StoreStatus struct {
-	Name      string
-	LastCheck time.Time
-	LastError error
-	LabelSets []storepb.LabelSet
-	StoreType component.StoreAPI
-	MinTime   int64
-	MaxTime   int64
+	Name         string
+	StrictStatic bool
+	Health       StoreHealth
+	LastCheck    time.Time
+	LastError    error
+	LabelSets    []storepb.LabelSet
+	StoreType    component.StoreAPI
+	MinTime      int64
+	MaxTime      int64
 }
 
 type grpcStoreSpec struct {
-	addr string
+	addr         string
+	strictStatic bool
 }
 
 // NewGRPCStoreSpec creates store pure gRPC spec.
 // It uses Info gRPC call to get Metadata.
-func NewGRPCStoreSpec(addr string) StoreSpec {
-	return &grpcStoreSpec{addr: addr}
+func NewGRPCStoreSpec(addr string, strictStatic bool) StoreSpec {
+	return &grpcStoreSpec{addr: addr, strictStatic: strictStatic}
 }
 
 func (s *grpcStoreSpec) Addr() string {
@@ -60,18 +102,22 @@ func (s *grpcStoreSpec) Addr() string {
 	return s.addr
 }
 
+func (s *grpcStoreSpec) StrictStatic() bool {
+	return s.strictStatic
+}
+
 // Metadata method for gRPC store API tries to reach host Info method until context timeout. If we are unable to get metadata after
 // that time, we assume that the host is unhealthy and return error.
-func (s *grpcStoreSpec) Metadata(ctx context.Context, client storepb.StoreClient) (labelSets []storepb.LabelSet, mint int64, maxt int64, storeType component.StoreAPI, err error) {
+func (s *grpcStoreSpec) Metadata(ctx context.Context, client storepb.StoreClient) (labelSets []storepb.LabelSet, mint int64, maxt int64, storeType component.StoreAPI, resolutions []int64, err error) {
 	resp, err := client.Info(ctx, &storepb.InfoRequest{}, grpc.WaitForReady(true))
 	if err != nil {
-		return nil, 0, 0, nil, errors.Wrapf(err, "fetching store info from %s", s.addr)
+		return nil, 0, 0, nil, nil, errors.Wrapf(err, "fetching store info from %s", s.addr)
 	}
 	if len(resp.LabelSets) == 0 && len(resp.Labels) > 0 {
 		resp.LabelSets = []storepb.LabelSet{{Labels: resp.Labels}}
 	}
 
-	return resp.LabelSets, resp.MinTime, resp.MaxTime, component.FromProto(resp.StoreType), nil
+	return resp.LabelSets, resp.MinTime, resp.MaxTime, component.FromProto(resp.StoreType), resp.Resolutions, nil
 }
 
 // storeSetNodeCollector is metric collector for Guge indicated number of available storeAPIs for Querier.
@@ -203,21 +249,26 @@ func NewStoreSet(
 
 type storeRef struct {
 	storepb.StoreClient
+	metadata metadatapb.MetadataClient
+	targets  targetspb.TargetsClient
+	query    querypb.QueryClient
 
-	mtx  sync.RWMutex
-	cc   *grpc.ClientConn
-	addr string
+	mtx          sync.RWMutex
+	cc           *grpc.ClientConn
+	addr         string
+	strictStatic bool
 
 	// Meta (can change during runtime).
-	labelSets []storepb.LabelSet
-	storeType component.StoreAPI
-	minTime   int64
-	maxTime   int64
+	labelSets   []storepb.LabelSet
+	storeType   component.StoreAPI
+	minTime     int64
+	maxTime     int64
+	resolutions []int64
 
 	logger log.Logger
 }
 
-func (s *storeRef) Update(labelSets []storepb.LabelSet, minTime int64, maxTime int64, storeType component.StoreAPI) {
+func (s *storeRef) Update(labelSets []storepb.LabelSet, minTime int64, maxTime int64, storeType component.StoreAPI, resolutions []int64) {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
@@ -225,6 +276,7 @@ func (s *storeRef) Update(labelSets []storepb.LabelSet, minTime int64, maxTime i
 	s.labelSets = labelSets
 	s.minTime = minTime
 	s.maxTime = maxTime
+	s.resolutions = resolutions
 }
 
 func (s *storeRef) StoreType() component.StoreAPI {
@@ -295,6 +347,13 @@ func (s *storeRef) TimeRange() (mint int64, maxt int64) {
 	return s.minTime, s.maxTime
 }
 
+func (s *storeRef) Resolutions() []int64 {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	return append([]int64(nil), s.resolutions...)
+}
+
 func (s *storeRef) String() string {
 	mint, maxt := s.TimeRange()
 	return fmt.Sprintf("Addr: %s LabelSets: %v Mint: %d Maxt: %d", s.addr, storepb.LabelSetsToString(s.LabelSets()), mint, maxt)
@@ -304,10 +363,69 @@ func (s *storeRef) Addr() string {
 	return s.addr
 }
 
+// HasMetadataAPI returns true if the store is expected to serve metric metadata as well.
+func (s *storeRef) HasMetadataAPI() bool {
+	switch s.StoreType() {
+	case component.Sidecar, component.Receive, component.Query:
+		return true
+	}
+	return false
+}
+
+func (s *storeRef) Metadata(ctx context.Context, r *metadatapb.MetadataRequest, opts ...grpc.CallOption) (*metadatapb.MetadataResponse, error) {
+	return s.metadata.Metadata(ctx, r, opts...)
+}
+
+// HasTargetsAPI returns true if the store is expected to serve scrape targets as well.
+func (s *storeRef) HasTargetsAPI() bool {
+	switch s.StoreType() {
+	case component.Sidecar, component.Query:
+		return true
+	}
+	return false
+}
+
+func (s *storeRef) Targets(ctx context.Context, r *targetspb.TargetsRequest, opts ...grpc.CallOption) (*targetspb.TargetsResponse, error) {
+	return s.targets.Targets(ctx, r, opts...)
+}
+
+// HasQueryAPI returns true if the store is expected to evaluate PromQL queries as well.
+func (s *storeRef) HasQueryAPI() bool {
+	return s.StoreType() == component.Query
+}
+
+func (s *storeRef) Query(ctx context.Context, r *querypb.QueryRequest, opts ...grpc.CallOption) (*querypb.QueryResponse, error) {
+	return s.query.Query(ctx, r, opts...)
+}
+
 func (s *storeRef) Close() {
+	if s.cc == nil {
+		return
+	}
 	runutil.CloseWithLogOnErr(s.logger, s.cc, fmt.Sprintf("store %v connection close", s.addr))
 }
 
+// undialedStoreClient is used for strict stores that could not be dialed. It fails every call with the dial error.
+type undialedStoreClient struct {
+	err error
+}
+
+func (c *undialedStoreClient) Info(context.Context, *storepb.InfoRequest, ...grpc.CallOption) (*storepb.InfoResponse, error) {
+	return nil, c.err
+}
+
+func (c *undialedStoreClient) Series(context.Context, *storepb.SeriesRequest, ...grpc.CallOption) (storepb.Store_SeriesClient, error) {
+	return nil, c.err
+}
+
+func (c *undialedStoreClient) LabelNames(context.Context, *storepb.LabelNamesRequest, ...grpc.CallOption) (*storepb.LabelNamesResponse, error) {
+	return nil, c.err
+}
+
+func (c *undialedStoreClient) LabelValues(context.Context, *storepb.LabelValuesRequest, ...grpc.CallOption) (*storepb.LabelValuesResponse, error) {
+	return nil, c.err
+}
+
 func newStoreAPIStats() map[component.StoreAPI]map[string]int {
 	nodes := make(map[component.StoreAPI]map[string]int, len(storepb.StoreType_name))
 	for i := range storepb.StoreType_name {
@@ -331,21 +449,30 @@ func (s *StoreSet) Update(ctx context.Context) {
 
 	level.Debug(s.logger).Log("msg", "starting updating storeAPIs", "cachedStores", len(stores))
 
-	healthyStores := s.getHealthyStores(ctx, stores)
-	level.Debug(s.logger).Log("msg", "checked requested storeAPIs", "healthyStores", len(healthyStores), "cachedStores", len(stores))
+	healthyStores, degradedStores := s.getHealthyStores(ctx, stores)
+	level.Debug(s.logger).Log("msg", "checked requested storeAPIs", "healthyStores", len(healthyStores), "degradedStores", len(degradedStores), "cachedStores", len(stores))
 
 	stats := newStoreAPIStats()
 
-	// Close stores that where not healthy this time (are not in healthy stores map).
+	// Close stores that where not healthy this time (are not in healthy stores map). Strict stores are kept.
 	for addr, st := range stores {
-		if _, ok := healthyStores[addr]; ok {
+		healthy, isHealthy := healthyStores[addr]
+		if isHealthy && healthy == st {
 			stats[st.StoreType()][st.LabelSetsString()]++
 			continue
 		}
+		degraded, isDegraded := degradedStores[addr]
+		if isDegraded && degraded == st {
+			continue
+		}
 
 		st.Close()
 		delete(stores, addr)
-		s.updateStoreStatus(st, errors.New(unhealthyStoreMessage))
+		if isHealthy || isDegraded {
+			// Strict store that could not be dialed before is replaced by the newly dialed one.
+			continue
+		}
+		s.updateStoreStatus(st, StoreDown, errors.New(unhealthyStoreMessage))
 		level.Info(s.logger).Log("msg", unhealthyStoreMessage, "address", addr, "extLset", st.LabelSetsString())
 	}
 
@@ -369,10 +496,20 @@ func (s *StoreSet) Update(ctx context.Context) {
 		stats[st.StoreType()][st.LabelSetsString()]++
 
 		stores[addr] = st
-		s.updateStoreStatus(st, nil)
+		s.updateStoreStatus(st, StoreHealthy, nil)
 		level.Info(s.logger).Log("msg", "adding new storeAPI to query storeset", "address", addr, "extLset", extLset)
 	}
 
+	// Add strict stores that are not yet in stores, even though they are not healthy.
+	for addr, st := range degradedStores {
+		if _, ok := stores[addr]; ok {
+			continue
+		}
+
+		stores[addr] = st
+		level.Info(s.logger).Log("msg", "adding new strict storeAPI to query storeset despite failed health check", "address", addr)
+	}
+
 	s.storesMetric.Update(stats)
 	s.storesMtx.Lock()
 	s.stores = stores
@@ -381,13 +518,16 @@ func (s *StoreSet) Update(ctx context.Context) {
 	s.cleanUpStoreStatuses(stores)
 }
 
-func (s *StoreSet) getHealthyStores(ctx context.Context, stores map[string]*storeRef) map[string]*storeRef {
+// getHealthyStores checks health of all stores from the specs. It returns healthy stores and strict stores which failed
+// the check, but should still be used.
+func (s *StoreSet) getHealthyStores(ctx context.Context, stores map[string]*storeRef) (healthyStores, degradedStores map[string]*storeRef) {
 	var (
-		unique        = make(map[string]struct{})
-		healthyStores = make(map[string]*storeRef, len(stores))
-		mtx           sync.Mutex
-		wg            sync.WaitGroup
+		unique = make(map[string]struct{})
+		mtx    sync.Mutex
+		wg     sync.WaitGroup
 	)
+	healthyStores = make(map[string]*storeRef, len(stores))
+	degradedStores = map[string]*storeRef{}
 
 	// Gather healthy stores map concurrently. Build new store if does not exist already.
 	for _, storeSpec := range s.storeSpecs() {
@@ -407,30 +547,75 @@ func (s *StoreSet) getHealthyStores(ctx context.Context, stores map[string]*stor
 			defer cancel()
 
 			st, seenAlready := stores[addr]
+			if seenAlready && st.cc == nil {
+				// Strict store that could not be dialed so far, try again.
+				seenAlready = false
+			}
 			if !seenAlready {
 				// New store or was unhealthy and was removed in the past - create new one.
+				s.initStoreStatus(addr, spec.StrictStatic())
+
 				conn, err := grpc.DialContext(ctx, addr, s.dialOpts...)
 				if err != nil {
-					s.updateStoreStatus(&storeRef{addr: addr}, err)
-					level.Warn(s.logger).Log("msg", "update of store node failed", "err", errors.Wrap(err, "dialing connection"), "address", addr)
+					level.Warn(s.logger).Log("msg", "update of store node failed", "err", errors.Wrap(err, "dialing connection"), "address", addr, "strict", spec.StrictStatic())
+
+					if spec.StrictStatic() {
+						// Keep the strict store, so its failure is always reported. Dialing is retried on next update.
+						st = &storeRef{
+							StoreClient:  &undialedStoreClient{err: errors.Wrap(err, "dialing connection")},
+							addr:         addr,
+							strictStatic: true,
+							logger:       s.logger,
+						}
+						st.Update(nil, math.MinInt64, math.MaxInt64, nil, nil)
+						s.updateStoreStatus(st, StoreDegraded, err)
+
+						mtx.Lock()
+						defer mtx.Unlock()
+
+						degradedStores[addr] = st
+						return
+					}
+					s.updateStoreStatus(&storeRef{addr: addr, strictStatic: spec.StrictStatic()}, StoreDown, err)
 					return
 				}
-				st = &storeRef{StoreClient: storepb.NewStoreClient(conn), cc: conn, addr: addr, logger: s.logger}
+				st = &storeRef{
+					StoreClient:  storepb.NewStoreClient(conn),
+					metadata:     metadatapb.NewMetadataClient(conn),
+					targets:      targetspb.NewTargetsClient(conn),
+					query:        querypb.NewQueryClient(conn),
+					cc:           conn,
+					addr:         addr,
+					strictStatic: spec.StrictStatic(),
+					logger:       s.logger,
+				}
 			}
 
 			// Check existing or new store. Is it healthy? What are current metadata?
-			labelSets, minTime, maxTime, storeType, err := spec.Metadata(ctx, st.StoreClient)
+			labelSets, minTime, maxTime, storeType, resolutions, err := spec.Metadata(ctx, st.StoreClient)
 			if err != nil {
+				level.Warn(s.logger).Log("msg", "update of store node failed", "err", errors.Wrap(err, "getting metadata"), "address", addr, "strict", st.strictStatic)
+
+				if st.strictStatic {
+					// Keep the strict store, but make it match all queries, so its failure is always reported.
+					st.Update(nil, math.MinInt64, math.MaxInt64, st.StoreType(), nil)
+					s.updateStoreStatus(st, StoreDegraded, err)
+
+					mtx.Lock()
+					defer mtx.Unlock()
+
+					degradedStores[addr] = st
+					return
+				}
 				if !seenAlready {
 					// Close only if new. Unhealthy `s.stores` will be closed later on.
 					st.Close()
 				}
-				s.updateStoreStatus(st, err)
-				level.Warn(s.logger).Log("msg", "update of store node failed", "err", errors.Wrap(err, "getting metadata"), "address", addr)
+				s.updateStoreStatus(st, StoreDown, err)
 				return
 			}
-			s.updateStoreStatus(st, nil)
-			st.Update(labelSets, minTime, maxTime, storeType)
+			st.Update(labelSets, minTime, maxTime, storeType, resolutions)
+			s.updateStoreStatus(st, StoreHealthy, nil)
 
 			mtx.Lock()
 			defer mtx.Unlock()
@@ -440,10 +625,21 @@ func (s *StoreSet) getHealthyStores(ctx context.Context, stores map[string]*stor
 	}
 	wg.Wait()
 
-	return healthyStores
+	return healthyStores, degradedStores
+}
+
+// initStoreStatus marks the store as connecting, unless its status is already known.
+func (s *StoreSet) initStoreStatus(addr string, strictStatic bool) {
+	s.storesStatusesMtx.Lock()
+	defer s.storesStatusesMtx.Unlock()
+
+	if _, ok := s.storeStatuses[addr]; ok {
+		return
+	}
+	s.storeStatuses[addr] = &StoreStatus{Name: addr, StrictStatic: strictStatic, Health: StoreConnecting, LastCheck: time.Now()}
 }
 
-func (s *StoreSet) updateStoreStatus(store *storeRef, err error) {
+func (s *StoreSet) updateStoreStatus(store *storeRef, health StoreHealth, err error) {
 	s.storesStatusesMtx.Lock()
 	defer s.storesStatusesMtx.Unlock()
 
@@ -453,6 +649,8 @@ func (s *StoreSet) updateStoreStatus(store *storeRef, err error) {
 		status = *prev
 	}
 
+	status.StrictStatic = store.strictStatic
+	status.Health = health
 	status.LastError = err
 	status.LastCheck = time.Now()
 
@@ -495,6 +693,69 @@ func (s *StoreSet) Get() []store.Client {
 	return stores
 }
 
+// DownsamplingResolutions returns sorted resolutions in milliseconds of downsampled data of all active stores.
+func (s *StoreSet) DownsamplingResolutions() []int64 {
+	var res []int64
+	for _, st := range s.Get() {
+		for _, r := range st.Resolutions() {
+			if r <= 0 {
+				continue
+			}
+			i := sort.Search(len(res), func(i int) bool { return res[i] >= r })
+			if i < len(res) && res[i] == r {
+				continue
+			}
+			res = append(res[:i], append([]int64{r}, res[i:]...)...)
+		}
+	}
+	return res
+}
+
+// GetMetadataClients returns a list of all active stores serving metric metadata.
+func (s *StoreSet) GetMetadataClients() []metadata.Client {
+	s.storesMtx.RLock()
+	defer s.storesMtx.RUnlock()
+
+	clients := make([]metadata.Client, 0, len(s.stores))
+	for _, st := range s.stores {
+		if !st.HasMetadataAPI() {
+			continue
+		}
+		clients = append(clients, st)
+	}
+	return clients
+}
+
+// GetTargetsClients returns a list of all active stores serving scrape targets.
+func (s *StoreSet) GetTargetsClients() []targets.Client {
+	s.storesMtx.RLock()
+	defer s.storesMtx.RUnlock()
+
+	clients := make([]targets.Client, 0, len(s.stores))
+	for _, st := range s.stores {
+		if !st.HasTargetsAPI() {
+			continue
+		}
+		clients = append(clients, st)
+	}
+	return clients
+}
+
+// GetQueryClients returns a list of all active stores able to evaluate PromQL queries.
+func (s *StoreSet) GetQueryClients() []QueryClient {
+	s.storesMtx.RLock()
+	defer s.storesMtx.RUnlock()
+
+	clients := make([]QueryClient, 0, len(s.stores))
+	for _, st := range s.stores {
+		if !st.HasQueryAPI() {
+			continue
+		}
+		clients = append(clients, st)
+	}
+	return clients
+}
+
 func (s *StoreSet) Close() {
 	s.storesMtx.Lock()
 	defer s.storesMtx.Unlock()
@@ -48,8 +48,9 @@ func (s *testStore) LabelValues(ctx context.Context, r *storepb.LabelValuesReque
 }
 
 type testStoreMeta struct {
-	extlsetFn func(addr string) []storepb.LabelSet
-	storeType component.StoreAPI
+	extlsetFn   func(addr string) []storepb.LabelSet
+	storeType   component.StoreAPI
+	resolutions []int64
 }
 
 type testStores struct {
@@ -74,7 +75,8 @@ func startTestStores(storeMetas []testStoreMeta) (*testStores, error) {
 
 		storeSrv := &testStore{
 			info: storepb.InfoResponse{
-				LabelSets: meta.extlsetFn(listener.Addr().String()),
+				LabelSets:   meta.extlsetFn(listener.Addr().String()),
+				Resolutions: meta.resolutions,
 			},
 		}
 		if meta.storeType != nil {
@@ -178,7 +180,7 @@ func TestStoreSet_Update(t *testing.T) {
 	discoveredStoreAddr = append(discoveredStoreAddr, discoveredStoreAddr[0])
 	storeSet := NewStoreSet(nil, nil, func() (specs []StoreSpec) {
 		for _, addr := range discoveredStoreAddr {
-			specs = append(specs, NewGRPCStoreSpec(addr))
+			specs = append(specs, NewGRPCStoreSpec(addr, false))
 		}
 		return specs
 	}, testGRPCOpts, time.Minute)
@@ -520,7 +522,7 @@ func TestStoreSet_Update_NoneAvailable(t *testing.T) {
 
 	storeSet := NewStoreSet(nil, nil, func() (specs []StoreSpec) {
 		for _, addr := range initialStoreAddr {
-			specs = append(specs, NewGRPCStoreSpec(addr))
+			specs = append(specs, NewGRPCStoreSpec(addr, false))
 		}
 		return specs
 	}, testGRPCOpts, time.Minute)
@@ -536,3 +538,138 @@ func TestStoreSet_Update_NoneAvailable(t *testing.T) {
 	expected := newStoreAPIStats()
 	testutil.Equals(t, expected, storeSet.storesMetric.storeNodes)
 }
+
+func TestStoreSet_Update_StrictStatic(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	extlsetFn := func(addr string) []storepb.LabelSet {
+		return []storepb.LabelSet{{Labels: []storepb.Label{{Name: "addr", Value: addr}}}}
+	}
+	st, err := startTestStores([]testStoreMeta{
+		{extlsetFn: extlsetFn, storeType: component.Store},
+		{extlsetFn: extlsetFn, storeType: component.Store},
+		{extlsetFn: extlsetFn, storeType: component.Store},
+	})
+	testutil.Ok(t, err)
+	defer st.Close()
+
+	addrs := st.StoreAddresses()
+	healthyAddr, strictAddr, downAddr := addrs[0], addrs[1], addrs[2]
+	st.CloseOne(strictAddr)
+	st.CloseOne(downAddr)
+
+	storeSet := NewStoreSet(nil, nil, func() []StoreSpec {
+		return []StoreSpec{
+			NewGRPCStoreSpec(healthyAddr, false),
+			NewGRPCStoreSpec(strictAddr, true),
+			NewGRPCStoreSpec(downAddr, false),
+		}
+	}, testGRPCOpts, time.Minute)
+	storeSet.gRPCInfoCallTimeout = 2 * time.Second
+	defer storeSet.Close()
+
+	storeSet.Update(context.Background())
+
+	// Strict store is kept, even though it is not reachable.
+	testutil.Equals(t, 2, len(storeSet.Get()))
+	strict, ok := storeSet.stores[strictAddr]
+	testutil.Assert(t, ok, "expected strict store to be in the store set")
+
+	// It has to match all queries, so its failure is reported.
+	mint, maxt := strict.TimeRange()
+	testutil.Equals(t, int64(math.MinInt64), mint)
+	testutil.Equals(t, int64(math.MaxInt64), maxt)
+	testutil.Equals(t, 0, len(strict.LabelSets()))
+
+	health := map[string]StoreHealth{}
+	for _, status := range storeSet.GetStoreStatus() {
+		health[status.Name] = status.Health
+		testutil.Equals(t, status.Name == strictAddr, status.StrictStatic)
+	}
+	testutil.Equals(t, map[string]StoreHealth{
+		healthyAddr: StoreHealthy,
+		strictAddr:  StoreDegraded,
+		downAddr:    StoreDown,
+	}, health)
+
+	// Previously healthy non-strict store is removed once it is not reachable.
+	st.CloseOne(healthyAddr)
+	storeSet.Update(context.Background())
+
+	testutil.Equals(t, 1, len(storeSet.Get()))
+	for _, status := range storeSet.GetStoreStatus() {
+		if status.Name == healthyAddr {
+			testutil.Equals(t, StoreDown, status.Health)
+		}
+	}
+}
+
+func TestStoreSet_DownsamplingResolutions(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	extlsetFn := func(addr string) []storepb.LabelSet {
+		return []storepb.LabelSet{{Labels: []storepb.Label{{Name: "addr", Value: addr}}}}
+	}
+	st, err := startTestStores([]testStoreMeta{
+		{extlsetFn: extlsetFn, storeType: component.Store, resolutions: []int64{0, 300000, 3600000}},
+		{extlsetFn: extlsetFn, storeType: component.Store, resolutions: []int64{60000, 300000}},
+		{extlsetFn: extlsetFn, storeType: component.Sidecar},
+	})
+	testutil.Ok(t, err)
+	defer st.Close()
+
+	storeSet := NewStoreSet(nil, nil, func() (specs []StoreSpec) {
+		for _, addr := range st.StoreAddresses() {
+			specs = append(specs, NewGRPCStoreSpec(addr, false))
+		}
+		return specs
+	}, testGRPCOpts, time.Minute)
+	storeSet.gRPCInfoCallTimeout = 2 * time.Second
+	defer storeSet.Close()
+
+	testutil.Equals(t, []int64(nil), storeSet.DownsamplingResolutions())
+
+	storeSet.Update(context.Background())
+	testutil.Equals(t, 3, len(storeSet.Get()))
+	testutil.Equals(t, []int64{60000, 300000, 3600000}, storeSet.DownsamplingResolutions())
+}
+
+func TestStoreSet_Update_StrictStaticDialFailure(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	st, err := startTestStores([]testStoreMeta{
+		{
+			extlsetFn: func(addr string) []storepb.LabelSet {
+				return []storepb.LabelSet{{Labels: []storepb.Label{{Name: "addr", Value: addr}}}}
+			},
+			storeType: component.Store,
+		},
+	})
+	testutil.Ok(t, err)
+	defer st.Close()
+
+	strictAddr := st.StoreAddresses()[0]
+
+	// No transport security is set, so dialing fails.
+	storeSet := NewStoreSet(nil, nil, func() []StoreSpec {
+		return []StoreSpec{NewGRPCStoreSpec(strictAddr, true)}
+	}, nil, time.Minute)
+	storeSet.gRPCInfoCallTimeout = 2 * time.Second
+	defer storeSet.Close()
+
+	storeSet.Update(context.Background())
+
+	// Strict store is kept, so its failure is reported for queries.
+	testutil.Equals(t, 1, len(storeSet.Get()))
+	_, err = storeSet.Get()[0].Series(context.Background(), &storepb.SeriesRequest{})
+	testutil.NotOk(t, err)
+	testutil.Equals(t, StoreDegraded, storeSet.GetStoreStatus()[0].Health)
+
+	// Dialing is retried on next update.
+	storeSet.dialOpts = testGRPCOpts
+	storeSet.Update(context.Background())
+
+	testutil.Equals(t, 1, len(storeSet.Get()))
+	testutil.Equals(t, "{addr=\""+strictAddr+"\"}", storeSet.stores[strictAddr].LabelSetsString())
+	testutil.Equals(t, StoreHealthy, storeSet.GetStoreStatus()[0].Health)
+}
@@ -42,6 +42,7 @@ var conflictErr = errors.New("conflict")
 // Options for the web Handler.
 type Options struct {
 	Writer            *Writer
+	Metadata          *Metadata
 	ListenAddress     string
 	Registry          prometheus.Registerer
 	Endpoint          string
@@ -237,6 +238,13 @@ func (h *Handler) receive(w http.ResponseWriter, r *http.Request) {
 
 	tenant := r.Header.Get(h.options.TenantHeader)
 
+	if h.options.Metadata != nil {
+		// Metadata is best effort, do not fail the write because of it.
+		if err := h.options.Metadata.Update(tenant, &wreq); err != nil {
+			level.Warn(h.logger).Log("msg", "failed to record metric metadata", "err", err)
+		}
+	}
+
 	// Forward any time series as necessary. All time series
 	// destined for the local node will be written to the receiver.
 	// Time series will be replicated as necessary.
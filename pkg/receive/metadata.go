@@ -0,0 +1,105 @@
+package receive
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/thanos-io/thanos/pkg/metadata/metadatapb"
+)
+
+// DefaultMetadataLimit is the default maximum number of metrics metadata is kept for per tenant.
+const DefaultMetadataLimit = 10000
+
+// Metadata keeps metric metadata sent by Prometheus servers along with remote write requests
+// and implements metadatapb.MetadataServer on top of it. Metadata is kept per tenant and the number
+// of metrics per tenant is capped, so a single tenant cannot grow it without bounds or evict metadata of others.
+type Metadata struct {
+	limit int
+
+	mtx      sync.RWMutex
+	metadata map[string]map[string]metadatapb.Meta
+
+	dropped *prometheus.CounterVec
+}
+
+// NewMetadata returns empty receive.Metadata keeping metadata of at most limit metrics per tenant.
+// Non-positive limit means no limit.
+func NewMetadata(reg prometheus.Registerer, limit int) *Metadata {
+	m := &Metadata{
+		limit:    limit,
+		metadata: map[string]map[string]metadatapb.Meta{},
+		dropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "thanos_receive_metadata_dropped_total",
+			Help: "The number of metric metadata entries dropped because the tenant reached the metadata limit.",
+		}, []string{"tenant"}),
+	}
+	if reg != nil {
+		reg.MustRegister(m.dropped)
+	}
+	return m
+}
+
+// Update records metric metadata of the given write request of the tenant, if any. The metadata field is not
+// known to the vendored prompb.WriteRequest, so it is decoded from the unrecognized fields.
+// Latest metadata wins for every metric. Metadata of new metrics is dropped once the tenant reached the limit.
+func (m *Metadata) Update(tenant string, wreq *prompb.WriteRequest) error {
+	if len(wreq.XXX_unrecognized) == 0 {
+		return nil
+	}
+
+	var rwm metadatapb.RemoteWriteMetadata
+	if err := proto.Unmarshal(wreq.XXX_unrecognized, &rwm); err != nil {
+		return errors.Wrap(err, "unmarshal remote write metadata")
+	}
+	if len(rwm.Metadata) == 0 {
+		return nil
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	tmd, ok := m.metadata[tenant]
+	if !ok {
+		tmd = map[string]metadatapb.Meta{}
+		m.metadata[tenant] = tmd
+	}
+
+	dropped := 0
+	for _, md := range rwm.Metadata {
+		if _, ok := tmd[md.MetricFamilyName]; !ok && m.limit > 0 && len(tmd) >= m.limit {
+			dropped++
+			continue
+		}
+		tmd[md.MetricFamilyName] = metadatapb.Meta{
+			Type: strings.ToLower(md.Type.String()),
+			Help: md.Help,
+			Unit: md.Unit,
+		}
+	}
+	if dropped > 0 {
+		m.dropped.WithLabelValues(tenant).Add(float64(dropped))
+	}
+	return nil
+}
+
+// Metadata returns metadata of all metrics received so far from all tenants, optionally filtered by metric name.
+func (m *Metadata) Metadata(_ context.Context, r *metadatapb.MetadataRequest) (*metadatapb.MetadataResponse, error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	md := map[string][]metadatapb.Meta{}
+	for _, tmd := range m.metadata {
+		for metric, meta := range tmd {
+			if r.Metric != "" && r.Metric != metric {
+				continue
+			}
+			md[metric] = append(md[metric], meta)
+		}
+	}
+	return &metadatapb.MetadataResponse{Metadata: metadatapb.FromMap(md, int(r.Limit))}, nil
+}
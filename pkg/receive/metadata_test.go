@@ -0,0 +1,81 @@
+package receive
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/thanos-io/thanos/pkg/metadata/metadatapb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+func TestMetadata(t *testing.T) {
+	newWriteRequest := func(t *testing.T, mds ...metadatapb.RemoteWriteMetricMetadata) *prompb.WriteRequest {
+		b, err := proto.Marshal(&metadatapb.RemoteWriteMetadata{Metadata: mds})
+		testutil.Ok(t, err)
+
+		var wreq prompb.WriteRequest
+		testutil.Ok(t, proto.Unmarshal(b, &wreq))
+		return &wreq
+	}
+
+	m := NewMetadata(nil, 0)
+	testutil.Ok(t, m.Update("", &prompb.WriteRequest{}))
+	testutil.Ok(t, m.Update("", newWriteRequest(t,
+		metadatapb.RemoteWriteMetricMetadata{MetricFamilyName: "up", Type: metadatapb.RemoteWriteMetricMetadata_GAUGE, Help: "old"},
+		metadatapb.RemoteWriteMetricMetadata{MetricFamilyName: "http_requests_total", Type: metadatapb.RemoteWriteMetricMetadata_COUNTER, Help: "Total requests."},
+	)))
+	testutil.Ok(t, m.Update("", newWriteRequest(t,
+		metadatapb.RemoteWriteMetricMetadata{MetricFamilyName: "up", Type: metadatapb.RemoteWriteMetricMetadata_GAUGE, Help: "Target is up."},
+	)))
+
+	resp, err := m.Metadata(context.Background(), &metadatapb.MetadataRequest{})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []metadatapb.MetricMetadata{
+		{Metric: "http_requests_total", Metas: []metadatapb.Meta{{Type: "counter", Help: "Total requests."}}},
+		{Metric: "up", Metas: []metadatapb.Meta{{Type: "gauge", Help: "Target is up."}}},
+	}, resp.Metadata)
+
+	resp, err = m.Metadata(context.Background(), &metadatapb.MetadataRequest{Metric: "up"})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []metadatapb.MetricMetadata{
+		{Metric: "up", Metas: []metadatapb.Meta{{Type: "gauge", Help: "Target is up."}}},
+	}, resp.Metadata)
+
+	resp, err = m.Metadata(context.Background(), &metadatapb.MetadataRequest{Limit: 1})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(resp.Metadata))
+}
+
+func TestMetadata_TenantLimit(t *testing.T) {
+	newWriteRequest := func(t *testing.T, metrics ...string) *prompb.WriteRequest {
+		var mds []metadatapb.RemoteWriteMetricMetadata
+		for _, m := range metrics {
+			mds = append(mds, metadatapb.RemoteWriteMetricMetadata{MetricFamilyName: m, Type: metadatapb.RemoteWriteMetricMetadata_GAUGE, Help: m})
+		}
+		b, err := proto.Marshal(&metadatapb.RemoteWriteMetadata{Metadata: mds})
+		testutil.Ok(t, err)
+
+		var wreq prompb.WriteRequest
+		testutil.Ok(t, proto.Unmarshal(b, &wreq))
+		return &wreq
+	}
+
+	m := NewMetadata(nil, 2)
+	testutil.Ok(t, m.Update("a", newWriteRequest(t, "up", "a_1", "a_2")))
+	// Known metrics are still updated once the limit is reached.
+	testutil.Ok(t, m.Update("a", newWriteRequest(t, "a_1")))
+	// Other tenants are not affected by the limit of tenant a.
+	testutil.Ok(t, m.Update("b", newWriteRequest(t, "b_1", "up")))
+
+	resp, err := m.Metadata(context.Background(), &metadatapb.MetadataRequest{})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []metadatapb.MetricMetadata{
+		{Metric: "a_1", Metas: []metadatapb.Meta{{Type: "gauge", Help: "a_1"}}},
+		{Metric: "b_1", Metas: []metadatapb.Meta{{Type: "gauge", Help: "b_1"}}},
+		{Metric: "up", Metas: []metadatapb.Meta{{Type: "gauge", Help: "up"}}},
+	}, resp.Metadata)
+	testutil.Equals(t, 1.0, promtest.ToFloat64(m.dropped.WithLabelValues("a")))
+}
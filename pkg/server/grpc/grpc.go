@@ -15,6 +15,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/thanos-io/thanos/pkg/component"
+	"github.com/thanos-io/thanos/pkg/extgrpc"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/tracing"
 	"google.golang.org/grpc"
@@ -59,6 +60,7 @@ func New(logger log.Logger, reg prometheus.Registerer, tracer opentracing.Tracer
 
 	grpcOpts := []grpc.ServerOption{
 		grpc.MaxSendMsgSize(math.MaxInt32),
+		grpc.StatsHandler(extgrpc.NewServerPayloadMetrics(reg)),
 		grpc_middleware.WithUnaryServerChain(
 			met.UnaryServerInterceptor(),
 			tracing.UnaryServerInterceptor(tracer),
@@ -77,6 +79,9 @@ func New(logger log.Logger, reg prometheus.Registerer, tracer opentracing.Tracer
 	s := grpc.NewServer(grpcOpts...)
 
 	storepb.RegisterStoreServer(s, storeSrv)
+	for _, f := range options.registerServerFuncs {
+		f(s)
+	}
 	met.InitializeMetrics(s)
 
 	return &Server{
@@ -3,6 +3,8 @@ package grpc
 import (
 	"crypto/tls"
 	"time"
+
+	"google.golang.org/grpc"
 )
 
 type options struct {
@@ -10,8 +12,12 @@ type options struct {
 	listen      string
 
 	tlsConfig *tls.Config
+
+	registerServerFuncs []registerServerFunc
 }
 
+type registerServerFunc func(s *grpc.Server)
+
 // Option overrides behavior of Server.
 type Option interface {
 	apply(*options)
@@ -45,3 +51,11 @@ func WithTLSConfig(cfg *tls.Config) Option {
 		o.tlsConfig = cfg
 	})
 }
+
+// WithServer calls the passed gRPC server registration function on the gRPC server, allowing to serve
+// additional gRPC services next to the StoreAPI.
+func WithServer(f registerServerFunc) Option {
+	return optionFunc(func(o *options) {
+		o.registerServerFuncs = append(o.registerServerFuncs, f)
+	})
+}
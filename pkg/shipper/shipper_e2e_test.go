@@ -116,8 +116,13 @@ func TestShipper_SyncBlocks_e2e(t *testing.T) {
 				testutil.Equals(t, 0, b)
 			}
 
-			// The external labels must be attached to the meta file on upload.
+			// The external labels and sizes of block files must be attached to the meta file on upload.
 			meta.Thanos.Labels = extLset.Map()
+			meta.Thanos.Files = []metadata.File{
+				{RelPath: "chunks/0001", SizeBytes: 14},
+				{RelPath: "chunks/0002", SizeBytes: 14},
+				{RelPath: "index", SizeBytes: 13},
+			}
 
 			var buf bytes.Buffer
 			enc := json.NewEncoder(&buf)
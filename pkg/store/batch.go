@@ -0,0 +1,51 @@
+package store
+
+import (
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+// batchSeriesServer wraps storepb.Store_SeriesServer sending series in batches of up to the requested number of
+// series per response. Warnings are sent right away, after any pending series. Flush must be called once all
+// series were sent, to send the last batch.
+type batchSeriesServer struct {
+	storepb.Store_SeriesServer
+
+	size   int
+	series []storepb.Series
+}
+
+// newBatchSeriesServer returns batchSeriesServer sending up to size series per response. Size below or equal to one
+// disables batching, in which case every series is sent in its own response.
+func newBatchSeriesServer(srv storepb.Store_SeriesServer, size int64) *batchSeriesServer {
+	return &batchSeriesServer{Store_SeriesServer: srv, size: int(size)}
+}
+
+func (s *batchSeriesServer) Send(r *storepb.SeriesResponse) error {
+	series := r.GetSeries()
+	if series == nil || s.size <= 1 {
+		if err := s.Flush(); err != nil {
+			return err
+		}
+		return s.Store_SeriesServer.Send(r)
+	}
+
+	if s.series == nil {
+		s.series = make([]storepb.Series, 0, s.size)
+	}
+	s.series = append(s.series, *series)
+	if len(s.series) < s.size {
+		return nil
+	}
+	return s.Flush()
+}
+
+// Flush sends all pending series.
+func (s *batchSeriesServer) Flush() error {
+	if len(s.series) == 0 {
+		return nil
+	}
+	// Batch is not reused, as in-process receivers may keep the series.
+	batch := s.series
+	s.series = nil
+	return s.Store_SeriesServer.Send(storepb.NewSeriesBatchResponse(batch))
+}
@@ -225,6 +225,7 @@ type BucketStore struct {
 
 	filterConfig             *FilterConfig
 	advLabelSets             []storepb.LabelSet
+	advResolutions           []int64
 	enableCompatibilityLabel bool
 }
 
@@ -374,6 +375,22 @@ func (s *BucketStore) SyncBlocks(ctx context.Context) error {
 	sort.Slice(s.advLabelSets, func(i, j int) bool {
 		return strings.Compare(s.advLabelSets[i].String(), s.advLabelSets[j].String()) < 0
 	})
+
+	// Sync advertised resolutions, so that queriers know which resolutions of downsampled data are available.
+	// A new slice is allocated as the previous one may still be referenced by Info responses.
+	var resolutions []int64
+	for _, bs := range s.blockSets {
+		bs.mtx.RLock()
+		for i, r := range bs.resolutions {
+			// Resolutions are kept when their last block is removed.
+			if len(bs.blocks[i]) > 0 && int64index(resolutions, r) < 0 {
+				resolutions = append(resolutions, r)
+			}
+		}
+		bs.mtx.RUnlock()
+	}
+	sort.Slice(resolutions, func(i, j int) bool { return resolutions[i] < resolutions[j] })
+	s.advResolutions = resolutions
 	s.mtx.Unlock()
 
 	return nil
@@ -535,6 +552,7 @@ func (s *BucketStore) Info(context.Context, *storepb.InfoRequest) (*storepb.Info
 	s.mtx.RLock()
 	// Should we clone?
 	res.LabelSets = s.advLabelSets
+	res.Resolutions = s.advResolutions
 	s.mtx.RUnlock()
 
 	if s.enableCompatibilityLabel && len(res.LabelSets) > 0 {
@@ -608,6 +626,7 @@ func blockSeries(
 	chunkr *bucketChunkReader,
 	matchers []*labels.Matcher,
 	req *storepb.SeriesRequest,
+	ranges []bucketBlockRange,
 	samplesLimiter *Limiter,
 ) (storepb.SeriesSet, *queryStats, error) {
 	ps, err := indexr.ExpandedPostings(matchers)
@@ -670,6 +689,15 @@ func blockSeries(
 			if meta.MinTime > req.MaxTime {
 				break
 			}
+			if !chunkInRanges(ranges, meta.MinTime, meta.MaxTime) {
+				continue
+			}
+
+			if req.SkipChunks {
+				// Chunks are not needed, it is enough to know that the series has data within the requested time range.
+				s.chks = append(s.chks, storepb.AggrChunk{})
+				break
+			}
 
 			if err := chunkr.addPreload(meta.Ref); err != nil {
 				return nil, nil, errors.Wrap(err, "add chunk preload")
@@ -680,9 +708,17 @@ func blockSeries(
 			})
 			s.refs = append(s.refs, meta.Ref)
 		}
-		if len(s.chks) > 0 {
-			res = append(res, s)
+		if len(s.chks) == 0 {
+			continue
+		}
+		if req.SkipChunks {
+			s.chks = nil
 		}
+		res = append(res, s)
+	}
+
+	if req.SkipChunks {
+		return newBucketSeriesSet(res), indexr.stats, nil
 	}
 
 	// Preload all chunks that were marked in the previous stage.
@@ -749,6 +785,25 @@ func populateChunk(out *storepb.AggrChunk, in chunkenc.Chunk, aggrs []storepb.Ag
 				return errors.Errorf("aggregate %s does not exist", downsample.AggrCounter)
 			}
 			out.Counter = &storepb.Chunk{Type: storepb.Chunk_XOR, Data: x.Bytes()}
+		case storepb.Aggr_LAST:
+			// Optional aggregates are skipped if the block was not downsampled with them.
+			x, err := ac.Get(downsample.AggrLast)
+			if err == downsample.ErrAggrNotExist {
+				continue
+			}
+			if err != nil {
+				return errors.Wrapf(err, "get aggregate %s", downsample.AggrLast)
+			}
+			out.Last = &storepb.Chunk{Type: storepb.Chunk_XOR, Data: x.Bytes()}
+		case storepb.Aggr_QUANTILES:
+			x, err := ac.Get(downsample.AggrQuantiles)
+			if err == downsample.ErrAggrNotExist {
+				continue
+			}
+			if err != nil {
+				return errors.Wrapf(err, "get aggregate %s", downsample.AggrQuantiles)
+			}
+			out.Quantiles = &storepb.Chunk{Type: storepb.Chunk_XOR, Data: x.Bytes()}
 		}
 	}
 	return nil
@@ -809,10 +864,11 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 	req.MaxTime = s.limitMaxTime(req.MaxTime)
 
 	var (
-		stats  = &queryStats{}
-		res    []storepb.SeriesSet
-		mtx    sync.Mutex
-		g, ctx = errgroup.WithContext(srv.Context())
+		stats    = &queryStats{}
+		res      []storepb.SeriesSet
+		warnings []string
+		mtx      sync.Mutex
+		g, ctx   = errgroup.WithContext(srv.Context())
 	)
 
 	s.mtx.RLock()
@@ -822,19 +878,36 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 		if !ok {
 			continue
 		}
-		blocks := bs.getFor(req.MinTime, req.MaxTime, req.MaxResolutionWindow)
+		// Requested time range is inclusive, while ranges of blocks are half-open.
+		maxt := req.MaxTime
+		if maxt < math.MaxInt64 {
+			maxt++
+		}
+		ranges := bs.getRangesFor(req.MinTime, maxt, req.MaxResolutionWindow)
+		if w := resolutionsWarning(bs.labels, ranges); w != "" {
+			warnings = append(warnings, w)
+		}
+		blockRanges := groupRangesByBlock(ranges)
 
 		mtx.Lock()
-		stats.blocksQueried += len(blocks)
+		stats.blocksQueried += len(blockRanges)
 		mtx.Unlock()
 
 		if s.debugLogging {
+			blocks := make([]*bucketBlock, 0, len(blockRanges))
+			for _, rs := range blockRanges {
+				blocks = append(blocks, rs[0].block)
+			}
 			debugFoundBlockSetOverview(s.logger, req.MinTime, req.MaxTime, req.MaxResolutionWindow, bs.labels, blocks)
 		}
 
-		for _, b := range blocks {
+		for _, rs := range blockRanges {
+			b, rs := rs[0].block, rs
 
-			b := b
+			// Fetch only chunks of the parts of the requested range the block is used for, so that blocks of different
+			// resolutions are not mixed. Block split by blocks of other resolutions is still queried only once.
+			blockReq := *req
+			blockReq.MinTime, blockReq.MaxTime = rs[0].mint, rs[len(rs)-1].maxt-1
 
 			// We must keep the readers open until all their data has been sent.
 			indexr := b.indexReader(ctx)
@@ -851,7 +924,8 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 					indexr,
 					chunkr,
 					blockMatchers,
-					req,
+					&blockReq,
+					rs,
 					s.samplesLimiter,
 				)
 				if err != nil {
@@ -914,6 +988,12 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 		// Chunks of returned series might be out of order w.r.t to their time range.
 		// This must be accounted for later by clients.
 		set := storepb.MergeSeriesSets(res...)
+		bsrv := newBatchSeriesServer(srv, req.ResponseBatchSize)
+		for _, w := range warnings {
+			if err := bsrv.Send(storepb.NewWarnSeriesResponse(errors.New(w))); err != nil {
+				return status.Error(codes.Unknown, errors.Wrap(err, "send warning response").Error())
+			}
+		}
 		for set.Next() {
 			var series storepb.Series
 
@@ -928,13 +1008,17 @@ func (s *BucketStore) Series(req *storepb.SeriesRequest, srv storepb.Store_Serie
 				s.metrics.chunkSizeBytes.Observe(float64(chunksSize(series.Chunks)))
 			}
 
-			if err := srv.Send(storepb.NewSeriesResponse(&series)); err != nil {
+			if err := bsrv.Send(storepb.NewSeriesResponse(&series)); err != nil {
 				return status.Error(codes.Unknown, errors.Wrap(err, "send series response").Error())
 			}
 		}
 		if set.Err() != nil {
 			return status.Error(codes.Unknown, errors.Wrap(set.Err(), "expand series set").Error())
 		}
+		// Flush before returning, as chunks of pending series are released once all readers are closed.
+		if err := bsrv.Flush(); err != nil {
+			return status.Error(codes.Unknown, errors.Wrap(err, "send series response").Error())
+		}
 		stats.mergeDuration = time.Since(begin)
 		s.metrics.seriesMergeDuration.Observe(stats.mergeDuration.Seconds())
 	}
@@ -949,7 +1033,26 @@ func chunksSize(chks []storepb.AggrChunk) (size int) {
 }
 
 // LabelNames implements the storepb.StoreServer interface.
-func (s *BucketStore) LabelNames(ctx context.Context, _ *storepb.LabelNamesRequest) (*storepb.LabelNamesResponse, error) {
+func (s *BucketStore) LabelNames(ctx context.Context, req *storepb.LabelNamesRequest) (*storepb.LabelNamesResponse, error) {
+	if len(req.Matchers) > 0 {
+		mint, maxt := req.TimeRange()
+		lsets, err := s.matchingSeriesLabels(ctx, req.Matchers, mint, maxt)
+		if err != nil {
+			return nil, err
+		}
+
+		names := map[string]struct{}{}
+		for _, lset := range lsets {
+			for _, l := range lset {
+				names[l.Name] = struct{}{}
+			}
+		}
+		return &storepb.LabelNamesResponse{Names: sortedKeys(names)}, nil
+	}
+
+	mint, maxt := req.TimeRange()
+	mint, maxt = s.limitMinTime(mint), s.limitMaxTime(maxt)
+
 	g, gctx := errgroup.WithContext(ctx)
 
 	s.mtx.RLock()
@@ -958,6 +1061,9 @@ func (s *BucketStore) LabelNames(ctx context.Context, _ *storepb.LabelNamesReque
 	var sets [][]string
 
 	for _, b := range s.blocks {
+		if !b.overlapsClosedInterval(mint, maxt) {
+			continue
+		}
 		indexr := b.indexReader(gctx)
 		g.Go(func() error {
 			defer runutil.CloseWithLogOnErr(s.logger, indexr, "label names")
@@ -986,6 +1092,28 @@ func (s *BucketStore) LabelNames(ctx context.Context, _ *storepb.LabelNamesReque
 
 // LabelValues implements the storepb.StoreServer interface.
 func (s *BucketStore) LabelValues(ctx context.Context, req *storepb.LabelValuesRequest) (*storepb.LabelValuesResponse, error) {
+	if len(req.Matchers) > 0 {
+		mint, maxt := req.TimeRange()
+		lsets, err := s.matchingSeriesLabels(ctx, req.Matchers, mint, maxt)
+		if err != nil {
+			return nil, err
+		}
+
+		values := map[string]struct{}{}
+		for _, lset := range lsets {
+			for _, l := range lset {
+				if l.Name == req.Label {
+					values[l.Value] = struct{}{}
+					break
+				}
+			}
+		}
+		return &storepb.LabelValuesResponse{Values: sortedKeys(values)}, nil
+	}
+
+	mint, maxt := req.TimeRange()
+	mint, maxt = s.limitMinTime(mint), s.limitMaxTime(maxt)
+
 	g, gctx := errgroup.WithContext(ctx)
 
 	s.mtx.RLock()
@@ -994,6 +1122,9 @@ func (s *BucketStore) LabelValues(ctx context.Context, req *storepb.LabelValuesR
 	var sets [][]string
 
 	for _, b := range s.blocks {
+		if !b.overlapsClosedInterval(mint, maxt) {
+			continue
+		}
 		indexr := b.indexReader(gctx)
 		g.Go(func() error {
 			defer runutil.CloseWithLogOnErr(s.logger, indexr, "label values")
@@ -1019,6 +1150,46 @@ func (s *BucketStore) LabelValues(ctx context.Context, req *storepb.LabelValuesR
 	}, nil
 }
 
+// matchingSeriesLabels returns label sets of series matching the given matchers within the given time range.
+func (s *BucketStore) matchingSeriesLabels(ctx context.Context, matchers []storepb.LabelMatcher, mint, maxt int64) ([][]storepb.Label, error) {
+	srv := &labelSetsServer{ctx: ctx}
+	if err := s.Series(&storepb.SeriesRequest{
+		MinTime:  mint,
+		MaxTime:  maxt,
+		Matchers: matchers,
+		// Series labels are the same for all resolutions, so prefer downsampled blocks as there are less of them.
+		MaxResolutionWindow: math.MaxInt64,
+		SkipChunks:          true,
+	}, srv); err != nil {
+		return nil, err
+	}
+	return srv.lsets, nil
+}
+
+// labelSetsServer is an in-process storepb.Store_SeriesServer collecting label sets of all sent series and warnings.
+type labelSetsServer struct {
+	// This field just exist to pseudo-implement the unused methods of the interface.
+	storepb.Store_SeriesServer
+	ctx context.Context
+
+	lsets    [][]storepb.Label
+	warnings []string
+}
+
+func (s *labelSetsServer) Send(r *storepb.SeriesResponse) error {
+	if series := r.GetSeries(); series != nil {
+		s.lsets = append(s.lsets, series.Labels)
+	}
+	if w := r.GetWarning(); w != "" {
+		s.warnings = append(s.warnings, w)
+	}
+	return nil
+}
+
+func (s *labelSetsServer) Context() context.Context {
+	return s.ctx
+}
+
 // bucketBlockSet holds all blocks of an equal label set. It internally splits
 // them up by downsampling resolution and allows querying.
 type bucketBlockSet struct {
@@ -1028,13 +1199,11 @@ type bucketBlockSet struct {
 	blocks      [][]*bucketBlock // Ordered buckets for the existing resolutions.
 }
 
-// newBucketBlockSet initializes a new set with the known downsampling windows hard-configured.
-// The set currently does not support arbitrary ranges.
+// newBucketBlockSet initializes a new set. Resolutions are added as blocks of them are added, so that any configured
+// downsampling resolutions are supported.
 func newBucketBlockSet(lset labels.Labels) *bucketBlockSet {
 	return &bucketBlockSet{
-		labels:      lset,
-		resolutions: []int64{downsample.ResLevel2, downsample.ResLevel1, downsample.ResLevel0},
-		blocks:      make([][]*bucketBlock, 3),
+		labels: lset,
 	}
 }
 
@@ -1045,9 +1214,16 @@ func (s *bucketBlockSet) add(b *bucketBlock) error {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 
-	i := int64index(s.resolutions, b.meta.Thanos.Downsample.Resolution)
+	res := b.meta.Thanos.Downsample.Resolution
+	if res < 0 {
+		return errors.Errorf("unsupported downsampling resolution %d", res)
+	}
+	i := int64index(s.resolutions, res)
 	if i < 0 {
-		return errors.Errorf("unsupported downsampling resolution %d", b.meta.Thanos.Downsample.Resolution)
+		// Keep resolutions ordered from the biggest to the smallest window, see getRangesFor.
+		i = sort.Search(len(s.resolutions), func(j int) bool { return s.resolutions[j] < res })
+		s.resolutions = append(s.resolutions[:i], append([]int64{res}, s.resolutions[i:]...)...)
+		s.blocks = append(s.blocks[:i], append([][]*bucketBlock{nil}, s.blocks[i:]...)...)
 	}
 	bs := append(s.blocks[i], b)
 	s.blocks[i] = bs
@@ -1085,6 +1261,51 @@ func int64index(s []int64, x int64) int {
 // getFor returns a time-ordered list of blocks that cover date between mint and maxt.
 // Blocks with the biggest resolution possible but not bigger than the given max resolution are returned.
 func (s *bucketBlockSet) getFor(mint, maxt, maxResolutionMillis int64) (bs []*bucketBlock) {
+	for _, r := range s.getRangesFor(mint, maxt, maxResolutionMillis) {
+		bs = append(bs, r.block)
+	}
+	return bs
+}
+
+// bucketBlockRange is a block together with the part of the requested time range it is used for. The part is
+// half-open, i.e. maxt is not included, same as for the time range of the block.
+type bucketBlockRange struct {
+	block      *bucketBlock
+	mint, maxt int64
+}
+
+// groupRangesByBlock returns the given ranges grouped by their blocks, in the order of the first range of each block.
+func groupRangesByBlock(rs []bucketBlockRange) [][]bucketBlockRange {
+	var (
+		res [][]bucketBlockRange
+		idx = map[*bucketBlock]int{}
+	)
+	for _, r := range rs {
+		i, ok := idx[r.block]
+		if !ok {
+			i = len(res)
+			idx[r.block] = i
+			res = append(res, nil)
+		}
+		res[i] = append(res[i], r)
+	}
+	return res
+}
+
+// chunkInRanges returns true if the chunk with the given inclusive time range overlaps with any of the given ranges.
+func chunkInRanges(rs []bucketBlockRange, mint, maxt int64) bool {
+	for _, r := range rs {
+		if mint < r.maxt && maxt >= r.mint {
+			return true
+		}
+	}
+	return false
+}
+
+// getRangesFor is like getFor, but it also returns the part of the requested half-open time range each block is used for.
+// Blocks of higher resolutions fill only the gaps not covered by blocks of the biggest resolution, so that each
+// time sub-range is served by the best resolution available for it.
+func (s *bucketBlockSet) getRangesFor(mint, maxt, maxResolutionMillis int64) (rs []bucketBlockRange) {
 	if mint == maxt {
 		return nil
 	}
@@ -1092,10 +1313,22 @@ func (s *bucketBlockSet) getFor(mint, maxt, maxResolutionMillis int64) (bs []*bu
 	s.mtx.RLock()
 	defer s.mtx.RUnlock()
 
+	return s.getRangesForLocked(mint, maxt, maxResolutionMillis)
+}
+
+func (s *bucketBlockSet) getRangesForLocked(mint, maxt, maxResolutionMillis int64) (rs []bucketBlockRange) {
+	// Gaps before blocks starting before the previous one ended are empty.
+	if mint >= maxt {
+		return nil
+	}
+
 	// Find first matching resolution.
 	i := 0
 	for ; i < len(s.resolutions) && s.resolutions[i] > maxResolutionMillis; i++ {
 	}
+	if i == len(s.resolutions) {
+		return nil
+	}
 
 	// Fill the given interval with the blocks for the current resolution.
 	// Our current resolution might not cover all data, so recursively fill the gaps with higher resolution blocks if there is any.
@@ -1109,16 +1342,48 @@ func (s *bucketBlockSet) getFor(mint, maxt, maxResolutionMillis int64) (bs []*bu
 		}
 
 		if i+1 < len(s.resolutions) {
-			bs = append(bs, s.getFor(start, b.meta.MinTime, s.resolutions[i+1])...)
+			rs = append(rs, s.getRangesForLocked(start, b.meta.MinTime, s.resolutions[i+1])...)
+		}
+		r := bucketBlockRange{block: b, mint: b.meta.MinTime, maxt: b.meta.MaxTime}
+		if r.mint < start {
+			r.mint = start
 		}
-		bs = append(bs, b)
+		if r.maxt > maxt {
+			r.maxt = maxt
+		}
+		rs = append(rs, r)
 		start = b.meta.MaxTime
 	}
 
 	if i+1 < len(s.resolutions) {
-		bs = append(bs, s.getFor(start, maxt, s.resolutions[i+1])...)
+		rs = append(rs, s.getRangesForLocked(start, maxt, s.resolutions[i+1])...)
 	}
-	return bs
+	return rs
+}
+
+// resolutionsWarning returns warning describing which resolutions were used for which time ranges, if the given ranges
+// stitch together blocks of multiple resolutions. It returns empty string otherwise.
+func resolutionsWarning(lset labels.Labels, rs []bucketBlockRange) string {
+	var (
+		parts            []string
+		currRes          = int64(-1)
+		currMin, currMax int64
+	)
+	for _, r := range rs {
+		if res := r.block.meta.Thanos.Downsample.Resolution; res != currRes {
+			if currRes != -1 {
+				parts = append(parts, fmt.Sprintf("%s for %d-%d", downsample.ResolutionString(currRes), currMin, currMax))
+			}
+			currRes, currMin = res, r.mint
+		}
+		currMax = r.maxt
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	parts = append(parts, fmt.Sprintf("%s for %d-%d", downsample.ResolutionString(currRes), currMin, currMax))
+
+	return fmt.Sprintf("data of blocks with labels %s was stitched from multiple resolutions: %s", lset, strings.Join(parts, ", "))
 }
 
 // labelMatchers verifies whether the block set matches the given matchers and returns a new
@@ -1231,6 +1496,12 @@ func (b *bucketBlock) readChunkRange(ctx context.Context, seq int, off, length i
 	return &internalBuf, nil
 }
 
+// overlapsClosedInterval returns true if the block's time range overlaps the closed interval [mint, maxt].
+// Block max time is exclusive.
+func (b *bucketBlock) overlapsClosedInterval(mint, maxt int64) bool {
+	return b.meta.MinTime <= maxt && mint < b.meta.MaxTime
+}
+
 func (b *bucketBlock) indexReader(ctx context.Context) *bucketIndexReader {
 	b.pendingReaders.Add(1)
 	return newBucketIndexReader(ctx, b.logger, b, b.indexCache)
@@ -187,6 +187,46 @@ func testBucketStore_e2e(t testing.TB, ctx context.Context, s *storeSuite) {
 	testutil.Ok(t, err)
 	testutil.Equals(t, []string{"1", "2"}, vals.Values)
 
+	// Label values and names of matching series only.
+	vals, err = s.store.LabelValues(ctx, &storepb.LabelValuesRequest{
+		Label:    "c",
+		Start:    mint,
+		End:      maxt,
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "a", Value: "1"}},
+	})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"1", "2"}, vals.Values)
+
+	vals, err = s.store.LabelValues(ctx, &storepb.LabelValuesRequest{
+		Label:    "b",
+		Start:    mint,
+		End:      maxt,
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "c", Value: "1"}},
+	})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{}, vals.Values)
+
+	names, err := s.store.LabelNames(ctx, &storepb.LabelNamesRequest{
+		Start:    mint,
+		End:      maxt,
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "b", Value: "1"}},
+	})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"a", "b", "ext1"}, names.Names)
+
+	// Only blocks overlapping the requested time range are consulted.
+	vals, err = s.store.LabelValues(ctx, &storepb.LabelValuesRequest{Label: "a", Start: maxt, End: maxt + 1000})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string(nil), vals.Values)
+
+	names, err = s.store.LabelNames(ctx, &storepb.LabelNamesRequest{Start: mint - 1000, End: mint})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"a", "b", "c"}, names.Names)
+
+	names, err = s.store.LabelNames(ctx, &storepb.LabelNamesRequest{Start: mint - 1000, End: mint - 1})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string(nil), names.Names)
+
 	// TODO(bwplotka): Add those test cases to TSDB querier_test.go as well, there are no tests for matching.
 	for i, tcase := range []struct {
 		req              *storepb.SeriesRequest
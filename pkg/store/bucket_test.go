@@ -263,6 +263,172 @@ func TestBucketBlockSet_addGet(t *testing.T) {
 	}
 }
 
+func TestBucketBlockSet_customResolutions(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	set := newBucketBlockSet(labels.Labels{})
+
+	const (
+		res1m  = int64(60 * 1000)
+		res10m = int64(10 * 60 * 1000)
+	)
+	type resBlock struct {
+		mint, maxt int64
+		window     int64
+	}
+	// Resolutions are added out of order.
+	for _, in := range []resBlock{
+		{window: res10m, mint: 0, maxt: 100},
+		{window: downsample.ResLevel0, mint: 0, maxt: 100},
+		{window: downsample.ResLevel0, mint: 100, maxt: 200},
+		{window: downsample.ResLevel0, mint: 200, maxt: 300},
+		{window: res1m, mint: 0, maxt: 200},
+	} {
+		var m metadata.Meta
+		m.Thanos.Downsample.Resolution = in.window
+		m.MinTime = in.mint
+		m.MaxTime = in.maxt
+
+		testutil.Ok(t, set.add(&bucketBlock{meta: &m}))
+	}
+	testutil.Equals(t, []int64{res10m, res1m, downsample.ResLevel0}, set.resolutions)
+
+	for _, c := range []struct {
+		maxResolution int64
+		res           []resBlock
+	}{
+		{
+			maxResolution: 0,
+			res: []resBlock{
+				{window: downsample.ResLevel0, mint: 0, maxt: 100},
+				{window: downsample.ResLevel0, mint: 100, maxt: 200},
+				{window: downsample.ResLevel0, mint: 200, maxt: 300},
+			},
+		}, {
+			maxResolution: downsample.ResLevel1,
+			res: []resBlock{
+				{window: res1m, mint: 0, maxt: 200},
+				{window: downsample.ResLevel0, mint: 200, maxt: 300},
+			},
+		}, {
+			maxResolution: downsample.ResLevel2,
+			res: []resBlock{
+				{window: res10m, mint: 0, maxt: 100},
+				{window: res1m, mint: 0, maxt: 200},
+				{window: downsample.ResLevel0, mint: 200, maxt: 300},
+			},
+		},
+	} {
+		var exp []*bucketBlock
+		for _, b := range c.res {
+			var m metadata.Meta
+			m.Thanos.Downsample.Resolution = b.window
+			m.MinTime = b.mint
+			m.MaxTime = b.maxt
+			exp = append(exp, &bucketBlock{meta: &m})
+		}
+		testutil.Equals(t, exp, set.getFor(0, 300, c.maxResolution))
+	}
+}
+
+func TestBucketBlockSet_getRangesFor(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	set := newBucketBlockSet(labels.Labels{{Name: "ext", Value: "1"}})
+
+	type resBlock struct {
+		mint, maxt int64
+		window     int64
+	}
+	input := []resBlock{
+		{window: downsample.ResLevel0, mint: 0, maxt: 100},
+		{window: downsample.ResLevel0, mint: 100, maxt: 200},
+		{window: downsample.ResLevel0, mint: 200, maxt: 300},
+		{window: downsample.ResLevel0, mint: 300, maxt: 400},
+		{window: downsample.ResLevel0, mint: 400, maxt: 500},
+		{window: downsample.ResLevel1, mint: 0, maxt: 400},
+		{window: downsample.ResLevel2, mint: 100, maxt: 300},
+	}
+	blocks := map[resBlock]*bucketBlock{}
+	for _, in := range input {
+		var m metadata.Meta
+		m.Thanos.Labels = map[string]string{"ext": "1"}
+		m.Thanos.Downsample.Resolution = in.window
+		m.MinTime = in.mint
+		m.MaxTime = in.maxt
+
+		b := &bucketBlock{meta: &m}
+		blocks[in] = b
+		testutil.Ok(t, set.add(b))
+	}
+
+	for _, c := range []struct {
+		mint, maxt    int64
+		maxResolution int64
+		exp           []bucketBlockRange
+		expWarning    string
+	}{
+		{
+			mint:          0,
+			maxt:          500,
+			maxResolution: downsample.ResLevel0,
+			exp: []bucketBlockRange{
+				{block: blocks[input[0]], mint: 0, maxt: 100},
+				{block: blocks[input[1]], mint: 100, maxt: 200},
+				{block: blocks[input[2]], mint: 200, maxt: 300},
+				{block: blocks[input[3]], mint: 300, maxt: 400},
+				{block: blocks[input[4]], mint: 400, maxt: 500},
+			},
+		},
+		{
+			// The 5m block is used only for parts not covered by the 1h block.
+			mint:          0,
+			maxt:          500,
+			maxResolution: downsample.ResLevel2,
+			exp: []bucketBlockRange{
+				{block: blocks[input[5]], mint: 0, maxt: 100},
+				{block: blocks[input[6]], mint: 100, maxt: 300},
+				{block: blocks[input[5]], mint: 300, maxt: 400},
+				{block: blocks[input[4]], mint: 400, maxt: 500},
+			},
+			expWarning: `data of blocks with labels {ext="1"} was stitched from multiple resolutions: 5m for 0-100, 1h for 100-300, 5m for 300-400, raw for 400-500`,
+		},
+		{
+			mint:          150,
+			maxt:          250,
+			maxResolution: downsample.ResLevel2,
+			exp: []bucketBlockRange{
+				{block: blocks[input[6]], mint: 150, maxt: 250},
+			},
+		},
+	} {
+		t.Run("", func(t *testing.T) {
+			res := set.getRangesFor(c.mint, c.maxt, c.maxResolution)
+			testutil.Equals(t, c.exp, res)
+			testutil.Equals(t, c.expWarning, resolutionsWarning(set.labels, res))
+		})
+	}
+}
+
+func TestGroupRangesByBlock(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	a, b := &bucketBlock{meta: &metadata.Meta{}}, &bucketBlock{meta: &metadata.Meta{}}
+	rs := []bucketBlockRange{
+		{block: a, mint: 0, maxt: 100},
+		{block: b, mint: 100, maxt: 300},
+		{block: a, mint: 300, maxt: 400},
+	}
+	groups := groupRangesByBlock(rs)
+	testutil.Equals(t, [][]bucketBlockRange{{rs[0], rs[2]}, {rs[1]}}, groups)
+
+	// Ranges are half-open, so chunks starting at their end are not included.
+	testutil.Assert(t, chunkInRanges(groups[0], 50, 99), "expected chunk within the first range")
+	testutil.Assert(t, chunkInRanges(groups[0], 250, 350), "expected chunk overlapping the second range")
+	testutil.Assert(t, !chunkInRanges(groups[0], 100, 299), "expected chunk between ranges not to be included")
+	testutil.Assert(t, !chunkInRanges(groups[0], 400, 450), "expected chunk starting at the end of the range not to be included")
+}
+
 func TestBucketBlockSet_remove(t *testing.T) {
 	defer leaktest.CheckTimeout(t, 10*time.Second)()
 
@@ -458,6 +624,7 @@ func TestBucketStore_Info(t *testing.T) {
 	testutil.Equals(t, int64(math.MinInt64), resp.MaxTime)
 	testutil.Equals(t, []storepb.LabelSet(nil), resp.LabelSets)
 	testutil.Equals(t, []storepb.Label(nil), resp.Labels)
+	testutil.Equals(t, []int64(nil), resp.Resolutions)
 }
 
 type recorder struct {
@@ -709,6 +876,11 @@ func testSharding(t *testing.T, reuseDisk string, bkt objstore.Bucket, all ...ul
 			testutil.Equals(t, storepb.StoreType_STORE, resp.StoreType)
 			testutil.Equals(t, []storepb.Label(nil), resp.Labels)
 			testutil.Equals(t, sc.expectedAdvLabels, resp.LabelSets)
+			if len(sc.expectedIDs) > 0 {
+				testutil.Equals(t, []int64{0}, resp.Resolutions)
+			} else {
+				testutil.Equals(t, []int64(nil), resp.Resolutions)
+			}
 
 			// Make sure we don't download files we did not expect to.
 			// Regression test: https://github.com/thanos-io/thanos/issues/1664
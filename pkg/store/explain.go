@@ -0,0 +1,173 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/tenancy"
+)
+
+type explanationKey struct{}
+
+// Explanation records how ProxyStore selected stores for Series requests and what the queried stores returned.
+// It is safe for concurrent use.
+type Explanation struct {
+	mtx    sync.Mutex
+	series []*SeriesExplanation
+}
+
+// SeriesExplanation describes a single Series request, i.e. a single selector of the query.
+type SeriesExplanation struct {
+	Matchers            string              `json:"matchers"`
+	MinTime             int64               `json:"minTime"`
+	MaxTime             int64               `json:"maxTime"`
+	MaxResolutionWindow int64               `json:"maxResolutionWindow"`
+	Aggregates          []string            `json:"aggregates"`
+	Stores              []*StoreExplanation `json:"stores"`
+
+	// tenant restricts recorded stores to the ones the tenant of the request is allowed to see.
+	tenant *tenancy.Tenant
+}
+
+// StoreExplanation describes whether a store was queried for series, and if so, what it returned.
+type StoreExplanation struct {
+	Name      string   `json:"name"`
+	LabelSets []string `json:"labelSets"`
+	MinTime   int64    `json:"minTime"`
+	MaxTime   int64    `json:"maxTime"`
+	Queried   bool     `json:"queried"`
+	// Reason why the store was not queried.
+	Reason string `json:"reason,omitempty"`
+
+	Series          int     `json:"series"`
+	Chunks          int     `json:"chunks"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	Error           string  `json:"error,omitempty"`
+
+	begin time.Time
+}
+
+// ContextWithExplanation returns a context which makes ProxyStore record the store selection of all Series requests
+// into the given Explanation.
+func ContextWithExplanation(ctx context.Context, e *Explanation) context.Context {
+	return context.WithValue(ctx, explanationKey{}, e)
+}
+
+// ExplanationFromContext returns Explanation of the context, or nil if there is none.
+func ExplanationFromContext(ctx context.Context) *Explanation {
+	e, _ := ctx.Value(explanationKey{}).(*Explanation)
+	return e
+}
+
+// Series returns explanations of all recorded Series requests. They must not be accessed before the requests
+// are finished.
+func (e *Explanation) Series() []*SeriesExplanation {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	return e.series
+}
+
+// add records the given Series request. If the tenant is not nil, only stores visible to it are recorded.
+func (e *Explanation) add(r *storepb.SeriesRequest, tenant *tenancy.Tenant) *SeriesExplanation {
+	if e == nil {
+		return nil
+	}
+
+	matchers, _ := matchersToString(r.Matchers)
+	s := &SeriesExplanation{
+		Matchers:            matchers,
+		MinTime:             r.MinTime,
+		MaxTime:             r.MaxTime,
+		MaxResolutionWindow: r.MaxResolutionWindow,
+		Aggregates:          make([]string, 0, len(r.Aggregates)),
+		Stores:              []*StoreExplanation{},
+		tenant:              tenant,
+	}
+	for _, a := range r.Aggregates {
+		s.Aggregates = append(s.Aggregates, a.String())
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	e.series = append(e.series, s)
+	return s
+}
+
+// store records the given store, which was filtered out for the given reason if it is not empty.
+// Stores with external labels of other tenants only are omitted, and only the label sets visible to the tenant
+// are recorded for the rest.
+func (s *SeriesExplanation) store(st Client, reason string) *StoreExplanation {
+	if s == nil {
+		return nil
+	}
+
+	lss := st.LabelSets()
+	if s.tenant != nil {
+		lss = make([]storepb.LabelSet, 0, len(st.LabelSets()))
+		for _, ls := range st.LabelSets() {
+			// NOTE: tenant matchers are validated when the tenant is resolved so we explicitly ignore error.
+			if ok, _ := labelSetMatches(ls, s.tenant.Matchers); ok {
+				lss = append(lss, ls)
+			}
+		}
+		if len(lss) == 0 && len(st.LabelSets()) > 0 {
+			return nil
+		}
+	}
+
+	mint, maxt := st.TimeRange()
+	e := &StoreExplanation{
+		Name:      s.storeName(st),
+		LabelSets: make([]string, 0, len(lss)),
+		MinTime:   mint,
+		MaxTime:   maxt,
+		Queried:   reason == "",
+		Reason:    reason,
+		begin:     time.Now(),
+	}
+	for _, ls := range lss {
+		e.LabelSets = append(e.LabelSets, storepb.LabelsToPromLabels(ls.Labels).String())
+	}
+	s.Stores = append(s.Stores, e)
+	return e
+}
+
+// storeName returns the name of the store to record. The address is used for tenants, as the description of
+// the store includes label sets of all tenants.
+func (s *SeriesExplanation) storeName(st Client) string {
+	if s.tenant != nil {
+		return st.Addr()
+	}
+	return st.String()
+}
+
+// storeFilteredReason returns why the store was filtered out for a request with the given time range.
+func storeFilteredReason(st Client, mint, maxt int64) string {
+	storeMinTime, storeMaxTime := st.TimeRange()
+	if mint > storeMaxTime || maxt < storeMinTime {
+		return "time range of the store does not overlap with the requested one"
+	}
+	return "external labels of the store do not match the matchers"
+}
+
+func (e *StoreExplanation) received(series *storepb.Series) {
+	if e == nil {
+		return
+	}
+	e.Series++
+	e.Chunks += len(series.Chunks)
+}
+
+func (e *StoreExplanation) finished(err error) {
+	if e == nil {
+		return
+	}
+	e.DurationSeconds = time.Since(e.begin).Seconds()
+	if err != nil {
+		e.Error = err.Error()
+	}
+}
@@ -12,8 +12,10 @@ import (
 	"net/url"
 	"path"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
@@ -23,6 +25,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/common/version"
 	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
 	"github.com/prometheus/prometheus/prompb"
 	"github.com/prometheus/prometheus/storage/remote"
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
@@ -140,7 +143,7 @@ func (p *PrometheusStore) putBuffer(b *[]byte) {
 }
 
 // Series returns all series for a requested time range and label matcher.
-func (p *PrometheusStore) Series(r *storepb.SeriesRequest, s storepb.Store_SeriesServer) error {
+func (p *PrometheusStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesServer) error {
 	externalLabels := p.externalLabels()
 
 	match, newMatchers, err := matchesExternalLabels(r.Matchers, externalLabels)
@@ -162,6 +165,7 @@ func (p *PrometheusStore) Series(r *storepb.SeriesRequest, s storepb.Store_Serie
 		r.MinTime = availableMinTime
 	}
 
+	s := newBatchSeriesServer(srv, r.ResponseBatchSize)
 	if r.SkipChunks {
 		labelMaps, err := p.seriesLabels(s.Context(), newMatchers, r.MinTime, r.MaxTime)
 		if err != nil {
@@ -185,7 +189,7 @@ func (p *PrometheusStore) Series(r *storepb.SeriesRequest, s storepb.Store_Serie
 				return err
 			}
 		}
-		return nil
+		return s.Flush()
 	}
 
 	q := &prompb.Query{StartTimestampMs: r.MinTime, EndTimestampMs: r.MaxTime}
@@ -208,7 +212,7 @@ func (p *PrometheusStore) Series(r *storepb.SeriesRequest, s storepb.Store_Serie
 		q.Matchers = append(q.Matchers, pm)
 	}
 
-	queryPrometheusSpan, ctx := tracing.StartSpan(s.Context(), "query_prometheus")
+	queryPrometheusSpan, ctx := tracing.StartSpan(srv.Context(), "query_prometheus")
 
 	httpResp, err := p.startPromSeries(ctx, q)
 	if err != nil {
@@ -220,13 +224,16 @@ func (p *PrometheusStore) Series(r *storepb.SeriesRequest, s storepb.Store_Serie
 	// remote read.
 	contentType := httpResp.Header.Get("Content-Type")
 	if strings.HasPrefix(contentType, "application/x-protobuf") {
-		return p.handleSampledPrometheusResponse(s, httpResp, queryPrometheusSpan, externalLabels)
+		err = p.handleSampledPrometheusResponse(s, httpResp, queryPrometheusSpan, externalLabels)
+	} else if strings.HasPrefix(contentType, "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse") {
+		err = p.handleStreamedPrometheusResponse(s, httpResp, queryPrometheusSpan, externalLabels)
+	} else {
+		err = errors.Errorf("not supported remote read content type: %s", contentType)
 	}
-
-	if !strings.HasPrefix(contentType, "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse") {
-		return errors.Errorf("not supported remote read content type: %s", contentType)
+	if err != nil {
+		return err
 	}
-	return p.handleStreamedPrometheusResponse(s, httpResp, queryPrometheusSpan, externalLabels)
+	return s.Flush()
 }
 
 func (p *PrometheusStore) handleSampledPrometheusResponse(s storepb.Store_SeriesServer, httpResp *http.Response, querySpan opentracing.Span, externalLabels labels.Labels) error {
@@ -533,10 +540,28 @@ func extendLset(lset []storepb.Label, extend labels.Labels) []storepb.Label {
 	return lset
 }
 
-// LabelNames returns all known label names.
-func (p *PrometheusStore) LabelNames(ctx context.Context, _ *storepb.LabelNamesRequest) (
+// LabelNames returns all known label names. If matchers are given, only label names of series matching them
+// within the requested time range are returned.
+func (p *PrometheusStore) LabelNames(ctx context.Context, r *storepb.LabelNamesRequest) (
 	*storepb.LabelNamesResponse, error,
 ) {
+	if len(r.Matchers) > 0 {
+		mint, maxt := r.TimeRange()
+		lsets, ok, err := p.matchingSeriesLabels(ctx, r.Matchers, mint, maxt)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			names := map[string]struct{}{}
+			for _, lset := range lsets {
+				for n := range lset {
+					names[n] = struct{}{}
+				}
+			}
+			return &storepb.LabelNamesResponse{Names: sortedKeys(names)}, nil
+		}
+	}
+
 	u := *p.base
 	u.Path = path.Join(u.Path, "/api/v1/labels")
 
@@ -589,10 +614,28 @@ func (p *PrometheusStore) LabelNames(ctx context.Context, _ *storepb.LabelNamesR
 	return &storepb.LabelNamesResponse{Names: m.Data}, nil
 }
 
-// LabelValues returns all known label values for a given label name.
+// LabelValues returns all known label values for a given label name. If matchers are given, only label values of
+// series matching them within the requested time range are returned.
 func (p *PrometheusStore) LabelValues(ctx context.Context, r *storepb.LabelValuesRequest) (*storepb.LabelValuesResponse, error) {
 	externalLset := p.externalLabels()
 
+	if len(r.Matchers) > 0 {
+		mint, maxt := r.TimeRange()
+		lsets, ok, err := p.matchingSeriesLabels(ctx, r.Matchers, mint, maxt)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			vals := map[string]struct{}{}
+			for _, lset := range lsets {
+				if v := lset[r.Label]; v != "" {
+					vals[v] = struct{}{}
+				}
+			}
+			return &storepb.LabelValuesResponse{Values: sortedKeys(vals)}, nil
+		}
+	}
+
 	// First check for matching external label which has priority.
 	if l := externalLset.Get(r.Label); l != "" {
 		return &storepb.LabelValuesResponse{Values: []string{l}}, nil
@@ -663,9 +706,14 @@ func (p *PrometheusStore) seriesLabels(ctx context.Context, matchers []storepb.L
 	}
 
 	q.Add("match[]", metric)
+	// Prometheus parses timestamps as float seconds, so leave the extreme ones to its defaults.
+	if startTime > minPromTime {
+		q.Add("start", formatPromTime(startTime))
+	}
+	if endTime < maxPromTime {
+		q.Add("end", formatPromTime(endTime))
+	}
 	u.RawQuery = q.Encode()
-	q.Add("start", string(startTime))
-	q.Add("end", string(endTime))
 
 	req, err := http.NewRequest("GET", u.String(), nil)
 	if err != nil {
@@ -715,3 +763,46 @@ func (p *PrometheusStore) seriesLabels(ctx context.Context, matchers []storepb.L
 
 	return m.Data, nil
 }
+
+// matchingSeriesLabels returns label sets of series matching the given matchers within the given time range, extended
+// with external labels. It returns false if matchers do not narrow down series e.g. they match external labels only.
+func (p *PrometheusStore) matchingSeriesLabels(ctx context.Context, matchers []storepb.LabelMatcher, mint, maxt int64) ([]map[string]string, bool, error) {
+	externalLabels := p.externalLabels()
+
+	match, newMatchers, err := matchesExternalLabels(matchers, externalLabels)
+	if err != nil {
+		return nil, false, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !match {
+		return nil, true, nil
+	}
+	if len(newMatchers) == 0 {
+		return nil, false, nil
+	}
+
+	// Don't ask for more than available time. This includes potential `minTime` flag limit.
+	if availableMinTime, _ := p.timestamps(); mint < availableMinTime {
+		mint = availableMinTime
+	}
+
+	lsets, err := p.seriesLabels(ctx, newMatchers, mint, maxt)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, lset := range lsets {
+		for _, l := range externalLabels {
+			lset[l.Name] = l.Value
+		}
+	}
+	return lsets, true, nil
+}
+
+var (
+	minPromTime = timestamp.FromTime(time.Unix(math.MinInt64/1000+62135596801, 0))
+	maxPromTime = timestamp.FromTime(time.Unix(math.MaxInt64/1000-62135596801, 999999999))
+)
+
+// formatPromTime formats the given milliseconds timestamp the way Prometheus HTTP API understands.
+func formatPromTime(t int64) string {
+	return strconv.FormatFloat(float64(t)/1e3, 'f', -1, 64)
+}
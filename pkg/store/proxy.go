@@ -19,6 +19,7 @@ import (
 	"github.com/thanos-io/thanos/pkg/component"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
 	"github.com/thanos-io/thanos/pkg/strutil"
+	"github.com/thanos-io/thanos/pkg/tenancy"
 	"github.com/thanos-io/thanos/pkg/tracing"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc/codes"
@@ -36,6 +37,9 @@ type Client interface {
 	// Minimum and maximum time range of data in the store.
 	TimeRange() (mint int64, maxt int64)
 
+	// Resolutions in milliseconds of data in the store, 0 for raw data. Empty means raw data only.
+	Resolutions() []int64
+
 	String() string
 	// Addr returns address of a Client.
 	Addr() string
@@ -49,6 +53,36 @@ type ProxyStore struct {
 	selectorLabels labels.Labels
 
 	responseTimeout time.Duration
+
+	replicaGroups     bool
+	replicaHedgeDelay time.Duration
+	// replicaCounter is used to spread requests among replicas of a group.
+	replicaCounter uint64
+
+	responseBatchSize int64
+}
+
+// ProxyStoreOption overrides behavior of ProxyStore.
+type ProxyStoreOption func(*ProxyStore)
+
+// WithReplicaGroups makes ProxyStore treat stores announcing identical label sets and time ranges as replicas of each
+// other. Series are requested from only one replica of such group, picked in round-robin fashion. If it fails before
+// sending any response, the request is retried on the next replica. If it does not respond within hedgeDelay,
+// the request is also sent to the next replica and the first one responding is used. Zero hedgeDelay disables hedging.
+// Errors after the first response are not retried, as the responses already passed on cannot be taken back.
+func WithReplicaGroups(hedgeDelay time.Duration) ProxyStoreOption {
+	return func(s *ProxyStore) {
+		s.replicaGroups = true
+		s.replicaHedgeDelay = hedgeDelay
+	}
+}
+
+// WithResponseBatchSize makes ProxyStore ask stores to send up to the given number of series per response, instead of
+// one series per response. Stores not supporting batching still send single series, which is handled as well.
+func WithResponseBatchSize(size int64) ProxyStoreOption {
+	return func(s *ProxyStore) {
+		s.responseBatchSize = size
+	}
 }
 
 // NewProxyStore returns a new ProxyStore that uses the given clients that implements storeAPI to fan-in all series to the client.
@@ -59,6 +93,7 @@ func NewProxyStore(
 	component component.StoreAPI,
 	selectorLabels labels.Labels,
 	responseTimeout time.Duration,
+	opts ...ProxyStoreOption,
 ) *ProxyStore {
 	if logger == nil {
 		logger = log.NewNopLogger()
@@ -71,9 +106,50 @@ func NewProxyStore(
 		selectorLabels:  selectorLabels,
 		responseTimeout: responseTimeout,
 	}
+	for _, o := range opts {
+		o(s)
+	}
 	return s
 }
 
+type queriedStoresKey struct{}
+
+// QueriedStores records addresses of stores queried by ProxyStore for series. It is safe for concurrent use.
+type QueriedStores struct {
+	mtx    sync.Mutex
+	stores map[string]struct{}
+}
+
+// ContextWithQueriedStores returns a context which makes ProxyStore record addresses of all stores asked
+// for series into the given QueriedStores.
+func ContextWithQueriedStores(ctx context.Context, qs *QueriedStores) context.Context {
+	return context.WithValue(ctx, queriedStoresKey{}, qs)
+}
+
+func queriedStoresFromContext(ctx context.Context) *QueriedStores {
+	qs, _ := ctx.Value(queriedStoresKey{}).(*QueriedStores)
+	return qs
+}
+
+// Add records the address of a queried store.
+func (qs *QueriedStores) Add(addr string) {
+	qs.mtx.Lock()
+	defer qs.mtx.Unlock()
+
+	if qs.stores == nil {
+		qs.stores = map[string]struct{}{}
+	}
+	qs.stores[addr] = struct{}{}
+}
+
+// Stores returns sorted addresses of queried stores.
+func (qs *QueriedStores) Stores() []string {
+	qs.mtx.Lock()
+	defer qs.mtx.Unlock()
+
+	return sortedKeys(qs.stores)
+}
+
 // Info returns store information about the external labels this store have.
 func (s *ProxyStore) Info(ctx context.Context, r *storepb.InfoRequest) (*storepb.InfoResponse, error) {
 	res := &storepb.InfoResponse{
@@ -106,6 +182,20 @@ func (s *ProxyStore) Info(ctx context.Context, r *storepb.InfoRequest) (*storepb
 	res.MaxTime = maxTime
 	res.MinTime = minTime
 
+	for _, st := range stores {
+		resolutions := st.Resolutions()
+		if len(resolutions) == 0 {
+			// Stores without resolutions hold raw data only.
+			resolutions = []int64{0}
+		}
+		for _, r := range resolutions {
+			if int64index(res.Resolutions, r) < 0 {
+				res.Resolutions = append(res.Resolutions, r)
+			}
+		}
+	}
+	sort.Slice(res.Resolutions, func(i, j int) bool { return res.Resolutions[i] < res.Resolutions[j] })
+
 	for _, l := range s.selectorLabels {
 		res.Labels = append(res.Labels, storepb.Label{
 			Name:  l.Name,
@@ -181,7 +271,8 @@ func (s ctxRespSender) send(r *storepb.SeriesResponse) {
 // Series returns all series for a requested time range and label matcher. Requested series are taken from other
 // stores and proxied to RPC client. NOTE: Resulted data are not trimmed exactly to min and max time range.
 func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesServer) error {
-	match, newMatchers, err := matchesExternalLabels(r.Matchers, s.selectorLabels)
+	// Tenant matchers are added before matching external labels, so stores of other tenants are filtered out.
+	match, newMatchers, err := matchesExternalLabels(tenancy.EnforceMatchers(srv.Context(), r.Matchers), s.selectorLabels)
 	if err != nil {
 		return status.Error(codes.InvalidArgument, err.Error())
 	}
@@ -213,42 +304,73 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 				MaxResolutionWindow:     r.MaxResolutionWindow,
 				SkipChunks:              r.SkipChunks,
 				PartialResponseDisabled: r.PartialResponseDisabled,
+				ResponseBatchSize:       s.responseBatchSize,
 			}
 			wg = &sync.WaitGroup{}
 		)
+		expl := ExplanationFromContext(gctx).add(r, tenancy.TenantFromContext(gctx))
 
 		defer func() {
 			wg.Wait()
 			closeFn()
 		}()
 
+		var matched []Client
 		for _, st := range s.stores() {
 			// We might be able to skip the store if its meta information indicates
 			// it cannot have series matching our query.
 			// NOTE: all matchers are validated in matchesExternalLabels method so we explicitly ignore error.
-			spanStoreMathes, gctx := tracing.StartSpan(gctx, "store_matches")
+			spanStoreMathes, _ := tracing.StartSpan(gctx, "store_matches")
 			ok, _ := storeMatches(st, r.MinTime, r.MaxTime, r.Matchers...)
 			spanStoreMathes.Finish()
 			if !ok {
 				storeDebugMsgs = append(storeDebugMsgs, fmt.Sprintf("store %s filtered out", st))
+				expl.store(st, storeFilteredReason(st, r.MinTime, r.MaxTime))
 				continue
 			}
-			storeDebugMsgs = append(storeDebugMsgs, fmt.Sprintf("store %s queried", st))
+			matched = append(matched, st)
+		}
 
+		for _, replicas := range s.replicaGroupsOf(matched) {
 			// This is used to cancel this stream when one operations takes too long.
 			seriesCtx, closeSeries := context.WithCancel(gctx)
-			seriesCtx = grpc_opentracing.ClientAddContextTags(seriesCtx, opentracing.Tags{
-				"target": st.Addr(),
-			})
 			defer closeSeries()
 
-			sc, err := st.Series(seriesCtx, r)
+			var (
+				st    = replicas[0]
+				sc    storepb.Store_SeriesClient
+				err   error
+				begin = time.Now()
+			)
+			if len(replicas) == 1 {
+				sc, err = st.Series(grpc_opentracing.ClientAddContextTags(seriesCtx, opentracing.Tags{
+					"target": st.Addr(),
+				}), r)
+			} else {
+				var cancelReplica context.CancelFunc
+				sc, st, cancelReplica, err = s.replicaSeries(seriesCtx, replicas, r)
+				defer cancelReplica()
+			}
+			storeDebugMsgs = append(storeDebugMsgs, fmt.Sprintf("store %s queried", st))
+			storeExpl := expl.store(st, "")
+			if storeExpl != nil {
+				storeExpl.begin = begin
+				for _, replica := range replicas {
+					if replica != st {
+						expl.store(replica, fmt.Sprintf("replica of %s", expl.storeName(st)))
+					}
+				}
+			}
+			if qs := queriedStoresFromContext(gctx); qs != nil {
+				qs.Add(st.Addr())
+			}
 			if err != nil {
 				storeID := storepb.LabelSetsToString(st.LabelSets())
 				if storeID == "" {
 					storeID = "Store Gateway"
 				}
 				err = errors.Wrapf(err, "fetch series for %s %s", storeID, st)
+				storeExpl.finished(err)
 				if r.PartialResponseDisabled {
 					level.Error(s.logger).Log("err", err, "msg", "partial response disabled; aborting request")
 					return err
@@ -260,7 +382,7 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 			// Schedule streamSeriesSet that translates gRPC streamed response
 			// into seriesSet (if series) or respCh if warnings.
 			seriesSet = append(seriesSet, startStreamSeriesSet(seriesCtx, s.logger, closeSeries,
-				wg, sc, respSender, st.String(), !r.PartialResponseDisabled, s.responseTimeout))
+				wg, sc, respSender, st.String(), !r.PartialResponseDisabled, s.responseTimeout, storeExpl))
 		}
 
 		level.Debug(s.logger).Log("msg", strings.Join(storeDebugMsgs, ";"))
@@ -281,8 +403,9 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 		return mergedSet.Err()
 	})
 
+	bsrv := newBatchSeriesServer(srv, r.ResponseBatchSize)
 	for resp := range respRecv {
-		if err := srv.Send(resp); err != nil {
+		if err := bsrv.Send(resp); err != nil {
 			return status.Error(codes.Unknown, errors.Wrap(err, "send series response").Error())
 		}
 	}
@@ -291,6 +414,9 @@ func (s *ProxyStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSe
 		level.Error(s.logger).Log("err", err)
 		return err
 	}
+	if err := bsrv.Flush(); err != nil {
+		return status.Error(codes.Unknown, errors.Wrap(err, "send series response").Error())
+	}
 	return nil
 }
 
@@ -318,6 +444,8 @@ type streamSeriesSet struct {
 
 	responseTimeout time.Duration
 	closeSeries     context.CancelFunc
+
+	expl *StoreExplanation
 }
 
 func startStreamSeriesSet(
@@ -330,6 +458,7 @@ func startStreamSeriesSet(
 	name string,
 	partialResponse bool,
 	responseTimeout time.Duration,
+	expl *StoreExplanation,
 ) *streamSeriesSet {
 	s := &streamSeriesSet{
 		ctx:             ctx,
@@ -341,12 +470,15 @@ func startStreamSeriesSet(
 		name:            name,
 		partialResponse: partialResponse,
 		responseTimeout: responseTimeout,
+		expl:            expl,
 	}
 
 	wg.Add(1)
 	go func() {
+		var recvErr error
 		defer wg.Done()
 		defer close(s.recvCh)
+		defer func() { s.expl.finished(recvErr) }()
 
 		for {
 			r, err := s.stream.Recv()
@@ -357,6 +489,7 @@ func startStreamSeriesSet(
 
 			if err != nil {
 				wrapErr := errors.Wrapf(err, "receive series from %s", s.name)
+				recvErr = wrapErr
 				if partialResponse {
 					s.warnCh.send(storepb.NewWarnSeriesResponse(wrapErr))
 					return
@@ -373,6 +506,19 @@ func startStreamSeriesSet(
 				continue
 			}
 
+			if b := r.GetBatch(); b != nil {
+				for i := range b.Series {
+					s.expl.received(&b.Series[i])
+					select {
+					case s.recvCh <- &b.Series[i]:
+					case <-ctx.Done():
+						return
+					}
+				}
+				continue
+			}
+
+			s.expl.received(r.GetSeries())
 			select {
 			case s.recvCh <- r.GetSeries():
 				continue
@@ -492,11 +638,37 @@ func (s *ProxyStore) LabelNames(ctx context.Context, r *storepb.LabelNamesReques
 		g, gctx  = errgroup.WithContext(ctx)
 	)
 
+	mint, maxt := r.TimeRange()
+	if tenancy.TenantFromContext(ctx) != nil {
+		lsets, warnings, err := s.tenantSeriesLabels(ctx, r.Matchers, mint, maxt, r.PartialResponseDisabled)
+		if err != nil {
+			return nil, err
+		}
+
+		names := map[string]struct{}{}
+		for _, lset := range lsets {
+			for _, l := range lset {
+				names[l.Name] = struct{}{}
+			}
+		}
+		return &storepb.LabelNamesResponse{Names: sortedKeys(names), Warnings: warnings}, nil
+	}
+
+	matchers := tenancy.EnforceMatchers(ctx, r.Matchers)
 	for _, st := range s.stores() {
 		st := st
+		// We might be able to skip the store if its meta information indicates it cannot have
+		// labels within the requested time range or matching our matchers.
+		// NOTE: matchers are validated by the stores themselves, so we explicitly ignore the error.
+		if ok, _ := storeMatches(st, mint, maxt, matchers...); !ok {
+			continue
+		}
 		g.Go(func() error {
 			resp, err := st.LabelNames(gctx, &storepb.LabelNamesRequest{
 				PartialResponseDisabled: r.PartialResponseDisabled,
+				Start:                   r.Start,
+				End:                     r.End,
+				Matchers:                matchers,
 			})
 			if err != nil {
 				err = errors.Wrapf(err, "fetch label names from store %s", st)
@@ -540,12 +712,39 @@ func (s *ProxyStore) LabelValues(ctx context.Context, r *storepb.LabelValuesRequ
 		g, gctx  = errgroup.WithContext(ctx)
 	)
 
+	mint, maxt := r.TimeRange()
+	if tenancy.TenantFromContext(ctx) != nil {
+		lsets, warnings, err := s.tenantSeriesLabels(ctx, r.Matchers, mint, maxt, r.PartialResponseDisabled)
+		if err != nil {
+			return nil, err
+		}
+
+		values := map[string]struct{}{}
+		for _, lset := range lsets {
+			for _, l := range lset {
+				if l.Name == r.Label {
+					values[l.Value] = struct{}{}
+					break
+				}
+			}
+		}
+		return &storepb.LabelValuesResponse{Values: sortedKeys(values), Warnings: warnings}, nil
+	}
+
+	matchers := tenancy.EnforceMatchers(ctx, r.Matchers)
 	for _, st := range s.stores() {
 		store := st
+		// NOTE: matchers are validated by the stores themselves, so we explicitly ignore the error.
+		if ok, _ := storeMatches(store, mint, maxt, matchers...); !ok {
+			continue
+		}
 		g.Go(func() error {
 			resp, err := store.LabelValues(gctx, &storepb.LabelValuesRequest{
 				Label:                   r.Label,
 				PartialResponseDisabled: r.PartialResponseDisabled,
+				Start:                   r.Start,
+				End:                     r.End,
+				Matchers:                matchers,
 			})
 			if err != nil {
 				err = errors.Wrapf(err, "fetch label values from store %s", store)
@@ -577,3 +776,23 @@ func (s *ProxyStore) LabelValues(ctx context.Context, r *storepb.LabelValuesRequ
 		Warnings: warnings,
 	}, nil
 }
+
+// tenantSeriesLabels returns label sets of series matching the given matchers and the matchers of the tenant in the
+// context within the given time range, along with warnings. Label names and values of tenants are gathered from series,
+// as stores built before label names and values requests had matchers ignore them and would return labels of other
+// tenants.
+func (s *ProxyStore) tenantSeriesLabels(ctx context.Context, matchers []storepb.LabelMatcher, mint, maxt int64, partialResponseDisabled bool) ([][]storepb.Label, []string, error) {
+	srv := &labelSetsServer{ctx: ctx}
+	if err := s.Series(&storepb.SeriesRequest{
+		MinTime:  mint,
+		MaxTime:  maxt,
+		Matchers: matchers,
+		// Series labels are the same for all resolutions, so prefer downsampled blocks as there are less of them.
+		MaxResolutionWindow:     math.MaxInt64,
+		SkipChunks:              true,
+		PartialResponseDisabled: partialResponseDisabled,
+	}, srv); err != nil {
+		return nil, nil, err
+	}
+	return srv.lsets, srv.warnings, nil
+}
@@ -0,0 +1,206 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	grpc_opentracing "github.com/grpc-ecosystem/go-grpc-middleware/tracing/opentracing"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/tracing"
+)
+
+// replicaGroupsOf groups the given stores into replica groups, keeping the order of the first occurrence. Each
+// store is in a separate group unless replica groups are enabled. Replicas of each group are rotated, so consecutive
+// requests start with a different replica.
+func (s *ProxyStore) replicaGroupsOf(stores []Client) [][]Client {
+	groups := make([][]Client, 0, len(stores))
+	if !s.replicaGroups {
+		for _, st := range stores {
+			groups = append(groups, []Client{st})
+		}
+		return groups
+	}
+
+	byKey := map[string]int{}
+	for _, st := range stores {
+		key := replicaGroupKey(st)
+		if key == "" {
+			groups = append(groups, []Client{st})
+			continue
+		}
+		if i, ok := byKey[key]; ok {
+			groups[i] = append(groups[i], st)
+			continue
+		}
+		byKey[key] = len(groups)
+		groups = append(groups, []Client{st})
+	}
+
+	offset := int(atomic.AddUint64(&s.replicaCounter, 1))
+	for i, g := range groups {
+		if len(g) < 2 {
+			continue
+		}
+		// Sort, so the rotation does not depend on the order of stores given by the store set.
+		sort.Slice(g, func(i, j int) bool { return g[i].Addr() < g[j].Addr() })
+		o := offset % len(g)
+		rotated := make([]Client, 0, len(g))
+		rotated = append(rotated, g[o:]...)
+		groups[i] = append(rotated, g[:o]...)
+	}
+	return groups
+}
+
+// replicaGroupKey returns key identifying stores serving the same data. Stores without any label set cannot be told
+// apart, so they are never treated as replicas and empty key is returned.
+func replicaGroupKey(st Client) string {
+	lsets := st.LabelSets()
+	if len(lsets) == 0 {
+		return ""
+	}
+
+	strs := make([]string, 0, len(lsets))
+	for _, ls := range lsets {
+		strs = append(strs, storepb.LabelsToString(ls.Labels))
+	}
+	sort.Strings(strs)
+
+	mint, maxt := st.TimeRange()
+	return fmt.Sprintf("%s/%d/%d", strings.Join(strs, ","), mint, maxt)
+}
+
+type replicaSeriesResult struct {
+	// attempt is the index of the attempt in the order replicas were tried.
+	attempt int
+	st      Client
+	stream  storepb.Store_SeriesClient
+	first   *storepb.SeriesResponse
+	err     error
+}
+
+// replicaSeries requests series from one of the given replicas. The next replica is tried if the current one fails
+// before sending the first response, or additionally requested (hedged) if it does not respond within the hedge delay.
+// It returns the stream of the first replica which responded along with that replica. Streams of other replicas are
+// cancelled. If all replicas fail, the last error is returned along with the replica which caused it.
+// Retries and hedging happen only before the first response. Once a replica responded, it is used for the rest of the
+// request and its later errors are not retried.
+// The returned cancel function has to be called once the returned stream is no longer used.
+func (s *ProxyStore) replicaSeries(ctx context.Context, replicas []Client, r *storepb.SeriesRequest) (storepb.Store_SeriesClient, Client, context.CancelFunc, error) {
+	span, ctx := tracing.StartSpan(ctx, "store_replica_series")
+	defer span.Finish()
+
+	var (
+		results = make(chan replicaSeriesResult, len(replicas))
+		cancels = make([]context.CancelFunc, 0, len(replicas))
+		next    int
+		pending int
+	)
+	start := func() {
+		st, attempt := replicas[next], next
+		next++
+		pending++
+
+		attemptCtx, cancel := context.WithCancel(ctx)
+		cancels = append(cancels, cancel)
+		attemptCtx = grpc_opentracing.ClientAddContextTags(attemptCtx, opentracing.Tags{
+			"target": st.Addr(),
+		})
+
+		go func() {
+			res := replicaSeriesResult{attempt: attempt, st: st}
+			res.stream, res.err = st.Series(attemptCtx, r)
+			if res.err == nil {
+				// Wait for the first response, so failing and slow replicas can be detected.
+				res.first, res.err = res.stream.Recv()
+				if res.err == io.EOF {
+					res.err = nil
+				}
+			}
+			results <- res
+		}()
+	}
+
+	var hedge <-chan time.Time
+	resetHedge := func() {
+		if s.replicaHedgeDelay > 0 && next < len(replicas) {
+			hedge = time.After(s.replicaHedgeDelay)
+			return
+		}
+		hedge = nil
+	}
+
+	start()
+	resetHedge()
+
+	var last replicaSeriesResult
+	for {
+		select {
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				// Cancel all other attempts. This one is cancelled by the caller once its stream is consumed.
+				for i, cancel := range cancels {
+					if i != res.attempt {
+						cancel()
+					}
+				}
+				span.SetTag("replica", res.st.Addr())
+				level.Debug(s.logger).Log("msg", "replica responded", "replica", res.st.Addr(), "attempts", next)
+				return &firstResponseSeriesClient{Store_SeriesClient: res.stream, first: res.first}, res.st, cancels[res.attempt], nil
+			}
+
+			cancels[res.attempt]()
+			last = res
+			level.Debug(s.logger).Log("msg", "replica failed", "replica", res.st.Addr(), "err", res.err)
+			if next < len(replicas) {
+				// Retry on the next replica.
+				start()
+				resetHedge()
+				continue
+			}
+			if pending == 0 {
+				return nil, last.st, func() {}, errors.Wrapf(last.err, "all %d replicas failed", len(replicas))
+			}
+		case <-hedge:
+			level.Debug(s.logger).Log("msg", "hedging series request", "replica", replicas[next].Addr(), "delay", s.replicaHedgeDelay)
+			start()
+			resetHedge()
+		case <-ctx.Done():
+			for _, cancel := range cancels {
+				cancel()
+			}
+			return nil, replicas[0], func() {}, ctx.Err()
+		}
+	}
+}
+
+// firstResponseSeriesClient returns already received first response before the rest of the stream.
+// Nil first response means the stream has already ended.
+type firstResponseSeriesClient struct {
+	storepb.Store_SeriesClient
+
+	first    *storepb.SeriesResponse
+	received bool
+}
+
+func (c *firstResponseSeriesClient) Recv() (*storepb.SeriesResponse, error) {
+	if !c.received {
+		c.received = true
+		if c.first == nil {
+			return nil, io.EOF
+		}
+		return c.first, nil
+	}
+	if c.first == nil {
+		return nil, io.EOF
+	}
+	return c.Store_SeriesClient.Recv()
+}
@@ -6,6 +6,7 @@ import (
 	"math"
 	"os"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -16,6 +17,7 @@ import (
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
 	"github.com/thanos-io/thanos/pkg/component"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/tenancy"
 	"github.com/thanos-io/thanos/pkg/testutil"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -26,9 +28,11 @@ type testClient struct {
 	// Just to pass interface check.
 	storepb.StoreClient
 
-	labelSets []storepb.LabelSet
-	minTime   int64
-	maxTime   int64
+	labelSets   []storepb.LabelSet
+	minTime     int64
+	maxTime     int64
+	resolutions []int64
+	addr        string
 }
 
 func (c *testClient) LabelSets() []storepb.LabelSet {
@@ -39,13 +43,21 @@ func (c *testClient) TimeRange() (int64, int64) {
 	return c.minTime, c.maxTime
 }
 
+func (c *testClient) Resolutions() []int64 {
+	return c.resolutions
+}
+
 func (c *testClient) String() string {
 	return "test"
 }
 
 func (c *testClient) Addr() string {
+	if c.addr != "" {
+		return c.addr
+	}
 	return "testaddr"
 }
+
 func TestProxyStore_Info(t *testing.T) {
 	defer leaktest.CheckTimeout(t, 10*time.Second)()
 
@@ -66,6 +78,30 @@ func TestProxyStore_Info(t *testing.T) {
 	testutil.Equals(t, int64(math.MaxInt64), resp.MaxTime)
 }
 
+func TestProxyStore_Info_Resolutions(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := NewProxyStore(nil,
+		func() []Client {
+			return []Client{
+				&testClient{minTime: 1, maxTime: 300, resolutions: []int64{3600000, 0, 300000}},
+				&testClient{minTime: 1, maxTime: 300, resolutions: []int64{60000, 300000}},
+				// Stores without resolutions hold raw data only.
+				&testClient{minTime: 1, maxTime: 300},
+			}
+		},
+		component.Query,
+		nil, 0*time.Second,
+	)
+
+	resp, err := q.Info(ctx, &storepb.InfoRequest{})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []int64{0, 60000, 300000, 3600000}, resp.Resolutions)
+}
+
 func TestProxyStore_Series(t *testing.T) {
 	defer leaktest.CheckTimeout(t, 10*time.Second)()
 
@@ -463,6 +499,181 @@ func TestProxyStore_Series(t *testing.T) {
 	}
 }
 
+func TestProxyStore_Series_QueriedStores(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	cls := []Client{
+		&testClient{
+			StoreClient: &mockedStoreAPI{
+				RespSeries: []*storepb.SeriesResponse{
+					storeSeriesResponse(t, labels.FromStrings("a", "a"), []sample{{0, 0}, {2, 1}, {3, 2}}),
+				},
+			},
+			minTime: 1,
+			maxTime: 300,
+		},
+		&testClient{
+			StoreClient: &mockedStoreAPI{
+				RespError: errors.New("error!"),
+			},
+			minTime: 301,
+			maxTime: 400,
+		},
+	}
+	q := NewProxyStore(nil,
+		func() []Client { return cls },
+		component.Query,
+		nil,
+		0*time.Second,
+	)
+
+	qs := &QueriedStores{}
+	s := newStoreSeriesServer(ContextWithQueriedStores(context.Background(), qs))
+	testutil.Ok(t, q.Series(&storepb.SeriesRequest{
+		MinTime:                 1,
+		MaxTime:                 300,
+		Matchers:                []storepb.LabelMatcher{{Name: "a", Value: "a", Type: storepb.LabelMatcher_EQ}},
+		PartialResponseDisabled: true,
+	}, s))
+	testutil.Equals(t, 1, len(s.SeriesSet))
+	testutil.Equals(t, []string{"testaddr"}, qs.Stores())
+
+	qs = &QueriedStores{}
+	s = newStoreSeriesServer(ContextWithQueriedStores(context.Background(), qs))
+	testutil.Ok(t, q.Series(&storepb.SeriesRequest{
+		MinTime:  500,
+		MaxTime:  600,
+		Matchers: []storepb.LabelMatcher{{Name: "a", Value: "a", Type: storepb.LabelMatcher_EQ}},
+	}, s))
+	testutil.Equals(t, []string{}, qs.Stores())
+}
+
+func TestProxyStore_Series_ReplicaGroups(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	replicaLabelSets := []storepb.LabelSet{{Labels: []storepb.Label{{Name: "ext", Value: "1"}}}}
+	healthyReplica := func(addr string, dur time.Duration) Client {
+		return &testClient{
+			StoreClient: &mockedStoreAPI{
+				RespSeries: []*storepb.SeriesResponse{
+					storeSeriesResponse(t, labels.FromStrings("a", "a"), []sample{{0, 0}, {2, 1}, {3, 2}}),
+				},
+				RespDuration: dur,
+			},
+			labelSets: replicaLabelSets,
+			minTime:   1,
+			maxTime:   300,
+			addr:      addr,
+		}
+	}
+	failingReplica := func(addr string) Client {
+		return &testClient{
+			StoreClient: &mockedStoreAPI{
+				RespError: errors.New("error!"),
+			},
+			labelSets: replicaLabelSets,
+			minTime:   1,
+			maxTime:   300,
+			addr:      addr,
+		}
+	}
+	req := &storepb.SeriesRequest{
+		MinTime:  1,
+		MaxTime:  300,
+		Matchers: []storepb.LabelMatcher{{Name: "a", Value: "a", Type: storepb.LabelMatcher_EQ}},
+	}
+	expectedSeries := []rawSeries{
+		{
+			lset:   []storepb.Label{{Name: "a", Value: "a"}},
+			chunks: [][]sample{{{0, 0}, {2, 1}, {3, 2}}},
+		},
+	}
+
+	// NOTE: Replicas are sorted by address and the first request of a new ProxyStore starts with the second one.
+	for _, tc := range []struct {
+		title      string
+		storeAPIs  []Client
+		hedgeDelay time.Duration
+
+		expectedSeries      []rawSeries
+		expectedWarningsLen int
+		expectedStores      []string
+	}{
+		{
+			title:          "only one replica is queried",
+			storeAPIs:      []Client{healthyReplica("replica-a", 0), healthyReplica("replica-b", 0)},
+			expectedSeries: expectedSeries,
+			expectedStores: []string{"replica-b"},
+		},
+		{
+			title:          "failed replica is retried on the next one",
+			storeAPIs:      []Client{healthyReplica("replica-a", 0), failingReplica("replica-b")},
+			expectedSeries: expectedSeries,
+			expectedStores: []string{"replica-a"},
+		},
+		{
+			title:          "slow replica is hedged",
+			storeAPIs:      []Client{healthyReplica("replica-a", 0), healthyReplica("replica-b", 2*time.Second)},
+			hedgeDelay:     100 * time.Millisecond,
+			expectedSeries: expectedSeries,
+			expectedStores: []string{"replica-a"},
+		},
+		{
+			title:               "all replicas failed",
+			storeAPIs:           []Client{failingReplica("replica-a"), failingReplica("replica-b")},
+			expectedWarningsLen: 2, // Error of the last replica and no store matched.
+			expectedStores:      []string{"replica-a"},
+		},
+		{
+			title: "stores with different time ranges are not replicas",
+			storeAPIs: []Client{
+				healthyReplica("replica-a", 0),
+				&testClient{
+					StoreClient: &mockedStoreAPI{
+						RespSeries: []*storepb.SeriesResponse{
+							storeSeriesResponse(t, labels.FromStrings("a", "a"), []sample{{4, 3}}),
+						},
+					},
+					labelSets: replicaLabelSets,
+					minTime:   4,
+					maxTime:   300,
+					addr:      "other",
+				},
+			},
+			expectedSeries: []rawSeries{
+				{
+					lset:   []storepb.Label{{Name: "a", Value: "a"}},
+					chunks: [][]sample{{{0, 0}, {2, 1}, {3, 2}}, {{4, 3}}},
+				},
+			},
+			expectedStores: []string{"other", "replica-a"},
+		},
+	} {
+		if ok := t.Run(tc.title, func(t *testing.T) {
+			q := NewProxyStore(nil,
+				func() []Client { return tc.storeAPIs },
+				component.Query,
+				nil,
+				0*time.Second,
+				WithReplicaGroups(tc.hedgeDelay),
+			)
+
+			qs := &QueriedStores{}
+			s := newStoreSeriesServer(ContextWithQueriedStores(context.Background(), qs))
+
+			begin := time.Now()
+			testutil.Ok(t, q.Series(req, s))
+			testutil.Assert(t, time.Since(begin) < 2*time.Second, "expected slow replica to be hedged")
+
+			seriesEquals(t, tc.expectedSeries, s.SeriesSet)
+			testutil.Equals(t, tc.expectedWarningsLen, len(s.Warnings), "got %v", s.Warnings)
+			testutil.Equals(t, tc.expectedStores, qs.Stores())
+		}); !ok {
+			return
+		}
+	}
+}
+
 func TestProxyStore_SeriesSlowStores(t *testing.T) {
 	enable := os.Getenv("THANOS_ENABLE_STORE_READ_TIMEOUT_TESTS")
 	if enable == "" {
@@ -627,6 +838,241 @@ func TestProxyStore_Series_RequestParamsProxied(t *testing.T) {
 	testutil.Assert(t, proto.Equal(req, m.LastSeriesReq), "request was not proxied properly to underlying storeAPI: %s vs %s", req, m.LastSeriesReq)
 }
 
+func TestProxyStore_Series_ResponseBatching(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	batch := func(resps ...*storepb.SeriesResponse) *storepb.SeriesResponse {
+		var series []storepb.Series
+		for _, r := range resps {
+			series = append(series, *r.GetSeries())
+		}
+		return storepb.NewSeriesBatchResponse(series)
+	}
+
+	// First store supports batching, second one sends single series.
+	batched := &mockedStoreAPI{
+		RespSeries: []*storepb.SeriesResponse{
+			batch(
+				storeSeriesResponse(t, labels.FromStrings("a", "a"), []sample{{0, 0}, {2, 1}}),
+				storeSeriesResponse(t, labels.FromStrings("a", "c"), []sample{{0, 0}}),
+			),
+			storepb.NewWarnSeriesResponse(errors.New("warning")),
+			batch(storeSeriesResponse(t, labels.FromStrings("a", "e"), []sample{{0, 0}})),
+		},
+	}
+	single := &mockedStoreAPI{
+		RespSeries: []*storepb.SeriesResponse{
+			storeSeriesResponse(t, labels.FromStrings("a", "b"), []sample{{1, 1}}),
+			storeSeriesResponse(t, labels.FromStrings("a", "d"), []sample{{1, 1}}),
+		},
+	}
+	cls := []Client{
+		&testClient{StoreClient: batched, minTime: 1, maxTime: 300},
+		&testClient{StoreClient: single, minTime: 1, maxTime: 300},
+	}
+	q := NewProxyStore(nil,
+		func() []Client { return cls },
+		component.Query,
+		nil,
+		0*time.Second,
+		WithResponseBatchSize(100),
+	)
+
+	s := newStoreSeriesServer(context.Background())
+	testutil.Ok(t, q.Series(&storepb.SeriesRequest{
+		MinTime:           1,
+		MaxTime:           300,
+		Matchers:          []storepb.LabelMatcher{{Name: "a", Value: ".*", Type: storepb.LabelMatcher_RE}},
+		ResponseBatchSize: 2,
+	}, s))
+
+	testutil.Equals(t, int64(100), batched.LastSeriesReq.ResponseBatchSize)
+	testutil.Equals(t, int64(100), single.LastSeriesReq.ResponseBatchSize)
+
+	testutil.Equals(t, []string{"warning"}, s.Warnings)
+	testutil.Equals(t, 3, s.Batches)
+	seriesEquals(t, []rawSeries{
+		{lset: []storepb.Label{{Name: "a", Value: "a"}}, chunks: [][]sample{{{0, 0}, {2, 1}}}},
+		{lset: []storepb.Label{{Name: "a", Value: "b"}}, chunks: [][]sample{{{1, 1}}}},
+		{lset: []storepb.Label{{Name: "a", Value: "c"}}, chunks: [][]sample{{{0, 0}}}},
+		{lset: []storepb.Label{{Name: "a", Value: "d"}}, chunks: [][]sample{{{1, 1}}}},
+		{lset: []storepb.Label{{Name: "a", Value: "e"}}, chunks: [][]sample{{{0, 0}}}},
+	}, s.SeriesSet)
+}
+
+func TestProxyStore_Series_TenantMatchers(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	storeA := &mockedStoreAPI{
+		RespSeries: []*storepb.SeriesResponse{
+			storeSeriesResponse(t, labels.FromStrings("a", "a"), []sample{{0, 0}}),
+		},
+		// Stores built before label values requests had matchers ignore them and return values of other tenants.
+		RespLabelValues: &storepb.LabelValuesResponse{Values: []string{"a", "x"}},
+		RespLabelNames:  &storepb.LabelNamesResponse{Names: []string{"a", "x"}},
+	}
+	storeB := &mockedStoreAPI{RespSeries: []*storepb.SeriesResponse{
+		storeSeriesResponse(t, labels.FromStrings("a", "b"), []sample{{0, 0}}),
+	}}
+	cls := []Client{
+		&testClient{StoreClient: storeA, labelSets: []storepb.LabelSet{{Labels: []storepb.Label{{Name: "team", Value: "a"}}}}, minTime: 1, maxTime: 300},
+		&testClient{StoreClient: storeB, labelSets: []storepb.LabelSet{{Labels: []storepb.Label{{Name: "team", Value: "b"}}}}, minTime: 1, maxTime: 300},
+	}
+	q := NewProxyStore(nil, func() []Client { return cls }, component.Query, nil, 0*time.Second)
+
+	tenantMatcher := storepb.LabelMatcher{Type: storepb.LabelMatcher_EQ, Name: "team", Value: "a"}
+	ctx := tenancy.ContextWithTenant(context.Background(), &tenancy.Tenant{Name: "team-a", Matchers: []storepb.LabelMatcher{tenantMatcher}})
+	s := newStoreSeriesServer(ctx)
+	testutil.Ok(t, q.Series(&storepb.SeriesRequest{
+		MinTime:  1,
+		MaxTime:  300,
+		Matchers: []storepb.LabelMatcher{{Name: "a", Value: ".*", Type: storepb.LabelMatcher_RE}},
+	}, s))
+
+	// Store of the other tenant is filtered out by its external labels.
+	testutil.Assert(t, storeB.LastSeriesReq == nil, "expected store of other tenant not to be queried")
+	seriesEquals(t, []rawSeries{{lset: []storepb.Label{{Name: "a", Value: "a"}}, chunks: [][]sample{{{0, 0}}}}}, s.SeriesSet)
+
+	// Label names and values of tenants are gathered from series.
+	storeA.LastSeriesReq = nil
+	resp, err := q.LabelValues(ctx, &storepb.LabelValuesRequest{Label: "a"})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"a"}, resp.Values)
+	testutil.Assert(t, storeA.LastLabelValuesReq == nil, "expected label values not to be requested")
+	testutil.Assert(t, storeA.LastSeriesReq.SkipChunks, "expected series without chunks to be requested")
+	testutil.Equals(t, []storepb.LabelMatcher{tenantMatcher}, storeA.LastSeriesReq.Matchers)
+	testutil.Assert(t, storeB.LastSeriesReq == nil, "expected store of other tenant not to be queried")
+
+	namesResp, err := q.LabelNames(ctx, &storepb.LabelNamesRequest{})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"a"}, namesResp.Names)
+	testutil.Assert(t, storeA.LastLabelNamesReq == nil, "expected label names not to be requested")
+	testutil.Assert(t, storeB.LastSeriesReq == nil, "expected store of other tenant not to be queried")
+}
+
+func TestProxyStore_Series_Explanation(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	cls := []Client{
+		&testClient{
+			StoreClient: &mockedStoreAPI{
+				RespSeries: []*storepb.SeriesResponse{
+					storeSeriesResponse(t, labels.FromStrings("a", "a"), []sample{{0, 0}}, []sample{{3, 1}}),
+					storeSeriesResponse(t, labels.FromStrings("a", "b"), []sample{{0, 0}}),
+				},
+			},
+			labelSets: []storepb.LabelSet{{Labels: []storepb.Label{{Name: "ext", Value: "1"}}}},
+			minTime:   1,
+			maxTime:   300,
+		},
+		&testClient{
+			StoreClient: &mockedStoreAPI{},
+			labelSets:   []storepb.LabelSet{{Labels: []storepb.Label{{Name: "ext", Value: "2"}}}},
+			minTime:     1,
+			maxTime:     300,
+		},
+		&testClient{
+			StoreClient: &mockedStoreAPI{},
+			labelSets:   []storepb.LabelSet{{Labels: []storepb.Label{{Name: "ext", Value: "1"}}}},
+			minTime:     400,
+			maxTime:     500,
+		},
+		&testClient{
+			StoreClient: &mockedStoreAPI{RespError: errors.New("unavailable")},
+			minTime:     1,
+			maxTime:     300,
+		},
+	}
+	q := NewProxyStore(nil, func() []Client { return cls }, component.Query, nil, 0*time.Second)
+
+	expl := &Explanation{}
+	s := newStoreSeriesServer(ContextWithExplanation(context.Background(), expl))
+	testutil.Ok(t, q.Series(&storepb.SeriesRequest{
+		MinTime:             1,
+		MaxTime:             300,
+		Matchers:            []storepb.LabelMatcher{{Name: "ext", Value: "1", Type: storepb.LabelMatcher_EQ}},
+		MaxResolutionWindow: 1000,
+		Aggregates:          []storepb.Aggr{storepb.Aggr_COUNT, storepb.Aggr_SUM},
+	}, s))
+	testutil.Equals(t, 2, len(s.SeriesSet))
+	testutil.Equals(t, 1, len(s.Warnings))
+
+	series := expl.Series()
+	testutil.Equals(t, 1, len(series))
+	testutil.Equals(t, `{ext="1"}`, series[0].Matchers)
+	testutil.Equals(t, int64(1000), series[0].MaxResolutionWindow)
+	testutil.Equals(t, []string{"COUNT", "SUM"}, series[0].Aggregates)
+
+	// Filtered out stores are recorded first.
+	stores := series[0].Stores
+	testutil.Equals(t, 4, len(stores))
+	for _, st := range stores {
+		st.DurationSeconds = 0
+		st.begin = time.Time{}
+	}
+	testutil.Equals(t, StoreExplanation{Name: "test", LabelSets: []string{`{ext="2"}`}, MinTime: 1, MaxTime: 300, Reason: "external labels of the store do not match the matchers"}, *stores[0])
+	testutil.Equals(t, StoreExplanation{Name: "test", LabelSets: []string{`{ext="1"}`}, MinTime: 400, MaxTime: 500, Reason: "time range of the store does not overlap with the requested one"}, *stores[1])
+	testutil.Equals(t, StoreExplanation{Name: "test", LabelSets: []string{`{ext="1"}`}, MinTime: 1, MaxTime: 300, Queried: true, Series: 2, Chunks: 3}, *stores[2])
+	testutil.Assert(t, stores[3].Queried, "expected failing store to be queried")
+	testutil.Assert(t, strings.Contains(stores[3].Error, "unavailable"), "expected error of failing store, got %q", stores[3].Error)
+}
+
+func TestProxyStore_Series_ExplanationTenant(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	cls := []Client{
+		&testClient{
+			StoreClient: &mockedStoreAPI{
+				RespSeries: []*storepb.SeriesResponse{
+					storeSeriesResponse(t, labels.FromStrings("a", "a"), []sample{{0, 0}}),
+				},
+			},
+			labelSets: []storepb.LabelSet{
+				{Labels: []storepb.Label{{Name: "team", Value: "a"}}},
+				{Labels: []storepb.Label{{Name: "team", Value: "b"}}},
+			},
+			minTime: 1,
+			maxTime: 300,
+			addr:    "shared",
+		},
+		&testClient{
+			StoreClient: &mockedStoreAPI{},
+			labelSets:   []storepb.LabelSet{{Labels: []storepb.Label{{Name: "team", Value: "b"}}}},
+			minTime:     1,
+			maxTime:     300,
+			addr:        "other",
+		},
+		&testClient{
+			StoreClient: &mockedStoreAPI{},
+			labelSets:   []storepb.LabelSet{{Labels: []storepb.Label{{Name: "team", Value: "b"}}}},
+			minTime:     400,
+			maxTime:     500,
+			addr:        "other-old",
+		},
+	}
+	q := NewProxyStore(nil, func() []Client { return cls }, component.Query, nil, 0*time.Second)
+
+	tenantMatcher := storepb.LabelMatcher{Type: storepb.LabelMatcher_EQ, Name: "team", Value: "a"}
+	ctx := tenancy.ContextWithTenant(context.Background(), &tenancy.Tenant{Name: "team-a", Matchers: []storepb.LabelMatcher{tenantMatcher}})
+	expl := &Explanation{}
+	s := newStoreSeriesServer(ContextWithExplanation(ctx, expl))
+	testutil.Ok(t, q.Series(&storepb.SeriesRequest{
+		MinTime:  1,
+		MaxTime:  300,
+		Matchers: []storepb.LabelMatcher{{Name: "a", Value: ".*", Type: storepb.LabelMatcher_RE}},
+	}, s))
+	testutil.Equals(t, 1, len(s.SeriesSet))
+
+	// Stores of other tenants, including filtered out ones, and label sets of other tenants are not recorded.
+	series := expl.Series()
+	testutil.Equals(t, 1, len(series))
+	stores := series[0].Stores
+	testutil.Equals(t, 1, len(stores))
+	stores[0].DurationSeconds = 0
+	stores[0].begin = time.Time{}
+	testutil.Equals(t, StoreExplanation{Name: "shared", LabelSets: []string{`{team="a"}`}, MinTime: 1, MaxTime: 300, Queried: true, Series: 1, Chunks: 1}, *stores[0])
+}
+
 func TestProxyStore_Series_RegressionFillResponseChannel(t *testing.T) {
 	defer leaktest.CheckTimeout(t, 10*time.Second)()
 
@@ -798,6 +1244,61 @@ func TestProxyStore_LabelNames(t *testing.T) {
 			expectedNames:       []string{"a", "b"},
 			expectedWarningsLen: 1,
 		},
+		{
+			title: "label_names store outside of time range is not queried",
+			storeAPIs: []Client{
+				&testClient{
+					StoreClient: &mockedStoreAPI{
+						RespLabelNames: &storepb.LabelNamesResponse{
+							Names: []string{"a", "b"},
+						},
+					},
+					minTime: 100,
+					maxTime: 200,
+				},
+				&testClient{
+					StoreClient: &mockedStoreAPI{
+						RespError: errors.New("error!"),
+					},
+					minTime: 300,
+					maxTime: 400,
+				},
+			},
+			req: &storepb.LabelNamesRequest{
+				Start:                   150,
+				End:                     250,
+				PartialResponseDisabled: true,
+			},
+			expectedNames:       []string{"a", "b"},
+			expectedWarningsLen: 0,
+		},
+		{
+			title: "label_names store with not matching external labels is not queried",
+			storeAPIs: []Client{
+				&testClient{
+					StoreClient: &mockedStoreAPI{
+						RespLabelNames: &storepb.LabelNamesResponse{
+							Names: []string{"a", "b"},
+						},
+					},
+					labelSets: []storepb.LabelSet{{Labels: []storepb.Label{{Name: "ext", Value: "1"}}}},
+					maxTime:   math.MaxInt64,
+				},
+				&testClient{
+					StoreClient: &mockedStoreAPI{
+						RespError: errors.New("error!"),
+					},
+					labelSets: []storepb.LabelSet{{Labels: []storepb.Label{{Name: "ext", Value: "2"}}}},
+					maxTime:   math.MaxInt64,
+				},
+			},
+			req: &storepb.LabelNamesRequest{
+				Matchers:                []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "ext", Value: "1"}},
+				PartialResponseDisabled: true,
+			},
+			expectedNames:       []string{"a", "b"},
+			expectedWarningsLen: 0,
+		},
 	} {
 		if ok := t.Run(tc.title, func(t *testing.T) {
 			q := NewProxyStore(
@@ -975,6 +1476,7 @@ type storeSeriesServer struct {
 
 	SeriesSet []storepb.Series
 	Warnings  []string
+	Batches   int
 }
 
 func newStoreSeriesServer(ctx context.Context) *storeSeriesServer {
@@ -987,6 +1489,12 @@ func (s *storeSeriesServer) Send(r *storepb.SeriesResponse) error {
 		return nil
 	}
 
+	if b := r.GetBatch(); b != nil {
+		s.Batches++
+		s.SeriesSet = append(s.SeriesSet, b.Series...)
+		return nil
+	}
+
 	if r.GetSeries() == nil {
 		return errors.New("no seriesSet")
 	}
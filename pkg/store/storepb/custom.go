@@ -1,6 +1,7 @@
 package storepb
 
 import (
+	"math"
 	"strings"
 
 	"github.com/prometheus/prometheus/pkg/labels"
@@ -30,6 +31,15 @@ func NewSeriesResponse(series *Series) *SeriesResponse {
 	}
 }
 
+// NewSeriesBatchResponse returns response carrying the given series in a single SeriesBatch.
+func NewSeriesBatchResponse(series []Series) *SeriesResponse {
+	return &SeriesResponse{
+		Result: &SeriesResponse_Batch{
+			Batch: &SeriesBatch{Series: series},
+		},
+	}
+}
+
 // CompareLabels compares two sets of labels.
 func CompareLabels(a, b []Label) int {
 	l := len(a)
@@ -187,3 +197,22 @@ func LabelSetsToString(lsets []LabelSet) string {
 	}
 	return strings.Join(s, "")
 }
+
+// TimeRange returns the requested time range. The whole time range is returned if it was not specified,
+// e.g. by an older client.
+func (m *LabelNamesRequest) TimeRange() (mint, maxt int64) {
+	return timeRangeOrAll(m.Start, m.End)
+}
+
+// TimeRange returns the requested time range. The whole time range is returned if it was not specified,
+// e.g. by an older client.
+func (m *LabelValuesRequest) TimeRange() (mint, maxt int64) {
+	return timeRangeOrAll(m.Start, m.End)
+}
+
+func timeRangeOrAll(start, end int64) (mint, maxt int64) {
+	if start == 0 && end == 0 {
+		return math.MinInt64, math.MaxInt64
+	}
+	return start, end
+}
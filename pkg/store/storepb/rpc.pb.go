@@ -102,12 +102,14 @@ func (PartialResponseStrategy) EnumDescriptor() ([]byte, []int) {
 type Aggr int32
 
 const (
-	Aggr_RAW     Aggr = 0
-	Aggr_COUNT   Aggr = 1
-	Aggr_SUM     Aggr = 2
-	Aggr_MIN     Aggr = 3
-	Aggr_MAX     Aggr = 4
-	Aggr_COUNTER Aggr = 5
+	Aggr_RAW       Aggr = 0
+	Aggr_COUNT     Aggr = 1
+	Aggr_SUM       Aggr = 2
+	Aggr_MIN       Aggr = 3
+	Aggr_MAX       Aggr = 4
+	Aggr_COUNTER   Aggr = 5
+	Aggr_LAST      Aggr = 6
+	Aggr_QUANTILES Aggr = 7
 )
 
 var Aggr_name = map[int32]string{
@@ -117,15 +119,19 @@ var Aggr_name = map[int32]string{
 	3: "MIN",
 	4: "MAX",
 	5: "COUNTER",
+	6: "LAST",
+	7: "QUANTILES",
 }
 
 var Aggr_value = map[string]int32{
-	"RAW":     0,
-	"COUNT":   1,
-	"SUM":     2,
-	"MIN":     3,
-	"MAX":     4,
-	"COUNTER": 5,
+	"RAW":       0,
+	"COUNT":     1,
+	"SUM":       2,
+	"MIN":       3,
+	"MAX":       4,
+	"COUNTER":   5,
+	"LAST":      6,
+	"QUANTILES": 7,
 }
 
 func (x Aggr) String() string {
@@ -180,6 +186,8 @@ type InfoResponse struct {
 	StoreType StoreType `protobuf:"varint,4,opt,name=storeType,proto3,enum=thanos.StoreType" json:"storeType,omitempty"`
 	// label_sets is an unsorted list of `LabelSet`s.
 	LabelSets []LabelSet `protobuf:"bytes,5,rep,name=label_sets,json=labelSets,proto3" json:"label_sets"`
+	/// resolutions are resolutions in milliseconds of data the store holds, 0 for raw data. Empty means raw data only.
+	Resolutions []int64 `protobuf:"varint,6,rep,packed,name=resolutions,proto3" json:"resolutions,omitempty"`
 }
 
 func (m *InfoResponse) Reset()         { *m = InfoResponse{} }
@@ -264,6 +272,9 @@ type SeriesRequest struct {
 	PartialResponseStrategy PartialResponseStrategy `protobuf:"varint,7,opt,name=partial_response_strategy,json=partialResponseStrategy,proto3,enum=thanos.PartialResponseStrategy" json:"partial_response_strategy,omitempty"`
 	// skip_chunks controls whether sending chunks or not in series responses.
 	SkipChunks bool `protobuf:"varint,8,opt,name=skip_chunks,json=skipChunks,proto3" json:"skip_chunks,omitempty"`
+	// response_batch_size is the maximum number of series the client accepts in a single response. Servers may send
+	// up to this many series in one SeriesBatch instead of one series per response. Zero or one disables batching.
+	ResponseBatchSize int64 `protobuf:"varint,9,opt,name=response_batch_size,json=responseBatchSize,proto3" json:"response_batch_size,omitempty"`
 }
 
 func (m *SeriesRequest) Reset()         { *m = SeriesRequest{} }
@@ -303,6 +314,7 @@ type SeriesResponse struct {
 	// Types that are valid to be assigned to Result:
 	//	*SeriesResponse_Series
 	//	*SeriesResponse_Warning
+	//	*SeriesResponse_Batch
 	Result isSeriesResponse_Result `protobuf_oneof:"result"`
 }
 
@@ -351,9 +363,13 @@ type SeriesResponse_Series struct {
 type SeriesResponse_Warning struct {
 	Warning string `protobuf:"bytes,2,opt,name=warning,proto3,oneof" json:"warning,omitempty"`
 }
+type SeriesResponse_Batch struct {
+	Batch *SeriesBatch `protobuf:"bytes,3,opt,name=batch,proto3,oneof" json:"batch,omitempty"`
+}
 
 func (*SeriesResponse_Series) isSeriesResponse_Result()  {}
 func (*SeriesResponse_Warning) isSeriesResponse_Result() {}
+func (*SeriesResponse_Batch) isSeriesResponse_Result()   {}
 
 func (m *SeriesResponse) GetResult() isSeriesResponse_Result {
 	if m != nil {
@@ -376,25 +392,76 @@ func (m *SeriesResponse) GetWarning() string {
 	return ""
 }
 
+func (m *SeriesResponse) GetBatch() *SeriesBatch {
+	if x, ok := m.GetResult().(*SeriesResponse_Batch); ok {
+		return x.Batch
+	}
+	return nil
+}
+
 // XXX_OneofWrappers is for the internal use of the proto package.
 func (*SeriesResponse) XXX_OneofWrappers() []interface{} {
 	return []interface{}{
 		(*SeriesResponse_Series)(nil),
 		(*SeriesResponse_Warning)(nil),
+		(*SeriesResponse_Batch)(nil),
+	}
+}
+
+type SeriesBatch struct {
+	Series []Series `protobuf:"bytes,1,rep,name=series,proto3" json:"series"`
+}
+
+func (m *SeriesBatch) Reset()         { *m = SeriesBatch{} }
+func (m *SeriesBatch) String() string { return proto.CompactTextString(m) }
+func (*SeriesBatch) ProtoMessage()    {}
+func (*SeriesBatch) Descriptor() ([]byte, []int) {
+	return fileDescriptor_77a6da22d6a3feb1, []int{5}
+}
+func (m *SeriesBatch) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *SeriesBatch) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_SeriesBatch.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
 	}
 }
+func (m *SeriesBatch) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SeriesBatch.Merge(m, src)
+}
+func (m *SeriesBatch) XXX_Size() int {
+	return m.Size()
+}
+func (m *SeriesBatch) XXX_DiscardUnknown() {
+	xxx_messageInfo_SeriesBatch.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SeriesBatch proto.InternalMessageInfo
 
 type LabelNamesRequest struct {
 	PartialResponseDisabled bool `protobuf:"varint,1,opt,name=partial_response_disabled,json=partialResponseDisabled,proto3" json:"partial_response_disabled,omitempty"`
 	// TODO(bwplotka): Move Thanos components to use strategy instead. Including QueryAPI.
 	PartialResponseStrategy PartialResponseStrategy `protobuf:"varint,2,opt,name=partial_response_strategy,json=partialResponseStrategy,proto3,enum=thanos.PartialResponseStrategy" json:"partial_response_strategy,omitempty"`
+	/// start and end limit label names to the ones of series having data within the given time range.
+	/// If both are zero (e.g. request from older client), all known label names are considered.
+	Start int64 `protobuf:"varint,3,opt,name=start,proto3" json:"start,omitempty"`
+	End   int64 `protobuf:"varint,4,opt,name=end,proto3" json:"end,omitempty"`
+	/// matchers, if specified, limit label names to the ones of series matching all of them.
+	Matchers []LabelMatcher `protobuf:"bytes,5,rep,name=matchers,proto3" json:"matchers"`
 }
 
 func (m *LabelNamesRequest) Reset()         { *m = LabelNamesRequest{} }
 func (m *LabelNamesRequest) String() string { return proto.CompactTextString(m) }
 func (*LabelNamesRequest) ProtoMessage()    {}
 func (*LabelNamesRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_77a6da22d6a3feb1, []int{5}
+	return fileDescriptor_77a6da22d6a3feb1, []int{6}
 }
 func (m *LabelNamesRequest) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -432,7 +499,7 @@ func (m *LabelNamesResponse) Reset()         { *m = LabelNamesResponse{} }
 func (m *LabelNamesResponse) String() string { return proto.CompactTextString(m) }
 func (*LabelNamesResponse) ProtoMessage()    {}
 func (*LabelNamesResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_77a6da22d6a3feb1, []int{6}
+	return fileDescriptor_77a6da22d6a3feb1, []int{7}
 }
 func (m *LabelNamesResponse) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -466,13 +533,19 @@ type LabelValuesRequest struct {
 	PartialResponseDisabled bool   `protobuf:"varint,2,opt,name=partial_response_disabled,json=partialResponseDisabled,proto3" json:"partial_response_disabled,omitempty"`
 	// TODO(bwplotka): Move Thanos components to use strategy instead. Including QueryAPI.
 	PartialResponseStrategy PartialResponseStrategy `protobuf:"varint,3,opt,name=partial_response_strategy,json=partialResponseStrategy,proto3,enum=thanos.PartialResponseStrategy" json:"partial_response_strategy,omitempty"`
+	/// start and end limit label values to the ones of series having data within the given time range.
+	/// If both are zero (e.g. request from older client), all known label values are considered.
+	Start int64 `protobuf:"varint,4,opt,name=start,proto3" json:"start,omitempty"`
+	End   int64 `protobuf:"varint,5,opt,name=end,proto3" json:"end,omitempty"`
+	/// matchers, if specified, limit label values to the ones of series matching all of them.
+	Matchers []LabelMatcher `protobuf:"bytes,6,rep,name=matchers,proto3" json:"matchers"`
 }
 
 func (m *LabelValuesRequest) Reset()         { *m = LabelValuesRequest{} }
 func (m *LabelValuesRequest) String() string { return proto.CompactTextString(m) }
 func (*LabelValuesRequest) ProtoMessage()    {}
 func (*LabelValuesRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_77a6da22d6a3feb1, []int{7}
+	return fileDescriptor_77a6da22d6a3feb1, []int{8}
 }
 func (m *LabelValuesRequest) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -510,7 +583,7 @@ func (m *LabelValuesResponse) Reset()         { *m = LabelValuesResponse{} }
 func (m *LabelValuesResponse) String() string { return proto.CompactTextString(m) }
 func (*LabelValuesResponse) ProtoMessage()    {}
 func (*LabelValuesResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_77a6da22d6a3feb1, []int{8}
+	return fileDescriptor_77a6da22d6a3feb1, []int{9}
 }
 func (m *LabelValuesResponse) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -548,6 +621,7 @@ func init() {
 	proto.RegisterType((*LabelSet)(nil), "thanos.LabelSet")
 	proto.RegisterType((*SeriesRequest)(nil), "thanos.SeriesRequest")
 	proto.RegisterType((*SeriesResponse)(nil), "thanos.SeriesResponse")
+	proto.RegisterType((*SeriesBatch)(nil), "thanos.SeriesBatch")
 	proto.RegisterType((*LabelNamesRequest)(nil), "thanos.LabelNamesRequest")
 	proto.RegisterType((*LabelNamesResponse)(nil), "thanos.LabelNamesResponse")
 	proto.RegisterType((*LabelValuesRequest)(nil), "thanos.LabelValuesRequest")
@@ -557,58 +631,66 @@ func init() {
 func init() { proto.RegisterFile("rpc.proto", fileDescriptor_77a6da22d6a3feb1) }
 
 var fileDescriptor_77a6da22d6a3feb1 = []byte{
-	// 814 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x55, 0x4f, 0x6f, 0xe3, 0x44,
-	0x14, 0xf7, 0xd8, 0x89, 0x13, 0xbf, 0x6c, 0x2b, 0xef, 0x34, 0xbb, 0xeb, 0x1a, 0x29, 0xad, 0x2c,
-	0x21, 0x45, 0x05, 0x65, 0x21, 0x08, 0x10, 0xdc, 0x92, 0xac, 0x57, 0x1b, 0xb1, 0x4d, 0x60, 0x92,
-	0x6c, 0xf8, 0x73, 0x08, 0x4e, 0x3b, 0xb8, 0xd6, 0x3a, 0xb6, 0xf1, 0x38, 0xb4, 0xbd, 0xf2, 0x09,
-	0xb8, 0xf2, 0x1d, 0xf8, 0x16, 0x5c, 0x7a, 0xdc, 0x23, 0x5c, 0x10, 0xb4, 0x5f, 0x04, 0x79, 0x3c,
-	0x4e, 0x62, 0x68, 0x2b, 0xad, 0x72, 0x9b, 0xf7, 0xfb, 0xbd, 0x79, 0x6f, 0xde, 0xef, 0xbd, 0x99,
-	0x01, 0x2d, 0x8e, 0x4e, 0x5a, 0x51, 0x1c, 0x26, 0x21, 0x56, 0x93, 0x33, 0x27, 0x08, 0x99, 0x59,
-	0x4b, 0x2e, 0x23, 0xca, 0x32, 0xd0, 0xac, 0xbb, 0xa1, 0x1b, 0xf2, 0xe5, 0xd3, 0x74, 0x95, 0xa1,
-	0xd6, 0x0e, 0xd4, 0xfa, 0xc1, 0x0f, 0x21, 0xa1, 0x3f, 0x2e, 0x29, 0x4b, 0xac, 0x3f, 0x11, 0x3c,
-	0xc8, 0x6c, 0x16, 0x85, 0x01, 0xa3, 0xf8, 0x3d, 0x50, 0x7d, 0x67, 0x4e, 0x7d, 0x66, 0xa0, 0x43,
-	0xa5, 0x59, 0x6b, 0xef, 0xb4, 0xb2, 0xd8, 0xad, 0x97, 0x29, 0xda, 0x2d, 0x5d, 0xfd, 0x75, 0x20,
-	0x11, 0xe1, 0x82, 0xf7, 0xa1, 0xba, 0xf0, 0x82, 0x59, 0xe2, 0x2d, 0xa8, 0x21, 0x1f, 0xa2, 0xa6,
-	0x42, 0x2a, 0x0b, 0x2f, 0x18, 0x7b, 0x0b, 0xca, 0x29, 0xe7, 0x22, 0xa3, 0x14, 0x41, 0x39, 0x17,
-	0x9c, 0x7a, 0x0a, 0x1a, 0x4b, 0xc2, 0x98, 0x8e, 0x2f, 0x23, 0x6a, 0x94, 0x0e, 0x51, 0x73, 0xb7,
-	0xfd, 0x30, 0xcf, 0x32, 0xca, 0x09, 0xb2, 0xf6, 0xc1, 0x1f, 0x03, 0xf0, 0x84, 0x33, 0x46, 0x13,
-	0x66, 0x94, 0xf9, 0xb9, 0xf4, 0xc2, 0xb9, 0x46, 0x34, 0x11, 0x47, 0xd3, 0x7c, 0x61, 0x33, 0xeb,
-	0x53, 0xa8, 0xe6, 0xe4, 0x5b, 0x95, 0x65, 0xfd, 0xaa, 0xc0, 0xce, 0x88, 0xc6, 0x1e, 0x65, 0x42,
-	0xa6, 0x42, 0xa1, 0xe8, 0xee, 0x42, 0xe5, 0x62, 0xa1, 0x9f, 0xa4, 0x54, 0x72, 0x72, 0x46, 0x63,
-	0x66, 0x28, 0x3c, 0x6d, 0xbd, 0x90, 0xf6, 0x38, 0x23, 0x45, 0xf6, 0x95, 0x2f, 0x6e, 0xc3, 0xa3,
-	0x34, 0x64, 0x4c, 0x59, 0xe8, 0x2f, 0x13, 0x2f, 0x0c, 0x66, 0xe7, 0x5e, 0x70, 0x1a, 0x9e, 0x73,
-	0xb1, 0x14, 0xb2, 0xb7, 0x70, 0x2e, 0xc8, 0x8a, 0x9b, 0x72, 0x0a, 0xbf, 0x0f, 0xe0, 0xb8, 0x6e,
-	0x4c, 0x5d, 0x27, 0xa1, 0x99, 0x46, 0xbb, 0xed, 0x07, 0x79, 0xb6, 0x8e, 0xeb, 0xc6, 0x64, 0x83,
-	0xc7, 0x9f, 0xc3, 0x7e, 0xe4, 0xc4, 0x89, 0xe7, 0xf8, 0x69, 0x16, 0xde, 0xf9, 0xd9, 0xa9, 0xc7,
-	0x9c, 0xb9, 0x4f, 0x4f, 0x0d, 0xf5, 0x10, 0x35, 0xab, 0xe4, 0x89, 0x70, 0xc8, 0x27, 0xe3, 0x99,
-	0xa0, 0xf1, 0x77, 0xb7, 0xec, 0x65, 0x49, 0xec, 0x24, 0xd4, 0xbd, 0x34, 0x2a, 0xbc, 0x9d, 0x07,
-	0x79, 0xe2, 0x2f, 0x8b, 0x31, 0x46, 0xc2, 0xed, 0x7f, 0xc1, 0x73, 0x02, 0x1f, 0x40, 0x8d, 0xbd,
-	0xf6, 0xa2, 0xd9, 0xc9, 0xd9, 0x32, 0x78, 0xcd, 0x8c, 0x2a, 0x3f, 0x0a, 0xa4, 0x50, 0x8f, 0x23,
-	0xd6, 0xf7, 0xb0, 0x9b, 0xb7, 0x46, 0x4c, 0x6c, 0x13, 0x54, 0xc6, 0x11, 0xde, 0x99, 0x5a, 0x7b,
-	0x77, 0x35, 0x4b, 0x1c, 0x7d, 0x21, 0x11, 0xc1, 0x63, 0x13, 0x2a, 0xe7, 0x4e, 0x1c, 0x78, 0x81,
-	0xcb, 0x3b, 0xa5, 0xbd, 0x90, 0x48, 0x0e, 0x74, 0xab, 0xa0, 0xc6, 0x94, 0x2d, 0xfd, 0xc4, 0xfa,
-	0x0d, 0xc1, 0x43, 0xde, 0x9e, 0x81, 0xb3, 0x58, 0x4f, 0xc0, 0xbd, 0x8a, 0xa1, 0x2d, 0x14, 0x93,
-	0xb7, 0x53, 0xcc, 0x7a, 0x0e, 0x78, 0xf3, 0xb4, 0x42, 0x94, 0x3a, 0x94, 0x83, 0x14, 0xe0, 0xe3,
-	0xae, 0x91, 0xcc, 0xc0, 0x26, 0x54, 0x45, 0xbd, 0xcc, 0x90, 0x39, 0xb1, 0xb2, 0xad, 0xdf, 0x91,
-	0x08, 0xf4, 0xca, 0xf1, 0x97, 0xeb, 0xba, 0xeb, 0x50, 0xe6, 0xb7, 0x82, 0xd7, 0xa8, 0x91, 0xcc,
-	0xb8, 0x5f, 0x0d, 0x79, 0x0b, 0x35, 0x94, 0x2d, 0xd5, 0xe8, 0xc3, 0x5e, 0xa1, 0x08, 0x21, 0xc7,
-	0x63, 0x50, 0x7f, 0xe2, 0x88, 0xd0, 0x43, 0x58, 0xf7, 0x09, 0x72, 0x44, 0x40, 0x5b, 0xbd, 0x46,
-	0xb8, 0x06, 0x95, 0xc9, 0xe0, 0x8b, 0xc1, 0x70, 0x3a, 0xd0, 0x25, 0xac, 0x41, 0xf9, 0xab, 0x89,
-	0x4d, 0xbe, 0xd1, 0x11, 0xae, 0x42, 0x89, 0x4c, 0x5e, 0xda, 0xba, 0x9c, 0x7a, 0x8c, 0xfa, 0xcf,
-	0xec, 0x5e, 0x87, 0xe8, 0x4a, 0xea, 0x31, 0x1a, 0x0f, 0x89, 0xad, 0x97, 0x52, 0x9c, 0xd8, 0x3d,
-	0xbb, 0xff, 0xca, 0xd6, 0xcb, 0x47, 0x2d, 0x78, 0x72, 0x47, 0x49, 0x69, 0xa4, 0x69, 0x87, 0x88,
-	0xf0, 0x9d, 0xee, 0x90, 0x8c, 0x75, 0x74, 0xd4, 0x85, 0x52, 0x7a, 0x77, 0x71, 0x05, 0x14, 0xd2,
-	0x99, 0x66, 0x5c, 0x6f, 0x38, 0x19, 0x8c, 0x75, 0x94, 0x62, 0xa3, 0xc9, 0xb1, 0x2e, 0xa7, 0x8b,
-	0xe3, 0xfe, 0x40, 0x57, 0xf8, 0xa2, 0xf3, 0x75, 0x96, 0x93, 0x7b, 0xd9, 0x44, 0x2f, 0xb7, 0x7f,
-	0x96, 0xa1, 0xcc, 0x0b, 0xc1, 0x1f, 0x42, 0x29, 0x7d, 0xeb, 0xf1, 0x5e, 0x2e, 0xef, 0xc6, 0x4f,
-	0x60, 0xd6, 0x8b, 0xa0, 0x10, 0xee, 0x33, 0x50, 0xb3, 0x6b, 0x84, 0x1f, 0x15, 0xaf, 0x55, 0xbe,
-	0xed, 0xf1, 0x7f, 0xe1, 0x6c, 0xe3, 0x07, 0x08, 0xf7, 0x00, 0xd6, 0x83, 0x89, 0xf7, 0x0b, 0x2f,
-	0xdf, 0xe6, 0xd5, 0x32, 0xcd, 0xdb, 0x28, 0x91, 0xff, 0x39, 0xd4, 0x36, 0xfa, 0x89, 0x8b, 0xae,
-	0x85, 0x49, 0x35, 0xdf, 0xb9, 0x95, 0xcb, 0xe2, 0x74, 0xdf, 0xbd, 0xfa, 0xa7, 0x21, 0x5d, 0x5d,
-	0x37, 0xd0, 0x9b, 0xeb, 0x06, 0xfa, 0xfb, 0xba, 0x81, 0x7e, 0xb9, 0x69, 0x48, 0x6f, 0x6e, 0x1a,
-	0xd2, 0x1f, 0x37, 0x0d, 0xe9, 0xdb, 0x0a, 0xff, 0x6b, 0xa2, 0xf9, 0x5c, 0xe5, 0x9f, 0xe4, 0x47,
-	0xff, 0x06, 0x00, 0x00, 0xff, 0xff, 0xa5, 0x34, 0x17, 0xba, 0x5c, 0x07, 0x00, 0x00,
+	// 939 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x56, 0x41, 0x6f, 0xe3, 0x44,
+	0x14, 0x8e, 0xed, 0xd8, 0x89, 0x9f, 0xb7, 0x95, 0x3b, 0xcd, 0xee, 0xba, 0x41, 0x4a, 0x23, 0x4b,
+	0x48, 0x51, 0x77, 0x95, 0x85, 0x20, 0x40, 0xc0, 0x29, 0xcd, 0x7a, 0xd5, 0x88, 0x36, 0x65, 0xc7,
+	0xc9, 0x16, 0xd8, 0x43, 0xe4, 0xb4, 0x83, 0x6b, 0x6d, 0x62, 0x07, 0x8f, 0x43, 0xdb, 0x3d, 0x72,
+	0x06, 0x89, 0xff, 0xc0, 0x9f, 0x29, 0xb7, 0x3d, 0x72, 0x42, 0xd0, 0xfe, 0x0c, 0x2e, 0xc8, 0x33,
+	0xe3, 0x24, 0x66, 0xb3, 0x15, 0x55, 0xb9, 0xcd, 0xfb, 0xbe, 0xe7, 0xf7, 0x9e, 0xbf, 0xf7, 0xe6,
+	0xd9, 0xa0, 0xc7, 0xd3, 0xe3, 0xe6, 0x34, 0x8e, 0x92, 0x08, 0x69, 0xc9, 0xa9, 0x17, 0x46, 0xb4,
+	0x6a, 0x24, 0x17, 0x53, 0x42, 0x39, 0x58, 0xad, 0xf8, 0x91, 0x1f, 0xb1, 0xe3, 0x93, 0xf4, 0xc4,
+	0x51, 0x7b, 0x0d, 0x8c, 0x6e, 0xf8, 0x5d, 0x84, 0xc9, 0xf7, 0x33, 0x42, 0x13, 0xfb, 0x6f, 0x09,
+	0xee, 0x71, 0x9b, 0x4e, 0xa3, 0x90, 0x12, 0xf4, 0x08, 0xb4, 0xb1, 0x37, 0x22, 0x63, 0x6a, 0x49,
+	0x75, 0xa5, 0x61, 0xb4, 0xd6, 0x9a, 0x3c, 0x76, 0x73, 0x3f, 0x45, 0x77, 0x8b, 0x97, 0x7f, 0x6c,
+	0x17, 0xb0, 0x70, 0x41, 0x5b, 0x50, 0x9e, 0x04, 0xe1, 0x30, 0x09, 0x26, 0xc4, 0x92, 0xeb, 0x52,
+	0x43, 0xc1, 0xa5, 0x49, 0x10, 0xf6, 0x83, 0x09, 0x61, 0x94, 0x77, 0xce, 0x29, 0x45, 0x50, 0xde,
+	0x39, 0xa3, 0x9e, 0x80, 0x4e, 0x93, 0x28, 0x26, 0xfd, 0x8b, 0x29, 0xb1, 0x8a, 0x75, 0xa9, 0xb1,
+	0xde, 0xda, 0xc8, 0xb2, 0xb8, 0x19, 0x81, 0x17, 0x3e, 0xe8, 0x63, 0x00, 0x96, 0x70, 0x48, 0x49,
+	0x42, 0x2d, 0x95, 0xd5, 0x65, 0xe6, 0xea, 0x72, 0x49, 0x22, 0x4a, 0xd3, 0xc7, 0xc2, 0xa6, 0xa8,
+	0x0e, 0x46, 0x4c, 0x68, 0x34, 0x9e, 0x25, 0x41, 0x14, 0x52, 0x4b, 0xab, 0x2b, 0x0d, 0x05, 0x2f,
+	0x43, 0xf6, 0xa7, 0x50, 0xce, 0x1e, 0xbf, 0xd5, 0x8b, 0xdb, 0xbf, 0x29, 0xb0, 0xe6, 0x92, 0x38,
+	0x20, 0x54, 0x08, 0x99, 0x93, 0x42, 0x7a, 0xb7, 0x14, 0x72, 0x5e, 0x8a, 0x4f, 0x52, 0x2a, 0x39,
+	0x3e, 0x25, 0x31, 0xb5, 0x14, 0x96, 0xb6, 0x92, 0x4b, 0x7b, 0xc0, 0x49, 0x91, 0x7d, 0xee, 0x8b,
+	0x5a, 0x70, 0x3f, 0x0d, 0xb9, 0x78, 0x97, 0xe1, 0x59, 0x10, 0x9e, 0x44, 0x67, 0x4c, 0x4e, 0x05,
+	0x6f, 0x4e, 0xbc, 0x73, 0x3c, 0xe7, 0x8e, 0x18, 0x85, 0x1e, 0x03, 0x78, 0xbe, 0x1f, 0x13, 0xdf,
+	0x4b, 0x08, 0x57, 0x71, 0xbd, 0x75, 0x2f, 0xcb, 0xd6, 0xf6, 0xfd, 0x18, 0x2f, 0xf1, 0xe8, 0x73,
+	0xd8, 0x9a, 0x7a, 0x71, 0x12, 0x78, 0xe3, 0x61, 0x2c, 0x66, 0x63, 0x78, 0x12, 0x50, 0x6f, 0x34,
+	0x26, 0x27, 0x96, 0x56, 0x97, 0x1a, 0x65, 0xfc, 0x50, 0x38, 0x64, 0xb3, 0xf3, 0x54, 0xd0, 0xe8,
+	0xe5, 0x8a, 0x67, 0x69, 0x12, 0x7b, 0x09, 0xf1, 0x2f, 0xac, 0x12, 0x6b, 0xf8, 0x76, 0x96, 0xf8,
+	0xab, 0x7c, 0x0c, 0x57, 0xb8, 0xbd, 0x15, 0x3c, 0x23, 0xd0, 0x36, 0x18, 0xf4, 0x55, 0x30, 0x1d,
+	0x1e, 0x9f, 0xce, 0xc2, 0x57, 0xd4, 0x2a, 0xb3, 0x52, 0x20, 0x85, 0x3a, 0x0c, 0x41, 0x4d, 0xd8,
+	0x9c, 0x67, 0x1d, 0xa5, 0x82, 0x0d, 0x69, 0xf0, 0x9a, 0x58, 0x3a, 0x53, 0x66, 0x23, 0xa3, 0x76,
+	0x53, 0xc6, 0x0d, 0x5e, 0x13, 0xfb, 0x67, 0x09, 0xd6, 0xb3, 0x5e, 0x72, 0x0e, 0x35, 0x40, 0xa3,
+	0x0c, 0x61, 0xad, 0x34, 0x5a, 0xeb, 0xf3, 0xf1, 0x64, 0xe8, 0x5e, 0x01, 0x0b, 0x1e, 0x55, 0xa1,
+	0x74, 0xe6, 0xc5, 0x61, 0x10, 0xfa, 0xac, 0xb5, 0xfa, 0x5e, 0x01, 0x67, 0x00, 0x7a, 0x04, 0x2a,
+	0xcb, 0xcf, 0xe6, 0xdf, 0x68, 0x6d, 0xe6, 0x83, 0xb0, 0x02, 0xf6, 0x0a, 0x98, 0xfb, 0xec, 0x96,
+	0x41, 0x8b, 0x09, 0x9d, 0x8d, 0x13, 0xfb, 0x0b, 0x30, 0x96, 0x3c, 0xd0, 0xe3, 0xa5, 0x5a, 0x94,
+	0xb7, 0x6b, 0xc9, 0x06, 0x93, 0xfb, 0xd8, 0x3f, 0xc9, 0xb0, 0xc1, 0x26, 0xa7, 0xe7, 0x4d, 0x16,
+	0xc3, 0x79, 0x63, 0x33, 0xa5, 0x3b, 0x34, 0x53, 0xbe, 0x63, 0x33, 0x2b, 0xa0, 0xd2, 0xc4, 0x8b,
+	0x13, 0xb1, 0x22, 0xb8, 0x81, 0x4c, 0x50, 0x48, 0x78, 0x22, 0x66, 0x39, 0x3d, 0xe6, 0xee, 0x89,
+	0xfa, 0xdf, 0xef, 0x89, 0xfd, 0x0c, 0xd0, 0xb2, 0x1a, 0xa2, 0xbd, 0x15, 0x50, 0x43, 0x6f, 0x22,
+	0x14, 0xd5, 0x31, 0x37, 0x50, 0x15, 0xca, 0xa2, 0x73, 0xd4, 0x92, 0x19, 0x31, 0xb7, 0xed, 0x5f,
+	0x65, 0x11, 0xe8, 0x85, 0x37, 0x9e, 0x2d, 0x74, 0xad, 0x80, 0xca, 0x16, 0x02, 0xd3, 0x50, 0xc7,
+	0xdc, 0xb8, 0x59, 0x6d, 0xf9, 0x0e, 0x6a, 0x2b, 0xff, 0x97, 0xda, 0xc5, 0x15, 0x6a, 0xab, 0xab,
+	0xd5, 0xd6, 0x6e, 0xa1, 0x76, 0x17, 0x36, 0x73, 0x22, 0x09, 0xb9, 0x1f, 0x80, 0xf6, 0x03, 0x43,
+	0x84, 0xde, 0xc2, 0xba, 0x49, 0xf0, 0x1d, 0x0c, 0xfa, 0xfc, 0x53, 0x80, 0x0c, 0x28, 0x0d, 0x7a,
+	0x5f, 0xf6, 0x0e, 0x8f, 0x7a, 0x66, 0x01, 0xe9, 0xa0, 0x3e, 0x1f, 0x38, 0xf8, 0x1b, 0x53, 0x42,
+	0x65, 0x28, 0xe2, 0xc1, 0xbe, 0x63, 0xca, 0xa9, 0x87, 0xdb, 0x7d, 0xea, 0x74, 0xda, 0xd8, 0x54,
+	0x52, 0x0f, 0xb7, 0x7f, 0x88, 0x1d, 0xb3, 0x98, 0xe2, 0xd8, 0xe9, 0x38, 0xdd, 0x17, 0x8e, 0xa9,
+	0xee, 0x34, 0xe1, 0xe1, 0x3b, 0x24, 0x4b, 0x23, 0x1d, 0xb5, 0xb1, 0x08, 0xdf, 0xde, 0x3d, 0xc4,
+	0x7d, 0x53, 0xda, 0x79, 0x09, 0xc5, 0x74, 0x2d, 0xa2, 0x12, 0x28, 0xb8, 0x7d, 0xc4, 0xb9, 0xce,
+	0xe1, 0xa0, 0xd7, 0x37, 0xa5, 0x14, 0x73, 0x07, 0x07, 0xa6, 0x9c, 0x1e, 0x0e, 0xba, 0x3d, 0x53,
+	0x61, 0x87, 0xf6, 0xd7, 0x3c, 0x27, 0xf3, 0x72, 0xb0, 0xa9, 0xa6, 0x81, 0xf7, 0xdb, 0x6e, 0xdf,
+	0xd4, 0xd0, 0x1a, 0xe8, 0xcf, 0x07, 0xed, 0x5e, 0xbf, 0xbb, 0xef, 0xb8, 0x66, 0xa9, 0xf5, 0xa3,
+	0x0c, 0x2a, 0x7b, 0x43, 0xf4, 0x21, 0x14, 0xd3, 0x2f, 0x30, 0x9a, 0xef, 0x87, 0xa5, 0xef, 0x73,
+	0xb5, 0x92, 0x07, 0x85, 0xa2, 0x9f, 0x81, 0xc6, 0x6f, 0x3f, 0xba, 0x9f, 0xdf, 0x06, 0xd9, 0x63,
+	0x0f, 0xfe, 0x0d, 0xf3, 0x07, 0x3f, 0x90, 0x50, 0x07, 0x60, 0x71, 0x23, 0xd0, 0x56, 0xae, 0xaf,
+	0xcb, 0x3b, 0xa3, 0x5a, 0x5d, 0x45, 0x89, 0xfc, 0xcf, 0xc0, 0x58, 0x6a, 0x34, 0xca, 0xbb, 0xe6,
+	0xae, 0x48, 0xf5, 0xbd, 0x95, 0x9c, 0xd8, 0xc1, 0xef, 0x5f, 0xfe, 0x55, 0x2b, 0x5c, 0x5e, 0xd5,
+	0xa4, 0x37, 0x57, 0x35, 0xe9, 0xcf, 0xab, 0x9a, 0xf4, 0xcb, 0x75, 0xad, 0xf0, 0xe6, 0xba, 0x56,
+	0xf8, 0xfd, 0xba, 0x56, 0xf8, 0xb6, 0xc4, 0xfe, 0x00, 0xa6, 0xa3, 0x91, 0xc6, 0x7e, 0x5d, 0x3e,
+	0xfa, 0x67, 0x00, 0x81, 0xb3, 0x38, 0x7e, 0xf2, 0x08, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -892,6 +974,25 @@ func (m *InfoResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if len(m.Resolutions) > 0 {
+		dAtA2 := make([]byte, len(m.Resolutions)*10)
+		var j1 int
+		for _, num1 := range m.Resolutions {
+			num := uint64(num1)
+			for num >= 1<<7 {
+				dAtA2[j1] = uint8(uint64(num)&0x7f | 0x80)
+				num >>= 7
+				j1++
+			}
+			dAtA2[j1] = uint8(num)
+			j1++
+		}
+		i -= j1
+		copy(dAtA[i:], dAtA2[:j1])
+		i = encodeVarintRpc(dAtA, i, uint64(j1))
+		i--
+		dAtA[i] = 0x32
+	}
 	if len(m.LabelSets) > 0 {
 		for iNdEx := len(m.LabelSets) - 1; iNdEx >= 0; iNdEx-- {
 			{
@@ -995,6 +1096,11 @@ func (m *SeriesRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.ResponseBatchSize != 0 {
+		i = encodeVarintRpc(dAtA, i, uint64(m.ResponseBatchSize))
+		i--
+		dAtA[i] = 0x48
+	}
 	if m.SkipChunks {
 		i--
 		if m.SkipChunks {
@@ -1021,20 +1127,20 @@ func (m *SeriesRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 		dAtA[i] = 0x30
 	}
 	if len(m.Aggregates) > 0 {
-		dAtA2 := make([]byte, len(m.Aggregates)*10)
-		var j1 int
+		dAtA4 := make([]byte, len(m.Aggregates)*10)
+		var j3 int
 		for _, num := range m.Aggregates {
 			for num >= 1<<7 {
-				dAtA2[j1] = uint8(uint64(num)&0x7f | 0x80)
+				dAtA4[j3] = uint8(uint64(num)&0x7f | 0x80)
 				num >>= 7
-				j1++
+				j3++
 			}
-			dAtA2[j1] = uint8(num)
-			j1++
+			dAtA4[j3] = uint8(num)
+			j3++
 		}
-		i -= j1
-		copy(dAtA[i:], dAtA2[:j1])
-		i = encodeVarintRpc(dAtA, i, uint64(j1))
+		i -= j3
+		copy(dAtA[i:], dAtA4[:j3])
+		i = encodeVarintRpc(dAtA, i, uint64(j3))
 		i--
 		dAtA[i] = 0x2a
 	}
@@ -1137,6 +1243,64 @@ func (m *SeriesResponse_Warning) MarshalToSizedBuffer(dAtA []byte) (int, error)
 	dAtA[i] = 0x12
 	return len(dAtA) - i, nil
 }
+func (m *SeriesResponse_Batch) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *SeriesResponse_Batch) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	if m.Batch != nil {
+		{
+			size, err := m.Batch.MarshalToSizedBuffer(dAtA[:i])
+			if err != nil {
+				return 0, err
+			}
+			i -= size
+			i = encodeVarintRpc(dAtA, i, uint64(size))
+		}
+		i--
+		dAtA[i] = 0x1a
+	}
+	return len(dAtA) - i, nil
+}
+func (m *SeriesBatch) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *SeriesBatch) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *SeriesBatch) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.Series) > 0 {
+		for iNdEx := len(m.Series) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Series[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintRpc(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0xa
+		}
+	}
+	return len(dAtA) - i, nil
+}
+
 func (m *LabelNamesRequest) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
@@ -1157,6 +1321,30 @@ func (m *LabelNamesRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if len(m.Matchers) > 0 {
+		for iNdEx := len(m.Matchers) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Matchers[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintRpc(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x2a
+		}
+	}
+	if m.End != 0 {
+		i = encodeVarintRpc(dAtA, i, uint64(m.End))
+		i--
+		dAtA[i] = 0x20
+	}
+	if m.Start != 0 {
+		i = encodeVarintRpc(dAtA, i, uint64(m.Start))
+		i--
+		dAtA[i] = 0x18
+	}
 	if m.PartialResponseStrategy != 0 {
 		i = encodeVarintRpc(dAtA, i, uint64(m.PartialResponseStrategy))
 		i--
@@ -1236,6 +1424,30 @@ func (m *LabelValuesRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if len(m.Matchers) > 0 {
+		for iNdEx := len(m.Matchers) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Matchers[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintRpc(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x32
+		}
+	}
+	if m.End != 0 {
+		i = encodeVarintRpc(dAtA, i, uint64(m.End))
+		i--
+		dAtA[i] = 0x28
+	}
+	if m.Start != 0 {
+		i = encodeVarintRpc(dAtA, i, uint64(m.Start))
+		i--
+		dAtA[i] = 0x20
+	}
 	if m.PartialResponseStrategy != 0 {
 		i = encodeVarintRpc(dAtA, i, uint64(m.PartialResponseStrategy))
 		i--
@@ -1349,6 +1561,13 @@ func (m *InfoResponse) Size() (n int) {
 			n += 1 + l + sovRpc(uint64(l))
 		}
 	}
+	if len(m.Resolutions) > 0 {
+		l = 0
+		for _, e := range m.Resolutions {
+			l += sovRpc(uint64(e))
+		}
+		n += 1 + sovRpc(uint64(l)) + l
+	}
 	return n
 }
 
@@ -1404,6 +1623,9 @@ func (m *SeriesRequest) Size() (n int) {
 	if m.SkipChunks {
 		n += 2
 	}
+	if m.ResponseBatchSize != 0 {
+		n += 1 + sovRpc(uint64(m.ResponseBatchSize))
+	}
 	return n
 }
 
@@ -1441,6 +1663,33 @@ func (m *SeriesResponse_Warning) Size() (n int) {
 	n += 1 + l + sovRpc(uint64(l))
 	return n
 }
+func (m *SeriesResponse_Batch) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Batch != nil {
+		l = m.Batch.Size()
+		n += 1 + l + sovRpc(uint64(l))
+	}
+	return n
+}
+func (m *SeriesBatch) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if len(m.Series) > 0 {
+		for _, e := range m.Series {
+			l = e.Size()
+			n += 1 + l + sovRpc(uint64(l))
+		}
+	}
+	return n
+}
+
 func (m *LabelNamesRequest) Size() (n int) {
 	if m == nil {
 		return 0
@@ -1453,6 +1702,18 @@ func (m *LabelNamesRequest) Size() (n int) {
 	if m.PartialResponseStrategy != 0 {
 		n += 1 + sovRpc(uint64(m.PartialResponseStrategy))
 	}
+	if m.Start != 0 {
+		n += 1 + sovRpc(uint64(m.Start))
+	}
+	if m.End != 0 {
+		n += 1 + sovRpc(uint64(m.End))
+	}
+	if len(m.Matchers) > 0 {
+		for _, e := range m.Matchers {
+			l = e.Size()
+			n += 1 + l + sovRpc(uint64(l))
+		}
+	}
 	return n
 }
 
@@ -1493,6 +1754,18 @@ func (m *LabelValuesRequest) Size() (n int) {
 	if m.PartialResponseStrategy != 0 {
 		n += 1 + sovRpc(uint64(m.PartialResponseStrategy))
 	}
+	if m.Start != 0 {
+		n += 1 + sovRpc(uint64(m.Start))
+	}
+	if m.End != 0 {
+		n += 1 + sovRpc(uint64(m.End))
+	}
+	if len(m.Matchers) > 0 {
+		for _, e := range m.Matchers {
+			l = e.Size()
+			n += 1 + l + sovRpc(uint64(l))
+		}
+	}
 	return n
 }
 
@@ -1730,6 +2003,82 @@ func (m *InfoResponse) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 6:
+			if wireType == 0 {
+				var v int64
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowRpc
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					v |= int64(b&0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				m.Resolutions = append(m.Resolutions, v)
+			} else if wireType == 2 {
+				var packedLen int
+				for shift := uint(0); ; shift += 7 {
+					if shift >= 64 {
+						return ErrIntOverflowRpc
+					}
+					if iNdEx >= l {
+						return io.ErrUnexpectedEOF
+					}
+					b := dAtA[iNdEx]
+					iNdEx++
+					packedLen |= int(b&0x7F) << shift
+					if b < 0x80 {
+						break
+					}
+				}
+				if packedLen < 0 {
+					return ErrInvalidLengthRpc
+				}
+				postIndex := iNdEx + packedLen
+				if postIndex < 0 {
+					return ErrInvalidLengthRpc
+				}
+				if postIndex > l {
+					return io.ErrUnexpectedEOF
+				}
+				var elementCount int
+				var count int
+				for _, integer := range dAtA[iNdEx:postIndex] {
+					if integer < 128 {
+						count++
+					}
+				}
+				elementCount = count
+				if elementCount != 0 && len(m.Resolutions) == 0 {
+					m.Resolutions = make([]int64, 0, elementCount)
+				}
+				for iNdEx < postIndex {
+					var v int64
+					for shift := uint(0); ; shift += 7 {
+						if shift >= 64 {
+							return ErrIntOverflowRpc
+						}
+						if iNdEx >= l {
+							return io.ErrUnexpectedEOF
+						}
+						b := dAtA[iNdEx]
+						iNdEx++
+						v |= int64(b&0x7F) << shift
+						if b < 0x80 {
+							break
+						}
+					}
+					m.Resolutions = append(m.Resolutions, v)
+				}
+			} else {
+				return fmt.Errorf("proto: wrong wireType = %d for field Resolutions", wireType)
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
@@ -2089,6 +2438,25 @@ func (m *SeriesRequest) Unmarshal(dAtA []byte) error {
 				}
 			}
 			m.SkipChunks = bool(v != 0)
+		case 9:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ResponseBatchSize", wireType)
+			}
+			m.ResponseBatchSize = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.ResponseBatchSize |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
@@ -2209,6 +2577,128 @@ func (m *SeriesResponse) Unmarshal(dAtA []byte) error {
 			}
 			m.Result = &SeriesResponse_Warning{string(dAtA[iNdEx:postIndex])}
 			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Batch", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			v := &SeriesBatch{}
+			if err := v.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			m.Result = &SeriesResponse_Batch{v}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipRpc(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *SeriesBatch) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowRpc
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: SeriesBatch: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: SeriesBatch: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Series", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Series = append(m.Series, Series{})
+			if err := m.Series[len(m.Series)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
@@ -2301,6 +2791,78 @@ func (m *LabelNamesRequest) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Start", wireType)
+			}
+			m.Start = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Start |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field End", wireType)
+			}
+			m.End = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.End |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Matchers", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Matchers = append(m.Matchers, LabelMatcher{})
+			if err := m.Matchers[len(m.Matchers)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
@@ -2542,6 +3104,78 @@ func (m *LabelValuesRequest) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Start", wireType)
+			}
+			m.Start = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Start |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field End", wireType)
+			}
+			m.End = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.End |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Matchers", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Matchers = append(m.Matchers, LabelMatcher{})
+			if err := m.Matchers[len(m.Matchers)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
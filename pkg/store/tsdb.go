@@ -102,12 +102,12 @@ func (s *TSDBStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSer
 		return status.Error(codes.Internal, err.Error())
 	}
 
-	var respSeries storepb.Series
-
+	bsrv := newBatchSeriesServer(srv, r.ResponseBatchSize)
 	for set.Next() {
 		series := set.At()
 
-		respSeries.Labels = s.translateAndExtendLabels(series.Labels(), s.externalLabels)
+		// Response is not reused, as batched responses keep the previous series until they are flushed.
+		respSeries := storepb.Series{Labels: s.translateAndExtendLabels(series.Labels(), s.externalLabels)}
 
 		if !r.SkipChunks {
 			// TODO(fabxc): An improvement over this trivial approach would be to directly
@@ -122,13 +122,16 @@ func (s *TSDBStore) Series(r *storepb.SeriesRequest, srv storepb.Store_SeriesSer
 				return status.Errorf(codes.Internal, "encode chunk: %s", err)
 			}
 
-			respSeries.Chunks = append(respSeries.Chunks[:0], c...)
+			respSeries.Chunks = c
 		}
 
-		if err := srv.Send(storepb.NewSeriesResponse(&respSeries)); err != nil {
+		if err := bsrv.Send(storepb.NewSeriesResponse(&respSeries)); err != nil {
 			return status.Error(codes.Aborted, err.Error())
 		}
 	}
+	if err := bsrv.Flush(); err != nil {
+		return status.Error(codes.Aborted, err.Error())
+	}
 	return nil
 }
 
@@ -200,36 +203,126 @@ func (s *TSDBStore) translateAndExtendLabels(m, extend labels.Labels) []storepb.
 	return lset
 }
 
-// LabelNames returns all known label names.
-func (s *TSDBStore) LabelNames(ctx context.Context, _ *storepb.LabelNamesRequest) (
+// LabelNames returns all known label names. If matchers are given, only label names of series matching them
+// within the requested time range are returned.
+func (s *TSDBStore) LabelNames(ctx context.Context, r *storepb.LabelNamesRequest) (
 	*storepb.LabelNamesResponse, error,
 ) {
-	q, err := s.db.Querier(math.MinInt64, math.MaxInt64)
+	match, matchers, err := s.translateLabelMatchers(r.Matchers)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !match {
+		return &storepb.LabelNamesResponse{Names: []string{}}, nil
+	}
+
+	q, err := s.db.Querier(r.TimeRange())
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 	defer runutil.CloseWithLogOnErr(s.logger, q, "close tsdb querier label names")
 
-	res, err := q.LabelNames()
+	if len(matchers) == 0 {
+		res, err := q.LabelNames()
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		return &storepb.LabelNamesResponse{Names: res}, nil
+	}
+
+	set, err := q.Select(matchers...)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
-	return &storepb.LabelNamesResponse{Names: res}, nil
+
+	names := map[string]struct{}{}
+	for set.Next() {
+		for _, l := range set.At().Labels() {
+			names[l.Name] = struct{}{}
+		}
+	}
+	if err := set.Err(); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if len(names) > 0 {
+		for _, l := range s.externalLabels {
+			names[l.Name] = struct{}{}
+		}
+	}
+
+	return &storepb.LabelNamesResponse{Names: sortedKeys(names)}, nil
 }
 
-// LabelValues returns all known label values for a given label name.
+// LabelValues returns all known label values for a given label name. If matchers are given, only label values of
+// series matching them within the requested time range are returned.
 func (s *TSDBStore) LabelValues(ctx context.Context, r *storepb.LabelValuesRequest) (
 	*storepb.LabelValuesResponse, error,
 ) {
-	q, err := s.db.Querier(math.MinInt64, math.MaxInt64)
+	match, matchers, err := s.translateLabelMatchers(r.Matchers)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !match {
+		return &storepb.LabelValuesResponse{Values: []string{}}, nil
+	}
+
+	q, err := s.db.Querier(r.TimeRange())
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 	defer runutil.CloseWithLogOnErr(s.logger, q, "close tsdb querier label values")
 
-	res, err := q.LabelValues(r.Label)
+	if len(matchers) == 0 {
+		res, err := q.LabelValues(r.Label)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		return &storepb.LabelValuesResponse{Values: res}, nil
+	}
+
+	set, err := q.Select(matchers...)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
-	return &storepb.LabelValuesResponse{Values: res}, nil
+
+	extValue := s.externalLabels.Get(r.Label)
+	vals := map[string]struct{}{}
+	for set.Next() {
+		v := extValue
+		if v == "" {
+			v = set.At().Labels().Get(r.Label)
+		}
+		if v != "" {
+			vals[v] = struct{}{}
+		}
+	}
+	if err := set.Err(); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &storepb.LabelValuesResponse{Values: sortedKeys(vals)}, nil
+}
+
+// translateLabelMatchers returns TSDB matchers equivalent to the given ones, excluding the ones on external labels.
+// It returns false if the given matchers do not match external labels.
+func (s *TSDBStore) translateLabelMatchers(ms []storepb.LabelMatcher) (bool, []*labels.Matcher, error) {
+	match, newMatchers, err := matchesExternalLabels(ms, s.externalLabels)
+	if err != nil || !match {
+		return false, nil, err
+	}
+	matchers, err := translateMatchers(newMatchers)
+	if err != nil {
+		return false, nil, err
+	}
+	return true, matchers, nil
+}
+
+// sortedKeys returns sorted keys of the given string set.
+func sortedKeys(set map[string]struct{}) []string {
+	res := make([]string, 0, len(set))
+	for k := range set {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
 }
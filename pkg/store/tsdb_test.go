@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"fmt"
 	"math"
 	"testing"
 	"time"
@@ -159,6 +160,51 @@ func TestTSDBStore_Series(t *testing.T) {
 	}
 }
 
+func TestTSDBStore_Series_ResponseBatching(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	db, err := testutil.NewTSDB()
+	defer func() { testutil.Ok(t, db.Close()) }()
+	testutil.Ok(t, err)
+
+	tsdbStore := NewTSDBStore(nil, nil, db, component.Rule, labels.FromStrings("region", "eu-west"))
+
+	appender := db.Appender()
+	var expected []rawSeries
+	for i := 0; i < 5; i++ {
+		_, err = appender.Add(labels.FromStrings("a", fmt.Sprintf("%d", i)), 1, float64(i))
+		testutil.Ok(t, err)
+		expected = append(expected, rawSeries{
+			lset:   []storepb.Label{{Name: "a", Value: fmt.Sprintf("%d", i)}, {Name: "region", Value: "eu-west"}},
+			chunks: [][]sample{{{1, float64(i)}}},
+		})
+	}
+	testutil.Ok(t, appender.Commit())
+
+	for _, tc := range []struct {
+		batchSize       int64
+		expectedBatches int
+	}{
+		{batchSize: 0, expectedBatches: 0},
+		{batchSize: 1, expectedBatches: 0},
+		{batchSize: 2, expectedBatches: 3},
+		{batchSize: 5, expectedBatches: 1},
+		{batchSize: 100, expectedBatches: 1},
+	} {
+		t.Run(fmt.Sprintf("batch size %d", tc.batchSize), func(t *testing.T) {
+			srv := newStoreSeriesServer(context.Background())
+			testutil.Ok(t, tsdbStore.Series(&storepb.SeriesRequest{
+				MinTime:           0,
+				MaxTime:           2,
+				Matchers:          []storepb.LabelMatcher{{Type: storepb.LabelMatcher_RE, Name: "a", Value: ".+"}},
+				ResponseBatchSize: tc.batchSize,
+			}, srv))
+			testutil.Equals(t, tc.expectedBatches, srv.Batches)
+			seriesEquals(t, expected, srv.SeriesSet)
+		})
+	}
+}
+
 func TestTSDBStore_LabelNames(t *testing.T) {
 	var err error
 	defer leaktest.CheckTimeout(t, 10*time.Second)()
@@ -272,6 +318,65 @@ func TestTSDBStore_LabelValues(t *testing.T) {
 	}
 }
 
+func TestTSDBStore_LabelNamesAndValues_Matchers(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 10*time.Second)()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, err := testutil.NewTSDB()
+	defer func() { testutil.Ok(t, db.Close()) }()
+	testutil.Ok(t, err)
+
+	app := db.Appender()
+	_, err = app.Add(labels.FromStrings("a", "1", "b", "1"), 100, 1)
+	testutil.Ok(t, err)
+	_, err = app.Add(labels.FromStrings("a", "2", "b", "2"), 100, 1)
+	testutil.Ok(t, err)
+	_, err = app.Add(labels.FromStrings("a", "3", "c", "1"), 200, 1)
+	testutil.Ok(t, err)
+	testutil.Ok(t, app.Commit())
+
+	tsdbStore := NewTSDBStore(nil, nil, db, component.Rule, labels.FromStrings("region", "eu-west"))
+
+	names, err := tsdbStore.LabelNames(ctx, &storepb.LabelNamesRequest{
+		Start:    0,
+		End:      300,
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_RE, Name: "a", Value: "1|2"}},
+	})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"a", "b", "region"}, names.Names)
+
+	// Series {a="3"} has no data within the requested time range.
+	vals, err := tsdbStore.LabelValues(ctx, &storepb.LabelValuesRequest{
+		Label:    "a",
+		Start:    0,
+		End:      150,
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_NEQ, Name: "a", Value: "1"}},
+	})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"2"}, vals.Values)
+
+	vals, err = tsdbStore.LabelValues(ctx, &storepb.LabelValuesRequest{
+		Label:    "region",
+		Start:    0,
+		End:      300,
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "c", Value: "1"}},
+	})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"eu-west"}, vals.Values)
+
+	// External labels not matching.
+	vals, err = tsdbStore.LabelValues(ctx, &storepb.LabelValuesRequest{
+		Label:    "a",
+		Start:    0,
+		End:      300,
+		Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "region", Value: "us-east"}},
+	})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{}, vals.Values)
+}
+
 // Regression test for https://github.com/thanos-io/thanos/issues/1038.
 func TestTSDBStore_Series_SplitSamplesIntoChunksWithMaxSizeOfUint16_e2e(t *testing.T) {
 	defer leaktest.CheckTimeout(t, 10*time.Second)()
@@ -0,0 +1,66 @@
+package targets
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/thanos-io/thanos/pkg/promclient"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/targets/targetspb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Prometheus implements targetspb.TargetsServer on top of the Prometheus targets API.
+type Prometheus struct {
+	logger         log.Logger
+	base           *url.URL
+	externalLabels func() labels.Labels
+}
+
+// NewPrometheus creates new targets.Prometheus.
+func NewPrometheus(logger log.Logger, base *url.URL, externalLabels func() labels.Labels) *Prometheus {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &Prometheus{
+		logger:         logger,
+		base:           base,
+		externalLabels: externalLabels,
+	}
+}
+
+// Targets returns scrape targets of the Prometheus instance. External labels are attached to labels of active targets,
+// overwriting existing ones on collision.
+func (p *Prometheus) Targets(ctx context.Context, r *targetspb.TargetsRequest) (*targetspb.TargetsResponse, error) {
+	var state string
+	if r.State != targetspb.TargetsRequest_ANY {
+		state = strings.ToLower(r.State.String())
+	}
+
+	td, err := promclient.Targets(ctx, p.logger, p.base, state)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	// Older Prometheus versions ignore the state parameter.
+	switch r.State {
+	case targetspb.TargetsRequest_ACTIVE:
+		td.DroppedTargets = nil
+	case targetspb.TargetsRequest_DROPPED:
+		td.ActiveTargets = nil
+	}
+
+	extLset := p.externalLabels()
+	for _, t := range td.ActiveTargets {
+		b := labels.NewBuilder(storepb.LabelsToPromLabels(t.Labels))
+		for _, l := range extLset {
+			b.Set(l.Name, l.Value)
+		}
+		t.Labels = targetspb.PromLabelsToLabels(b.Labels())
+	}
+	return &targetspb.TargetsResponse{Targets: targetspb.Merge(*td)}, nil
+}
@@ -0,0 +1,92 @@
+package targets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/targets/targetspb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+const targetsResponse = `{
+  "status": "success",
+  "data": {
+    "activeTargets": [
+      {
+        "discoveredLabels": {"__address__": "localhost:9090", "job": "prometheus"},
+        "labels": {"instance": "localhost:9090", "job": "prometheus", "replica": "target"},
+        "scrapePool": "prometheus",
+        "scrapeUrl": "http://localhost:9090/metrics",
+        "lastError": "",
+        "lastScrape": "2020-01-10T10:00:00Z",
+        "health": "up"
+      }
+    ],
+    "droppedTargets": [
+      {
+        "discoveredLabels": {"__address__": "localhost:9100", "job": "node"}
+      }
+    ]
+  }
+}`
+
+func TestPrometheus_Targets(t *testing.T) {
+	var lastState string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastState = r.URL.Query().Get("state")
+		fmt.Fprint(w, targetsResponse)
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	testutil.Ok(t, err)
+
+	p := NewPrometheus(nil, u, func() labels.Labels {
+		return labels.FromStrings("region", "eu", "replica", "a")
+	})
+
+	expActive := &targetspb.ActiveTarget{
+		DiscoveredLabels: []storepb.Label{{Name: "__address__", Value: "localhost:9090"}, {Name: "job", Value: "prometheus"}},
+		Labels: []storepb.Label{
+			{Name: "instance", Value: "localhost:9090"},
+			{Name: "job", Value: "prometheus"},
+			{Name: "region", Value: "eu"},
+			{Name: "replica", Value: "a"},
+		},
+		ScrapePool: "prometheus",
+		ScrapeUrl:  "http://localhost:9090/metrics",
+		LastScrape: time.Date(2020, 1, 10, 10, 0, 0, 0, time.UTC),
+		Health:     targetspb.ActiveTarget_UP,
+	}
+	expDropped := &targetspb.DroppedTarget{
+		DiscoveredLabels: []storepb.Label{{Name: "__address__", Value: "localhost:9100"}, {Name: "job", Value: "node"}},
+	}
+
+	resp, err := p.Targets(context.Background(), &targetspb.TargetsRequest{})
+	testutil.Ok(t, err)
+	testutil.Equals(t, "", lastState)
+	testutil.Equals(t, []*targetspb.ActiveTarget{expActive}, resp.Targets.ActiveTargets)
+	testutil.Equals(t, []*targetspb.DroppedTarget{expDropped}, resp.Targets.DroppedTargets)
+
+	// State is filtered on our side as well, as older Prometheus versions ignore it.
+	resp, err = p.Targets(context.Background(), &targetspb.TargetsRequest{State: targetspb.TargetsRequest_ACTIVE})
+	testutil.Ok(t, err)
+	testutil.Equals(t, "active", lastState)
+	testutil.Equals(t, []*targetspb.ActiveTarget{expActive}, resp.Targets.ActiveTargets)
+	testutil.Equals(t, []*targetspb.DroppedTarget{}, resp.Targets.DroppedTargets)
+
+	// Targets are marshaled to JSON in the same format as Prometheus uses.
+	b, err := json.Marshal(resp.Targets)
+	testutil.Ok(t, err)
+	testutil.Equals(t, `{"activeTargets":[{"discoveredLabels":{"__address__":"localhost:9090","job":"prometheus"},`+
+		`"labels":{"instance":"localhost:9090","job":"prometheus","region":"eu","replica":"a"},"scrapePool":"prometheus",`+
+		`"scrapeUrl":"http://localhost:9090/metrics","lastError":"","lastScrape":"2020-01-10T10:00:00Z","health":"up"}],"droppedTargets":[]}`, string(b))
+}
@@ -0,0 +1,89 @@
+package targets
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/thanos/pkg/targets/targetspb"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+)
+
+// Client holds a client to a targets source.
+type Client interface {
+	// Client to access the targets source.
+	targetspb.TargetsClient
+
+	String() string
+}
+
+// Proxy implements targetspb.TargetsServer that fans out requests to all given targets sources and merges
+// their responses.
+type Proxy struct {
+	logger  log.Logger
+	clients func() []Client
+}
+
+// NewProxy returns a new targets.Proxy.
+func NewProxy(logger log.Logger, clients func() []Client) *Proxy {
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return &Proxy{
+		logger:  logger,
+		clients: clients,
+	}
+}
+
+// Targets returns merged scrape targets from all targets sources.
+func (p *Proxy) Targets(ctx context.Context, r *targetspb.TargetsRequest) (*targetspb.TargetsResponse, error) {
+	var (
+		warnings []string
+		all      []targetspb.TargetDiscovery
+		mtx      sync.Mutex
+		g, gctx  = errgroup.WithContext(ctx)
+	)
+
+	for _, c := range p.clients() {
+		c := c
+		g.Go(func() error {
+			resp, err := c.Targets(gctx, r)
+			if err != nil {
+				err = errors.Wrapf(err, "fetch targets from %s", c)
+				if r.PartialResponseDisabled {
+					return err
+				}
+
+				mtx.Lock()
+				warnings = append(warnings, err.Error())
+				mtx.Unlock()
+				return nil
+			}
+
+			mtx.Lock()
+			warnings = append(warnings, resp.Warnings...)
+			all = append(all, resp.Targets)
+			mtx.Unlock()
+
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	return &targetspb.TargetsResponse{
+		Targets:  targetspb.Merge(all...),
+		Warnings: warnings,
+	}, nil
+}
+
+// RegisterTargetsServer returns function that registers the given targets server in the gRPC server.
+func RegisterTargetsServer(targetsSrv targetspb.TargetsServer) func(*grpc.Server) {
+	return func(s *grpc.Server) {
+		targetspb.RegisterTargetsServer(s, targetsSrv)
+	}
+}
@@ -0,0 +1,60 @@
+package targets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/targets/targetspb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+	"google.golang.org/grpc"
+)
+
+type testClient struct {
+	resp *targetspb.TargetsResponse
+	err  error
+}
+
+func (c *testClient) Targets(context.Context, *targetspb.TargetsRequest, ...grpc.CallOption) (*targetspb.TargetsResponse, error) {
+	return c.resp, c.err
+}
+
+func (c *testClient) String() string {
+	return "test"
+}
+
+func TestProxy_Targets(t *testing.T) {
+	target := func(pool, replica string) *targetspb.ActiveTarget {
+		return &targetspb.ActiveTarget{ScrapePool: pool, Labels: []storepb.Label{{Name: "replica", Value: replica}}}
+	}
+	newClients := func() []Client {
+		return []Client{
+			&testClient{resp: &targetspb.TargetsResponse{
+				Targets: targetspb.TargetDiscovery{ActiveTargets: []*targetspb.ActiveTarget{target("b", "a"), target("a", "a")}},
+			}},
+			&testClient{resp: &targetspb.TargetsResponse{
+				Targets:  targetspb.TargetDiscovery{ActiveTargets: []*targetspb.ActiveTarget{target("b", "b")}},
+				Warnings: []string{"warning"},
+			}},
+		}
+	}
+
+	cls := newClients()
+	p := NewProxy(nil, func() []Client { return cls })
+
+	resp, err := p.Targets(context.Background(), &targetspb.TargetsRequest{})
+	testutil.Ok(t, err)
+	testutil.Equals(t, []*targetspb.ActiveTarget{target("a", "a"), target("b", "a"), target("b", "b")}, resp.Targets.ActiveTargets)
+	testutil.Equals(t, []string{"warning"}, resp.Warnings)
+
+	cls = append(newClients(), &testClient{err: errors.New("unavailable")})
+
+	resp, err = p.Targets(context.Background(), &targetspb.TargetsRequest{})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 3, len(resp.Targets.ActiveTargets))
+	testutil.Equals(t, 2, len(resp.Warnings))
+
+	_, err = p.Targets(context.Background(), &targetspb.TargetsRequest{PartialResponseDisabled: true})
+	testutil.NotOk(t, err)
+}
@@ -0,0 +1,126 @@
+package targetspb
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+)
+
+// MarshalJSON marshals health the same way as Prometheus does, e.g "up".
+func (h ActiveTarget_Health) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strings.ToLower(h.String()))
+}
+
+// UnmarshalJSON unmarshals health marshaled by Prometheus.
+func (h *ActiveTarget_Health) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, ok := ActiveTarget_Health_value[strings.ToUpper(s)]
+	if !ok {
+		return errors.Errorf("unknown target health %q", s)
+	}
+	*h = ActiveTarget_Health(v)
+	return nil
+}
+
+// activeTargetJSON is the ActiveTarget representation used by the Prometheus targets API, with labels as JSON objects.
+type activeTargetJSON struct {
+	DiscoveredLabels labels.Labels       `json:"discoveredLabels"`
+	Labels           labels.Labels       `json:"labels"`
+	ScrapePool       string              `json:"scrapePool"`
+	ScrapeUrl        string              `json:"scrapeUrl"`
+	LastError        string              `json:"lastError"`
+	LastScrape       time.Time           `json:"lastScrape"`
+	Health           ActiveTarget_Health `json:"health"`
+}
+
+// MarshalJSON marshals the target in the format of the Prometheus targets API.
+func (t ActiveTarget) MarshalJSON() ([]byte, error) {
+	return json.Marshal(activeTargetJSON{
+		DiscoveredLabels: storepb.LabelsToPromLabels(t.DiscoveredLabels),
+		Labels:           storepb.LabelsToPromLabels(t.Labels),
+		ScrapePool:       t.ScrapePool,
+		ScrapeUrl:        t.ScrapeUrl,
+		LastError:        t.LastError,
+		LastScrape:       t.LastScrape,
+		Health:           t.Health,
+	})
+}
+
+// UnmarshalJSON unmarshals the target in the format of the Prometheus targets API.
+func (t *ActiveTarget) UnmarshalJSON(b []byte) error {
+	var j activeTargetJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	*t = ActiveTarget{
+		DiscoveredLabels: PromLabelsToLabels(j.DiscoveredLabels),
+		Labels:           PromLabelsToLabels(j.Labels),
+		ScrapePool:       j.ScrapePool,
+		ScrapeUrl:        j.ScrapeUrl,
+		LastError:        j.LastError,
+		LastScrape:       j.LastScrape,
+		Health:           j.Health,
+	}
+	return nil
+}
+
+// MarshalJSON marshals the target in the format of the Prometheus targets API.
+func (t DroppedTarget) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		DiscoveredLabels labels.Labels `json:"discoveredLabels"`
+	}{DiscoveredLabels: storepb.LabelsToPromLabels(t.DiscoveredLabels)})
+}
+
+// UnmarshalJSON unmarshals the target in the format of the Prometheus targets API.
+func (t *DroppedTarget) UnmarshalJSON(b []byte) error {
+	var j struct {
+		DiscoveredLabels labels.Labels `json:"discoveredLabels"`
+	}
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	*t = DroppedTarget{DiscoveredLabels: PromLabelsToLabels(j.DiscoveredLabels)}
+	return nil
+}
+
+// PromLabelsToLabels converts Prometheus labels to the protobuf ones.
+func PromLabelsToLabels(lset labels.Labels) []storepb.Label {
+	if len(lset) == 0 {
+		return nil
+	}
+	res := make([]storepb.Label, 0, len(lset))
+	for _, l := range lset {
+		res = append(res, storepb.Label{Name: l.Name, Value: l.Value})
+	}
+	return res
+}
+
+// Merge returns a single target discovery containing targets of all given ones, sorted by scrape pool and labels.
+func Merge(tds ...TargetDiscovery) TargetDiscovery {
+	// Same as Prometheus, return empty lists rather than nulls.
+	res := TargetDiscovery{ActiveTargets: []*ActiveTarget{}, DroppedTargets: []*DroppedTarget{}}
+	for _, td := range tds {
+		res.ActiveTargets = append(res.ActiveTargets, td.ActiveTargets...)
+		res.DroppedTargets = append(res.DroppedTargets, td.DroppedTargets...)
+	}
+
+	sort.Slice(res.ActiveTargets, func(i, j int) bool {
+		a, b := res.ActiveTargets[i], res.ActiveTargets[j]
+		if a.ScrapePool != b.ScrapePool {
+			return a.ScrapePool < b.ScrapePool
+		}
+		return storepb.CompareLabels(a.Labels, b.Labels) < 0
+	})
+	sort.Slice(res.DroppedTargets, func(i, j int) bool {
+		return storepb.CompareLabels(res.DroppedTargets[i].DiscoveredLabels, res.DroppedTargets[j].DiscoveredLabels) < 0
+	})
+	return res
+}
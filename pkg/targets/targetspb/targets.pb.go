@@ -0,0 +1,1570 @@
+// Code generated by protoc-gen-gogo. DO NOT EDIT.
+// source: targets.proto
+
+package targetspb
+
+import (
+	context "context"
+	fmt "fmt"
+	io "io"
+	math "math"
+	math_bits "math/bits"
+	time "time"
+
+	_ "github.com/gogo/protobuf/gogoproto"
+	proto "github.com/gogo/protobuf/proto"
+	_ "github.com/gogo/protobuf/types"
+	github_com_gogo_protobuf_types "github.com/gogo/protobuf/types"
+	storepb "github.com/thanos-io/thanos/pkg/store/storepb"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+var _ = time.Kitchen
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.GoGoProtoPackageIsVersion3 // please upgrade the proto package
+
+type TargetsRequest_State int32
+
+const (
+	TargetsRequest_ANY     TargetsRequest_State = 0
+	TargetsRequest_ACTIVE  TargetsRequest_State = 1
+	TargetsRequest_DROPPED TargetsRequest_State = 2
+)
+
+var TargetsRequest_State_name = map[int32]string{
+	0: "ANY",
+	1: "ACTIVE",
+	2: "DROPPED",
+}
+
+var TargetsRequest_State_value = map[string]int32{
+	"ANY":     0,
+	"ACTIVE":  1,
+	"DROPPED": 2,
+}
+
+func (x TargetsRequest_State) String() string {
+	return proto.EnumName(TargetsRequest_State_name, int32(x))
+}
+
+func (TargetsRequest_State) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_4009e2e15debba2c, []int{0, 0}
+}
+
+type ActiveTarget_Health int32
+
+const (
+	ActiveTarget_UNKNOWN ActiveTarget_Health = 0
+	ActiveTarget_DOWN    ActiveTarget_Health = 1
+	ActiveTarget_UP      ActiveTarget_Health = 2
+)
+
+var ActiveTarget_Health_name = map[int32]string{
+	0: "UNKNOWN",
+	1: "DOWN",
+	2: "UP",
+}
+
+var ActiveTarget_Health_value = map[string]int32{
+	"UNKNOWN": 0,
+	"DOWN":    1,
+	"UP":      2,
+}
+
+func (x ActiveTarget_Health) String() string {
+	return proto.EnumName(ActiveTarget_Health_name, int32(x))
+}
+
+func (ActiveTarget_Health) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_4009e2e15debba2c, []int{3, 0}
+}
+
+type TargetsRequest struct {
+	State                   TargetsRequest_State `protobuf:"varint,1,opt,name=state,proto3,enum=thanos.TargetsRequest_State" json:"state,omitempty"`
+	PartialResponseDisabled bool                 `protobuf:"varint,2,opt,name=partial_response_disabled,json=partialResponseDisabled,proto3" json:"partial_response_disabled,omitempty"`
+}
+
+func (m *TargetsRequest) Reset()         { *m = TargetsRequest{} }
+func (m *TargetsRequest) String() string { return proto.CompactTextString(m) }
+func (*TargetsRequest) ProtoMessage()    {}
+func (*TargetsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4009e2e15debba2c, []int{0}
+}
+func (m *TargetsRequest) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *TargetsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_TargetsRequest.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *TargetsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TargetsRequest.Merge(m, src)
+}
+func (m *TargetsRequest) XXX_Size() int {
+	return m.Size()
+}
+func (m *TargetsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_TargetsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TargetsRequest proto.InternalMessageInfo
+
+type TargetsResponse struct {
+	Targets TargetDiscovery `protobuf:"bytes,1,opt,name=targets,proto3" json:"targets"`
+	/// warnings are non-critical errors that occurred while fetching targets, e.g. unavailable sources.
+	Warnings []string `protobuf:"bytes,2,rep,name=warnings,proto3" json:"warnings,omitempty"`
+}
+
+func (m *TargetsResponse) Reset()         { *m = TargetsResponse{} }
+func (m *TargetsResponse) String() string { return proto.CompactTextString(m) }
+func (*TargetsResponse) ProtoMessage()    {}
+func (*TargetsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4009e2e15debba2c, []int{1}
+}
+func (m *TargetsResponse) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *TargetsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_TargetsResponse.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *TargetsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TargetsResponse.Merge(m, src)
+}
+func (m *TargetsResponse) XXX_Size() int {
+	return m.Size()
+}
+func (m *TargetsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_TargetsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TargetsResponse proto.InternalMessageInfo
+
+type TargetDiscovery struct {
+	ActiveTargets  []*ActiveTarget  `protobuf:"bytes,1,rep,name=activeTargets,proto3" json:"activeTargets"`
+	DroppedTargets []*DroppedTarget `protobuf:"bytes,2,rep,name=droppedTargets,proto3" json:"droppedTargets"`
+}
+
+func (m *TargetDiscovery) Reset()         { *m = TargetDiscovery{} }
+func (m *TargetDiscovery) String() string { return proto.CompactTextString(m) }
+func (*TargetDiscovery) ProtoMessage()    {}
+func (*TargetDiscovery) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4009e2e15debba2c, []int{2}
+}
+func (m *TargetDiscovery) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *TargetDiscovery) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_TargetDiscovery.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *TargetDiscovery) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TargetDiscovery.Merge(m, src)
+}
+func (m *TargetDiscovery) XXX_Size() int {
+	return m.Size()
+}
+func (m *TargetDiscovery) XXX_DiscardUnknown() {
+	xxx_messageInfo_TargetDiscovery.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TargetDiscovery proto.InternalMessageInfo
+
+type ActiveTarget struct {
+	DiscoveredLabels []storepb.Label     `protobuf:"bytes,1,rep,name=discoveredLabels,proto3" json:"discoveredLabels"`
+	Labels           []storepb.Label     `protobuf:"bytes,2,rep,name=labels,proto3" json:"labels"`
+	ScrapePool       string              `protobuf:"bytes,3,opt,name=scrapePool,proto3" json:"scrapePool"`
+	ScrapeUrl        string              `protobuf:"bytes,4,opt,name=scrapeUrl,proto3" json:"scrapeUrl"`
+	LastError        string              `protobuf:"bytes,5,opt,name=lastError,proto3" json:"lastError"`
+	LastScrape       time.Time           `protobuf:"bytes,6,opt,name=lastScrape,proto3,stdtime" json:"lastScrape"`
+	Health           ActiveTarget_Health `protobuf:"varint,7,opt,name=health,proto3,enum=thanos.ActiveTarget_Health" json:"health"`
+}
+
+func (m *ActiveTarget) Reset()         { *m = ActiveTarget{} }
+func (m *ActiveTarget) String() string { return proto.CompactTextString(m) }
+func (*ActiveTarget) ProtoMessage()    {}
+func (*ActiveTarget) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4009e2e15debba2c, []int{3}
+}
+func (m *ActiveTarget) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *ActiveTarget) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_ActiveTarget.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *ActiveTarget) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ActiveTarget.Merge(m, src)
+}
+func (m *ActiveTarget) XXX_Size() int {
+	return m.Size()
+}
+func (m *ActiveTarget) XXX_DiscardUnknown() {
+	xxx_messageInfo_ActiveTarget.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ActiveTarget proto.InternalMessageInfo
+
+type DroppedTarget struct {
+	DiscoveredLabels []storepb.Label `protobuf:"bytes,1,rep,name=discoveredLabels,proto3" json:"discoveredLabels"`
+}
+
+func (m *DroppedTarget) Reset()         { *m = DroppedTarget{} }
+func (m *DroppedTarget) String() string { return proto.CompactTextString(m) }
+func (*DroppedTarget) ProtoMessage()    {}
+func (*DroppedTarget) Descriptor() ([]byte, []int) {
+	return fileDescriptor_4009e2e15debba2c, []int{4}
+}
+func (m *DroppedTarget) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *DroppedTarget) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_DroppedTarget.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *DroppedTarget) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DroppedTarget.Merge(m, src)
+}
+func (m *DroppedTarget) XXX_Size() int {
+	return m.Size()
+}
+func (m *DroppedTarget) XXX_DiscardUnknown() {
+	xxx_messageInfo_DroppedTarget.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DroppedTarget proto.InternalMessageInfo
+
+func init() {
+	proto.RegisterEnum("thanos.TargetsRequest_State", TargetsRequest_State_name, TargetsRequest_State_value)
+	proto.RegisterEnum("thanos.ActiveTarget_Health", ActiveTarget_Health_name, ActiveTarget_Health_value)
+	proto.RegisterType((*TargetsRequest)(nil), "thanos.TargetsRequest")
+	proto.RegisterType((*TargetsResponse)(nil), "thanos.TargetsResponse")
+	proto.RegisterType((*TargetDiscovery)(nil), "thanos.TargetDiscovery")
+	proto.RegisterType((*ActiveTarget)(nil), "thanos.ActiveTarget")
+	proto.RegisterType((*DroppedTarget)(nil), "thanos.DroppedTarget")
+}
+
+func init() { proto.RegisterFile("targets.proto", fileDescriptor_4009e2e15debba2c) }
+
+var fileDescriptor_4009e2e15debba2c = []byte{
+	// 622 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xb4, 0x54, 0xc1, 0x6e, 0xd3, 0x4c,
+	0x10, 0xb6, 0x9d, 0xd6, 0x69, 0x26, 0x7f, 0xd2, 0xfc, 0xab, 0xd2, 0x9a, 0x80, 0xec, 0xc8, 0x97,
+	0x06, 0x21, 0xb9, 0x52, 0x10, 0x42, 0xea, 0x05, 0xd5, 0x24, 0x12, 0x08, 0x48, 0xc3, 0x36, 0x05,
+	0xc1, 0xa5, 0xda, 0xd4, 0xdb, 0x34, 0x92, 0x9b, 0x35, 0xf6, 0xb6, 0xa8, 0x6f, 0xd1, 0xf7, 0xe0,
+	0xc8, 0x4b, 0xf4, 0xd8, 0x23, 0x27, 0x03, 0xe9, 0x2d, 0x4f, 0x81, 0xbc, 0x5e, 0x27, 0x4e, 0x9b,
+	0x2b, 0xa7, 0x9d, 0xf9, 0xe6, 0x9b, 0x6f, 0x26, 0x93, 0x19, 0x43, 0x85, 0x93, 0x70, 0x48, 0x79,
+	0xe4, 0x04, 0x21, 0xe3, 0x0c, 0xe9, 0xfc, 0x94, 0x8c, 0x59, 0x54, 0x2f, 0xf3, 0xcb, 0x80, 0x4a,
+	0xb0, 0xbe, 0x31, 0x64, 0x43, 0x26, 0xcc, 0x9d, 0xc4, 0x92, 0xa8, 0x35, 0x64, 0x6c, 0xe8, 0xd3,
+	0x1d, 0xe1, 0x0d, 0xce, 0x4f, 0x76, 0xf8, 0xe8, 0x8c, 0x46, 0x9c, 0x9c, 0x05, 0x29, 0xc1, 0xfe,
+	0xae, 0x42, 0xb5, 0x9f, 0xaa, 0x63, 0xfa, 0xf5, 0x9c, 0x46, 0x1c, 0xb5, 0x60, 0x35, 0xe2, 0x84,
+	0x53, 0x43, 0x6d, 0xa8, 0xcd, 0x6a, 0xeb, 0xb1, 0x93, 0x96, 0x73, 0x16, 0x69, 0xce, 0x41, 0xc2,
+	0xc1, 0x29, 0x15, 0xed, 0xc2, 0xc3, 0x80, 0x84, 0x7c, 0x44, 0xfc, 0xa3, 0x90, 0x46, 0x01, 0x1b,
+	0x47, 0xf4, 0xc8, 0x1b, 0x45, 0x64, 0xe0, 0x53, 0xcf, 0xd0, 0x1a, 0x6a, 0x73, 0x0d, 0x6f, 0x49,
+	0x02, 0x96, 0xf1, 0xb6, 0x0c, 0xdb, 0x4f, 0x60, 0x55, 0x68, 0xa1, 0x22, 0x14, 0xf6, 0xba, 0x9f,
+	0x6b, 0x0a, 0x02, 0xd0, 0xf7, 0x5e, 0xf5, 0xdf, 0x7c, 0xec, 0xd4, 0x54, 0x54, 0x86, 0x62, 0x1b,
+	0xef, 0xf7, 0x7a, 0x9d, 0x76, 0x4d, 0xb3, 0x4f, 0x60, 0x7d, 0xd6, 0x45, 0xaa, 0x82, 0x5e, 0x40,
+	0x51, 0x4e, 0x47, 0xf4, 0x5b, 0x6e, 0x6d, 0x2d, 0xf6, 0xdb, 0x1e, 0x45, 0xc7, 0xec, 0x82, 0x86,
+	0x97, 0xee, 0xca, 0x75, 0x6c, 0x29, 0x38, 0x63, 0xa3, 0x3a, 0xac, 0x7d, 0x23, 0xe1, 0x78, 0x34,
+	0x1e, 0x46, 0x86, 0xd6, 0x28, 0x34, 0x4b, 0x78, 0xe6, 0xdb, 0x3f, 0x54, 0x58, 0xbf, 0x93, 0x8e,
+	0xde, 0x43, 0x85, 0x1c, 0xf3, 0xd1, 0x05, 0xed, 0xcf, 0xca, 0x15, 0x9a, 0xe5, 0xd6, 0x46, 0x56,
+	0x6e, 0x2f, 0x17, 0x74, 0xff, 0x9f, 0xc6, 0xd6, 0x22, 0x1d, 0x2f, 0xba, 0xe8, 0x03, 0x54, 0xbd,
+	0x90, 0x05, 0x01, 0xf5, 0x32, 0x3d, 0x4d, 0xe8, 0x3d, 0xc8, 0xf4, 0xda, 0xf9, 0xa8, 0x8b, 0xa6,
+	0xb1, 0x75, 0x27, 0x01, 0xdf, 0xf1, 0xed, 0x49, 0x01, 0xfe, 0xcb, 0x77, 0x81, 0x0e, 0xa0, 0xe6,
+	0xc9, 0xfe, 0xa9, 0xf7, 0x8e, 0x0c, 0xa8, 0x9f, 0x75, 0x5d, 0xc9, 0xaa, 0x08, 0xd4, 0x35, 0x92,
+	0xd1, 0x4c, 0x63, 0xeb, 0x1e, 0x1d, 0xdf, 0x43, 0xd0, 0x73, 0xd0, 0xfd, 0x54, 0x4a, 0x5b, 0x26,
+	0x55, 0x95, 0x52, 0x92, 0x84, 0xe5, 0x8b, 0x1c, 0x80, 0xe8, 0x38, 0x24, 0x01, 0xed, 0x31, 0xe6,
+	0x1b, 0x85, 0x86, 0xda, 0x2c, 0xb9, 0xd5, 0x69, 0x6c, 0xe5, 0x50, 0x9c, 0xb3, 0xd1, 0x53, 0x28,
+	0xa5, 0xde, 0x61, 0xe8, 0x1b, 0x2b, 0x82, 0x5e, 0x99, 0xc6, 0xd6, 0x1c, 0xc4, 0x73, 0x33, 0x21,
+	0xfb, 0x24, 0xe2, 0x9d, 0x30, 0x64, 0xa1, 0xb1, 0x3a, 0x27, 0xcf, 0x40, 0x3c, 0x37, 0x11, 0x06,
+	0x48, 0x9c, 0x03, 0x91, 0x6d, 0xe8, 0x62, 0x69, 0xea, 0x4e, 0x7a, 0x28, 0x4e, 0x76, 0x28, 0x4e,
+	0x3f, 0x3b, 0x14, 0x77, 0x53, 0xfe, 0xa2, 0x5c, 0xd6, 0xd5, 0x2f, 0x4b, 0xc5, 0x39, 0x1f, 0xbd,
+	0x04, 0xfd, 0x94, 0x12, 0x9f, 0x9f, 0x1a, 0x45, 0x71, 0x34, 0x8f, 0x96, 0x6d, 0x85, 0xf3, 0x5a,
+	0x50, 0x5c, 0x48, 0xc6, 0x93, 0xd2, 0xb1, 0x7c, 0xed, 0x6d, 0xd0, 0xd3, 0x68, 0xb2, 0xf0, 0x87,
+	0xdd, 0xb7, 0xdd, 0xfd, 0x4f, 0xdd, 0x9a, 0x82, 0xd6, 0x60, 0xa5, 0x9d, 0x58, 0x2a, 0xd2, 0x41,
+	0x3b, 0xec, 0xd5, 0x34, 0xdb, 0x83, 0xca, 0xc2, 0x66, 0xfc, 0x93, 0x3f, 0xb9, 0xd5, 0x81, 0x62,
+	0xb6, 0xa8, 0xbb, 0x73, 0x73, 0x73, 0xf9, 0xa7, 0xa0, 0xbe, 0x75, 0x0f, 0x4f, 0x8f, 0xd3, 0xdd,
+	0xbe, 0xfe, 0x63, 0x2a, 0xd7, 0x13, 0x53, 0xbd, 0x99, 0x98, 0xea, 0xef, 0x89, 0xa9, 0x5e, 0xdd,
+	0x9a, 0xca, 0xcd, 0xad, 0xa9, 0xfc, 0xbc, 0x35, 0x95, 0x2f, 0x25, 0x79, 0x8a, 0xc1, 0x60, 0xa0,
+	0x8b, 0xb9, 0x3f, 0xfb, 0x3b, 0x00, 0xb9, 0x63, 0xb2, 0x02, 0xea, 0x04, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// TargetsClient is the client API for Targets service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type TargetsClient interface {
+	/// Targets returns active and dropped scrape targets, with external labels attached to the target labels.
+	Targets(ctx context.Context, in *TargetsRequest, opts ...grpc.CallOption) (*TargetsResponse, error)
+}
+
+type targetsClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewTargetsClient(cc *grpc.ClientConn) TargetsClient {
+	return &targetsClient{cc}
+}
+
+func (c *targetsClient) Targets(ctx context.Context, in *TargetsRequest, opts ...grpc.CallOption) (*TargetsResponse, error) {
+	out := new(TargetsResponse)
+	err := c.cc.Invoke(ctx, "/thanos.Targets/Targets", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TargetsServer is the server API for Targets service.
+type TargetsServer interface {
+	/// Targets returns active and dropped scrape targets, with external labels attached to the target labels.
+	Targets(context.Context, *TargetsRequest) (*TargetsResponse, error)
+}
+
+// UnimplementedTargetsServer can be embedded to have forward compatible implementations.
+type UnimplementedTargetsServer struct {
+}
+
+func (*UnimplementedTargetsServer) Targets(ctx context.Context, req *TargetsRequest) (*TargetsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Targets not implemented")
+}
+
+func RegisterTargetsServer(s *grpc.Server, srv TargetsServer) {
+	s.RegisterService(&_Targets_serviceDesc, srv)
+}
+
+func _Targets_Targets_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TargetsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TargetsServer).Targets(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/thanos.Targets/Targets",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TargetsServer).Targets(ctx, req.(*TargetsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Targets_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "thanos.Targets",
+	HandlerType: (*TargetsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Targets",
+			Handler:    _Targets_Targets_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "targets.proto",
+}
+
+func (m *TargetsRequest) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *TargetsRequest) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *TargetsRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.PartialResponseDisabled {
+		i--
+		if m.PartialResponseDisabled {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x10
+	}
+	if m.State != 0 {
+		i = encodeVarintTargets(dAtA, i, uint64(m.State))
+		i--
+		dAtA[i] = 0x8
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *TargetsResponse) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *TargetsResponse) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *TargetsResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.Warnings) > 0 {
+		for iNdEx := len(m.Warnings) - 1; iNdEx >= 0; iNdEx-- {
+			i -= len(m.Warnings[iNdEx])
+			copy(dAtA[i:], m.Warnings[iNdEx])
+			i = encodeVarintTargets(dAtA, i, uint64(len(m.Warnings[iNdEx])))
+			i--
+			dAtA[i] = 0x12
+		}
+	}
+	{
+		size, err := m.Targets.MarshalToSizedBuffer(dAtA[:i])
+		if err != nil {
+			return 0, err
+		}
+		i -= size
+		i = encodeVarintTargets(dAtA, i, uint64(size))
+	}
+	i--
+	dAtA[i] = 0xa
+	return len(dAtA) - i, nil
+}
+
+func (m *TargetDiscovery) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *TargetDiscovery) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *TargetDiscovery) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.DroppedTargets) > 0 {
+		for iNdEx := len(m.DroppedTargets) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.DroppedTargets[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintTargets(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x12
+		}
+	}
+	if len(m.ActiveTargets) > 0 {
+		for iNdEx := len(m.ActiveTargets) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.ActiveTargets[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintTargets(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0xa
+		}
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *ActiveTarget) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *ActiveTarget) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *ActiveTarget) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.Health != 0 {
+		i = encodeVarintTargets(dAtA, i, uint64(m.Health))
+		i--
+		dAtA[i] = 0x38
+	}
+	n2, err2 := github_com_gogo_protobuf_types.StdTimeMarshalTo(m.LastScrape, dAtA[i-github_com_gogo_protobuf_types.SizeOfStdTime(m.LastScrape):])
+	if err2 != nil {
+		return 0, err2
+	}
+	i -= n2
+	i = encodeVarintTargets(dAtA, i, uint64(n2))
+	i--
+	dAtA[i] = 0x32
+	if len(m.LastError) > 0 {
+		i -= len(m.LastError)
+		copy(dAtA[i:], m.LastError)
+		i = encodeVarintTargets(dAtA, i, uint64(len(m.LastError)))
+		i--
+		dAtA[i] = 0x2a
+	}
+	if len(m.ScrapeUrl) > 0 {
+		i -= len(m.ScrapeUrl)
+		copy(dAtA[i:], m.ScrapeUrl)
+		i = encodeVarintTargets(dAtA, i, uint64(len(m.ScrapeUrl)))
+		i--
+		dAtA[i] = 0x22
+	}
+	if len(m.ScrapePool) > 0 {
+		i -= len(m.ScrapePool)
+		copy(dAtA[i:], m.ScrapePool)
+		i = encodeVarintTargets(dAtA, i, uint64(len(m.ScrapePool)))
+		i--
+		dAtA[i] = 0x1a
+	}
+	if len(m.Labels) > 0 {
+		for iNdEx := len(m.Labels) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Labels[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintTargets(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x12
+		}
+	}
+	if len(m.DiscoveredLabels) > 0 {
+		for iNdEx := len(m.DiscoveredLabels) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.DiscoveredLabels[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintTargets(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0xa
+		}
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *DroppedTarget) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *DroppedTarget) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *DroppedTarget) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if len(m.DiscoveredLabels) > 0 {
+		for iNdEx := len(m.DiscoveredLabels) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.DiscoveredLabels[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintTargets(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0xa
+		}
+	}
+	return len(dAtA) - i, nil
+}
+
+func encodeVarintTargets(dAtA []byte, offset int, v uint64) int {
+	offset -= sovTargets(v)
+	base := offset
+	for v >= 1<<7 {
+		dAtA[offset] = uint8(v&0x7f | 0x80)
+		v >>= 7
+		offset++
+	}
+	dAtA[offset] = uint8(v)
+	return base
+}
+func (m *TargetsRequest) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.State != 0 {
+		n += 1 + sovTargets(uint64(m.State))
+	}
+	if m.PartialResponseDisabled {
+		n += 2
+	}
+	return n
+}
+
+func (m *TargetsResponse) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	l = m.Targets.Size()
+	n += 1 + l + sovTargets(uint64(l))
+	if len(m.Warnings) > 0 {
+		for _, s := range m.Warnings {
+			l = len(s)
+			n += 1 + l + sovTargets(uint64(l))
+		}
+	}
+	return n
+}
+
+func (m *TargetDiscovery) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if len(m.ActiveTargets) > 0 {
+		for _, e := range m.ActiveTargets {
+			l = e.Size()
+			n += 1 + l + sovTargets(uint64(l))
+		}
+	}
+	if len(m.DroppedTargets) > 0 {
+		for _, e := range m.DroppedTargets {
+			l = e.Size()
+			n += 1 + l + sovTargets(uint64(l))
+		}
+	}
+	return n
+}
+
+func (m *ActiveTarget) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if len(m.DiscoveredLabels) > 0 {
+		for _, e := range m.DiscoveredLabels {
+			l = e.Size()
+			n += 1 + l + sovTargets(uint64(l))
+		}
+	}
+	if len(m.Labels) > 0 {
+		for _, e := range m.Labels {
+			l = e.Size()
+			n += 1 + l + sovTargets(uint64(l))
+		}
+	}
+	l = len(m.ScrapePool)
+	if l > 0 {
+		n += 1 + l + sovTargets(uint64(l))
+	}
+	l = len(m.ScrapeUrl)
+	if l > 0 {
+		n += 1 + l + sovTargets(uint64(l))
+	}
+	l = len(m.LastError)
+	if l > 0 {
+		n += 1 + l + sovTargets(uint64(l))
+	}
+	l = github_com_gogo_protobuf_types.SizeOfStdTime(m.LastScrape)
+	n += 1 + l + sovTargets(uint64(l))
+	if m.Health != 0 {
+		n += 1 + sovTargets(uint64(m.Health))
+	}
+	return n
+}
+
+func (m *DroppedTarget) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if len(m.DiscoveredLabels) > 0 {
+		for _, e := range m.DiscoveredLabels {
+			l = e.Size()
+			n += 1 + l + sovTargets(uint64(l))
+		}
+	}
+	return n
+}
+
+func sovTargets(x uint64) (n int) {
+	return (math_bits.Len64(x|1) + 6) / 7
+}
+func sozTargets(x uint64) (n int) {
+	return sovTargets(uint64((x << 1) ^ uint64((int64(x) >> 63))))
+}
+func (m *TargetsRequest) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowTargets
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: TargetsRequest: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: TargetsRequest: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field State", wireType)
+			}
+			m.State = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTargets
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.State |= TargetsRequest_State(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field PartialResponseDisabled", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTargets
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.PartialResponseDisabled = bool(v != 0)
+		default:
+			iNdEx = preIndex
+			skippy, err := skipTargets(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthTargets
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthTargets
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *TargetsResponse) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowTargets
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: TargetsResponse: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: TargetsResponse: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Targets", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTargets
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthTargets
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthTargets
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := m.Targets.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Warnings", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTargets
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthTargets
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthTargets
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Warnings = append(m.Warnings, string(dAtA[iNdEx:postIndex]))
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipTargets(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthTargets
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthTargets
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *TargetDiscovery) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowTargets
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: TargetDiscovery: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: TargetDiscovery: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ActiveTargets", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTargets
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthTargets
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthTargets
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.ActiveTargets = append(m.ActiveTargets, &ActiveTarget{})
+			if err := m.ActiveTargets[len(m.ActiveTargets)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DroppedTargets", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTargets
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthTargets
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthTargets
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.DroppedTargets = append(m.DroppedTargets, &DroppedTarget{})
+			if err := m.DroppedTargets[len(m.DroppedTargets)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipTargets(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthTargets
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthTargets
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *ActiveTarget) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowTargets
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: ActiveTarget: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ActiveTarget: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DiscoveredLabels", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTargets
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthTargets
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthTargets
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.DiscoveredLabels = append(m.DiscoveredLabels, storepb.Label{})
+			if err := m.DiscoveredLabels[len(m.DiscoveredLabels)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Labels", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTargets
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthTargets
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthTargets
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Labels = append(m.Labels, storepb.Label{})
+			if err := m.Labels[len(m.Labels)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ScrapePool", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTargets
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthTargets
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthTargets
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.ScrapePool = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ScrapeUrl", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTargets
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthTargets
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthTargets
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.ScrapeUrl = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LastError", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTargets
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthTargets
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthTargets
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.LastError = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field LastScrape", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTargets
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthTargets
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthTargets
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if err := github_com_gogo_protobuf_types.StdTimeUnmarshal(&m.LastScrape, dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 7:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Health", wireType)
+			}
+			m.Health = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTargets
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Health |= ActiveTarget_Health(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipTargets(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthTargets
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthTargets
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *DroppedTarget) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowTargets
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: DroppedTarget: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: DroppedTarget: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DiscoveredLabels", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTargets
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthTargets
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthTargets
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.DiscoveredLabels = append(m.DiscoveredLabels, storepb.Label{})
+			if err := m.DiscoveredLabels[len(m.DiscoveredLabels)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipTargets(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthTargets
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthTargets
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func skipTargets(dAtA []byte) (n int, err error) {
+	l := len(dAtA)
+	iNdEx := 0
+	depth := 0
+	for iNdEx < l {
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return 0, ErrIntOverflowTargets
+			}
+			if iNdEx >= l {
+				return 0, io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		wireType := int(wire & 0x7)
+		switch wireType {
+		case 0:
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowTargets
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				iNdEx++
+				if dAtA[iNdEx-1] < 0x80 {
+					break
+				}
+			}
+		case 1:
+			iNdEx += 8
+		case 2:
+			var length int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return 0, ErrIntOverflowTargets
+				}
+				if iNdEx >= l {
+					return 0, io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				length |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if length < 0 {
+				return 0, ErrInvalidLengthTargets
+			}
+			iNdEx += length
+		case 3:
+			depth++
+		case 4:
+			if depth == 0 {
+				return 0, ErrUnexpectedEndOfGroupTargets
+			}
+			depth--
+		case 5:
+			iNdEx += 4
+		default:
+			return 0, fmt.Errorf("proto: illegal wireType %d", wireType)
+		}
+		if iNdEx < 0 {
+			return 0, ErrInvalidLengthTargets
+		}
+		if depth == 0 {
+			return iNdEx, nil
+		}
+	}
+	return 0, io.ErrUnexpectedEOF
+}
+
+var (
+	ErrInvalidLengthTargets        = fmt.Errorf("proto: negative length found during unmarshaling")
+	ErrIntOverflowTargets          = fmt.Errorf("proto: integer overflow")
+	ErrUnexpectedEndOfGroupTargets = fmt.Errorf("proto: unexpected end of group")
+)
@@ -0,0 +1,145 @@
+// Package tenancy implements query-time tenant enforcement: every query of a tenant is limited to series matching
+// label matchers configured for it.
+package tenancy
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"gopkg.in/yaml.v2"
+)
+
+// Config maps tenants to label matchers enforced on all their queries.
+type Config struct {
+	Tenants []TenantConfig `yaml:"tenants"`
+}
+
+// TenantConfig holds matchers of a single tenant.
+type TenantConfig struct {
+	Name string `yaml:"name"`
+	// Matchers is a series selector without metric name, e.g. {team="a"}, matching all series the tenant can see.
+	Matchers string `yaml:"matchers"`
+}
+
+// Tenant is a tenant with label matchers required for all its queries.
+type Tenant struct {
+	Name     string
+	Matchers []storepb.LabelMatcher
+}
+
+// Enforcer resolves tenants of HTTP requests from the configured header.
+type Enforcer struct {
+	header  string
+	tenants map[string]*Tenant
+}
+
+// NewEnforcer returns Enforcer reading tenant names from the given HTTP header and their matchers from the given
+// YAML configuration.
+func NewEnforcer(header string, confYaml []byte) (*Enforcer, error) {
+	if header == "" {
+		return nil, errors.New("tenant header is empty")
+	}
+
+	var conf Config
+	if err := yaml.UnmarshalStrict(confYaml, &conf); err != nil {
+		return nil, errors.Wrap(err, "parsing tenancy config YAML")
+	}
+
+	e := &Enforcer{
+		header:  header,
+		tenants: make(map[string]*Tenant, len(conf.Tenants)),
+	}
+	for _, tc := range conf.Tenants {
+		if tc.Name == "" {
+			return nil, errors.New("tenant without name")
+		}
+		if _, ok := e.tenants[tc.Name]; ok {
+			return nil, errors.Errorf("duplicated tenant %s", tc.Name)
+		}
+		ms, err := parseMatchers(tc.Matchers)
+		if err != nil {
+			return nil, errors.Wrapf(err, "matchers of tenant %s", tc.Name)
+		}
+		e.tenants[tc.Name] = &Tenant{Name: tc.Name, Matchers: ms}
+	}
+	return e, nil
+}
+
+func parseMatchers(selector string) ([]storepb.LabelMatcher, error) {
+	ms, err := promql.ParseMetricSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]storepb.LabelMatcher, 0, len(ms))
+	for _, m := range ms {
+		var t storepb.LabelMatcher_Type
+		switch m.Type {
+		case labels.MatchEqual:
+			t = storepb.LabelMatcher_EQ
+		case labels.MatchNotEqual:
+			t = storepb.LabelMatcher_NEQ
+		case labels.MatchRegexp:
+			t = storepb.LabelMatcher_RE
+		case labels.MatchNotRegexp:
+			t = storepb.LabelMatcher_NRE
+		default:
+			return nil, errors.Errorf("unrecognized label matcher type %d", m.Type)
+		}
+		res = append(res, storepb.LabelMatcher{Type: t, Name: m.Name, Value: m.Value})
+	}
+	return res, nil
+}
+
+// Tenant returns the tenant of the request. It returns error if the request has no tenant header or the tenant is
+// not configured.
+func (e *Enforcer) Tenant(r *http.Request) (*Tenant, error) {
+	name := r.Header.Get(e.header)
+	if name == "" {
+		return nil, errors.Errorf("missing tenant header %s", e.header)
+	}
+	t, ok := e.tenants[name]
+	if !ok {
+		return nil, errors.Errorf("unknown tenant %s", name)
+	}
+	return t, nil
+}
+
+type tenantKey struct{}
+
+// ContextWithTenant returns a context which makes queriers and ProxyStore enforce matchers of the given tenant.
+func ContextWithTenant(ctx context.Context, t *Tenant) context.Context {
+	return context.WithValue(ctx, tenantKey{}, t)
+}
+
+// TenantFromContext returns the tenant of the context, or nil if there is none.
+func TenantFromContext(ctx context.Context) *Tenant {
+	t, _ := ctx.Value(tenantKey{}).(*Tenant)
+	return t
+}
+
+// EnforceMatchers returns the given matchers extended with the ones required for the tenant of the context.
+// Required matchers already present are not added again.
+func EnforceMatchers(ctx context.Context, ms []storepb.LabelMatcher) []storepb.LabelMatcher {
+	t := TenantFromContext(ctx)
+	if t == nil {
+		return ms
+	}
+
+	res := make([]storepb.LabelMatcher, 0, len(ms)+len(t.Matchers))
+	res = append(res, ms...)
+Outer:
+	for _, tm := range t.Matchers {
+		for _, m := range ms {
+			if m == tm {
+				continue Outer
+			}
+		}
+		res = append(res, tm)
+	}
+	return res
+}
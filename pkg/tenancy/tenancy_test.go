@@ -0,0 +1,86 @@
+package tenancy
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/thanos-io/thanos/pkg/store/storepb"
+	"github.com/thanos-io/thanos/pkg/testutil"
+)
+
+const testConfig = `
+tenants:
+  - name: team-a
+    matchers: '{team="a"}'
+  - name: team-b
+    matchers: '{team="b", env=~"prod|staging"}'
+`
+
+func TestNewEnforcer(t *testing.T) {
+	e, err := NewEnforcer("X-Tenant", []byte(testConfig))
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[string]*Tenant{
+		"team-a": {Name: "team-a", Matchers: []storepb.LabelMatcher{{Type: storepb.LabelMatcher_EQ, Name: "team", Value: "a"}}},
+		"team-b": {Name: "team-b", Matchers: []storepb.LabelMatcher{
+			{Type: storepb.LabelMatcher_EQ, Name: "team", Value: "b"},
+			{Type: storepb.LabelMatcher_RE, Name: "env", Value: "prod|staging"},
+		}},
+	}, e.tenants)
+
+	for _, tcase := range []struct {
+		name   string
+		header string
+		conf   string
+	}{
+		{name: "no header", conf: testConfig},
+		{name: "unknown field", header: "X-Tenant", conf: "tenant: []"},
+		{name: "tenant without name", header: "X-Tenant", conf: `tenants: [{matchers: '{team="a"}'}]`},
+		{name: "duplicated tenant", header: "X-Tenant", conf: `tenants: [{name: a, matchers: '{team="a"}'}, {name: a, matchers: '{team="b"}'}]`},
+		{name: "invalid matchers", header: "X-Tenant", conf: `tenants: [{name: a, matchers: 'team="a"'}]`},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			_, err := NewEnforcer(tcase.header, []byte(tcase.conf))
+			testutil.NotOk(t, err)
+		})
+	}
+}
+
+func TestEnforcer_Tenant(t *testing.T) {
+	e, err := NewEnforcer("X-Tenant", []byte(testConfig))
+	testutil.Ok(t, err)
+
+	r, err := http.NewRequest("GET", "http://example.com", nil)
+	testutil.Ok(t, err)
+	_, err = e.Tenant(r)
+	testutil.NotOk(t, err)
+
+	r.Header.Set("X-Tenant", "team-c")
+	_, err = e.Tenant(r)
+	testutil.NotOk(t, err)
+
+	r.Header.Set("X-Tenant", "team-a")
+	tenant, err := e.Tenant(r)
+	testutil.Ok(t, err)
+	testutil.Equals(t, "team-a", tenant.Name)
+}
+
+func TestEnforceMatchers(t *testing.T) {
+	ms := []storepb.LabelMatcher{
+		{Type: storepb.LabelMatcher_EQ, Name: "__name__", Value: "up"},
+		{Type: storepb.LabelMatcher_EQ, Name: "team", Value: "a"},
+	}
+	testutil.Equals(t, ms, EnforceMatchers(context.Background(), ms))
+
+	ctx := ContextWithTenant(context.Background(), &Tenant{Name: "team-a", Matchers: []storepb.LabelMatcher{
+		{Type: storepb.LabelMatcher_EQ, Name: "team", Value: "a"},
+		{Type: storepb.LabelMatcher_NEQ, Name: "env", Value: "dev"},
+	}})
+	testutil.Equals(t, []storepb.LabelMatcher{
+		{Type: storepb.LabelMatcher_EQ, Name: "__name__", Value: "up"},
+		{Type: storepb.LabelMatcher_EQ, Name: "team", Value: "a"},
+		{Type: storepb.LabelMatcher_NEQ, Name: "env", Value: "dev"},
+	}, EnforceMatchers(ctx, ms))
+	// Matchers of the request are not modified.
+	testutil.Equals(t, 2, len(ms))
+}
@@ -0,0 +1,51 @@
+package ui
+
+import (
+	"net/http"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/common/route"
+	"github.com/thanos-io/thanos/pkg/compact"
+	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
+)
+
+// Compact is a web UI representing progress of the compactor.
+type Compact struct {
+	*BaseUI
+	flagsMap map[string]string
+	progress *compact.Progress
+}
+
+func NewCompactUI(logger log.Logger, progress *compact.Progress, flagsMap map[string]string) *Compact {
+	tmplFuncs := queryTmplFuncs()
+	tmplFuncs["stage"] = func(name string, status compact.StageStatus) stageRow {
+		return stageRow{Name: name, Status: status}
+	}
+
+	return &Compact{
+		BaseUI:   NewBaseUI(logger, "compact_menu.html", tmplFuncs),
+		flagsMap: flagsMap,
+		progress: progress,
+	}
+}
+
+type stageRow struct {
+	Name   string
+	Status compact.StageStatus
+}
+
+// Register registers http routes for compact UI.
+func (c *Compact) Register(r *route.Router, ins extpromhttp.InstrumentationMiddleware) {
+	instrf := func(name string, next func(w http.ResponseWriter, r *http.Request)) http.HandlerFunc {
+		return ins.NewHandler(name, http.HandlerFunc(next))
+	}
+
+	r.Get("/", instrf("root", c.root))
+	r.Get("/static/*filepath", instrf("static", c.serveStaticAsset))
+}
+
+// Handle / of compact UI.
+func (c *Compact) root(w http.ResponseWriter, r *http.Request) {
+	prefix := GetWebPrefix(c.logger, c.flagsMap, r)
+	c.executeTemplate(w, "compact.html", prefix, c.progress.Status())
+}
@@ -1,6 +1,7 @@
 package ui
 
 import (
+	"fmt"
 	"html/template"
 	"net/http"
 	"os"
@@ -17,11 +18,13 @@ import (
 	"github.com/thanos-io/thanos/pkg/component"
 	extpromhttp "github.com/thanos-io/thanos/pkg/extprom/http"
 	"github.com/thanos-io/thanos/pkg/query"
+	"github.com/thanos-io/thanos/pkg/targets/targetspb"
 )
 
 type Query struct {
 	*BaseUI
-	storeSet *query.StoreSet
+	storeSet      *query.StoreSet
+	targetsServer targetspb.TargetsServer
 
 	flagsMap map[string]string
 
@@ -40,19 +43,20 @@ type thanosVersion struct {
 	GoVersion string `json:"goVersion"`
 }
 
-func NewQueryUI(logger log.Logger, reg prometheus.Registerer, storeSet *query.StoreSet, flagsMap map[string]string) *Query {
+func NewQueryUI(logger log.Logger, reg prometheus.Registerer, storeSet *query.StoreSet, targetsServer targetspb.TargetsServer, flagsMap map[string]string) *Query {
 	cwd, err := os.Getwd()
 	if err != nil {
 		cwd = "<error retrieving current working directory>"
 	}
 	return &Query{
-		BaseUI:   NewBaseUI(logger, "query_menu.html", queryTmplFuncs()),
-		storeSet: storeSet,
-		flagsMap: flagsMap,
-		cwd:      cwd,
-		birth:    time.Now(),
-		reg:      reg,
-		now:      model.Now,
+		BaseUI:        NewBaseUI(logger, "query_menu.html", queryTmplFuncs()),
+		storeSet:      storeSet,
+		targetsServer: targetsServer,
+		flagsMap:      flagsMap,
+		cwd:           cwd,
+		birth:         time.Now(),
+		reg:           reg,
+		now:           model.Now,
 	}
 }
 
@@ -77,6 +81,7 @@ func (q *Query) Register(r *route.Router, ins extpromhttp.InstrumentationMiddlew
 	r.Get("/", instrf("root", q.root))
 	r.Get("/graph", instrf("graph", q.graph))
 	r.Get("/stores", instrf("stores", q.stores))
+	r.Get("/targets", instrf("targets", q.targets))
 	r.Get("/status", instrf("status", q.status))
 
 	r.Get("/static/*filepath", instrf("static", q.serveStaticAsset))
@@ -95,7 +100,16 @@ func (q *Query) root(w http.ResponseWriter, r *http.Request) {
 func (q *Query) graph(w http.ResponseWriter, r *http.Request) {
 	prefix := GetWebPrefix(q.logger, q.flagsMap, r)
 
-	q.executeTemplate(w, "graph.html", prefix, nil)
+	// Offer resolutions of downsampled data available in stores as max source resolution of queries, e.g. 5m.
+	var resolutions []string
+	for _, r := range q.storeSet.DownsamplingResolutions() {
+		resolutions = append(resolutions, model.Duration(time.Duration(r)*time.Millisecond).String())
+	}
+	q.executeTemplate(w, "graph.html", prefix, struct {
+		DownsamplingResolutions []string
+	}{
+		DownsamplingResolutions: resolutions,
+	})
 }
 
 func (q *Query) status(w http.ResponseWriter, r *http.Request) {
@@ -148,3 +162,33 @@ func (q *Query) stores(w http.ResponseWriter, r *http.Request) {
 		Sources: sources,
 	})
 }
+
+func (q *Query) targets(w http.ResponseWriter, r *http.Request) {
+	prefix := GetWebPrefix(q.logger, q.flagsMap, r)
+
+	resp, err := q.targetsServer.Targets(r.Context(), &targetspb.TargetsRequest{State: targetspb.TargetsRequest_ACTIVE})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error fetching targets: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Targets are already sorted by scrape pool.
+	var pools []string
+	targets := make(map[string][]*targetspb.ActiveTarget)
+	for _, t := range resp.Targets.ActiveTargets {
+		if _, ok := targets[t.ScrapePool]; !ok {
+			pools = append(pools, t.ScrapePool)
+		}
+		targets[t.ScrapePool] = append(targets[t.ScrapePool], t)
+	}
+
+	q.executeTemplate(w, "targets.html", prefix, struct {
+		Pools    []string
+		Targets  map[string][]*targetspb.ActiveTarget
+		Warnings []string
+	}{
+		Pools:    pools,
+		Targets:  targets,
+		Warnings: resp.Warnings,
+	})
+}
@@ -52,7 +52,8 @@ Prometheus.Graph.prototype.initialize = function() {
 
   var options = {
     'pathPrefix': PATH_PREFIX,
-    'buildVersion': BUILD_VERSION
+    'buildVersion': BUILD_VERSION,
+    'downsamplingResolutions': DOWNSAMPLING_RESOLUTIONS || []
   };
   jQuery.extend(options, self.options);
   self.graphHTML = $(Mustache.render(graphTemplate, options));
@@ -23,14 +23,24 @@ GO111MODULE=on go install "github.com/gogo/protobuf/protoc-gen-gogofast"
 
 GOGOPROTO_ROOT="$(GO111MODULE=on go list -f '{{ .Dir }}' -m github.com/gogo/protobuf)"
 GOGOPROTO_PATH="${GOGOPROTO_ROOT}:${GOGOPROTO_ROOT}/protobuf"
+STOREPB_PATH="$(pwd)/pkg/store/storepb"
 
-DIRS="pkg/store/storepb"
+# Packages other than storepb can import storepb types and well-known types.
+IMPORT_MAPPINGS="Mtypes.proto=github.com/thanos-io/thanos/pkg/store/storepb,Mgoogle/protobuf/timestamp.proto=github.com/gogo/protobuf/types"
+
+DIRS="pkg/store/storepb pkg/metadata/metadatapb pkg/targets/targetspb pkg/query/querypb"
 
 echo "generating code"
 for dir in ${DIRS}; do
+	mappings=""
+	if [[ "${dir}" != "pkg/store/storepb" ]]; then
+		mappings="${IMPORT_MAPPINGS},"
+	fi
+
 	pushd ${dir}
-		${PROTOC_BIN} --gogofast_out=plugins=grpc:. -I=. \
+		${PROTOC_BIN} --gogofast_out=${mappings}plugins=grpc:. -I=. \
             -I="${GOGOPROTO_PATH}" \
+            -I="${STOREPB_PATH}" \
             *.proto
 
 		sed -i.bak -E 's/import _ \"gogoproto\"//g' *.pb.go